@@ -20,6 +20,7 @@ func main() {
 	viper.SetDefault("server.host", "localhost")
 	viper.SetDefault("server.port", 8080)
 	viper.SetDefault("server.timeout", "30s")
+	viper.SetDefault("server.shutdown_timeout", "30s")
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
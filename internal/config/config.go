@@ -5,11 +5,16 @@ import "time"
 type Config struct {
 	Server   Server   `mapstructure:"server"`
 	WatchDog WatchDog `mapstructure:"WatchDog"`
+	Plans    Plans    `mapstructure:"Plans"`
+	Tasks    Tasks    `mapstructure:"Tasks"`
+	SSH      SSH      `mapstructure:"ssh"`
+	Plugins  Plugins  `mapstructure:"plugins"`
 
-	Database struct {
-		URL            string `mapstructure:"url"`
-		MaxConnections int    `mapstructure:"max_connections"`
-	} `mapstructure:"database"`
+	// Контроллеры компонентов и мониторинга; без секций регистрируются встроенные по умолчанию
+	Controllers        []Controller `mapstructure:"controllers"`
+	MonitorControllers []Controller `mapstructure:"monitor_controllers"`
+
+	Database Database `mapstructure:"database"`
 
 	Logging struct {
 		Level  string `mapstructure:"level"`
@@ -23,6 +28,60 @@ type Server struct {
 	Port        int           `mapstructure:"port"`
 	UnixSocket  string        `mapstructure:"unix_socket"`
 	Timeout     time.Duration `mapstructure:"timeout"`
+	// Сколько ждать завершения выполнений и запросов при остановке
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+}
+
+type Database struct {
+	URL              string        `mapstructure:"url"`
+	MaxConnections   int           `mapstructure:"max_connections"`
+	SnapshotInterval time.Duration `mapstructure:"snapshot_interval"`
+}
+
+type Plans struct {
+	// Максимум одновременно выполняемых задач одного плана
+	MaxWorkers int `mapstructure:"MaxWorkers"`
+	// Поведение плана при падении задачи: abort, continue или rollback-completed
+	FailurePolicy string `mapstructure:"FailurePolicy"`
+}
+
+type Tasks struct {
+	// Сколько байт stdout и stderr хранится для одного выполнения
+	OutputLimit int `mapstructure:"OutputLimit"`
+	// Сколько последних выполнений хранится для одной задачи
+	OutputHistory int `mapstructure:"OutputHistory"`
+}
+
+type SSH struct {
+	// known_hosts по умолчанию для SSH-компонентов
+	KnownHosts string `mapstructure:"known_hosts"`
+	// Проверка ключа хоста по умолчанию: strict, tofu или insecure
+	HostKeyPolicy string `mapstructure:"host_key_policy"`
+	// Пул соединений: нули означают значения по умолчанию из controllers.SSHPool
+	MaxConnsPerHost    int           `mapstructure:"max_connections_per_host"`
+	MaxSessionsPerConn int           `mapstructure:"max_sessions_per_connection"`
+	IdleTimeout        time.Duration `mapstructure:"idle_timeout"`
+	KeepAliveInterval  time.Duration `mapstructure:"keepalive_interval"`
+}
+
+type Plugins struct {
+	// Каталог плагинов-контроллеров; пустой — плагины отключены
+	Dir string `mapstructure:"dir"`
+	// Таймаут вызовов плагина, кроме выполнения задач
+	CallTimeout time.Duration `mapstructure:"call_timeout"`
+	// Таймаут запуска плагина и handshake
+	StartTimeout time.Duration `mapstructure:"start_timeout"`
+	// Таймаут задач плагинов, если он не задан в метаданных задачи (timeout)
+	TaskTimeout time.Duration `mapstructure:"task_timeout"`
+}
+
+type Controller struct {
+	// Вид контроллера: ssh, systemd, exec, http, docker, kuber; для мониторинга — promql
+	Kind string `mapstructure:"kind"`
+	// Тип, под которым контроллер регистрируется (Component.Type или Monitoring.Type)
+	Type string `mapstructure:"type"`
+	// Параметры контроллера, у каждого вида свои
+	Options map[string]string `mapstructure:"options"`
 }
 
 type WatchDog struct {
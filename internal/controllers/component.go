@@ -1,49 +1,13 @@
 package controllers
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
-	"time"
 
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ssh"
 )
 
-/*
-	================
-	kuber-controller
-	================
-*/
-
-type KuberController struct {
-	Logger *logrus.Logger
-}
-
-func (i *KuberController) RunTask(taskMeta map[string]string, componentMeta map[string]string) error {
-	taskID := taskMeta["id"] // предполагаем, что ID есть в метаданных
-	taskType := taskMeta["Type"]
-
-	i.Logger.Infof("KuberController running task %s of type %s with component metadata: %+v", taskID, taskType, componentMeta)
-
-	// Здесь может быть логика запуска kubectl, apply, check и т.д.
-	time.Sleep(1 * time.Second)
-
-	i.Logger.Infof("Task %s completed", taskID)
-	return nil
-}
-
-func (i *KuberController) ValideTask(TaskMeta map[string]string) error {
-	return nil
-}
-
-func (i *KuberController) ValideComponent(ComponentMeta map[string]string) error {
-	return nil
-}
-
-func (i *KuberController) CheckComponent(ComponentMeta map[string]string) error {
-	return nil
-}
-
 /*
 	================
 	ssh-controller
@@ -52,57 +16,68 @@ func (i *KuberController) CheckComponent(ComponentMeta map[string]string) error
 
 type SSHController struct {
 	Logger *logrus.Logger
+	// known_hosts по умолчанию для компонентов без своего known_hosts
+	KnownHosts string
+	// Политика проверки ключа хоста по умолчанию: strict, tofu или insecure (см. ssh_hostkey.go)
+	HostKeyPolicy string
+	// Ключи, которым доверились в режиме tofu
+	HostKeys *HostKeyStore
+	// Пул соединений; без пула каждая задача и проверка открывают своё соединение
+	Pool *SSHPool
 }
 
 func (s *SSHController) RunTask(taskMeta map[string]string, componentMeta map[string]string) error {
+	return RunTaskLogged(s.Logger, "SSH", s, taskMeta, componentMeta)
+}
+
+// RunTaskOutput загружает файлы задачи (см. ssh_upload.go) и выполняет её команду,
+// направляя stdout и stderr в output
+func (s *SSHController) RunTaskOutput(taskMeta map[string]string, componentMeta map[string]string, output TaskOutput) error {
 	cmd := taskMeta["command"]
 	taskID := taskMeta["id"]
 	taskType := taskMeta["type"]
 
-	host := componentMeta["host"]
-	user := componentMeta["user"]
-	password := componentMeta["password"]
-	port := componentMeta["port"]
-	if port == "" {
-		port = "22"
+	uploads, err := parseUploads(taskMeta)
+	if err != nil {
+		return err
 	}
-
-	if host == "" || user == "" || cmd == "" {
-		return fmt.Errorf("missing required metadata (host, user, command)")
+	if cmd == "" && len(uploads) == 0 {
+		return fmt.Errorf("missing required metadata (command or file.<N>.dest)")
 	}
-
-	s.Logger.Infof("SSHController running task %s (%s) on %s@%s:%s: %s", taskID, taskType, user, host, port, cmd)
-
-	config := &ssh.ClientConfig{
-		User:            user,
-		Auth:            []ssh.AuthMethod{ssh.Password(password)},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // ⚠️ заменить на безопасный при боевом использовании
-		Timeout:         5 * time.Second,
+	target, err := s.target(componentMeta)
+	if err != nil {
+		return err
 	}
+	defer target.Close()
 
-	address := fmt.Sprintf("%s:%s", host, port)
-	client, err := ssh.Dial("tcp", address, config)
-	if err != nil {
-		return fmt.Errorf("failed to dial SSH: %w", err)
+	if len(uploads) != 0 {
+		s.Logger.Infof("SSHController uploading %d files for task %s (%s) to %s@%s", len(uploads), taskID, taskType, target.config.User, target.address)
+		if err := s.upload(target, uploads, output); err != nil {
+			return err
+		}
 	}
-	defer client.Close()
+	if cmd == "" {
+		return nil
+	}
+
+	s.Logger.Infof("SSHController running task %s (%s) on %s@%s: %s", taskID, taskType, target.config.User, target.address, cmd)
 
-	session, err := client.NewSession()
+	session, release, err := s.session(target)
 	if err != nil {
-		return fmt.Errorf("failed to create SSH session: %w", err)
+		return err
 	}
-	defer session.Close()
+	defer release()
 
-	var stdout, stderr bytes.Buffer
-	session.Stdout = &stdout
-	session.Stderr = &stderr
+	session.Stdout = output.Stdout
+	session.Stderr = output.Stderr
 
 	if err := session.Run(cmd); err != nil {
-		s.Logger.Errorf("SSH command failed: %s", stderr.String())
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			err = &ExitError{Code: exitErr.ExitStatus(), Err: err}
+		}
 		return fmt.Errorf("ssh command error: %w", err)
 	}
-
-	s.Logger.Infof("SSH task %s output:\n%s", taskID, stdout.String())
 	return nil
 }
 
@@ -113,53 +88,38 @@ func (s *SSHController) ValideTask(taskMeta map[string]string) error {
 	if taskMeta["type"] == "" {
 		return fmt.Errorf("task type is required")
 	}
-	if taskMeta["command"] == "" {
-		return fmt.Errorf("task command is required")
+	uploads, err := parseUploads(taskMeta)
+	if err != nil {
+		return err
+	}
+	if taskMeta["command"] == "" && len(uploads) == 0 {
+		return fmt.Errorf("task command or file.<N>.dest is required")
 	}
 	return nil
 }
 
+// ValideComponent проверяет адрес и наличие хотя бы одного способа аутентификации
 func (s *SSHController) ValideComponent(componentMeta map[string]string) error {
-	if componentMeta["host"] == "" {
-		return fmt.Errorf("component host is required")
-	}
-	if componentMeta["user"] == "" {
-		return fmt.Errorf("component user is required")
-	}
-	if componentMeta["password"] == "" {
-		return fmt.Errorf("component password is required")
+	target, err := s.target(componentMeta)
+	if err != nil {
+		return err
 	}
+	target.Close()
 	return nil
 }
 
 func (s *SSHController) CheckComponent(componentMeta map[string]string) error {
-	host := componentMeta["host"]
-	user := componentMeta["user"]
-	password := componentMeta["password"]
-	port := componentMeta["port"]
-	if port == "" {
-		port = "22"
-	}
-
-	config := &ssh.ClientConfig{
-		User:            user,
-		Auth:            []ssh.AuthMethod{ssh.Password(password)},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // ⚠️ заменить в проде
-		Timeout:         5 * time.Second,
-	}
-
-	address := fmt.Sprintf("%s:%s", host, port)
-	client, err := ssh.Dial("tcp", address, config)
+	target, err := s.target(componentMeta)
 	if err != nil {
-		return fmt.Errorf("failed to dial SSH for check: %w", err)
+		return err
 	}
-	defer client.Close()
+	defer target.Close()
 
-	session, err := client.NewSession()
+	session, release, err := s.session(target)
 	if err != nil {
-		return fmt.Errorf("failed to create SSH session: %w", err)
+		return fmt.Errorf("SSH check failed: %w", err)
 	}
-	defer session.Close()
+	defer release()
 
 	if err := session.Run("echo ok"); err != nil {
 		return fmt.Errorf("SSH check command failed: %w", err)
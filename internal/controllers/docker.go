@@ -0,0 +1,531 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+/*
+	================
+	docker-controller
+	================
+*/
+
+/*
+	RUS: Компонент docker-controller — контейнер Docker-совместимого движка. Метаданные компонента:
+		host                                  — unix:///var/run/docker.sock (по умолчанию) или tcp://host:port
+		api_version                           — версия Engine API, по умолчанию 1.41
+		ca_file / ca_cert, cert_file / key_file,
+		insecure_skip_verify                  — TLS для tcp://
+		registry_username / registry_password,
+		registry_address                      — авторизация в реестре для pull
+		container                             — имя или ID контейнера
+	Метаданные задачи:
+		action       — pull, recreate, restart, start или stop
+		image        — образ для pull и recreate
+		tag          — для recreate: сменить только тег текущего образа контейнера
+		pull         — recreate: скачать образ перед пересозданием, по умолчанию true
+		stop_timeout — сколько секунд ждать остановки до SIGKILL, по умолчанию 10
+		wait         — ждать, пока контейнер запустится и станет healthy, по умолчанию true
+		timeout      — ограничение времени задачи, по умолчанию 5m
+	recreate переименовывает старый контейнер в <name>-laplasd-old, создаёт новый с той же
+	конфигурацией и новым образом и удаляет старый только после успешного запуска нового;
+	при ошибке старый контейнер возвращается на место.
+	ENG: docker-controller components are containers of a Docker-compatible engine; tasks pull
+	images, recreate the container with a new image, restart, start or stop it (see above).
+*/
+
+const (
+	DefaultDockerTimeout      = 5 * time.Minute
+	DefaultDockerStopTimeout  = 10
+	DefaultDockerPollInterval = time.Second
+	DefaultDockerCheckTimeout = 10 * time.Second
+
+	dockerBackupSuffix = "-laplasd-old"
+)
+
+// Действия задач docker-controller
+const (
+	DockerActionPull     = "pull"
+	DockerActionRecreate = "recreate"
+	DockerActionRestart  = "restart"
+	DockerActionStart    = "start"
+	DockerActionStop     = "stop"
+)
+
+type DockerController struct {
+	Logger *logrus.Logger
+	// Период опроса состояния контейнера, по умолчанию DefaultDockerPollInterval
+	PollInterval time.Duration
+
+	mu sync.Mutex
+	// HTTP-клиенты по адресам движка и настройкам TLS
+	clients map[string]*http.Client
+}
+
+// dockerTask — действие задачи
+type dockerTask struct {
+	action      string
+	image       string
+	tag         string
+	pull        bool
+	stopTimeout int
+	wait        bool
+	timeout     time.Duration
+}
+
+func parseDockerTask(meta map[string]string) (*dockerTask, error) {
+	task := &dockerTask{
+		action:      meta["action"],
+		image:       meta["image"],
+		tag:         meta["tag"],
+		pull:        true,
+		stopTimeout: DefaultDockerStopTimeout,
+		wait:        true,
+		timeout:     DefaultDockerTimeout,
+	}
+
+	switch task.action {
+	case DockerActionPull:
+		if task.image == "" {
+			return nil, fmt.Errorf("pull requires image")
+		}
+	case DockerActionRecreate:
+		if (task.image == "") == (task.tag == "") {
+			return nil, fmt.Errorf("recreate requires exactly one of image or tag")
+		}
+		if strings.ContainsAny(task.tag, ":/@") {
+			return nil, fmt.Errorf("invalid tag %q", task.tag)
+		}
+	case DockerActionRestart, DockerActionStart, DockerActionStop:
+	case "":
+		return nil, fmt.Errorf("task action is required (pull, recreate, restart, start or stop)")
+	default:
+		return nil, fmt.Errorf("unknown task action %q (expected pull, recreate, restart, start or stop)", task.action)
+	}
+
+	for key, dst := range map[string]*bool{"pull": &task.pull, "wait": &task.wait} {
+		if meta[key] == "" {
+			continue
+		}
+		v, err := parseBool(meta, key)
+		if err != nil {
+			return nil, err
+		}
+		*dst = v
+	}
+	if raw := meta["stop_timeout"]; raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid stop_timeout %q: expected seconds", raw)
+		}
+		task.stopTimeout = v
+	}
+	if raw := meta["timeout"]; raw != "" {
+		v, err := time.ParseDuration(raw)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", raw)
+		}
+		task.timeout = v
+	}
+	return task, nil
+}
+
+// dockerContainer — нужная часть ответа GET /containers/{id}/json.
+// Config и HostConfig хранятся как есть, чтобы пересоздать контейнер без потери полей.
+type dockerContainer struct {
+	ID              string                 `json:"Id"`
+	Name            string                 `json:"Name"`
+	RestartCount    int                    `json:"RestartCount"`
+	Config          map[string]interface{} `json:"Config"`
+	HostConfig      map[string]interface{} `json:"HostConfig"`
+	NetworkSettings struct {
+		Networks map[string]map[string]interface{} `json:"Networks"`
+	} `json:"NetworkSettings"`
+	State struct {
+		Status     string `json:"Status"`
+		Running    bool   `json:"Running"`
+		Restarting bool   `json:"Restarting"`
+		ExitCode   int    `json:"ExitCode"`
+		Error      string `json:"Error"`
+		Health     *struct {
+			Status        string `json:"Status"`
+			FailingStreak int    `json:"FailingStreak"`
+			Log           []struct {
+				ExitCode int    `json:"ExitCode"`
+				Output   string `json:"Output"`
+			} `json:"Log"`
+		} `json:"Health"`
+	} `json:"State"`
+}
+
+func (c *dockerContainer) name() string {
+	return strings.TrimPrefix(c.Name, "/")
+}
+
+func (c *dockerContainer) image() string {
+	image, _ := c.Config["Image"].(string)
+	return image
+}
+
+// health возвращает признак готовности контейнера и ошибку, если он не может стать готовым сам
+func (c *dockerContainer) health() (bool, error) {
+	state := c.State
+	switch {
+	case state.Restarting:
+		return false, nil
+	case !state.Running:
+		msg := fmt.Sprintf("container %s is %s", c.name(), state.Status)
+		if state.Status == "exited" {
+			msg += fmt.Sprintf(" with code %d", state.ExitCode)
+		}
+		if state.Error != "" {
+			msg += ": " + state.Error
+		}
+		return false, fmt.Errorf("%s", msg)
+	case state.Health == nil || state.Health.Status == "" || state.Health.Status == "none":
+		return true, nil
+	case state.Health.Status == "healthy":
+		return true, nil
+	case state.Health.Status == "unhealthy":
+		msg := fmt.Sprintf("container %s is unhealthy (%d failed checks)", c.name(), state.Health.FailingStreak)
+		if n := len(state.Health.Log); n != 0 {
+			if output := strings.TrimSpace(state.Health.Log[n-1].Output); output != "" {
+				msg += ": " + output
+			}
+		}
+		return false, fmt.Errorf("%s", msg)
+	}
+	return false, nil
+}
+
+func (d *DockerController) inspect(ctx context.Context, ep *dockerEndpoint, name string) (*dockerContainer, error) {
+	var container dockerContainer
+	if err := d.call(ctx, ep, http.MethodGet, "/containers/"+url.PathEscape(name)+"/json", nil, nil, &container); err != nil {
+		return nil, fmt.Errorf("inspect container %s: %w", name, err)
+	}
+	return &container, nil
+}
+
+func (d *DockerController) containerAction(ctx context.Context, ep *dockerEndpoint, name, action string, query url.Values) error {
+	if err := d.call(ctx, ep, http.MethodPost, "/containers/"+url.PathEscape(name)+"/"+action, query, nil, nil); err != nil {
+		return fmt.Errorf("%s container %s: %w", action, name, err)
+	}
+	return nil
+}
+
+func (d *DockerController) remove(ctx context.Context, ep *dockerEndpoint, name string) error {
+	if err := d.call(ctx, ep, http.MethodDelete, "/containers/"+url.PathEscape(name), url.Values{"force": {"true"}}, nil, nil); err != nil {
+		return fmt.Errorf("remove container %s: %w", name, err)
+	}
+	return nil
+}
+
+// waitReady ждёт, пока контейнер запустится и, если у него есть healthcheck, станет healthy
+func (d *DockerController) waitReady(ctx context.Context, ep *dockerEndpoint, name string, out io.Writer) error {
+	interval := d.PollInterval
+	if interval <= 0 {
+		interval = DefaultDockerPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last string
+	for {
+		container, err := d.inspect(ctx, ep, name)
+		if err != nil {
+			return err
+		}
+		ready, err := container.health()
+		if err != nil {
+			return err
+		}
+		status := container.State.Status
+		if container.State.Health != nil && container.State.Health.Status != "" {
+			status += " (" + container.State.Health.Status + ")"
+		}
+		if status != last {
+			fmt.Fprintf(out, "container %s: %s\n", name, status)
+			last = status
+		}
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for container %s: %s", name, last)
+		case <-ticker.C:
+		}
+	}
+}
+
+// recreate пересоздаёт контейнер с новым образом, сохраняя его конфигурацию
+func (d *DockerController) recreate(ctx context.Context, ep *dockerEndpoint, name string, task *dockerTask, out io.Writer) error {
+	old, err := d.inspect(ctx, ep, name)
+	if err != nil {
+		return err
+	}
+	name = old.name()
+	image := task.image
+	if image == "" {
+		image = imageWithTag(old.image(), task.tag)
+	}
+	backup := name + dockerBackupSuffix
+	if _, err := d.inspect(ctx, ep, backup); err == nil {
+		return fmt.Errorf("container %s is left from a previous recreate: remove it or rename it back to %s", backup, name)
+	} else if !isDockerNotFound(err) {
+		return err
+	}
+
+	if task.pull {
+		if err := d.pull(ctx, ep, image, out); err != nil {
+			return err
+		}
+	}
+
+	config, primary, others := recreateConfig(old, image)
+
+	fmt.Fprintf(out, "stopping container %s (%s)\n", name, old.image())
+	stopQuery := url.Values{"t": {strconv.Itoa(task.stopTimeout)}}
+	if err := d.containerAction(ctx, ep, name, "stop", stopQuery); err != nil {
+		return err
+	}
+	if err := d.containerAction(ctx, ep, name, "rename", url.Values{"name": {backup}}); err != nil {
+		// Контейнер остался под своим именем, но уже остановлен
+		if old.State.Running {
+			rctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if startErr := d.containerAction(rctx, ep, name, "start", nil); startErr != nil {
+				return fmt.Errorf("%w (restore failed: %v)", err, startErr)
+			}
+			fmt.Fprintf(out, "restarted container %s (%s)\n", name, old.image())
+		}
+		return err
+	}
+
+	// Возвращает старый контейнер на место, если новый не запустился
+	restore := func(cause error, newID string) error {
+		rctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if newID != "" {
+			if err := d.remove(rctx, ep, newID); err != nil {
+				d.Logger.Errorf("DockerController: %v", err)
+			}
+		}
+		if err := d.containerAction(rctx, ep, backup, "rename", url.Values{"name": {name}}); err != nil {
+			return fmt.Errorf("%w (restore failed: %v)", cause, err)
+		}
+		if old.State.Running {
+			if err := d.containerAction(rctx, ep, name, "start", nil); err != nil {
+				return fmt.Errorf("%w (restore failed: %v)", cause, err)
+			}
+		}
+		fmt.Fprintf(out, "restored container %s (%s)\n", name, old.image())
+		return cause
+	}
+
+	var created struct {
+		ID       string   `json:"Id"`
+		Warnings []string `json:"Warnings"`
+	}
+	if err := d.call(ctx, ep, http.MethodPost, "/containers/create", url.Values{"name": {name}}, config, &created); err != nil {
+		return restore(fmt.Errorf("create container %s: %w", name, err), "")
+	}
+	for _, warning := range created.Warnings {
+		fmt.Fprintf(out, "warning: %s\n", warning)
+	}
+	for network, endpoint := range others {
+		body := map[string]interface{}{"Container": created.ID, "EndpointConfig": endpoint}
+		if err := d.call(ctx, ep, http.MethodPost, "/networks/"+url.PathEscape(network)+"/connect", nil, body, nil); err != nil {
+			return restore(fmt.Errorf("connect container %s to network %s: %w", name, network, err), created.ID)
+		}
+	}
+	if err := d.containerAction(ctx, ep, created.ID, "start", nil); err != nil {
+		return restore(err, created.ID)
+	}
+	fmt.Fprintf(out, "started container %s (%s) on network %s\n", name, image, primary)
+
+	if task.wait {
+		if err := d.waitReady(ctx, ep, name, out); err != nil {
+			return restore(err, created.ID)
+		}
+	}
+	// Новый контейнер уже работает: неудачное удаление старого не откатывает обновление.
+	// Оставшийся backup нужно удалить вручную, иначе следующий recreate откажется выполняться
+	if err := d.remove(ctx, ep, backup); err != nil {
+		d.Logger.Warnf("DockerController: container %s updated, previous container left as %s: %v", name, backup, err)
+		fmt.Fprintf(out, "warning: failed to remove previous container %s: %v\n", backup, err)
+		return nil
+	}
+	fmt.Fprintf(out, "removed previous container %s\n", old.ID[:min(12, len(old.ID))])
+	return nil
+}
+
+// recreateConfig собирает тело POST /containers/create из старого контейнера: сеть из
+// HostConfig.NetworkMode подключается при создании, остальные — отдельными запросами
+func recreateConfig(old *dockerContainer, image string) (map[string]interface{}, string, map[string]interface{}) {
+	config := make(map[string]interface{}, len(old.Config)+2)
+	for key, value := range old.Config {
+		config[key] = value
+	}
+	config["Image"] = image
+	// Hostname по умолчанию — короткий ID старого контейнера
+	if hostname, _ := config["Hostname"].(string); hostname != "" && strings.HasPrefix(old.ID, hostname) {
+		delete(config, "Hostname")
+	}
+	config["HostConfig"] = old.HostConfig
+
+	mode, _ := old.HostConfig["NetworkMode"].(string)
+	if mode == "default" {
+		mode = "bridge"
+	}
+	others := make(map[string]interface{})
+	if mode == "host" || mode == "none" || strings.HasPrefix(mode, "container:") {
+		return config, mode, others
+	}
+
+	endpoints := make(map[string]interface{})
+	for network, settings := range old.NetworkSettings.Networks {
+		endpoint := make(map[string]interface{})
+		for _, key := range []string{"IPAMConfig", "Links", "DriverOpts"} {
+			if value, ok := settings[key]; ok && value != nil {
+				endpoint[key] = value
+			}
+		}
+		// Старые псевдонимы с ID контейнера движок добавит заново для нового
+		if aliases, ok := settings["Aliases"].([]interface{}); ok {
+			var kept []interface{}
+			for _, alias := range aliases {
+				if s, _ := alias.(string); s != "" && !strings.HasPrefix(old.ID, s) {
+					kept = append(kept, s)
+				}
+			}
+			if len(kept) != 0 {
+				endpoint["Aliases"] = kept
+			}
+		}
+		if network == mode {
+			endpoints[network] = endpoint
+		} else {
+			others[network] = endpoint
+		}
+	}
+	config["NetworkingConfig"] = map[string]interface{}{"EndpointsConfig": endpoints}
+	return config, mode, others
+}
+
+func (d *DockerController) RunTask(taskMeta map[string]string, componentMeta map[string]string) error {
+	return RunTaskLogged(d.Logger, "Docker", d, taskMeta, componentMeta)
+}
+
+// RunTaskOutput выполняет действие задачи, описывая ход выполнения в output.Stdout
+func (d *DockerController) RunTaskOutput(taskMeta map[string]string, componentMeta map[string]string, output TaskOutput) error {
+	task, err := parseDockerTask(taskMeta)
+	if err != nil {
+		return err
+	}
+	ep, err := parseDockerEndpoint(componentMeta)
+	if err != nil {
+		return err
+	}
+	name := componentMeta["container"]
+	if name == "" && task.action != DockerActionPull {
+		return fmt.Errorf("%s requires component container", task.action)
+	}
+	out := output.Stdout
+	if out == nil {
+		out = io.Discard
+	}
+
+	d.Logger.Infof("DockerController running task %s (%s) on %s at %s", taskMeta["id"], task.action, name, ep.host)
+
+	ctx, cancel := context.WithTimeout(context.Background(), task.timeout)
+	defer cancel()
+
+	stopQuery := url.Values{"t": {strconv.Itoa(task.stopTimeout)}}
+	switch task.action {
+	case DockerActionPull:
+		return d.pull(ctx, ep, task.image, out)
+	case DockerActionRecreate:
+		return d.recreate(ctx, ep, name, task, out)
+	case DockerActionStop:
+		if err := d.containerAction(ctx, ep, name, "stop", stopQuery); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "stopped container %s\n", name)
+		return nil
+	case DockerActionRestart:
+		if err := d.containerAction(ctx, ep, name, "restart", stopQuery); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "restarted container %s\n", name)
+	case DockerActionStart:
+		if err := d.containerAction(ctx, ep, name, "start", nil); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "started container %s\n", name)
+	}
+	if !task.wait {
+		return nil
+	}
+	return d.waitReady(ctx, ep, name, out)
+}
+
+func (d *DockerController) ValideTask(taskMeta map[string]string) error {
+	if taskMeta["id"] == "" {
+		return fmt.Errorf("task id is required")
+	}
+	_, err := parseDockerTask(taskMeta)
+	return err
+}
+
+func (d *DockerController) ValideComponent(componentMeta map[string]string) error {
+	_, err := parseDockerEndpoint(componentMeta)
+	return err
+}
+
+// CheckComponent проверяет, что контейнер запущен и его healthcheck в состоянии healthy;
+// без container проверяется только доступность движка
+func (d *DockerController) CheckComponent(componentMeta map[string]string) error {
+	ep, err := parseDockerEndpoint(componentMeta)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultDockerCheckTimeout)
+	defer cancel()
+
+	name := componentMeta["container"]
+	if name == "" {
+		if err := d.call(ctx, ep, http.MethodGet, "/version", nil, nil, nil); err != nil {
+			return fmt.Errorf("docker engine %s: %w", ep.host, err)
+		}
+		return nil
+	}
+
+	container, err := d.inspect(ctx, ep, name)
+	if err != nil {
+		return err
+	}
+	ready, err := container.health()
+	if err != nil {
+		return err
+	}
+	if !ready {
+		status := container.State.Status
+		if container.State.Health != nil {
+			status = "health " + container.State.Health.Status
+		}
+		return fmt.Errorf("container %s is not ready: %s (restarted %d times)", name, status, container.RestartCount)
+	}
+	return nil
+}
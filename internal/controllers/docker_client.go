@@ -0,0 +1,298 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+/*
+	RUS: Клиент Docker Engine API поверх HTTP: unix-сокет или TCP (с TLS при ca_file/cert_file/key_file).
+	Ответы с кодом >= 400 превращаются в dockerAPIError с сообщением движка.
+	ENG: Docker Engine API client over a unix socket or TCP (TLS when certificates are set).
+*/
+
+const (
+	DefaultDockerHost       = "unix:///var/run/docker.sock"
+	DefaultDockerAPIVersion = "1.41"
+)
+
+type dockerEndpoint struct {
+	host       string
+	network    string
+	address    string
+	scheme     string
+	apiVersion string
+	tlsConfig  *tls.Config
+	// Настройки TLS для ключа кэша клиентов: CA, проверка сертификата и клиентский сертификат
+	transportKey string
+	// Значение X-Registry-Auth для pull из приватного реестра
+	registryAuth string
+}
+
+// dockerAPIError — ошибка, возвращённая Docker Engine API
+type dockerAPIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *dockerAPIError) Error() string {
+	return fmt.Sprintf("docker API error (%d): %s", e.StatusCode, e.Message)
+}
+
+func isDockerNotFound(err error) bool {
+	var apiErr *dockerAPIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+func parseDockerEndpoint(meta map[string]string) (*dockerEndpoint, error) {
+	ep := &dockerEndpoint{
+		host:       meta["host"],
+		apiVersion: strings.TrimPrefix(meta["api_version"], "v"),
+		scheme:     "http",
+	}
+	if ep.host == "" {
+		ep.host = DefaultDockerHost
+	}
+	if ep.apiVersion == "" {
+		ep.apiVersion = DefaultDockerAPIVersion
+	}
+
+	parsed, err := url.Parse(ep.host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host %q: %w", ep.host, err)
+	}
+	switch parsed.Scheme {
+	case "unix":
+		ep.network, ep.address = "unix", parsed.Path
+		if ep.address == "" {
+			return nil, fmt.Errorf("invalid host %q: socket path is empty", ep.host)
+		}
+	case "tcp":
+		ep.network, ep.address = "tcp", parsed.Host
+		if parsed.Port() == "" {
+			return nil, fmt.Errorf("invalid host %q: port is required", ep.host)
+		}
+	default:
+		return nil, fmt.Errorf("invalid host %q: expected unix:///path or tcp://host:port", ep.host)
+	}
+
+	certFile, keyFile := meta["cert_file"], meta["key_file"]
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("cert_file and key_file must be set together")
+	}
+	if certFile != "" || meta["ca_file"] != "" || meta["ca_cert"] != "" || meta["insecure_skip_verify"] != "" {
+		if ep.network != "tcp" {
+			return nil, fmt.Errorf("TLS settings require a tcp:// host")
+		}
+		ep.tlsConfig, ep.transportKey, err = parseTLSConfig(meta)
+		if err != nil {
+			return nil, err
+		}
+		if ep.tlsConfig == nil {
+			ep.tlsConfig = &tls.Config{}
+		}
+		if certFile != "" {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			ep.tlsConfig.Certificates = []tls.Certificate{cert}
+			ep.transportKey += fmt.Sprintf("|cert=%x", sha256.Sum256(cert.Certificate[0]))
+		}
+		ep.scheme = "https"
+	}
+
+	if user := meta["registry_username"]; user != "" {
+		auth, err := json.Marshal(map[string]string{
+			"username":      user,
+			"password":      meta["registry_password"],
+			"serveraddress": meta["registry_address"],
+		})
+		if err != nil {
+			return nil, err
+		}
+		ep.registryAuth = base64.URLEncoding.EncodeToString(auth)
+	}
+	return ep, nil
+}
+
+// client возвращает HTTP-клиент движка; таймаут задаётся контекстом запроса.
+// Клиенты переиспользуются для одного адреса с одинаковыми настройками TLS.
+func (d *DockerController) client(ep *dockerEndpoint) *http.Client {
+	key := ep.host + "|" + ep.scheme + "|" + ep.transportKey
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if client, ok := d.clients[key]; ok {
+		return client
+	}
+	if d.clients == nil {
+		d.clients = make(map[string]*http.Client)
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, ep.network, ep.address)
+		},
+		TLSClientConfig:     ep.tlsConfig,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	client := &http.Client{Transport: transport}
+	d.clients[key] = client
+	return client
+}
+
+func (ep *dockerEndpoint) newRequest(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Request, error) {
+	host := "docker"
+	if ep.network == "tcp" {
+		host = ep.address
+	}
+	endpoint := ep.scheme + "://" + host + "/v" + ep.apiVersion + path
+	if len(query) != 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// call выполняет запрос к API и декодирует JSON-ответ в out, если он задан.
+// 304 Not Modified (контейнер уже запущен или остановлен) ошибкой не считается.
+func (d *DockerController) call(ctx context.Context, ep *dockerEndpoint, method, path string, query url.Values, body, out interface{}) error {
+	req, err := ep.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client(ep).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return readDockerError(resp)
+	}
+	if out != nil && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotModified {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("%s %s: decode response: %w", method, path, err)
+		}
+	}
+	return nil
+}
+
+func readDockerError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var body struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(data, &body) != nil || body.Message == "" {
+		body.Message = strings.TrimSpace(string(data))
+	}
+	if body.Message == "" {
+		body.Message = resp.Status
+	}
+	return &dockerAPIError{StatusCode: resp.StatusCode, Message: body.Message}
+}
+
+// pull скачивает образ, выводя в out сообщения о ходе загрузки (без построчного прогресса слоёв)
+func (d *DockerController) pull(ctx context.Context, ep *dockerEndpoint, image string, out io.Writer) error {
+	req, err := ep.newRequest(ctx, http.MethodPost, "/images/create", url.Values{"fromImage": {withDefaultTag(image)}}, nil)
+	if err != nil {
+		return err
+	}
+	if ep.registryAuth != "" {
+		req.Header.Set("X-Registry-Auth", ep.registryAuth)
+	}
+	resp, err := d.client(ep).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("pull %s: %w", image, readDockerError(resp))
+	}
+
+	// Ошибка скачивания приходит сообщением в потоке при коде 200
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var msg struct {
+			ID       string `json:"id"`
+			Status   string `json:"status"`
+			Progress string `json:"progress"`
+			Error    string `json:"error"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &msg) != nil {
+			continue
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("pull %s: %s", image, msg.Error)
+		}
+		if msg.Progress != "" || msg.Status == "" {
+			continue
+		}
+		if msg.ID != "" {
+			fmt.Fprintf(out, "%s: %s\n", msg.ID, msg.Status)
+		} else {
+			fmt.Fprintln(out, msg.Status)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("pull %s: %w", image, err)
+	}
+	return nil
+}
+
+// withDefaultTag добавляет :latest к образу без тега и дайджеста:
+// иначе API скачивает все теги репозитория
+func withDefaultTag(image string) string {
+	if strings.Contains(image, "@") {
+		return image
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	if strings.Contains(name, ":") {
+		return image
+	}
+	return image + ":latest"
+}
+
+// imageWithTag заменяет тег (или дайджест) образа
+func imageWithTag(image, tag string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	slash := strings.LastIndex(image, "/")
+	if i := strings.LastIndex(image, ":"); i > slash {
+		image = image[:i]
+	}
+	return image + ":" + tag
+}
@@ -0,0 +1,311 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeContainer — контейнер fakeDockerEngine
+type fakeContainer struct {
+	id      string
+	name    string
+	image   string
+	running bool
+	health  string
+}
+
+// fakeDockerEngine — Engine API в памяти: inspect, stop, start, rename, create, delete и pull
+type fakeDockerEngine struct {
+	t  *testing.T
+	mu sync.Mutex
+
+	containers []*fakeContainer
+	created    map[string]interface{}
+	nextID     int
+
+	// Ответ /images/create построчно
+	pullStream []string
+	// Ошибка rename и запуска новых (созданных через API) контейнеров
+	failRename   bool
+	failNewStart bool
+	// Ошибка удаления контейнеров
+	failRemove bool
+	// Состояние healthcheck новых контейнеров после запуска
+	newHealth string
+}
+
+func newFakeDockerEngine(t *testing.T, containers ...*fakeContainer) (*fakeDockerEngine, map[string]string) {
+	engine := &fakeDockerEngine{t: t, containers: containers}
+	srv := httptest.NewServer(engine)
+	t.Cleanup(srv.Close)
+	component := map[string]string{"host": "tcp://" + strings.TrimPrefix(srv.URL, "http://"), "container": "web"}
+	return engine, component
+}
+
+func (e *fakeDockerEngine) find(ref string) *fakeContainer {
+	for _, c := range e.containers {
+		if c.id == ref || c.name == ref {
+			return c
+		}
+	}
+	return nil
+}
+
+func (e *fakeDockerEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v"+DefaultDockerAPIVersion)
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch {
+	case r.Method == http.MethodPost && path == "/images/create":
+		for _, line := range e.pullStream {
+			fmt.Fprintln(w, line)
+		}
+	case r.Method == http.MethodPost && path == "/containers/create":
+		var config map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			e.t.Errorf("decode create body: %v", err)
+		}
+		e.created = config
+		e.nextID++
+		c := &fakeContainer{id: fmt.Sprintf("new%d", e.nextID), name: r.URL.Query().Get("name"), image: config["Image"].(string)}
+		if e.find(c.name) != nil {
+			dockerError(w, http.StatusConflict, "container name %s is already in use", c.name)
+			return
+		}
+		e.containers = append(e.containers, c)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"Id": c.id, "Warnings": []string{}})
+	case len(parts) >= 2 && parts[0] == "containers":
+		c := e.find(parts[1])
+		if c == nil {
+			dockerError(w, http.StatusNotFound, "No such container: %s", parts[1])
+			return
+		}
+		e.container(w, r, c, strings.Join(parts[2:], "/"))
+	default:
+		dockerError(w, http.StatusNotFound, "unexpected request %s %s", r.Method, path)
+	}
+}
+
+func (e *fakeDockerEngine) container(w http.ResponseWriter, r *http.Request, c *fakeContainer, action string) {
+	switch {
+	case r.Method == http.MethodGet && action == "json":
+		status := "exited"
+		if c.running {
+			status = "running"
+		}
+		state := map[string]interface{}{"Status": status, "Running": c.running}
+		if c.health != "" {
+			state["Health"] = map[string]interface{}{
+				"Status": c.health, "FailingStreak": 3,
+				"Log": []map[string]interface{}{{"ExitCode": 1, "Output": "connection refused"}},
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Id":              c.id,
+			"Name":            "/" + c.name,
+			"Config":          map[string]interface{}{"Image": c.image, "Hostname": c.id[:3], "Env": []string{"A=1"}},
+			"HostConfig":      map[string]interface{}{"NetworkMode": "bridge"},
+			"NetworkSettings": map[string]interface{}{"Networks": map[string]interface{}{"bridge": map[string]interface{}{}}},
+			"State":           state,
+		})
+	case r.Method == http.MethodPost && action == "stop":
+		c.running = false
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && action == "start":
+		if e.failNewStart && strings.HasPrefix(c.id, "new") {
+			dockerError(w, http.StatusInternalServerError, "failed to create task for container: exec: \"app\": not found")
+			return
+		}
+		c.running = true
+		if strings.HasPrefix(c.id, "new") {
+			c.health = e.newHealth
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && action == "rename":
+		if e.failRename {
+			dockerError(w, http.StatusInternalServerError, "rename failed")
+			return
+		}
+		c.name = r.URL.Query().Get("name")
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete && action == "":
+		if e.failRemove {
+			dockerError(w, http.StatusConflict, "removal of container %s is already in progress", c.id)
+			return
+		}
+		for i, other := range e.containers {
+			if other == c {
+				e.containers = append(e.containers[:i], e.containers[i+1:]...)
+				break
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		dockerError(w, http.StatusNotFound, "unexpected request %s %s", r.Method, r.URL.Path)
+	}
+}
+
+func dockerError(w http.ResponseWriter, code int, format string, args ...interface{}) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"message": fmt.Sprintf(format, args...)})
+}
+
+// state возвращает имена и образы контейнеров движка, например "web=nginx:1(running)"
+func (e *fakeDockerEngine) state() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var parts []string
+	for _, c := range e.containers {
+		state := "stopped"
+		if c.running {
+			state = "running"
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s(%s)", c.name, c.image, state))
+	}
+	return strings.Join(parts, " ")
+}
+
+func newTestDockerController() *DockerController {
+	return &DockerController{Logger: testLogger(), PollInterval: time.Millisecond}
+}
+
+func oldWebContainer() *fakeContainer {
+	return &fakeContainer{id: "old123456789", name: "web", image: "nginx:1", running: true}
+}
+
+func TestDockerPullStreamsError(t *testing.T) {
+	engine, component := newFakeDockerEngine(t)
+	engine.pullStream = []string{
+		`{"status":"Pulling from library/nginx","id":"latest"}`,
+		`{"status":"Downloading","progressDetail":{"current":10},"progress":"[=>   ]","id":"a1b2"}`,
+		`{"errorDetail":{"message":"manifest unknown"},"error":"manifest unknown"}`,
+	}
+
+	var stdout bytes.Buffer
+	err := newTestDockerController().RunTaskOutput(map[string]string{"action": "pull", "image": "nginx"}, component, TaskOutput{Stdout: &stdout})
+	if err == nil || !strings.Contains(err.Error(), "pull nginx: manifest unknown") {
+		t.Fatalf("RunTaskOutput error = %v, want the error from the pull stream", err)
+	}
+	if out := stdout.String(); !strings.Contains(out, "latest: Pulling from library/nginx") || strings.Contains(out, "Downloading") {
+		t.Errorf("output should contain status messages without layer progress:\n%s", out)
+	}
+}
+
+func TestDockerRecreate(t *testing.T) {
+	engine, component := newFakeDockerEngine(t, oldWebContainer())
+	engine.pullStream = []string{`{"status":"Status: Downloaded newer image for nginx:2"}`}
+	engine.newHealth = "healthy"
+
+	var stdout bytes.Buffer
+	if err := newTestDockerController().RunTaskOutput(map[string]string{"action": "recreate", "tag": "2"}, component, TaskOutput{Stdout: &stdout}); err != nil {
+		t.Fatalf("RunTaskOutput: %v\n%s", err, stdout.String())
+	}
+	if got := engine.state(); got != "web=nginx:2(running)" {
+		t.Errorf("containers = %s, want only the new web container", got)
+	}
+	if _, ok := engine.created["Hostname"]; ok {
+		t.Errorf("create kept the old container hostname: %v", engine.created["Hostname"])
+	}
+	if env, _ := engine.created["Env"].([]interface{}); len(env) != 1 || env[0] != "A=1" {
+		t.Errorf("create lost the container config: Env = %v", engine.created["Env"])
+	}
+	out := stdout.String()
+	for _, want := range []string{"Downloaded newer image for nginx:2", "container web: running (healthy)", "removed previous container old123456789"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestDockerRecreateRollsBackFailedStart(t *testing.T) {
+	engine, component := newFakeDockerEngine(t, oldWebContainer())
+	engine.failNewStart = true
+
+	var stdout bytes.Buffer
+	err := newTestDockerController().RunTaskOutput(map[string]string{"action": "recreate", "image": "nginx:2", "pull": "false"}, component, TaskOutput{Stdout: &stdout})
+	if err == nil || !strings.Contains(err.Error(), "start container") {
+		t.Fatalf("RunTaskOutput error = %v, want start failure", err)
+	}
+	if got := engine.state(); got != "web=nginx:1(running)" {
+		t.Errorf("containers = %s, want the old container restored and running", got)
+	}
+	if !strings.Contains(stdout.String(), "restored container web (nginx:1)") {
+		t.Errorf("output does not report the rollback:\n%s", stdout.String())
+	}
+}
+
+func TestDockerRecreateRollsBackUnhealthy(t *testing.T) {
+	engine, component := newFakeDockerEngine(t, oldWebContainer())
+	engine.newHealth = "unhealthy"
+
+	err := newTestDockerController().RunTask(map[string]string{"action": "recreate", "image": "nginx:2", "pull": "false"}, component)
+	if err == nil || !strings.Contains(err.Error(), "container web is unhealthy (3 failed checks): connection refused") {
+		t.Fatalf("RunTask error = %v, want the failed healthcheck", err)
+	}
+	if got := engine.state(); got != "web=nginx:1(running)" {
+		t.Errorf("containers = %s, want the old container restored and running", got)
+	}
+}
+
+func TestDockerRecreateRestartsOldContainerWhenRenameFails(t *testing.T) {
+	engine, component := newFakeDockerEngine(t, oldWebContainer())
+	engine.failRename = true
+
+	err := newTestDockerController().RunTask(map[string]string{"action": "recreate", "image": "nginx:2", "pull": "false"}, component)
+	if err == nil || !strings.Contains(err.Error(), "rename failed") {
+		t.Fatalf("RunTask error = %v, want rename failure", err)
+	}
+	if got := engine.state(); got != "web=nginx:1(running)" {
+		t.Errorf("containers = %s, want the old container running again", got)
+	}
+}
+
+func TestDockerRecreateSucceedsWhenBackupRemovalFails(t *testing.T) {
+	engine, component := newFakeDockerEngine(t, oldWebContainer())
+	engine.failRemove = true
+
+	var stdout bytes.Buffer
+	if err := newTestDockerController().RunTaskOutput(map[string]string{"action": "recreate", "image": "nginx:2", "pull": "false"}, component, TaskOutput{Stdout: &stdout}); err != nil {
+		t.Fatalf("RunTaskOutput: %v, want success with the new container running", err)
+	}
+	if got := engine.state(); got != "web-laplasd-old=nginx:1(stopped) web=nginx:2(running)" {
+		t.Errorf("containers = %s, want the new container running and the backup left", got)
+	}
+	if !strings.Contains(stdout.String(), "warning: failed to remove previous container web-laplasd-old") {
+		t.Errorf("output does not report the failed removal:\n%s", stdout.String())
+	}
+}
+
+func TestDockerClientsKeyedByTLSSettings(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	tlsServer.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+
+	d := newTestDockerController()
+	plain, err := parseDockerEndpoint(map[string]string{"host": "tcp://docker:2376", "ca_cert": string(ca)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	insecure, err := parseDockerEndpoint(map[string]string{"host": "tcp://docker:2376", "insecure_skip_verify": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.client(plain) == d.client(insecure) {
+		t.Error("endpoints with different TLS settings share a client")
+	}
+	if d.client(plain) != d.client(plain) {
+		t.Error("client is not reused for the same endpoint")
+	}
+}
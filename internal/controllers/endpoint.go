@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	RUS: Подключение к HTTP API, общее для promql-monitor и http-controller:
+		url                  — базовый URL API
+		username / password  — basic auth
+		bearer_token         — токен (или bearer_token_file — путь к файлу с токеном)
+		header.<Name>        — произвольные заголовки запроса
+		tenant_id            — арендатор (заголовок tenant_header, по умолчанию X-Scope-OrgID)
+		ca_file / ca_cert    — CA для TLS (путь к файлу или PEM)
+		insecure_skip_verify — отключить проверку сертификата
+	ENG: HTTP API connection settings shared by promql-monitor and http-controller (see above).
+*/
+
+const (
+	DefaultTenantHeader = "X-Scope-OrgID"
+	headerPrefix        = "header."
+)
+
+type httpEndpoint struct {
+	url          string
+	username     string
+	password     string
+	bearerToken  string
+	headers      map[string]string
+	tlsConfig    *tls.Config
+	transportKey string
+}
+
+// parseEndpoint собирает параметры подключения; defaultURL используется, если url не задан
+func parseEndpoint(config map[string]string, defaultURL string) (*httpEndpoint, error) {
+	ep := &httpEndpoint{
+		url:      strings.TrimRight(config["url"], "/"),
+		username: config["username"],
+		password: config["password"],
+		headers:  make(map[string]string),
+	}
+	if ep.url == "" {
+		ep.url = strings.TrimRight(defaultURL, "/")
+	}
+	if ep.url == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	parsed, err := url.Parse(ep.url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q: %w", ep.url, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("invalid url %q: scheme must be http or https", ep.url)
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("invalid url %q: host is empty", ep.url)
+	}
+
+	if (ep.username == "") != (ep.password == "") {
+		return nil, fmt.Errorf("basic auth requires both username and password")
+	}
+	ep.bearerToken = config["bearer_token"]
+	if file := config["bearer_token_file"]; file != "" {
+		if ep.bearerToken != "" {
+			return nil, fmt.Errorf("bearer_token and bearer_token_file are mutually exclusive")
+		}
+		token, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bearer_token_file: %w", err)
+		}
+		ep.bearerToken = strings.TrimSpace(string(token))
+	}
+	if ep.bearerToken != "" && ep.username != "" {
+		return nil, fmt.Errorf("basic auth and bearer token are mutually exclusive")
+	}
+
+	for key, value := range config {
+		name, ok := strings.CutPrefix(key, headerPrefix)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			return nil, fmt.Errorf("header name is empty in %q", key)
+		}
+		ep.headers[http.CanonicalHeaderKey(name)] = value
+	}
+	if tenant := config["tenant_id"]; tenant != "" {
+		header := config["tenant_header"]
+		if header == "" {
+			header = DefaultTenantHeader
+		}
+		ep.headers[http.CanonicalHeaderKey(header)] = tenant
+	} else if config["tenant_header"] != "" {
+		return nil, fmt.Errorf("tenant_header requires tenant_id")
+	}
+
+	if ep.tlsConfig, ep.transportKey, err = parseTLSConfig(config); err != nil {
+		return nil, err
+	}
+	return ep, nil
+}
+
+// parseTLSConfig разбирает ca_file / ca_cert / insecure_skip_verify; nil, если TLS не настраивается.
+// Вторым значением возвращается ключ настроек для кэша клиентов.
+func parseTLSConfig(config map[string]string) (*tls.Config, string, error) {
+	caFile, caCert := config["ca_file"], config["ca_cert"]
+	insecure := false
+	if v := config["insecure_skip_verify"]; v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid insecure_skip_verify %q", v)
+		}
+		insecure = b
+	}
+	if caFile == "" && caCert == "" && !insecure {
+		return nil, "", nil
+	}
+	if caFile != "" && caCert != "" {
+		return nil, "", fmt.Errorf("ca_file and ca_cert are mutually exclusive")
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecure}
+	pem := []byte(caCert)
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read ca_file: %w", err)
+		}
+		pem = data
+	}
+	if len(pem) != 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, "", fmt.Errorf("no valid certificates in CA")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, fmt.Sprintf("ca=%s|insecure=%t", pem, insecure), nil
+}
+
+// clientKey — клиенты переиспользуются для одного хоста с одинаковыми настройками TLS
+func (ep *httpEndpoint) clientKey() string {
+	parsed, _ := url.Parse(ep.url)
+	return parsed.Scheme + "://" + parsed.Host + "|" + ep.transportKey
+}
+
+func (ep *httpEndpoint) authorize(req *http.Request) {
+	names := make([]string, 0, len(ep.headers))
+	for name := range ep.headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		req.Header.Set(name, ep.headers[name])
+	}
+	if ep.username != "" {
+		req.SetBasicAuth(ep.username, ep.password)
+	}
+	if ep.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+ep.bearerToken)
+	}
+}
+
+// newEndpointClient создаёт HTTP-клиент подключения; таймаут задаётся контекстом запроса
+func newEndpointClient(tlsConfig *tls.Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.MaxIdleConnsPerHost = 4
+	transport.IdleConnTimeout = 90 * time.Second
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,370 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+/*
+	================
+	exec-controller
+	================
+*/
+
+/*
+	RUS: Компонент exec-controller — хост, на котором работает сам laplasd. Метаданные компонента:
+		dir           — рабочий каталог команд
+		user          — пользователь, от имени которого выполняются команды (laplasd должен работать от root)
+		env.<NAME>    — переменные окружения
+		clear_env     — не наследовать окружение laplasd (по умолчанию false)
+		timeout       — ограничение времени задач, по умолчанию без ограничения
+		check_command — команда проверки для CheckComponent; check_arg.<N> и check_timeout (по умолчанию 10s) как у задач
+	Метаданные задачи:
+		command   — команда; без arg.<N> выполняется через /bin/sh -c, с ними — напрямую
+		arg.<N>   — аргументы команды по порядку, N с 1
+		env.<NAME>, dir, user, timeout — переопределяют значения компонента
+	ENG: exec-controller components are the laplasd host itself; tasks run a command with args,
+	env, working dir, timeout and user (see above), CheckComponent runs check_command.
+*/
+
+const (
+	DefaultExecShell        = "/bin/sh"
+	DefaultExecCheckTimeout = 10 * time.Second
+	// Сколько ждать закрытия вывода после завершения или остановки процесса
+	execWaitDelay = 5 * time.Second
+	// Сколько stderr проверки попадает в текст ошибки
+	maxCheckStderr = 512
+)
+
+type ExecController struct {
+	Logger *logrus.Logger
+}
+
+// execCommand — команда с аргументами и ограничением времени
+type execCommand struct {
+	command string
+	args    []string
+	timeout time.Duration
+}
+
+// execEnv — окружение выполнения команд
+type execEnv struct {
+	dir      string
+	user     string
+	env      map[string]string
+	clearEnv bool
+}
+
+// parseExecCommand разбирает <prefix>command, <prefix>arg.<N> и <prefix>timeout
+func parseExecCommand(meta map[string]string, prefix string) (*execCommand, error) {
+	cmd := &execCommand{command: meta[prefix+"command"]}
+
+	argPrefix := prefix + "arg."
+	args := make(map[int]string)
+	for key, value := range meta {
+		if !strings.HasPrefix(key, argPrefix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(key, argPrefix))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid argument %q: expected %s<N>", key, argPrefix)
+		}
+		args[n] = value
+	}
+	for n := 1; n <= len(args); n++ {
+		value, ok := args[n]
+		if !ok {
+			return nil, fmt.Errorf("%s%d is missing: arguments must be numbered from 1 without gaps", argPrefix, n)
+		}
+		cmd.args = append(cmd.args, value)
+	}
+	if cmd.command == "" && len(cmd.args) != 0 {
+		return nil, fmt.Errorf("%sarg.<N> is set without %scommand", prefix, prefix)
+	}
+
+	if raw := meta[prefix+"timeout"]; raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid %stimeout %q", prefix, raw)
+		}
+		cmd.timeout = timeout
+	}
+	return cmd, nil
+}
+
+// argv возвращает программу и её аргументы: без аргументов команда выполняется оболочкой
+func (c *execCommand) argv() (string, []string) {
+	if len(c.args) == 0 {
+		return DefaultExecShell, []string{"-c", c.command}
+	}
+	return c.command, c.args
+}
+
+func (c *execCommand) String() string {
+	if len(c.args) == 0 {
+		return c.command
+	}
+	quoted := make([]string, 0, len(c.args)+1)
+	for _, arg := range append([]string{c.command}, c.args...) {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+func parseExecEnv(meta map[string]string) (*execEnv, error) {
+	env := &execEnv{
+		dir:  meta["dir"],
+		user: meta["user"],
+		env:  make(map[string]string),
+	}
+	for key, value := range meta {
+		if name, ok := strings.CutPrefix(key, "env."); ok {
+			if name == "" || strings.ContainsAny(name, "=\x00") {
+				return nil, fmt.Errorf("invalid environment variable %q", key)
+			}
+			env.env[name] = value
+		}
+	}
+	clearEnv, err := parseBool(meta, "clear_env")
+	if err != nil {
+		return nil, err
+	}
+	env.clearEnv = clearEnv
+	return env, nil
+}
+
+// merge накладывает настройки задачи на настройки компонента
+func (e *execEnv) merge(task *execEnv) *execEnv {
+	merged := &execEnv{dir: e.dir, user: e.user, env: make(map[string]string), clearEnv: e.clearEnv || task.clearEnv}
+	if task.dir != "" {
+		merged.dir = task.dir
+	}
+	if task.user != "" {
+		merged.user = task.user
+	}
+	for name, value := range e.env {
+		merged.env[name] = value
+	}
+	for name, value := range task.env {
+		merged.env[name] = value
+	}
+	return merged
+}
+
+// validate проверяет каталог и пользователя на хосте laplasd
+func (e *execEnv) validate() error {
+	if e.dir != "" {
+		info, err := os.Stat(e.dir)
+		if err != nil {
+			return fmt.Errorf("dir: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("dir %s is not a directory", e.dir)
+		}
+	}
+	if e.user != "" {
+		if _, err := lookupExecUser(e.user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// environ собирает окружение процесса; у пользователя свои HOME, USER и LOGNAME
+func (e *execEnv) environ(account *user.User) []string {
+	vars := make(map[string]string)
+	if !e.clearEnv {
+		for _, kv := range os.Environ() {
+			if name, value, ok := strings.Cut(kv, "="); ok {
+				vars[name] = value
+			}
+		}
+	}
+	if account != nil {
+		vars["HOME"] = account.HomeDir
+		vars["USER"] = account.Username
+		vars["LOGNAME"] = account.Username
+	}
+	for name, value := range e.env {
+		vars[name] = value
+	}
+
+	environ := make([]string, 0, len(vars))
+	for name, value := range vars {
+		environ = append(environ, name+"="+value)
+	}
+	sort.Strings(environ)
+	return environ
+}
+
+// lookupExecUser ищет пользователя по имени или числовому UID
+func lookupExecUser(name string) (*user.User, error) {
+	account, err := user.Lookup(name)
+	if err != nil {
+		if _, convErr := strconv.Atoi(name); convErr == nil {
+			account, err = user.LookupId(name)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("user %q: %w", name, err)
+	}
+	return account, nil
+}
+
+// run выполняет команду, направляя вывод в output
+func (x *ExecController) run(command *execCommand, env *execEnv, output TaskOutput) error {
+	ctx := context.Background()
+	if command.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, command.timeout)
+		defer cancel()
+	}
+
+	name, args := command.argv()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = env.dir
+	cmd.Stdout = output.Stdout
+	cmd.Stderr = output.Stderr
+	cmd.WaitDelay = execWaitDelay
+
+	var account *user.User
+	if env.user != "" {
+		var err error
+		if account, err = lookupExecUser(env.user); err != nil {
+			return err
+		}
+	}
+	if err := configureExecCommand(cmd, account); err != nil {
+		return err
+	}
+	cmd.Env = env.environ(account)
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("command timed out after %s", command.timeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.Exited() {
+		return &ExitError{Code: exitErr.ExitCode(), Err: err}
+	}
+	return err
+}
+
+func (x *ExecController) RunTask(taskMeta map[string]string, componentMeta map[string]string) error {
+	return RunTaskLogged(x.Logger, "Exec", x, taskMeta, componentMeta)
+}
+
+// RunTaskOutput выполняет команду задачи на хосте laplasd, направляя stdout и stderr в output
+func (x *ExecController) RunTaskOutput(taskMeta map[string]string, componentMeta map[string]string, output TaskOutput) error {
+	command, env, err := x.prepare(taskMeta, componentMeta)
+	if err != nil {
+		return err
+	}
+
+	x.Logger.Infof("ExecController running task %s (%s): %s", taskMeta["id"], taskMeta["type"], command)
+	if err := x.run(command, env, output); err != nil {
+		return fmt.Errorf("exec command error: %w", err)
+	}
+	return nil
+}
+
+// prepare собирает команду задачи и окружение с учётом настроек компонента
+func (x *ExecController) prepare(taskMeta map[string]string, componentMeta map[string]string) (*execCommand, *execEnv, error) {
+	command, err := parseExecCommand(taskMeta, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	if command.command == "" {
+		return nil, nil, fmt.Errorf("missing required metadata (command)")
+	}
+	componentEnv, err := parseExecEnv(componentMeta)
+	if err != nil {
+		return nil, nil, err
+	}
+	taskEnv, err := parseExecEnv(taskMeta)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if command.timeout == 0 {
+		defaults, err := parseExecCommand(componentMeta, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		command.timeout = defaults.timeout
+	}
+	return command, componentEnv.merge(taskEnv), nil
+}
+
+func (x *ExecController) ValideTask(taskMeta map[string]string) error {
+	if taskMeta["id"] == "" {
+		return fmt.Errorf("task id is required")
+	}
+	command, err := parseExecCommand(taskMeta, "")
+	if err != nil {
+		return err
+	}
+	if command.command == "" {
+		return fmt.Errorf("task command is required")
+	}
+	env, err := parseExecEnv(taskMeta)
+	if err != nil {
+		return err
+	}
+	return env.validate()
+}
+
+func (x *ExecController) ValideComponent(componentMeta map[string]string) error {
+	if _, err := parseExecCommand(componentMeta, ""); err != nil {
+		return err
+	}
+	if _, err := parseExecCommand(componentMeta, "check_"); err != nil {
+		return err
+	}
+	env, err := parseExecEnv(componentMeta)
+	if err != nil {
+		return err
+	}
+	return env.validate()
+}
+
+// CheckComponent выполняет check_command; без неё проверяет рабочий каталог и пользователя
+func (x *ExecController) CheckComponent(componentMeta map[string]string) error {
+	env, err := parseExecEnv(componentMeta)
+	if err != nil {
+		return err
+	}
+	check, err := parseExecCommand(componentMeta, "check_")
+	if err != nil {
+		return err
+	}
+	if check.command == "" {
+		return env.validate()
+	}
+	if check.timeout == 0 {
+		check.timeout = DefaultExecCheckTimeout
+	}
+
+	var stderr bytes.Buffer
+	if err := x.run(check, env, TaskOutput{Stderr: &stderr}); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			if len(msg) > maxCheckStderr {
+				msg = "..." + msg[len(msg)-maxCheckStderr:]
+			}
+			return fmt.Errorf("check command failed: %w: %s", err, msg)
+		}
+		return fmt.Errorf("check command failed: %w", err)
+	}
+	return nil
+}
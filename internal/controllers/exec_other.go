@@ -0,0 +1,16 @@
+//go:build !unix
+
+package controllers
+
+import (
+	"fmt"
+	"os/exec"
+	"os/user"
+)
+
+func configureExecCommand(cmd *exec.Cmd, account *user.User) error {
+	if account != nil {
+		return fmt.Errorf("running commands as another user is not supported on this platform")
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+//go:build unix
+
+package controllers
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestExecController() *ExecController {
+	return &ExecController{Logger: testLogger()}
+}
+
+// runExec выполняет задачу и возвращает её stdout
+func runExec(t *testing.T, task, component map[string]string) (string, error) {
+	t.Helper()
+	var stdout bytes.Buffer
+	err := newTestExecController().RunTaskOutput(task, component, TaskOutput{Stdout: &stdout, Stderr: io.Discard})
+	return stdout.String(), err
+}
+
+func TestExecArgsNumberedInOrder(t *testing.T) {
+	task := map[string]string{
+		"id":      "t1",
+		"command": DefaultExecShell,
+		"arg.1":   "-c",
+		"arg.2":   `printf '%s,' "$@"`,
+		"arg.3":   "sh",
+	}
+	// arg.10 и arg.11 идут после arg.9, а не после arg.1
+	for n := 4; n <= 11; n++ {
+		task["arg."+strconv.Itoa(n)] = "a" + strconv.Itoa(n)
+	}
+	out, err := runExec(t, task, map[string]string{})
+	if err != nil {
+		t.Fatalf("RunTaskOutput: %v", err)
+	}
+	if out != "a4,a5,a6,a7,a8,a9,a10,a11," {
+		t.Errorf("output = %q, want arguments in numeric order", out)
+	}
+
+	_, err = parseExecCommand(map[string]string{"command": "echo", "arg.1": "a", "arg.3": "c"}, "")
+	if err == nil || !strings.Contains(err.Error(), "arg.2 is missing") {
+		t.Errorf("parse error = %v, want the missing arg.2 reported", err)
+	}
+	_, err = parseExecCommand(map[string]string{"command": "echo", "arg.0": "a"}, "")
+	if err == nil || !strings.Contains(err.Error(), `invalid argument "arg.0"`) {
+		t.Errorf("parse error = %v, want arg.0 rejected", err)
+	}
+}
+
+func TestExecEnvMerge(t *testing.T) {
+	t.Setenv("LAPLAS_TEST_INHERITED", "inherited")
+	component := map[string]string{"env.SHARED": "component", "env.COMPONENT_ONLY": "component"}
+	task := map[string]string{
+		"id":            "t1",
+		"command":       `echo "$SHARED $COMPONENT_ONLY $TASK_ONLY ${LAPLAS_TEST_INHERITED:-unset}"`,
+		"env.SHARED":    "task",
+		"env.TASK_ONLY": "task",
+	}
+
+	out, err := runExec(t, task, component)
+	if err != nil {
+		t.Fatalf("RunTaskOutput: %v", err)
+	}
+	if got := strings.TrimSpace(out); got != "task component task inherited" {
+		t.Errorf("output = %q, want task env over component env and the laplasd env inherited", got)
+	}
+
+	component["clear_env"] = "true"
+	out, err = runExec(t, task, component)
+	if err != nil {
+		t.Fatalf("RunTaskOutput with clear_env: %v", err)
+	}
+	if got := strings.TrimSpace(out); got != "task component task unset" {
+		t.Errorf("output = %q, want the laplasd env dropped with clear_env", got)
+	}
+}
+
+func TestExecTimeoutKillsProcessGroup(t *testing.T) {
+	// Фоновый sleep держит stdout открытым: если остановить только оболочку,
+	// Run дождался бы закрытия вывода не раньше execWaitDelay
+	task := map[string]string{"id": "t1", "command": "sleep 30 & wait"}
+	component := map[string]string{"timeout": "100ms"}
+
+	start := time.Now()
+	_, err := runExec(t, task, component)
+	if err == nil || !strings.Contains(err.Error(), "command timed out after 100ms") {
+		t.Fatalf("RunTaskOutput error = %v, want the component timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed >= execWaitDelay {
+		t.Errorf("returned after %s: background process outlived the timeout", elapsed)
+	}
+}
+
+func TestExecExitCode(t *testing.T) {
+	_, err := runExec(t, map[string]string{"id": "t1", "command": "exit 3"}, map[string]string{})
+	if code, ok := ExitCode(err); !ok || code != 3 {
+		t.Fatalf("ExitCode(%v) = %d, %v, want 3", err, code, ok)
+	}
+	if code, ok := ExitCode(nil); !ok || code != 0 {
+		t.Errorf("ExitCode(nil) = %d, %v, want 0", code, ok)
+	}
+}
+
+func TestExecCheckCommand(t *testing.T) {
+	x := newTestExecController()
+	if err := x.CheckComponent(map[string]string{"check_command": "true"}); err != nil {
+		t.Fatalf("CheckComponent: %v", err)
+	}
+
+	err := x.CheckComponent(map[string]string{"check_command": "echo disk full >&2; exit 2"})
+	if err == nil || !strings.Contains(err.Error(), "check command failed") || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("CheckComponent error = %v, want the check stderr", err)
+	}
+	if code, _ := ExitCode(err); code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+
+	err = x.CheckComponent(map[string]string{"check_command": "sleep 30", "check_timeout": "100ms"})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Errorf("CheckComponent error = %v, want check_timeout", err)
+	}
+}
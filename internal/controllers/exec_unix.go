@@ -0,0 +1,50 @@
+//go:build unix
+
+package controllers
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// configureExecCommand запускает команду в своей группе процессов, чтобы по таймауту остановить
+// и её потомков, и при необходимости от имени другого пользователя
+func configureExecCommand(cmd *exec.Cmd, account *user.User) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	if account == nil {
+		return nil
+	}
+
+	uid, err := strconv.ParseUint(account.Uid, 10, 32)
+	if err != nil {
+		return fmt.Errorf("user %s: invalid uid %q", account.Username, account.Uid)
+	}
+	gid, err := strconv.ParseUint(account.Gid, 10, 32)
+	if err != nil {
+		return fmt.Errorf("user %s: invalid gid %q", account.Username, account.Gid)
+	}
+	if int(uid) == os.Geteuid() {
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("running commands as user %s requires laplasd to run as root", account.Username)
+	}
+
+	var groups []uint32
+	if ids, err := account.GroupIds(); err == nil {
+		for _, id := range ids {
+			if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+				groups = append(groups, uint32(g))
+			}
+		}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: groups}
+	return nil
+}
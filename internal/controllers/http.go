@@ -0,0 +1,364 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+/*
+	================
+	http-controller
+	================
+*/
+
+/*
+	RUS: Компонент http-controller — сервис с HTTP API. Метаданные компонента:
+		url                                 — базовый URL API
+		username / password, bearer_token,
+		bearer_token_file, header.<Name>,
+		ca_file / ca_cert, insecure_skip_verify — авторизация и TLS (см. endpoint.go)
+		timeout                             — таймаут запроса, по умолчанию 30s
+		health_path                         — путь проверки для CheckComponent (по умолчанию сам url)
+		health_method                       — метод проверки, по умолчанию GET
+		health_status                       — ожидаемые коды проверки, по умолчанию 2xx
+	Метаданные задачи:
+		method          — метод запроса, по умолчанию POST
+		path            — путь относительно url (шаблон text/template)
+		body            — тело запроса (шаблон text/template)
+		content_type    — тип тела, по умолчанию application/json
+		header.<Name>   — дополнительные заголовки запроса
+		expected_status — ожидаемые коды через запятую: 200, 204, 2xx; по умолчанию 2xx
+		timeout         — переопределяет таймаут компонента
+	В шаблонах доступны .Task и .Component — метаданные задачи и компонента, и функция json,
+	кодирующая значение как JSON-строку: {"image": {{ json .Task.image }}}.
+	ENG: http-controller components are HTTP APIs; tasks send a templated request and check the
+	status code, CheckComponent requests a health endpoint (see above).
+*/
+
+const (
+	DefaultHTTPTimeout        = 30 * time.Second
+	DefaultHTTPMethod         = http.MethodPost
+	DefaultHTTPContentType    = "application/json"
+	DefaultHTTPExpectedStatus = "2xx"
+	// Сколько байт ответа попадает в вывод задачи и текст ошибки
+	maxHTTPResponseBody = 64 << 10
+	maxHTTPErrorBody    = 512
+)
+
+type HTTPController struct {
+	Logger *logrus.Logger
+
+	mu sync.Mutex
+	// HTTP-клиенты по подключениям (см. httpEndpoint.clientKey)
+	clients map[string]*http.Client
+}
+
+// httpRequest — запрос задачи или проверки
+type httpRequest struct {
+	method      string
+	path        *template.Template
+	body        *template.Template
+	contentType string
+	headers     map[string]string
+	expected    statusCodes
+	timeout     time.Duration
+}
+
+// statusCodes — допустимые коды ответа, каждый диапазон [from, to]
+type statusCodes [][2]int
+
+func parseStatusCodes(spec string) (statusCodes, error) {
+	var codes statusCodes
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if len(part) == 3 && part[0] >= '1' && part[0] <= '5' && part[1:] == "xx" {
+			class := int(part[0]-'0') * 100
+			codes = append(codes, [2]int{class, class + 99})
+			continue
+		}
+		code, err := strconv.Atoi(part)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status code %q: expected a code like 200 or a class like 2xx", part)
+		}
+		codes = append(codes, [2]int{code, code})
+	}
+	return codes, nil
+}
+
+func (c statusCodes) match(code int) bool {
+	for _, r := range c {
+		if code >= r[0] && code <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+var httpTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+func parseHTTPTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(httpTemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// parseHTTPRequest разбирает запрос; prefix — "" для задачи или "health_" для проверки
+func parseHTTPRequest(meta map[string]string, prefix, defaultMethod, defaultStatus string) (*httpRequest, error) {
+	req := &httpRequest{
+		method:      strings.ToUpper(meta[prefix+"method"]),
+		contentType: meta["content_type"],
+		headers:     make(map[string]string),
+	}
+	if req.method == "" {
+		req.method = defaultMethod
+	}
+	if strings.IndexFunc(req.method, func(r rune) bool { return r < 'A' || r > 'Z' }) >= 0 {
+		return nil, fmt.Errorf("invalid %smethod %q", prefix, meta[prefix+"method"])
+	}
+
+	var err error
+	if req.path, err = parseHTTPTemplate(prefix+"path", meta[prefix+"path"]); err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		if req.body, err = parseHTTPTemplate("body", meta["body"]); err != nil {
+			return nil, err
+		}
+		if req.contentType == "" {
+			req.contentType = DefaultHTTPContentType
+		}
+		for key, value := range meta {
+			if name, ok := strings.CutPrefix(key, headerPrefix); ok {
+				if name == "" {
+					return nil, fmt.Errorf("header name is empty in %q", key)
+				}
+				req.headers[http.CanonicalHeaderKey(name)] = value
+			}
+		}
+	}
+
+	status := meta[prefix+"expected_status"]
+	if prefix != "" {
+		status = meta[prefix+"status"]
+	}
+	if status == "" {
+		status = defaultStatus
+	}
+	if req.expected, err = parseStatusCodes(status); err != nil {
+		return nil, err
+	}
+
+	if raw := meta["timeout"]; raw != "" {
+		if req.timeout, err = time.ParseDuration(raw); err != nil || req.timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", raw)
+		}
+	}
+	return req, nil
+}
+
+// parseHTTPEndpoint разбирает подключение компонента
+func parseHTTPEndpoint(componentMeta map[string]string) (*httpEndpoint, time.Duration, error) {
+	if componentMeta["url"] == "" {
+		return nil, 0, fmt.Errorf("component url is required")
+	}
+	ep, err := parseEndpoint(componentMeta, "")
+	if err != nil {
+		return nil, 0, err
+	}
+	timeout := DefaultHTTPTimeout
+	if raw := componentMeta["timeout"]; raw != "" {
+		if timeout, err = time.ParseDuration(raw); err != nil || timeout <= 0 {
+			return nil, 0, fmt.Errorf("invalid timeout %q", raw)
+		}
+	}
+	return ep, timeout, nil
+}
+
+// resolveURL подставляет путь к базовому URL; абсолютные URL не допускаются,
+// чтобы авторизация компонента не уходила на чужие хосты
+func resolveURL(base, path string) (string, error) {
+	if path == "" {
+		return base, nil
+	}
+	ref, err := url.Parse(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid path %q: %w", path, err)
+	}
+	if ref.Scheme != "" || ref.Host != "" {
+		return "", fmt.Errorf("invalid path %q: must be relative to component url", path)
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	baseURL.Path = strings.TrimRight(baseURL.Path, "/") + "/" + strings.TrimLeft(ref.Path, "/")
+	baseURL.RawPath = ""
+	if ref.RawQuery != "" {
+		baseURL.RawQuery = ref.RawQuery
+	}
+	return baseURL.String(), nil
+}
+
+// do отправляет запрос и проверяет код ответа; тело ответа пишется в out, если он задан
+func (h *HTTPController) do(ep *httpEndpoint, timeout time.Duration, req *httpRequest, data map[string]interface{}, out io.Writer) (int, error) {
+	var path, body bytes.Buffer
+	if err := req.path.Execute(&path, data); err != nil {
+		return 0, fmt.Errorf("render path: %w", err)
+	}
+	if req.body != nil {
+		if err := req.body.Execute(&body, data); err != nil {
+			return 0, fmt.Errorf("render body: %w", err)
+		}
+	}
+	endpoint, err := resolveURL(ep.url, path.String())
+	if err != nil {
+		return 0, err
+	}
+
+	if req.timeout > 0 {
+		timeout = req.timeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var reader io.Reader
+	if body.Len() != 0 {
+		reader = &body
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, endpoint, reader)
+	if err != nil {
+		return 0, err
+	}
+	if reader != nil {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+	ep.authorize(httpReq)
+	for name, value := range req.headers {
+		httpReq.Header.Set(name, value)
+	}
+
+	// Ошибка клиента (*url.Error) уже содержит метод и URL
+	resp, err := h.client(ep).Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPResponseBody))
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("%s %s: read response: %w", req.method, endpoint, err)
+	}
+	if out != nil {
+		fmt.Fprintf(out, "%s %s -> %s\n", req.method, endpoint, resp.Status)
+		if len(respBody) != 0 {
+			out.Write(respBody)
+			if respBody[len(respBody)-1] != '\n' {
+				io.WriteString(out, "\n")
+			}
+		}
+	}
+
+	if !req.expected.match(resp.StatusCode) {
+		msg := strings.TrimSpace(string(respBody))
+		if len(msg) > maxHTTPErrorBody {
+			msg = msg[:maxHTTPErrorBody] + "..."
+		}
+		if msg != "" {
+			return resp.StatusCode, fmt.Errorf("%s %s: unexpected status %s: %s", req.method, endpoint, resp.Status, msg)
+		}
+		return resp.StatusCode, fmt.Errorf("%s %s: unexpected status %s", req.method, endpoint, resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func (h *HTTPController) client(ep *httpEndpoint) *http.Client {
+	key := ep.clientKey()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if client, ok := h.clients[key]; ok {
+		return client
+	}
+	if h.clients == nil {
+		h.clients = make(map[string]*http.Client)
+	}
+	client := newEndpointClient(ep.tlsConfig)
+	h.clients[key] = client
+	return client
+}
+
+func (h *HTTPController) RunTask(taskMeta map[string]string, componentMeta map[string]string) error {
+	return RunTaskLogged(h.Logger, "HTTP", h, taskMeta, componentMeta)
+}
+
+// RunTaskOutput отправляет запрос задачи; строка статуса и тело ответа пишутся в output.Stdout
+func (h *HTTPController) RunTaskOutput(taskMeta map[string]string, componentMeta map[string]string, output TaskOutput) error {
+	ep, timeout, err := parseHTTPEndpoint(componentMeta)
+	if err != nil {
+		return err
+	}
+	req, err := parseHTTPRequest(taskMeta, "", DefaultHTTPMethod, DefaultHTTPExpectedStatus)
+	if err != nil {
+		return err
+	}
+
+	h.Logger.Infof("HTTPController running task %s (%s): %s %s", taskMeta["id"], taskMeta["type"], req.method, ep.url)
+	data := map[string]interface{}{"Task": taskMeta, "Component": componentMeta}
+	if _, err := h.do(ep, timeout, req, data, output.Stdout); err != nil {
+		return fmt.Errorf("http request error: %w", err)
+	}
+	return nil
+}
+
+func (h *HTTPController) ValideTask(taskMeta map[string]string) error {
+	if taskMeta["id"] == "" {
+		return fmt.Errorf("task id is required")
+	}
+	_, err := parseHTTPRequest(taskMeta, "", DefaultHTTPMethod, DefaultHTTPExpectedStatus)
+	return err
+}
+
+func (h *HTTPController) ValideComponent(componentMeta map[string]string) error {
+	if _, _, err := parseHTTPEndpoint(componentMeta); err != nil {
+		return err
+	}
+	_, err := parseHTTPRequest(componentMeta, "health_", http.MethodGet, DefaultHTTPExpectedStatus)
+	return err
+}
+
+// CheckComponent запрашивает health_path и проверяет код ответа
+func (h *HTTPController) CheckComponent(componentMeta map[string]string) error {
+	ep, timeout, err := parseHTTPEndpoint(componentMeta)
+	if err != nil {
+		return err
+	}
+	req, err := parseHTTPRequest(componentMeta, "health_", http.MethodGet, DefaultHTTPExpectedStatus)
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{"Component": componentMeta}
+	if _, err := h.do(ep, timeout, req, data, nil); err != nil {
+		return fmt.Errorf("HTTP check failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestHTTPController() *HTTPController {
+	return &HTTPController{Logger: testLogger()}
+}
+
+func TestHTTPTaskRendersRequest(t *testing.T) {
+	var got struct {
+		method, path, query, body, contentType, auth, header string
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got.method, got.path, got.query, got.body = r.Method, r.URL.Path, r.URL.RawQuery, string(body)
+		got.contentType, got.auth, got.header = r.Header.Get("Content-Type"), r.Header.Get("Authorization"), r.Header.Get("X-Request-Id")
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"status":"deploying"}`)
+	}))
+	defer srv.Close()
+
+	component := map[string]string{"url": srv.URL + "/api/", "bearer_token": "secret", "service": "web"}
+	task := map[string]string{
+		"id":                  "t1",
+		"path":                "/services/{{ .Component.service }}/deploy?force=1",
+		"body":                `{"image": {{ json .Task.image }}}`,
+		"image":               `nginx:"2"`,
+		"header.x-request-id": "42",
+	}
+
+	var stdout bytes.Buffer
+	if err := newTestHTTPController().RunTaskOutput(task, component, TaskOutput{Stdout: &stdout}); err != nil {
+		t.Fatalf("RunTaskOutput: %v", err)
+	}
+	if got.method != http.MethodPost || got.path != "/api/services/web/deploy" || got.query != "force=1" {
+		t.Errorf("request = %s %s?%s, want POST /api/services/web/deploy?force=1", got.method, got.path, got.query)
+	}
+	if got.body != `{"image": "nginx:\"2\""}` {
+		t.Errorf("body = %s", got.body)
+	}
+	if got.contentType != DefaultHTTPContentType || got.auth != "Bearer secret" || got.header != "42" {
+		t.Errorf("headers: content-type %q, authorization %q, x-request-id %q", got.contentType, got.auth, got.header)
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "-> 202 Accepted") || !strings.Contains(out, `{"status":"deploying"}`) {
+		t.Errorf("output does not contain the status and response body:\n%s", out)
+	}
+}
+
+func TestHTTPTaskUnexpectedStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "deploy already running", http.StatusConflict)
+	}))
+	defer srv.Close()
+
+	task := map[string]string{"id": "t1", "method": "put", "expected_status": "200,204"}
+	err := newTestHTTPController().RunTask(task, map[string]string{"url": srv.URL})
+	if err == nil || !strings.Contains(err.Error(), "unexpected status 409 Conflict: deploy already running") {
+		t.Fatalf("RunTask error = %v, want the status and response body", err)
+	}
+}
+
+func TestHTTPTaskTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	start := time.Now()
+	err := newTestHTTPController().RunTask(map[string]string{"id": "t1", "timeout": "50ms"}, map[string]string{"url": srv.URL})
+	if err == nil || !strings.Contains(err.Error(), "context deadline exceeded") {
+		t.Fatalf("RunTask error = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("task timeout ignored: returned after %s", elapsed)
+	}
+}
+
+func TestHTTPCheckComponent(t *testing.T) {
+	healthy := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead || r.URL.Path != "/healthz" {
+			t.Errorf("health request = %s %s, want HEAD /healthz", r.Method, r.URL.Path)
+		}
+		if user, pass, _ := r.BasicAuth(); user != "admin" || pass != "pw" {
+			t.Errorf("basic auth = %s:%s", user, pass)
+		}
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	h := newTestHTTPController()
+	component := map[string]string{
+		"url": srv.URL, "username": "admin", "password": "pw",
+		"health_path": "healthz", "health_method": "HEAD", "health_status": "200",
+	}
+	if err := h.CheckComponent(component); err != nil {
+		t.Fatalf("CheckComponent: %v", err)
+	}
+	healthy = false
+	if err := h.CheckComponent(component); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("CheckComponent error = %v, want unexpected status 503", err)
+	}
+}
+
+func TestHTTPRejectsAbsolutePath(t *testing.T) {
+	err := newTestHTTPController().RunTask(map[string]string{"id": "t1", "path": "http://attacker.example/"}, map[string]string{"url": "http://127.0.0.1:1"})
+	if err == nil || !strings.Contains(err.Error(), "must be relative to component url") {
+		t.Fatalf("RunTask error = %v, want absolute path rejected", err)
+	}
+}
+
+func TestHTTPClientsKeyedByTLSSettings(t *testing.T) {
+	h := newTestHTTPController()
+	plain, err := parseEndpoint(map[string]string{"url": "https://api.example/v1"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	insecure, err := parseEndpoint(map[string]string{"url": "https://api.example/v2", "insecure_skip_verify": "true"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.client(plain) == h.client(insecure) {
+		t.Error("endpoints with different TLS settings share a client")
+	}
+	if h.client(plain) != h.client(plain) {
+		t.Error("client is not reused for the same endpoint")
+	}
+}
@@ -0,0 +1,552 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
+)
+
+/*
+	================
+	kuber-controller
+	================
+*/
+
+/*
+	RUS: Компонент kuber-controller — рабочая нагрузка в кластере Kubernetes. Метаданные компонента:
+		kubeconfig — путь к kubeconfig; без него in-cluster конфигурация или $KUBECONFIG / ~/.kube/config
+		context    — контекст kubeconfig
+		namespace  — namespace, по умолчанию default
+		kind       — deployment (по умолчанию), statefulset или daemonset
+		name       — имя рабочей нагрузки (нужно для set_image, scale и restart)
+	Метаданные задачи:
+		action          — apply, set_image, scale или restart
+		manifest        — YAML для apply (несколько документов через ---)
+		manifest_file   — путь к YAML для apply на хосте laplasd
+		container       — контейнер для set_image (необязателен, если контейнер один)
+		image           — образ для set_image
+		replicas        — число реплик для scale
+		wait            — ждать завершения rollout, по умолчанию true
+		rollout_timeout — сколько ждать rollout, по умолчанию 5m
+	ENG: kuber-controller components are Kubernetes workloads; tasks apply manifests, set an image,
+	scale or restart the workload and wait for the rollout (see above).
+*/
+
+const (
+	DefaultKubeNamespace       = "default"
+	DefaultRolloutTimeout      = 5 * time.Minute
+	DefaultRolloutPollInterval = 2 * time.Second
+	DefaultKubeRequestTimeout  = 30 * time.Second
+
+	kubeFieldManager      = "laplasd"
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+)
+
+// Действия задач kuber-controller
+const (
+	KubeActionApply    = "apply"
+	KubeActionSetImage = "set_image"
+	KubeActionScale    = "scale"
+	KubeActionRestart  = "restart"
+)
+
+// Поддерживаемые виды рабочих нагрузок
+const (
+	KubeKindDeployment  = "deployment"
+	KubeKindStatefulSet = "statefulset"
+	KubeKindDaemonSet   = "daemonset"
+)
+
+// KubeClients — клиенты кластера компонента
+type KubeClients struct {
+	Clientset kubernetes.Interface
+	Dynamic   dynamic.Interface
+	// Сопоставляет виды объектов из манифестов с ресурсами API
+	Mapper meta.RESTMapper
+}
+
+type KuberController struct {
+	Logger *logrus.Logger
+	// NewClients создаёт клиентов по метаданным компонента. Если не задан, клиенты строятся
+	// из kubeconfig; в тестах подменяется fake-клиентами (k8s.io/client-go/kubernetes/fake).
+	NewClients func(componentMeta map[string]string) (*KubeClients, error)
+	// Период опроса статуса rollout, по умолчанию DefaultRolloutPollInterval
+	PollInterval time.Duration
+
+	mu      sync.Mutex
+	clients map[string]*KubeClients
+}
+
+// kubeComponent — рабочая нагрузка компонента
+type kubeComponent struct {
+	kubeconfig string
+	context    string
+	namespace  string
+	kind       string
+	name       string
+}
+
+func (c kubeComponent) String() string {
+	return c.kind + "/" + c.name
+}
+
+func parseKubeComponent(meta map[string]string) (kubeComponent, error) {
+	comp := kubeComponent{
+		kubeconfig: meta["kubeconfig"],
+		context:    meta["context"],
+		namespace:  meta["namespace"],
+		kind:       strings.ToLower(meta["kind"]),
+		name:       meta["name"],
+	}
+	if comp.namespace == "" {
+		comp.namespace = DefaultKubeNamespace
+	}
+	if errs := validation.IsDNS1123Label(comp.namespace); len(errs) != 0 {
+		return comp, fmt.Errorf("invalid namespace %q: %s", comp.namespace, strings.Join(errs, "; "))
+	}
+	switch comp.kind {
+	case "":
+		comp.kind = KubeKindDeployment
+	case KubeKindDeployment, KubeKindStatefulSet, KubeKindDaemonSet:
+	default:
+		return comp, fmt.Errorf("unsupported kind %q (expected deployment, statefulset or daemonset)", meta["kind"])
+	}
+	if comp.name != "" {
+		if errs := validation.IsDNS1123Subdomain(comp.name); len(errs) != 0 {
+			return comp, fmt.Errorf("invalid name %q: %s", comp.name, strings.Join(errs, "; "))
+		}
+	}
+	if comp.kubeconfig != "" {
+		if _, err := os.Stat(comp.kubeconfig); err != nil {
+			return comp, fmt.Errorf("kubeconfig: %w", err)
+		}
+	}
+	return comp, nil
+}
+
+// kubeTask — действие задачи
+type kubeTask struct {
+	action    string
+	objects   []*unstructured.Unstructured
+	container string
+	image     string
+	replicas  int32
+	wait      bool
+	timeout   time.Duration
+}
+
+func parseKubeTask(meta map[string]string) (*kubeTask, error) {
+	task := &kubeTask{
+		action:    meta["action"],
+		container: meta["container"],
+		image:     meta["image"],
+		wait:      true,
+		timeout:   DefaultRolloutTimeout,
+	}
+
+	switch task.action {
+	case KubeActionApply:
+		manifest, file := meta["manifest"], meta["manifest_file"]
+		if (manifest == "") == (file == "") {
+			return nil, fmt.Errorf("apply requires exactly one of manifest or manifest_file")
+		}
+		data := []byte(manifest)
+		if file != "" {
+			var err error
+			if data, err = os.ReadFile(file); err != nil {
+				return nil, fmt.Errorf("manifest_file: %w", err)
+			}
+		}
+		objects, err := decodeManifest(data)
+		if err != nil {
+			return nil, err
+		}
+		task.objects = objects
+	case KubeActionSetImage:
+		if task.image == "" {
+			return nil, fmt.Errorf("set_image requires image")
+		}
+	case KubeActionScale:
+		replicas, err := strconv.ParseInt(meta["replicas"], 10, 32)
+		if err != nil || replicas < 0 {
+			return nil, fmt.Errorf("scale requires replicas >= 0, got %q", meta["replicas"])
+		}
+		task.replicas = int32(replicas)
+	case KubeActionRestart:
+	case "":
+		return nil, fmt.Errorf("task action is required (apply, set_image, scale or restart)")
+	default:
+		return nil, fmt.Errorf("unknown task action %q (expected apply, set_image, scale or restart)", task.action)
+	}
+
+	if _, ok := meta["wait"]; ok {
+		wait, err := parseBool(meta, "wait")
+		if err != nil {
+			return nil, err
+		}
+		task.wait = wait
+	}
+	if raw := meta["rollout_timeout"]; raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid rollout_timeout %q", raw)
+		}
+		task.timeout = timeout
+	}
+	return task, nil
+}
+
+// decodeManifest разбирает YAML или JSON из одного или нескольких документов
+func decodeManifest(data []byte) ([]*unstructured.Unstructured, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	var objects []*unstructured.Unstructured
+	for i := 1; ; i++ {
+		var raw map[string]interface{}
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("invalid manifest document %d: %w", i, err)
+		}
+		if len(raw) == 0 {
+			continue
+		}
+		obj := &unstructured.Unstructured{Object: raw}
+		if obj.GetAPIVersion() == "" || obj.GetKind() == "" || obj.GetName() == "" {
+			return nil, fmt.Errorf("manifest document %d: apiVersion, kind and metadata.name are required", i)
+		}
+		objects = append(objects, obj)
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("manifest has no objects")
+	}
+	return objects, nil
+}
+
+func (k *KuberController) RunTask(taskMeta map[string]string, componentMeta map[string]string) error {
+	return RunTaskLogged(k.Logger, "Kubernetes", k, taskMeta, componentMeta)
+}
+
+// RunTaskOutput выполняет действие задачи и ждёт rollout, описывая ход выполнения в output.Stdout
+func (k *KuberController) RunTaskOutput(taskMeta map[string]string, componentMeta map[string]string, output TaskOutput) error {
+	task, err := parseKubeTask(taskMeta)
+	if err != nil {
+		return err
+	}
+	comp, err := parseKubeComponent(componentMeta)
+	if err != nil {
+		return err
+	}
+	if task.action != KubeActionApply && comp.name == "" {
+		return fmt.Errorf("%s requires component name", task.action)
+	}
+	clients, err := k.clientsFor(comp, componentMeta)
+	if err != nil {
+		return err
+	}
+
+	out := output.Stdout
+	if out == nil {
+		out = io.Discard
+	}
+	k.Logger.Infof("KuberController running task %s (%s) on %s in %s", taskMeta["id"], task.action, comp, comp.namespace)
+
+	ctx, cancel := context.WithTimeout(context.Background(), task.timeout+DefaultKubeRequestTimeout)
+	defer cancel()
+
+	var (
+		rollouts []kubeComponent
+		message  string
+	)
+	switch task.action {
+	case KubeActionApply:
+		rollouts, err = k.apply(ctx, clients, comp, task.objects, out)
+	case KubeActionSetImage:
+		err = mutateWorkload(ctx, clients, comp, func(template *corev1.PodTemplateSpec, _ **int32) error {
+			return setImage(template, task.container, task.image)
+		})
+		message = fmt.Sprintf("%s image updated to %s", comp, task.image)
+		rollouts = []kubeComponent{comp}
+	case KubeActionScale:
+		err = mutateWorkload(ctx, clients, comp, func(_ *corev1.PodTemplateSpec, replicas **int32) error {
+			if replicas == nil {
+				return fmt.Errorf("%s can not be scaled", comp.kind)
+			}
+			*replicas = &task.replicas
+			return nil
+		})
+		message = fmt.Sprintf("%s scaled to %d", comp, task.replicas)
+		rollouts = []kubeComponent{comp}
+	case KubeActionRestart:
+		err = mutateWorkload(ctx, clients, comp, func(template *corev1.PodTemplateSpec, _ **int32) error {
+			if template.Annotations == nil {
+				template.Annotations = make(map[string]string)
+			}
+			template.Annotations[restartedAtAnnotation] = time.Now().Format(time.RFC3339)
+			return nil
+		})
+		message = fmt.Sprintf("%s restarted", comp)
+		rollouts = []kubeComponent{comp}
+	}
+	if err != nil {
+		return err
+	}
+	if message != "" {
+		fmt.Fprintln(out, message)
+	}
+
+	if !task.wait {
+		return nil
+	}
+	waitCtx, cancelWait := context.WithTimeout(ctx, task.timeout)
+	defer cancelWait()
+	for _, workload := range rollouts {
+		if err := k.waitRollout(waitCtx, clients, workload, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply применяет объекты манифеста (server-side apply) и возвращает рабочие нагрузки, чей rollout нужно дождаться
+func (k *KuberController) apply(ctx context.Context, clients *KubeClients, comp kubeComponent, objects []*unstructured.Unstructured, out io.Writer) ([]kubeComponent, error) {
+	if clients.Dynamic == nil || clients.Mapper == nil {
+		return nil, fmt.Errorf("apply requires dynamic client and REST mapper")
+	}
+
+	var rollouts []kubeComponent
+	for _, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		mapping, err := clients.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", gvk.Kind, obj.GetName(), err)
+		}
+
+		resource := clients.Dynamic.Resource(mapping.Resource)
+		var target dynamic.ResourceInterface = resource
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			if obj.GetNamespace() == "" {
+				obj.SetNamespace(comp.namespace)
+			}
+			target = resource.Namespace(obj.GetNamespace())
+		}
+
+		_, err = target.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{FieldManager: kubeFieldManager, Force: true})
+		if err != nil {
+			return nil, fmt.Errorf("apply %s %s: %w", gvk.Kind, obj.GetName(), err)
+		}
+		fmt.Fprintf(out, "%s/%s applied\n", strings.ToLower(gvk.Kind), obj.GetName())
+
+		if gvk.Group == "apps" {
+			switch kind := strings.ToLower(gvk.Kind); kind {
+			case KubeKindDeployment, KubeKindStatefulSet, KubeKindDaemonSet:
+				workload := comp
+				workload.kind, workload.name, workload.namespace = kind, obj.GetName(), obj.GetNamespace()
+				rollouts = append(rollouts, workload)
+			}
+		}
+	}
+	return rollouts, nil
+}
+
+// mutateWorkload изменяет шаблон пода и число реплик рабочей нагрузки, повторяя при конфликте версий.
+// Для daemonset replicas передаётся nil.
+func mutateWorkload(ctx context.Context, clients *KubeClients, comp kubeComponent, mutate func(template *corev1.PodTemplateSpec, replicas **int32) error) error {
+	apps := clients.Clientset.AppsV1()
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		switch comp.kind {
+		case KubeKindDeployment:
+			obj, err := apps.Deployments(comp.namespace).Get(ctx, comp.name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if err := mutate(&obj.Spec.Template, &obj.Spec.Replicas); err != nil {
+				return err
+			}
+			_, err = apps.Deployments(comp.namespace).Update(ctx, obj, metav1.UpdateOptions{FieldManager: kubeFieldManager})
+			return err
+		case KubeKindStatefulSet:
+			obj, err := apps.StatefulSets(comp.namespace).Get(ctx, comp.name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if err := mutate(&obj.Spec.Template, &obj.Spec.Replicas); err != nil {
+				return err
+			}
+			_, err = apps.StatefulSets(comp.namespace).Update(ctx, obj, metav1.UpdateOptions{FieldManager: kubeFieldManager})
+			return err
+		case KubeKindDaemonSet:
+			obj, err := apps.DaemonSets(comp.namespace).Get(ctx, comp.name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if err := mutate(&obj.Spec.Template, nil); err != nil {
+				return err
+			}
+			_, err = apps.DaemonSets(comp.namespace).Update(ctx, obj, metav1.UpdateOptions{FieldManager: kubeFieldManager})
+			return err
+		}
+		return fmt.Errorf("unsupported kind %q", comp.kind)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", comp, err)
+	}
+	return nil
+}
+
+// setImage меняет образ контейнера; имя можно не указывать, если контейнер в поде один
+func setImage(template *corev1.PodTemplateSpec, container, image string) error {
+	containers := template.Spec.Containers
+	if container == "" {
+		if len(containers) != 1 {
+			return fmt.Errorf("pod has %d containers, set container (one of %s)", len(containers), containerNames(template))
+		}
+		containers[0].Image = image
+		return nil
+	}
+	for _, list := range [][]corev1.Container{template.Spec.Containers, template.Spec.InitContainers} {
+		for i := range list {
+			if list[i].Name == container {
+				list[i].Image = image
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("container %q not found (have %s)", container, containerNames(template))
+}
+
+func containerNames(template *corev1.PodTemplateSpec) string {
+	names := make([]string, 0, len(template.Spec.Containers)+len(template.Spec.InitContainers))
+	for _, c := range template.Spec.Containers {
+		names = append(names, c.Name)
+	}
+	for _, c := range template.Spec.InitContainers {
+		names = append(names, c.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func (k *KuberController) ValideTask(taskMeta map[string]string) error {
+	if taskMeta["id"] == "" {
+		return fmt.Errorf("task id is required")
+	}
+	_, err := parseKubeTask(taskMeta)
+	return err
+}
+
+// ValideComponent проверяет метаданные и загружает kubeconfig, не обращаясь к кластеру
+func (k *KuberController) ValideComponent(componentMeta map[string]string) error {
+	comp, err := parseKubeComponent(componentMeta)
+	if err != nil {
+		return err
+	}
+	_, err = k.clientsFor(comp, componentMeta)
+	return err
+}
+
+// CheckComponent проверяет доступность кластера и здоровье рабочей нагрузки (см. kuber_health.go)
+func (k *KuberController) CheckComponent(componentMeta map[string]string) error {
+	comp, err := parseKubeComponent(componentMeta)
+	if err != nil {
+		return err
+	}
+	clients, err := k.clientsFor(comp, componentMeta)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultKubeRequestTimeout)
+	defer cancel()
+
+	if comp.name == "" {
+		if _, err := clients.Clientset.CoreV1().Namespaces().Get(ctx, comp.namespace, metav1.GetOptions{}); err != nil {
+			return fmt.Errorf("namespace %s: %w", comp.namespace, err)
+		}
+		return nil
+	}
+	return checkWorkloadHealth(ctx, clients, comp)
+}
+
+// clientsFor возвращает клиентов кластера, кешируя их по kubeconfig и контексту
+func (k *KuberController) clientsFor(comp kubeComponent, componentMeta map[string]string) (*KubeClients, error) {
+	if k.NewClients != nil {
+		return k.NewClients(componentMeta)
+	}
+
+	key := comp.kubeconfig + "\x00" + comp.context
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if clients, ok := k.clients[key]; ok {
+		return clients, nil
+	}
+	config, err := loadKubeConfig(comp.kubeconfig, comp.context)
+	if err != nil {
+		return nil, err
+	}
+	clients, err := newKubeClients(config)
+	if err != nil {
+		return nil, err
+	}
+	if k.clients == nil {
+		k.clients = make(map[string]*KubeClients)
+	}
+	k.clients[key] = clients
+	return clients, nil
+}
+
+func loadKubeConfig(kubeconfig, kubeContext string) (*rest.Config, error) {
+	if kubeconfig == "" && kubeContext == "" && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return rest.InClusterConfig()
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig != "" {
+		rules.ExplicitPath = kubeconfig
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DefaultKubeRequestTimeout
+	}
+	return config, nil
+}
+
+func newKubeClients(config *rest.Config) (*KubeClients, error) {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	dyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(clientset.Discovery()))
+	return &KubeClients{Clientset: clientset, Dynamic: dyn, Mapper: mapper}, nil
+}
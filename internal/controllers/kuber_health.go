@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*
+	RUS: Проверка здоровья рабочей нагрузки для CheckComponent: доступные реплики против желаемых,
+	неудачные условия (conditions) и поды в CrashLoopBackOff / ImagePullBackOff и т.п.
+	Ошибка описывает все найденные проблемы одной строкой — watchdog записывает её в события компонента.
+	ENG: Workload health for CheckComponent: available vs desired replicas, failed conditions and
+	crash-looping pods, reported as one descriptive error the watchdog records as a component event.
+*/
+
+// Максимум подов, перечисляемых в описании ошибки
+const maxReportedPods = 3
+
+// Причины ожидания контейнера, при которых под сам не восстановится
+var failedWaitingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+	"RunContainerError":          true,
+}
+
+// workloadHealth — сводка состояния рабочей нагрузки
+type workloadHealth struct {
+	desired   int32
+	available int32
+	selector  *metav1.LabelSelector
+	problems  []string
+}
+
+// checkWorkloadHealth возвращает ошибку с описанием, если рабочая нагрузка компонента нездорова
+func checkWorkloadHealth(ctx context.Context, clients *KubeClients, comp kubeComponent) error {
+	health, err := getWorkloadHealth(ctx, clients, comp)
+	if err != nil {
+		return err
+	}
+
+	if health.available < health.desired {
+		health.problems = append([]string{fmt.Sprintf("%d of %d replicas available", health.available, health.desired)}, health.problems...)
+	}
+	// Поды смотрим всегда: под в CrashLoopBackOff не мешает нагрузке оставаться доступной,
+	// пока его перезапуски покрывают остальные реплики
+	if health.selector != nil {
+		pods, err := podProblems(ctx, clients, comp.namespace, health.selector)
+		if err != nil {
+			return fmt.Errorf("%s: %w", comp, err)
+		}
+		health.problems = append(health.problems, pods...)
+	}
+
+	if len(health.problems) != 0 {
+		return fmt.Errorf("%s in %s unhealthy: %s", comp, comp.namespace, strings.Join(health.problems, "; "))
+	}
+	return nil
+}
+
+func getWorkloadHealth(ctx context.Context, clients *KubeClients, comp kubeComponent) (*workloadHealth, error) {
+	apps := clients.Clientset.AppsV1()
+	switch comp.kind {
+	case KubeKindDeployment:
+		obj, err := apps.Deployments(comp.namespace).Get(ctx, comp.name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", comp, err)
+		}
+		return deploymentHealth(obj), nil
+	case KubeKindStatefulSet:
+		obj, err := apps.StatefulSets(comp.namespace).Get(ctx, comp.name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", comp, err)
+		}
+		return statefulSetHealth(obj), nil
+	case KubeKindDaemonSet:
+		obj, err := apps.DaemonSets(comp.namespace).Get(ctx, comp.name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", comp, err)
+		}
+		return daemonSetHealth(obj), nil
+	}
+	return nil, fmt.Errorf("unsupported kind %q", comp.kind)
+}
+
+func deploymentHealth(d *appsv1.Deployment) *workloadHealth {
+	health := &workloadHealth{desired: 1, available: d.Status.AvailableReplicas, selector: d.Spec.Selector}
+	if d.Spec.Replicas != nil {
+		health.desired = *d.Spec.Replicas
+	}
+	for _, cond := range d.Status.Conditions {
+		switch {
+		case cond.Type == appsv1.DeploymentAvailable && cond.Status == corev1.ConditionFalse,
+			cond.Type == appsv1.DeploymentReplicaFailure && cond.Status == corev1.ConditionTrue,
+			cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded":
+			health.problems = append(health.problems, conditionProblem(string(cond.Type), string(cond.Status), cond.Reason, cond.Message))
+		}
+	}
+	return health
+}
+
+func statefulSetHealth(s *appsv1.StatefulSet) *workloadHealth {
+	health := &workloadHealth{desired: 1, available: s.Status.AvailableReplicas, selector: s.Spec.Selector}
+	if s.Spec.Replicas != nil {
+		health.desired = *s.Spec.Replicas
+	}
+	for _, cond := range s.Status.Conditions {
+		if cond.Status == corev1.ConditionTrue && strings.HasSuffix(string(cond.Type), "Failure") {
+			health.problems = append(health.problems, conditionProblem(string(cond.Type), string(cond.Status), cond.Reason, cond.Message))
+		}
+	}
+	return health
+}
+
+func daemonSetHealth(d *appsv1.DaemonSet) *workloadHealth {
+	health := &workloadHealth{desired: d.Status.DesiredNumberScheduled, available: d.Status.NumberAvailable, selector: d.Spec.Selector}
+	if d.Status.NumberMisscheduled > 0 {
+		health.problems = append(health.problems, fmt.Sprintf("%d pods misscheduled", d.Status.NumberMisscheduled))
+	}
+	for _, cond := range d.Status.Conditions {
+		if cond.Status == corev1.ConditionTrue && strings.HasSuffix(string(cond.Type), "Failure") {
+			health.problems = append(health.problems, conditionProblem(string(cond.Type), string(cond.Status), cond.Reason, cond.Message))
+		}
+	}
+	return health
+}
+
+func conditionProblem(condType, status, reason, message string) string {
+	problem := fmt.Sprintf("condition %s=%s", condType, status)
+	if reason != "" {
+		problem += " (" + reason + ")"
+	}
+	if message != "" {
+		problem += ": " + strings.TrimSuffix(message, ".")
+	}
+	return problem
+}
+
+// podProblems описывает упавшие поды и контейнеры, которые не могут запуститься
+func podProblems(ctx context.Context, clients *KubeClients, namespace string, labelSelector *metav1.LabelSelector) ([]string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector: %w", err)
+	}
+	pods, err := clients.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("list pods: %w", err)
+	}
+
+	var problems []string
+	for i := range pods.Items {
+		problems = append(problems, podProblem(&pods.Items[i])...)
+	}
+	if len(problems) > maxReportedPods {
+		problems = append(problems[:maxReportedPods], fmt.Sprintf("and %d more pod problems", len(problems)-maxReportedPods))
+	}
+	return problems, nil
+}
+
+func podProblem(pod *corev1.Pod) []string {
+	if pod.Status.Phase == corev1.PodFailed {
+		problem := fmt.Sprintf("pod %s failed", pod.Name)
+		if pod.Status.Reason != "" {
+			problem += " (" + pod.Status.Reason + ")"
+		}
+		if pod.Status.Message != "" {
+			problem += ": " + pod.Status.Message
+		}
+		return []string{problem}
+	}
+
+	var problems []string
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		waiting := status.State.Waiting
+		if waiting == nil || !failedWaitingReasons[waiting.Reason] {
+			continue
+		}
+		problem := fmt.Sprintf("pod %s container %s: %s", pod.Name, status.Name, waiting.Reason)
+		if status.RestartCount > 0 {
+			problem += fmt.Sprintf(" after %d restarts", status.RestartCount)
+		}
+		if last := status.LastTerminationState.Terminated; last != nil {
+			problem += fmt.Sprintf(", last exit code %d", last.ExitCode)
+			if last.Reason != "" {
+				problem += " (" + last.Reason + ")"
+			}
+		} else if waiting.Message != "" {
+			problem += ": " + waiting.Message
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*
+	RUS: Статус rollout рабочих нагрузок по тем же правилам, что kubectl rollout status
+	ENG: Workload rollout status following the same rules as kubectl rollout status
+*/
+
+// rolloutStatus возвращает описание состояния и признак завершения rollout.
+// Ошибка означает, что нагрузка недоступна или rollout не может завершиться.
+func rolloutStatus(ctx context.Context, clients *KubeClients, comp kubeComponent) (string, bool, error) {
+	apps := clients.Clientset.AppsV1()
+	switch comp.kind {
+	case KubeKindDeployment:
+		obj, err := apps.Deployments(comp.namespace).Get(ctx, comp.name, metav1.GetOptions{})
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %w", comp, err)
+		}
+		return deploymentStatus(obj)
+	case KubeKindStatefulSet:
+		obj, err := apps.StatefulSets(comp.namespace).Get(ctx, comp.name, metav1.GetOptions{})
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %w", comp, err)
+		}
+		return statefulSetStatus(obj)
+	case KubeKindDaemonSet:
+		obj, err := apps.DaemonSets(comp.namespace).Get(ctx, comp.name, metav1.GetOptions{})
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %w", comp, err)
+		}
+		return daemonSetStatus(obj)
+	}
+	return "", false, fmt.Errorf("unsupported kind %q", comp.kind)
+}
+
+func deploymentStatus(d *appsv1.Deployment) (string, bool, error) {
+	if d.Generation > d.Status.ObservedGeneration {
+		return "waiting for deployment spec update to be observed", false, nil
+	}
+	for _, cond := range d.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			return "", false, fmt.Errorf("deployment %q exceeded its progress deadline", d.Name)
+		}
+	}
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	switch {
+	case d.Status.UpdatedReplicas < replicas:
+		return fmt.Sprintf("%d out of %d new replicas have been updated", d.Status.UpdatedReplicas, replicas), false, nil
+	case d.Status.Replicas > d.Status.UpdatedReplicas:
+		return fmt.Sprintf("%d old replicas are pending termination", d.Status.Replicas-d.Status.UpdatedReplicas), false, nil
+	case d.Status.AvailableReplicas < d.Status.UpdatedReplicas:
+		return fmt.Sprintf("%d of %d updated replicas are available", d.Status.AvailableReplicas, d.Status.UpdatedReplicas), false, nil
+	}
+	return "successfully rolled out", true, nil
+}
+
+func statefulSetStatus(s *appsv1.StatefulSet) (string, bool, error) {
+	if s.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		return "rollout status is only available for RollingUpdate strategy", true, nil
+	}
+	if s.Status.ObservedGeneration == 0 || s.Generation > s.Status.ObservedGeneration {
+		return "waiting for statefulset spec update to be observed", false, nil
+	}
+	replicas := int32(1)
+	if s.Spec.Replicas != nil {
+		replicas = *s.Spec.Replicas
+	}
+	if s.Status.ReadyReplicas < replicas {
+		return fmt.Sprintf("waiting for %d pods to be ready", replicas-s.Status.ReadyReplicas), false, nil
+	}
+	if rolling := s.Spec.UpdateStrategy.RollingUpdate; rolling != nil && rolling.Partition != nil && *rolling.Partition > 0 {
+		if s.Status.UpdatedReplicas < replicas-*rolling.Partition {
+			return fmt.Sprintf("waiting for partitioned roll out to finish: %d out of %d new pods have been updated",
+				s.Status.UpdatedReplicas, replicas-*rolling.Partition), false, nil
+		}
+		return "partitioned roll out complete", true, nil
+	}
+	if s.Status.UpdateRevision != s.Status.CurrentRevision {
+		return fmt.Sprintf("waiting for statefulset rolling update to complete %d pods at revision %s",
+			s.Status.UpdatedReplicas, s.Status.UpdateRevision), false, nil
+	}
+	return "successfully rolled out", true, nil
+}
+
+func daemonSetStatus(d *appsv1.DaemonSet) (string, bool, error) {
+	if d.Spec.UpdateStrategy.Type != appsv1.RollingUpdateDaemonSetStrategyType {
+		return "rollout status is only available for RollingUpdate strategy", true, nil
+	}
+	if d.Generation > d.Status.ObservedGeneration {
+		return "waiting for daemon set spec update to be observed", false, nil
+	}
+	switch {
+	case d.Status.UpdatedNumberScheduled < d.Status.DesiredNumberScheduled:
+		return fmt.Sprintf("%d out of %d new pods have been updated", d.Status.UpdatedNumberScheduled, d.Status.DesiredNumberScheduled), false, nil
+	case d.Status.NumberAvailable < d.Status.DesiredNumberScheduled:
+		return fmt.Sprintf("%d of %d updated pods are available", d.Status.NumberAvailable, d.Status.DesiredNumberScheduled), false, nil
+	}
+	return "successfully rolled out", true, nil
+}
+
+// waitRollout опрашивает статус до завершения rollout или отмены ctx, выводя изменения статуса в out
+func (k *KuberController) waitRollout(ctx context.Context, clients *KubeClients, comp kubeComponent, out io.Writer) error {
+	interval := k.PollInterval
+	if interval <= 0 {
+		interval = DefaultRolloutPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last string
+	for {
+		status, done, err := rolloutStatus(ctx, clients, comp)
+		if err != nil {
+			return err
+		}
+		if status != last {
+			fmt.Fprintf(out, "%s: %s\n", comp, status)
+			last = status
+		}
+		if done {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for rollout of %s: %s", comp, last)
+		case <-ticker.C:
+		}
+	}
+}
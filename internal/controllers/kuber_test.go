@@ -0,0 +1,278 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var deploymentsResource = appsv1.SchemeGroupVersion.WithResource("deployments")
+
+func newTestDeployment(name string, replicas int32) *appsv1.Deployment {
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "prod", Generation: 1},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: selector,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: selector.MatchLabels},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{
+					{Name: "app", Image: "nginx:1"},
+					{Name: "sidecar", Image: "envoy:1"},
+				}},
+			},
+		},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 1,
+			Replicas:           replicas,
+			UpdatedReplicas:    replicas,
+			AvailableReplicas:  replicas,
+		},
+	}
+}
+
+// newFakeKuber возвращает контроллер на fake-клиенте. Fake не увеличивает generation при изменении
+// spec, поэтому это делает реактор; с rollout=true каждый Get продвигает rollout на шаг, как контроллер
+// deployment в кластере.
+func newFakeKuber(t *testing.T, rollout bool, objects ...runtime.Object) (*KuberController, *fake.Clientset) {
+	t.Helper()
+
+	clientset := fake.NewSimpleClientset(objects...)
+	clientset.PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() == "" {
+			obj := action.(k8stesting.UpdateAction).GetObject().(*appsv1.Deployment)
+			obj.Generation++
+		}
+		return false, nil, nil
+	})
+	if rollout {
+		clientset.PrependReactor("get", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			get := action.(k8stesting.GetAction)
+			obj, err := clientset.Tracker().Get(deploymentsResource, get.GetNamespace(), get.GetName())
+			if err != nil {
+				return false, nil, nil
+			}
+			d := obj.(*appsv1.Deployment)
+			replicas := *d.Spec.Replicas
+			switch {
+			case d.Status.ObservedGeneration < d.Generation:
+				d.Status.ObservedGeneration = d.Generation
+				d.Status.UpdatedReplicas = 0
+			case d.Status.UpdatedReplicas < replicas:
+				d.Status.UpdatedReplicas, d.Status.Replicas, d.Status.AvailableReplicas = replicas, replicas, 0
+			case d.Status.AvailableReplicas < d.Status.UpdatedReplicas:
+				d.Status.AvailableReplicas = d.Status.UpdatedReplicas
+			default:
+				return false, nil, nil
+			}
+			if err := clientset.Tracker().Update(deploymentsResource, d, d.Namespace); err != nil {
+				t.Errorf("update deployment status: %v", err)
+			}
+			return false, nil, nil
+		})
+	}
+
+	controller := &KuberController{
+		Logger:       testLogger(),
+		PollInterval: time.Millisecond,
+		NewClients: func(map[string]string) (*KubeClients, error) {
+			return &KubeClients{Clientset: clientset}, nil
+		},
+	}
+	return controller, clientset
+}
+
+func getTestDeployment(t *testing.T, clientset *fake.Clientset, name string) *appsv1.Deployment {
+	t.Helper()
+	d, err := clientset.AppsV1().Deployments("prod").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get deployment %s: %v", name, err)
+	}
+	return d
+}
+
+func TestKuberSetImageWaitsForRollout(t *testing.T) {
+	k, clientset := newFakeKuber(t, true, newTestDeployment("web", 2))
+	component := map[string]string{"namespace": "prod", "name": "web"}
+	task := map[string]string{"action": "set_image", "container": "app", "image": "nginx:2", "rollout_timeout": "5s"}
+
+	var stdout bytes.Buffer
+	if err := k.RunTaskOutput(task, component, TaskOutput{Stdout: &stdout}); err != nil {
+		t.Fatalf("RunTaskOutput: %v", err)
+	}
+
+	d := getTestDeployment(t, clientset, "web")
+	if got := d.Spec.Template.Spec.Containers[0].Image; got != "nginx:2" {
+		t.Errorf("app image = %q, want nginx:2", got)
+	}
+	if got := d.Spec.Template.Spec.Containers[1].Image; got != "envoy:1" {
+		t.Errorf("sidecar image = %q, want it unchanged", got)
+	}
+	out := stdout.String()
+	for _, want := range []string{"image updated to nginx:2", "0 out of 2 new replicas have been updated", "successfully rolled out"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestKuberSetImageRequiresContainerForMultiContainerPods(t *testing.T) {
+	k, clientset := newFakeKuber(t, true, newTestDeployment("web", 2))
+	component := map[string]string{"namespace": "prod", "name": "web"}
+
+	err := k.RunTask(map[string]string{"action": "set_image", "image": "nginx:2"}, component)
+	if err == nil || !strings.Contains(err.Error(), "app, sidecar") {
+		t.Fatalf("RunTask error = %v, want one listing the containers", err)
+	}
+	if got := getTestDeployment(t, clientset, "web").Spec.Template.Spec.Containers[0].Image; got != "nginx:1" {
+		t.Errorf("image changed to %q on failed task", got)
+	}
+}
+
+func TestKuberScale(t *testing.T) {
+	k, clientset := newFakeKuber(t, true, newTestDeployment("web", 2))
+	component := map[string]string{"namespace": "prod", "name": "web"}
+
+	var stdout bytes.Buffer
+	if err := k.RunTaskOutput(map[string]string{"action": "scale", "replicas": "5", "rollout_timeout": "5s"}, component, TaskOutput{Stdout: &stdout}); err != nil {
+		t.Fatalf("RunTaskOutput: %v", err)
+	}
+	d := getTestDeployment(t, clientset, "web")
+	if *d.Spec.Replicas != 5 {
+		t.Errorf("replicas = %d, want 5", *d.Spec.Replicas)
+	}
+	if d.Status.AvailableReplicas != 5 {
+		t.Errorf("returned before rollout completed: %d available", d.Status.AvailableReplicas)
+	}
+	if !strings.Contains(stdout.String(), "scaled to 5") {
+		t.Errorf("output does not report scaling:\n%s", stdout.String())
+	}
+}
+
+func TestKuberScaleWithoutWait(t *testing.T) {
+	k, clientset := newFakeKuber(t, false, newTestDeployment("web", 2))
+	component := map[string]string{"namespace": "prod", "name": "web"}
+
+	if err := k.RunTask(map[string]string{"action": "scale", "replicas": "0", "wait": "false"}, component); err != nil {
+		t.Fatalf("RunTask: %v", err)
+	}
+	if got := *getTestDeployment(t, clientset, "web").Spec.Replicas; got != 0 {
+		t.Errorf("replicas = %d, want 0", got)
+	}
+}
+
+func TestKuberRolloutTimeout(t *testing.T) {
+	// Без rollout-реактора новая generation никогда не будет замечена
+	k, _ := newFakeKuber(t, false, newTestDeployment("web", 2))
+	component := map[string]string{"namespace": "prod", "name": "web"}
+	task := map[string]string{"action": "restart", "rollout_timeout": "50ms"}
+
+	err := k.RunTask(task, component)
+	if err == nil || !strings.Contains(err.Error(), "timed out waiting for rollout") || !strings.Contains(err.Error(), "spec update to be observed") {
+		t.Fatalf("RunTask error = %v, want rollout timeout with the last status", err)
+	}
+}
+
+func TestKuberRolloutProgressDeadline(t *testing.T) {
+	d := newTestDeployment("web", 2)
+	d.Status.Conditions = []appsv1.DeploymentCondition{{
+		Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded",
+	}}
+	k, _ := newFakeKuber(t, true, d)
+	task := map[string]string{"action": "scale", "replicas": "3", "rollout_timeout": "5s"}
+
+	err := k.RunTask(task, map[string]string{"namespace": "prod", "name": "web"})
+	if err == nil || !strings.Contains(err.Error(), "exceeded its progress deadline") {
+		t.Fatalf("RunTask error = %v, want progress deadline error", err)
+	}
+}
+
+func crashLoopingPod(name, app string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "prod", Labels: map[string]string{"app": app}},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:                 "app",
+				RestartCount:         7,
+				State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}},
+			}},
+		},
+	}
+}
+
+func TestKuberCheckComponentHealthy(t *testing.T) {
+	k, _ := newFakeKuber(t, false, newTestDeployment("web", 3))
+	if err := k.CheckComponent(map[string]string{"namespace": "prod", "name": "web"}); err != nil {
+		t.Fatalf("CheckComponent: %v", err)
+	}
+}
+
+func TestKuberCheckComponentUnavailable(t *testing.T) {
+	d := newTestDeployment("web", 3)
+	d.Status.AvailableReplicas = 1
+	d.Status.Conditions = []appsv1.DeploymentCondition{{
+		Type: appsv1.DeploymentAvailable, Status: corev1.ConditionFalse,
+		Reason: "MinimumReplicasUnavailable", Message: "Deployment does not have minimum availability.",
+	}}
+	imagePull := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-2", Namespace: "prod", Labels: map[string]string{"app": "web"}},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodPending,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "app",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"}},
+			}},
+		},
+	}
+	k, _ := newFakeKuber(t, false, d, crashLoopingPod("web-1", "web"), imagePull, crashLoopingPod("db-1", "db"))
+
+	err := k.CheckComponent(map[string]string{"namespace": "prod", "name": "web"})
+	if err == nil {
+		t.Fatal("CheckComponent succeeded for an unavailable deployment")
+	}
+	for _, want := range []string{
+		"1 of 3 replicas available",
+		"condition Available=False (MinimumReplicasUnavailable): Deployment does not have minimum availability",
+		"pod web-1 container app: CrashLoopBackOff after 7 restarts, last exit code 1 (Error)",
+		"pod web-2 container app: ImagePullBackOff: Back-off pulling image",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not contain %q: %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "db-1") {
+		t.Errorf("error reports a pod outside the selector: %v", err)
+	}
+}
+
+func TestKuberCheckComponentCrashLoopWhileAvailable(t *testing.T) {
+	k, _ := newFakeKuber(t, false, newTestDeployment("web", 3), crashLoopingPod("web-1", "web"))
+
+	err := k.CheckComponent(map[string]string{"namespace": "prod", "name": "web"})
+	if err == nil || !strings.Contains(err.Error(), "pod web-1 container app: CrashLoopBackOff") {
+		t.Fatalf("CheckComponent error = %v, want the crash-looping pod reported", err)
+	}
+	if strings.Contains(err.Error(), "replicas available") {
+		t.Errorf("error reports missing replicas for an available deployment: %v", err)
+	}
+}
+
+func TestKuberCheckComponentMissingWorkload(t *testing.T) {
+	k, _ := newFakeKuber(t, false)
+	err := k.CheckComponent(map[string]string{"namespace": "prod", "name": "web"})
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("CheckComponent error = %v, want not found", err)
+	}
+}
@@ -1,90 +1,257 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 type PromQLMonitorController struct {
-	logger     *logrus.Logger
-	promAPIURL string // URL Prometheus API, например "http://prometheus:9090/api/v1"
+	logger *logrus.Logger
+	// URL Prometheus API по умолчанию, например "http://prometheus:9090/api/v1".
+	// Используется, если в Monitoring.Config не задан url.
+	promAPIURL string
+	mu         sync.Mutex
+	// HTTP-клиенты по подключениям (см. httpEndpoint.clientKey)
+	clients map[string]*http.Client
+	// Отменяется при остановке демона: прерывает запросы и ожидание условия в режиме for
+	ctx context.Context
 }
 
-func NewPromQLMonitorController(logger *logrus.Logger, apiURL string) *PromQLMonitorController {
+func NewPromQLMonitorController(ctx context.Context, logger *logrus.Logger, apiURL string) *PromQLMonitorController {
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	return &PromQLMonitorController{
 		logger:     logger,
 		promAPIURL: apiURL,
+		clients:    make(map[string]*http.Client),
+		ctx:        ctx,
 	}
 }
 
-// ValidateCheck проверяет корректность параметров запроса PromQL
+// ValidateCheck проверяет корректность параметров запроса PromQL.
+// monitorMeta — Monitoring.Config её мониторинга, переопределённый метаданными проверки.
 func (p *PromQLMonitorController) ValidateCheck(monitorMeta map[string]string) error {
-	query := monitorMeta["query"]
-	if query == "" {
-		return fmt.Errorf("promql query is required")
+	if _, err := parsePromCheck(monitorMeta); err != nil {
+		return err
 	}
-	return nil
+	_, err := parseEndpoint(monitorMeta, p.promAPIURL)
+	return err
 }
 
-// ValidateMonitoring — здесь можно проверить конфиг мониторинга, например, таймауты, повторные попытки и т.д.
-// Для упрощения — просто возвращаем nil
+// ValidateMonitoring проверяет параметры подключения из Monitoring.Config
 func (p *PromQLMonitorController) ValidateMonitoring(config map[string]string) error {
-	return nil
+	_, err := parseEndpoint(config, p.promAPIURL)
+	return err
 }
 
-// RunCheck выполняет запрос к Prometheus API и анализирует результат
+// RunCheck выполняет запрос к Prometheus API и анализирует результат.
+// В режиме for запрос повторяется, пока условие не продержится всё окно или не истечёт for_timeout.
 func (p *PromQLMonitorController) RunCheck(monitorMeta map[string]string) error {
-	query := monitorMeta["query"]
-	timeoutStr := monitorMeta["timeout"] // например, "5s"
-	timeout := 10 * time.Second
-	if timeoutStr != "" {
-		if d, err := time.ParseDuration(timeoutStr); err == nil {
-			timeout = d
+	check, err := parsePromCheck(monitorMeta)
+	if err != nil {
+		return err
+	}
+	check.endpoint, err = parseEndpoint(monitorMeta, p.promAPIURL)
+	if err != nil {
+		return err
+	}
+	if check.hold > 0 {
+		return p.runHold(check)
+	}
+	if err := p.evaluate(check); err != nil {
+		return err
+	}
+
+	p.logger.Infof("PromQL monitoring check passed for query: %s", check.query)
+	return nil
+}
+
+// runHold опрашивает Prometheus каждые pollInterval и ждёт, пока условие выполняется hold подряд
+func (p *PromQLMonitorController) runHold(check *promCheck) error {
+	deadline := time.Now().Add(check.forTimeout)
+
+	var heldSince time.Time
+	var lastErr error
+	for {
+		now := time.Now()
+		if err := p.evaluate(check); err != nil {
+			if !heldSince.IsZero() {
+				p.logger.Debugf("PromQL condition for query %s broke after %s: %v", check.query, now.Sub(heldSince).Round(time.Second), err)
+			}
+			heldSince, lastErr = time.Time{}, err
+		} else {
+			if heldSince.IsZero() {
+				heldSince = now
+			}
+			if now.Sub(heldSince) >= check.hold {
+				p.logger.Infof("PromQL monitoring check held for %s for query: %s", check.hold, check.query)
+				return nil
+			}
+		}
+
+		// Не ждём, если окно уже не успеет набраться до for_timeout
+		windowEnd := heldSince.Add(check.hold)
+		if heldSince.IsZero() {
+			windowEnd = now.Add(check.pollInterval).Add(check.hold)
+		}
+		if windowEnd.After(deadline) {
+			if lastErr == nil {
+				return fmt.Errorf("condition did not hold for %s within %s", check.hold, check.forTimeout)
+			}
+			return fmt.Errorf("condition did not hold for %s within %s: %w", check.hold, check.forTimeout, lastErr)
+		}
+		timer := time.NewTimer(check.pollInterval)
+		select {
+		case <-timer.C:
+		case <-p.ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("condition wait for query %s interrupted: %w", check.query, p.ctx.Err())
+		}
+	}
+}
+
+// evaluate выполняет один запрос (instant или range) и проверяет условие
+func (p *PromQLMonitorController) evaluate(check *promCheck) error {
+	result, err := p.fetch(check)
+	if err != nil {
+		return err
+	}
+	if len(result.Warnings) != 0 {
+		p.logger.Warnf("PromQL query %s returned warnings: %s", check.query, strings.Join(result.Warnings, "; "))
+	}
+
+	series, err := parsePromSeries(result.Data)
+	if err != nil {
+		return withWarnings(fmt.Errorf("query %s: %w", check.query, err), result.Warnings)
+	}
+
+	// Без условия успешный мониторинг — это когда query вернула не пустой набор данных
+	if check.condition == nil {
+		if len(series) == 0 {
+			return withWarnings(fmt.Errorf("promql query returned no data"), result.Warnings)
 		}
+		return nil
+	}
+	if err := check.condition.evaluate(series); err != nil {
+		return withWarnings(fmt.Errorf("query %s: %w", check.query, err), result.Warnings)
 	}
+	return nil
+}
 
-	client := &http.Client{Timeout: timeout}
+func (p *PromQLMonitorController) fetch(check *promCheck) (*PrometheusQueryResponse, error) {
+	method := "query"
+	params := url.Values{
+		"query":   {check.query},
+		"timeout": {check.timeout.String()},
+	}
+	now := time.Now()
+	if check.isRange() {
+		start, err := parseTimeSpec(check.start, now)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseTimeSpec(check.end, now)
+		if err != nil {
+			return nil, err
+		}
+		method = "query_range"
+		params.Set("start", formatPromTime(start))
+		params.Set("end", formatPromTime(end))
+		params.Set("step", check.step.String())
+	} else if check.time != "" {
+		at, err := parseTimeSpec(check.time, now)
+		if err != nil {
+			return nil, err
+		}
+		params.Set("time", formatPromTime(at))
+	}
 
-	url := fmt.Sprintf("%s/query?query=%s", p.promAPIURL, query)
-	p.logger.Debugf("Running PromQL query: %s", url)
+	ctx, cancel := context.WithTimeout(p.ctx, check.timeout)
+	defer cancel()
+	req, err := check.endpoint.newRequest(ctx, method, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build prometheus request: %w", err)
+	}
+	p.logger.Debugf("Running PromQL query (%s %s): %s", req.Method, method, check.query)
 
-	resp, err := client.Get(url)
+	resp, err := p.client(check.endpoint).Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to query prometheus: %w", err)
+		return nil, fmt.Errorf("failed to query prometheus: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("prometheus API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prometheus response: %w", err)
 	}
 
+	// Ошибки запроса (400, 422, 503) Prometheus тоже возвращает в JSON с errorType и error
 	var result PrometheusQueryResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return fmt.Errorf("failed to decode prometheus response: %w", err)
+	if err := json.Unmarshal(body, &result); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("prometheus API returned status %d: %s", resp.StatusCode, string(body))
+		}
+		return nil, fmt.Errorf("failed to decode prometheus response: %w", err)
 	}
-
-	if result.Status != "success" {
-		return fmt.Errorf("prometheus query failed with status: %s", result.Status)
+	if result.Status != "success" || resp.StatusCode != http.StatusOK {
+		return nil, &PrometheusAPIError{
+			StatusCode: resp.StatusCode,
+			ErrorType:  result.ErrorType,
+			Message:    result.Error,
+			Warnings:   result.Warnings,
+		}
 	}
+	return &result, nil
+}
+
+// PrometheusAPIError — ошибка, которую вернул Prometheus API
+type PrometheusAPIError struct {
+	StatusCode int
+	ErrorType  string
+	Message    string
+	Warnings   []string
+}
 
-	// Пример простой проверки: считаем, что успешный мониторинг — это когда query вернула не пустой набор данных
-	if len(result.Data.Result) == 0 {
-		return fmt.Errorf("promql query returned no data")
+func (e *PrometheusAPIError) Error() string {
+	msg := fmt.Sprintf("prometheus API returned status %d", e.StatusCode)
+	if e.ErrorType != "" {
+		msg += fmt.Sprintf(": %s", e.ErrorType)
 	}
+	if e.Message != "" {
+		msg += fmt.Sprintf(": %s", e.Message)
+	}
+	if len(e.Warnings) != 0 {
+		msg += fmt.Sprintf(" (warnings: %s)", strings.Join(e.Warnings, "; "))
+	}
+	return msg
+}
 
-	p.logger.Infof("PromQL monitoring check passed for query: %s", query)
-	return nil
+// withWarnings дополняет ошибку проверки предупреждениями Prometheus: они часто объясняют пустой результат
+func withWarnings(err error, warnings []string) error {
+	if len(warnings) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w (warnings: %s)", err, strings.Join(warnings, "; "))
 }
 
-// CheckMonitoring — по сути alias для RunCheck, или можешь добавить дополнительную логику
+// CheckMonitoring проверяет доступность API мониторинга простым запросом
 func (p *PromQLMonitorController) CheckMonitoring(config map[string]string) error {
-	return p.RunCheck(config)
+	meta := make(map[string]string, len(config)+1)
+	for k, v := range config {
+		meta[k] = v
+	}
+	meta["query"] = "vector(1)"
+	return p.RunCheck(meta)
 }
 
 //
@@ -92,16 +259,21 @@ func (p *PromQLMonitorController) CheckMonitoring(config map[string]string) erro
 //
 
 type PrometheusQueryResponse struct {
-	Status string              `json:"status"`
-	Data   PrometheusQueryData `json:"data"`
+	Status    string              `json:"status"`
+	Data      PrometheusQueryData `json:"data"`
+	ErrorType string              `json:"errorType,omitempty"`
+	Error     string              `json:"error,omitempty"`
+	Warnings  []string            `json:"warnings,omitempty"`
 }
 
 type PrometheusQueryData struct {
-	ResultType string                  `json:"resultType"`
-	Result     []PrometheusQueryResult `json:"result"`
+	ResultType string `json:"resultType"`
+	// Формат зависит от ResultType: vector/matrix — []PrometheusQueryResult, scalar/string — [ timestamp, value ]
+	Result json.RawMessage `json:"result"`
 }
 
 type PrometheusQueryResult struct {
 	Metric map[string]string `json:"metric"`
-	Value  [2]interface{}    `json:"value"` // [ timestamp, value ]
+	Value  [2]interface{}    `json:"value"`  // [ timestamp, value ] для vector
+	Values [][2]interface{}  `json:"values"` // [ [ timestamp, value ], ... ] для matrix
 }
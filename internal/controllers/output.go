@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TaskOutput — куда контроллер пишет вывод команды задачи
+type TaskOutput struct {
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// OutputRunner — контроллер, умеющий отдавать вывод команды задачи.
+// Обработчик задач вызывает RunTaskOutput вместо RunTask, если контроллер его реализует.
+type OutputRunner interface {
+	RunTaskOutput(taskMeta map[string]string, componentMeta map[string]string, output TaskOutput) error
+}
+
+// RunTaskLogged — RunTask поверх RunTaskOutput для вызовов без обработчика задач:
+// вывод собирается в память и пишется в журнал, stderr — только при ошибке.
+// kind открывает сообщения журнала, например "SSH" или "Plugin deploy".
+func RunTaskLogged(logger *logrus.Logger, kind string, runner OutputRunner, taskMeta, componentMeta map[string]string) error {
+	var stdout, stderr bytes.Buffer
+	if err := runner.RunTaskOutput(taskMeta, componentMeta, TaskOutput{Stdout: &stdout, Stderr: &stderr}); err != nil {
+		if stderr.Len() != 0 {
+			logger.Errorf("%s task %s failed: %s", kind, taskMeta["id"], stderr.String())
+		}
+		return err
+	}
+	logger.Infof("%s task %s output:\n%s", kind, taskMeta["id"], stdout.String())
+	return nil
+}
+
+// ExitError — команда задачи завершилась с ненулевым кодом
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode возвращает код завершения команды из ошибки RunTaskOutput
+func ExitCode(err error) (int, bool) {
+	if err == nil {
+		return 0, true
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code, true
+	}
+	return 0, false
+}
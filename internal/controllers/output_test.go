@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// testLogger — журнал контроллеров в тестах, вывод отбрасывается
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// scriptedRunner пишет заданный вывод и возвращает err
+type scriptedRunner struct {
+	stdout, stderr string
+	err            error
+}
+
+func (r scriptedRunner) RunTaskOutput(taskMeta map[string]string, componentMeta map[string]string, output TaskOutput) error {
+	fmt.Fprint(output.Stdout, r.stdout)
+	fmt.Fprint(output.Stderr, r.stderr)
+	return r.err
+}
+
+func TestRunTaskLogged(t *testing.T) {
+	var log bytes.Buffer
+	logger := testLogger()
+	logger.SetOutput(&log)
+	task := map[string]string{"id": "t1"}
+
+	if err := RunTaskLogged(logger, "Exec", scriptedRunner{stdout: "done", stderr: "noise"}, task, nil); err != nil {
+		t.Fatalf("RunTaskLogged: %v", err)
+	}
+	if out := log.String(); !strings.Contains(out, `Exec task t1 output:\ndone`) || strings.Contains(out, "noise") {
+		t.Errorf("log after success = %s", out)
+	}
+
+	log.Reset()
+	runErr := &ExitError{Code: 2, Err: errors.New("exit status 2")}
+	err := RunTaskLogged(logger, "Exec", scriptedRunner{stdout: "partial", stderr: "disk full", err: runErr}, task, nil)
+	if !errors.Is(err, runErr) {
+		t.Fatalf("RunTaskLogged = %v, want the runner error", err)
+	}
+	if out := log.String(); !strings.Contains(out, "Exec task t1 failed: disk full") || strings.Contains(out, "partial") {
+		t.Errorf("log after failure = %s", out)
+	}
+}
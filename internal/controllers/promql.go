@@ -0,0 +1,401 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	RUS: Условие PromQL-проверки. Задаётся метаданными проверки:
+		operator    — <, <=, ==, !=, >, >=
+		threshold   — число, с которым сравнивается значение ряда
+		aggregation — all (по умолчанию), any или none: сколько рядов должны удовлетворять условию
+	Без operator проверка успешна, если запрос вернул непустой результат.
+	ENG: PromQL check condition, configured by the check metadata (see above).
+	Without an operator the check passes when the query returns any data.
+*/
+
+const (
+	AggregationAll  = "all"
+	AggregationAny  = "any"
+	AggregationNone = "none"
+)
+
+// maxReportedSeries — сколько рядов перечислять в сообщении о непройденной проверке
+const maxReportedSeries = 5
+
+type promCondition struct {
+	operator    string
+	threshold   float64
+	aggregation string
+}
+
+func parsePromCondition(meta map[string]string) (*promCondition, error) {
+	operator := strings.TrimSpace(meta["operator"])
+	aggregation := strings.ToLower(strings.TrimSpace(meta["aggregation"]))
+	threshold := strings.TrimSpace(meta["threshold"])
+
+	if operator == "" {
+		if threshold != "" {
+			return nil, fmt.Errorf("threshold %q requires an operator", threshold)
+		}
+		if aggregation != "" {
+			return nil, fmt.Errorf("aggregation %q requires an operator", aggregation)
+		}
+		return nil, nil
+	}
+
+	switch operator {
+	case "<", "<=", "==", "!=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("unknown operator %q (expected <, <=, ==, !=, >, >=)", operator)
+	}
+	if threshold == "" {
+		return nil, fmt.Errorf("operator %q requires a threshold", operator)
+	}
+	value, err := strconv.ParseFloat(threshold, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid threshold %q: %w", threshold, err)
+	}
+	switch aggregation {
+	case "":
+		aggregation = AggregationAll
+	case AggregationAll, AggregationAny, AggregationNone:
+	default:
+		return nil, fmt.Errorf("unknown aggregation %q (expected all, any or none)", aggregation)
+	}
+
+	return &promCondition{operator: operator, threshold: value, aggregation: aggregation}, nil
+}
+
+func (c *promCondition) match(value float64) bool {
+	switch c.operator {
+	case "<":
+		return value < c.threshold
+	case "<=":
+		return value <= c.threshold
+	case "==":
+		return value == c.threshold
+	case "!=":
+		return value != c.threshold
+	case ">":
+		return value > c.threshold
+	case ">=":
+		return value >= c.threshold
+	}
+	return false
+}
+
+func (c *promCondition) String() string {
+	return fmt.Sprintf("value %s %s", c.operator, strconv.FormatFloat(c.threshold, 'g', -1, 64))
+}
+
+// promSeries — ряд результата запроса с его значениями (у matrix их несколько)
+type promSeries struct {
+	metric map[string]string
+	values []float64
+}
+
+func (s promSeries) String() string {
+	values := make([]string, len(s.values))
+	for i, v := range s.values {
+		values[i] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprintf("%s = %s", formatMetric(s.metric), strings.Join(values, ", "))
+}
+
+// evaluate проверяет условие по рядам результата.
+// Ряд matrix удовлетворяет условию, только если ему удовлетворяют все его значения.
+func (c *promCondition) evaluate(series []promSeries) error {
+	var matched, failed []promSeries
+	for _, s := range series {
+		ok := len(s.values) != 0
+		for _, v := range s.values {
+			if !c.match(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matched = append(matched, s)
+		} else {
+			failed = append(failed, s)
+		}
+	}
+
+	switch c.aggregation {
+	case AggregationAll:
+		if len(series) == 0 {
+			return fmt.Errorf("promql query returned no data, expected %s", c)
+		}
+		if len(failed) != 0 {
+			return fmt.Errorf("%d of %d series do not satisfy %s: %s", len(failed), len(series), c, formatSeries(failed))
+		}
+	case AggregationAny:
+		if len(matched) == 0 {
+			if len(series) == 0 {
+				return fmt.Errorf("promql query returned no data, expected any series with %s", c)
+			}
+			return fmt.Errorf("no series satisfy %s: %s", c, formatSeries(failed))
+		}
+	case AggregationNone:
+		if len(matched) != 0 {
+			return fmt.Errorf("%d of %d series satisfy %s, expected none: %s", len(matched), len(series), c, formatSeries(matched))
+		}
+	}
+	return nil
+}
+
+// parsePromSeries разбирает data.result в зависимости от resultType
+func parsePromSeries(data PrometheusQueryData) ([]promSeries, error) {
+	switch data.ResultType {
+	case "vector":
+		var results []PrometheusQueryResult
+		if err := json.Unmarshal(data.Result, &results); err != nil {
+			return nil, fmt.Errorf("failed to decode vector result: %w", err)
+		}
+		series := make([]promSeries, 0, len(results))
+		for _, r := range results {
+			v, err := sampleValue(r.Value)
+			if err != nil {
+				return nil, err
+			}
+			series = append(series, promSeries{metric: r.Metric, values: []float64{v}})
+		}
+		return series, nil
+	case "matrix":
+		var results []PrometheusQueryResult
+		if err := json.Unmarshal(data.Result, &results); err != nil {
+			return nil, fmt.Errorf("failed to decode matrix result: %w", err)
+		}
+		series := make([]promSeries, 0, len(results))
+		for _, r := range results {
+			s := promSeries{metric: r.Metric, values: make([]float64, 0, len(r.Values))}
+			for _, sample := range r.Values {
+				v, err := sampleValue(sample)
+				if err != nil {
+					return nil, err
+				}
+				s.values = append(s.values, v)
+			}
+			series = append(series, s)
+		}
+		return series, nil
+	case "scalar":
+		var sample [2]interface{}
+		if err := json.Unmarshal(data.Result, &sample); err != nil {
+			return nil, fmt.Errorf("failed to decode scalar result: %w", err)
+		}
+		v, err := sampleValue(sample)
+		if err != nil {
+			return nil, err
+		}
+		return []promSeries{{values: []float64{v}}}, nil
+	case "string":
+		return nil, fmt.Errorf("string results can not be compared")
+	}
+	return nil, fmt.Errorf("unknown result type %q", data.ResultType)
+}
+
+// sampleValue извлекает значение из пары [ timestamp, "value" ]
+func sampleValue(sample [2]interface{}) (float64, error) {
+	raw, ok := sample[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected sample value %v", sample[1])
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sample value %q: %w", raw, err)
+	}
+	return v, nil
+}
+
+func formatSeries(series []promSeries) string {
+	parts := make([]string, 0, maxReportedSeries+1)
+	for i, s := range series {
+		if i == maxReportedSeries {
+			parts = append(parts, fmt.Sprintf("and %d more", len(series)-maxReportedSeries))
+			break
+		}
+		parts = append(parts, s.String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+func formatMetric(metric map[string]string) string {
+	if len(metric) == 0 {
+		return "{}"
+	}
+	name := metric["__name__"]
+	labels := make([]string, 0, len(metric))
+	for k, v := range metric {
+		if k != "__name__" {
+			labels = append(labels, fmt.Sprintf("%s=%q", k, v))
+		}
+	}
+	sort.Strings(labels)
+	return name + "{" + strings.Join(labels, ", ") + "}"
+}
+
+/*
+	RUS: Параметры PromQL-проверки из метаданных:
+		query                — выражение PromQL (обязательно)
+		time                 — момент вычисления instant-запроса (now, now-5m, RFC3339 или unix-время)
+		start / end / step   — range-запрос (query_range): start и end задаются как now, now-5m,
+		                       RFC3339 или unix-время; end по умолчанию now, step по умолчанию 15s
+		for                  — условие должно непрерывно выполняться указанное время:
+		                       запрос повторяется каждые poll_interval (по умолчанию 15s)
+		for_timeout          — сколько ждать выполнения условия в режиме for (по умолчанию 2 × for);
+		                       check_timeout проверки ограничивает всю проверку со всеми попытками
+		timeout              — таймаут одного запроса к Prometheus (по умолчанию 10s),
+		                       передаётся и как параметр timeout вычисления запроса
+	ENG: PromQL check parameters taken from the check metadata (see above).
+*/
+
+const (
+	DefaultPromQueryTimeout = 10 * time.Second
+	DefaultPromStep         = 15 * time.Second
+	DefaultPromPollInterval = 15 * time.Second
+)
+
+type promCheck struct {
+	query     string
+	condition *promCondition
+	timeout   time.Duration
+	endpoint  *httpEndpoint
+
+	// момент вычисления instant-запроса
+	time string
+
+	// range-запрос, если start задан
+	start, end string
+	step       time.Duration
+
+	// режим for: условие должно держаться hold подряд
+	hold         time.Duration
+	pollInterval time.Duration
+	forTimeout   time.Duration
+}
+
+func parsePromCheck(meta map[string]string) (*promCheck, error) {
+	check := &promCheck{
+		query:        meta["query"],
+		timeout:      DefaultPromQueryTimeout,
+		step:         DefaultPromStep,
+		pollInterval: DefaultPromPollInterval,
+	}
+	if check.query == "" {
+		return nil, fmt.Errorf("promql query is required")
+	}
+
+	condition, err := parsePromCondition(meta)
+	if err != nil {
+		return nil, err
+	}
+	check.condition = condition
+
+	durations := []struct {
+		key   string
+		value *time.Duration
+	}{
+		{"timeout", &check.timeout},
+		{"step", &check.step},
+		{"for", &check.hold},
+		{"poll_interval", &check.pollInterval},
+		{"for_timeout", &check.forTimeout},
+	}
+	for _, d := range durations {
+		raw := meta[d.key]
+		if raw == "" {
+			continue
+		}
+		v, err := time.ParseDuration(raw)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid %s %q: must be a positive duration", d.key, raw)
+		}
+		*d.value = v
+	}
+
+	check.time = meta["time"]
+	if check.time != "" {
+		if _, err := parseTimeSpec(check.time, time.Now()); err != nil {
+			return nil, fmt.Errorf("invalid time: %w", err)
+		}
+	}
+
+	check.start, check.end = meta["start"], meta["end"]
+	if check.start != "" && check.time != "" {
+		return nil, fmt.Errorf("time can not be combined with start/end")
+	}
+	if check.start == "" && check.end != "" {
+		return nil, fmt.Errorf("end %q requires start", check.end)
+	}
+	if check.start != "" {
+		if check.end == "" {
+			check.end = "now"
+		}
+		now := time.Now()
+		start, err := parseTimeSpec(check.start, now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start: %w", err)
+		}
+		end, err := parseTimeSpec(check.end, now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end: %w", err)
+		}
+		if !start.Before(end) {
+			return nil, fmt.Errorf("start %q must be before end %q", check.start, check.end)
+		}
+	}
+
+	if check.hold > 0 {
+		if check.forTimeout == 0 {
+			check.forTimeout = 2 * check.hold
+		}
+		if check.forTimeout < check.hold {
+			return nil, fmt.Errorf("for_timeout %s is shorter than for %s", check.forTimeout, check.hold)
+		}
+		if check.pollInterval > check.hold {
+			check.pollInterval = check.hold
+		}
+	}
+	return check, nil
+}
+
+// isRange — проверка выполняется range-запросом
+func (c *promCheck) isRange() bool {
+	return c.start != ""
+}
+
+// parseTimeSpec разбирает момент времени: now, now-5m, now+1m, RFC3339 или unix-время в секундах
+func parseTimeSpec(spec string, now time.Time) (time.Time, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "now" {
+		return now, nil
+	}
+	if rest, ok := strings.CutPrefix(spec, "now"); ok {
+		offset, err := time.ParseDuration(rest)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid relative time %q", spec)
+		}
+		return now.Add(offset), nil
+	}
+	if t, err := time.Parse(time.RFC3339, spec); err == nil {
+		return t, nil
+	}
+	if unix, err := strconv.ParseFloat(spec, 64); err == nil {
+		sec, frac := math.Modf(unix)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (expected now, now-<duration>, RFC3339 or unix time)", spec)
+}
+
+// formatPromTime — время в формате параметров Prometheus API (unix-секунды)
+func formatPromTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 3, 64)
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+/*
+	RUS: Подключение к Prometheus-совместимому API берётся из Monitoring.Config в формате httpEndpoint
+	(см. endpoint.go); url — базовый URL API, например http://prometheus:9090/api/v1.
+	tenant_id / tenant_header задают арендатора Thanos/Cortex/Mimir/VictoriaMetrics.
+	ENG: Prometheus-compatible API connection settings taken from Monitoring.Config (see endpoint.go).
+*/
+
+// Параметры длиннее отправляются POST-формой
+const maxGetQueryLength = 2048
+
+// newRequest создаёт запрос к методу API с заголовками и авторизацией подключения.
+// Длинные запросы отправляются POST-формой: URL ограничен по длине у прокси и самого Prometheus.
+func (ep *httpEndpoint) newRequest(ctx context.Context, method string, params url.Values) (*http.Request, error) {
+	encoded := params.Encode()
+	endpoint := ep.url + "/" + method
+
+	var req *http.Request
+	var err error
+	if len(encoded) > maxGetQueryLength {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(encoded))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+encoded, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ep.authorize(req)
+	return req, nil
+}
+
+// client возвращает общий HTTP-клиент подключения
+func (p *PromQLMonitorController) client(ep *httpEndpoint) *http.Client {
+	key := ep.clientKey()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if client, ok := p.clients[key]; ok {
+		return client
+	}
+	client := newEndpointClient(ep.tlsConfig)
+	p.clients[key] = client
+	return client
+}
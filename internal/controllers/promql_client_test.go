@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPromQLLongQueryUsesPost(t *testing.T) {
+	prom, p := newFakePrometheus(t, promVector(map[string]string{"a": "1"}))
+
+	long := "up{instance=~\"" + strings.Repeat("host-0|", maxGetQueryLength/len("host-0|")+1) + "host-1\"}"
+	for _, query := range []string{"up", long} {
+		if err := p.RunCheck(map[string]string{"query": query}); err != nil {
+			t.Fatalf("RunCheck: %v", err)
+		}
+	}
+	reqs := prom.received()
+	if len(reqs) != 2 {
+		t.Fatalf("got %d requests, want 2", len(reqs))
+	}
+	if reqs[0].method != http.MethodGet || reqs[0].form["query"] != "up" {
+		t.Errorf("short query sent as %s with query %q, want GET", reqs[0].method, reqs[0].form["query"])
+	}
+	if reqs[1].method != http.MethodPost || reqs[1].path != "/query" || reqs[1].form["query"] != long {
+		t.Errorf("long query sent as %s %s, want a POST form with the full query", reqs[1].method, reqs[1].path)
+	}
+}
+
+func TestPromQLAPIError(t *testing.T) {
+	prom, p := newFakePrometheus(t, `{"status":"error","errorType":"bad_data","error":"parse error at char 4","warnings":["partial response"]}`)
+	prom.status = http.StatusBadRequest
+
+	err := p.RunCheck(map[string]string{"query": "up{"})
+	var apiErr *PrometheusAPIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("RunCheck error = %v, want PrometheusAPIError", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || apiErr.ErrorType != "bad_data" || apiErr.Message != "parse error at char 4" {
+		t.Errorf("API error = %+v", apiErr)
+	}
+	if want := "prometheus API returned status 400: bad_data: parse error at char 4 (warnings: partial response)"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
+
+func TestPromQLNonJSONError(t *testing.T) {
+	prom, p := newFakePrometheus(t, "upstream unavailable")
+	prom.status = http.StatusBadGateway
+
+	err := p.RunCheck(map[string]string{"query": "up"})
+	if err == nil || err.Error() != "prometheus API returned status 502: upstream unavailable" {
+		t.Fatalf("RunCheck error = %v, want the status and body", err)
+	}
+}
+
+func TestPromQLWarningsExplainFailure(t *testing.T) {
+	_, p := newFakePrometheus(t, `{"status":"success","data":{"resultType":"vector","result":[]},"warnings":["store gateway timed out"]}`)
+
+	err := p.RunCheck(map[string]string{"query": "up"})
+	if err == nil || !strings.Contains(err.Error(), "returned no data (warnings: store gateway timed out)") {
+		t.Fatalf("RunCheck error = %v, want the warnings appended", err)
+	}
+}
@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// promRequest — запрос, который получил fakePrometheus
+type promRequest struct {
+	method string
+	path   string
+	form   map[string]string
+}
+
+// fakePrometheus отдаёт ответы по порядку, последний — на все следующие запросы
+type fakePrometheus struct {
+	mu        sync.Mutex
+	status    int
+	responses []string
+	requests  []promRequest
+}
+
+func newFakePrometheus(t *testing.T, responses ...string) (*fakePrometheus, *PromQLMonitorController) {
+	prom := &fakePrometheus{status: http.StatusOK, responses: responses}
+	srv := httptest.NewServer(prom)
+	t.Cleanup(srv.Close)
+
+	return prom, NewPromQLMonitorController(context.Background(), testLogger(), srv.URL)
+}
+
+func (p *fakePrometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	req := promRequest{method: r.Method, path: r.URL.Path, form: make(map[string]string)}
+	for key := range r.Form {
+		req.form[key] = r.Form.Get(key)
+	}
+
+	p.mu.Lock()
+	n := len(p.requests)
+	p.requests = append(p.requests, req)
+	p.mu.Unlock()
+
+	if n >= len(p.responses) {
+		n = len(p.responses) - 1
+	}
+	w.WriteHeader(p.status)
+	io.WriteString(w, p.responses[n])
+}
+
+func (p *fakePrometheus) received() []promRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]promRequest(nil), p.requests...)
+}
+
+// promVector — ответ instant-запроса с рядами instance=<имя> и их значениями
+func promVector(values map[string]string) string {
+	results := make([]string, 0, len(values))
+	for instance, value := range values {
+		results = append(results, `{"metric":{"__name__":"up","instance":"`+instance+`"},"value":[1700000000,"`+value+`"]}`)
+	}
+	return `{"status":"success","data":{"resultType":"vector","result":[` + strings.Join(results, ",") + `]}}`
+}
+
+func TestPromConditionParse(t *testing.T) {
+	tests := []struct {
+		meta map[string]string
+		err  string
+	}{
+		{meta: map[string]string{}},
+		{meta: map[string]string{"operator": ">=", "threshold": "0.99", "aggregation": "ANY"}},
+		{meta: map[string]string{"operator": "=>", "threshold": "1"}, err: `unknown operator "=>"`},
+		{meta: map[string]string{"operator": ">"}, err: `operator ">" requires a threshold`},
+		{meta: map[string]string{"threshold": "1"}, err: `threshold "1" requires an operator`},
+		{meta: map[string]string{"aggregation": "any"}, err: `aggregation "any" requires an operator`},
+		{meta: map[string]string{"operator": "<", "threshold": "fast"}, err: `invalid threshold "fast"`},
+		{meta: map[string]string{"operator": "<", "threshold": "1", "aggregation": "most"}, err: `unknown aggregation "most"`},
+	}
+	for _, tt := range tests {
+		_, err := parsePromCondition(tt.meta)
+		if tt.err == "" && err != nil {
+			t.Errorf("%v: unexpected error %v", tt.meta, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%v: error = %v, want %q", tt.meta, err, tt.err)
+		}
+	}
+}
+
+func TestPromConditionAggregation(t *testing.T) {
+	series := []promSeries{
+		{metric: map[string]string{"instance": "a"}, values: []float64{0.01}},
+		{metric: map[string]string{"instance": "b"}, values: []float64{0.2}},
+	}
+	tests := []struct {
+		aggregation string
+		series      []promSeries
+		err         string
+	}{
+		{aggregation: AggregationAll, series: series, err: `1 of 2 series do not satisfy value < 0.05: {instance="b"} = 0.2`},
+		{aggregation: AggregationAll, series: series[:1]},
+		{aggregation: AggregationAll, err: "returned no data"},
+		{aggregation: AggregationAny, series: series},
+		{aggregation: AggregationAny, series: series[1:], err: "no series satisfy value < 0.05"},
+		{aggregation: AggregationNone, series: series, err: "1 of 2 series satisfy value < 0.05, expected none"},
+		{aggregation: AggregationNone, series: series[1:]},
+		{aggregation: AggregationNone},
+	}
+	for _, tt := range tests {
+		condition := &promCondition{operator: "<", threshold: 0.05, aggregation: tt.aggregation}
+		err := condition.evaluate(tt.series)
+		if tt.err == "" && err != nil {
+			t.Errorf("%s over %d series: unexpected error %v", tt.aggregation, len(tt.series), err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s over %d series: error = %v, want %q", tt.aggregation, len(tt.series), err, tt.err)
+		}
+	}
+}
+
+func TestPromQLCheckComparesVector(t *testing.T) {
+	_, p := newFakePrometheus(t, promVector(map[string]string{"a": "1", "b": "0"}))
+
+	meta := map[string]string{"query": "up", "operator": "==", "threshold": "1"}
+	err := p.RunCheck(meta)
+	if err == nil || !strings.Contains(err.Error(), `up{instance="b"} = 0`) {
+		t.Fatalf("RunCheck error = %v, want the failing series reported", err)
+	}
+
+	meta["aggregation"] = AggregationAny
+	if err := p.RunCheck(meta); err != nil {
+		t.Fatalf("RunCheck with any: %v", err)
+	}
+}
+
+func TestPromQLRangeQuery(t *testing.T) {
+	matrix := `{"status":"success","data":{"resultType":"matrix","result":[` +
+		`{"metric":{"instance":"a"},"values":[[1700000000,"0.01"],[1700000060,"0.3"],[1700000120,"0.02"]]}]}}`
+	prom, p := newFakePrometheus(t, matrix)
+
+	err := p.RunCheck(map[string]string{"query": "error_rate", "start": "now-5m", "step": "1m", "operator": "<", "threshold": "0.05"})
+	if err == nil || !strings.Contains(err.Error(), `{instance="a"} = 0.01, 0.3, 0.02`) {
+		t.Fatalf("RunCheck error = %v, want the series failed by one of its values", err)
+	}
+	reqs := prom.received()
+	if len(reqs) != 1 || reqs[0].path != "/query_range" {
+		t.Fatalf("requests = %+v, want one query_range", reqs)
+	}
+	if form := reqs[0].form; form["step"] != "1m0s" || form["start"] == "" || form["end"] == "" || form["start"] >= form["end"] {
+		t.Errorf("range params = %v", form)
+	}
+
+	for _, meta := range []map[string]string{
+		{"query": "up", "start": "now", "end": "now-5m"},
+		{"query": "up", "end": "now"},
+		{"query": "up", "start": "now-5m", "time": "now"},
+	} {
+		if err := p.ValidateCheck(meta); err == nil {
+			t.Errorf("ValidateCheck(%v) succeeded, want an error", meta)
+		}
+	}
+}
+
+func TestPromQLForWaitsForUnbrokenWindow(t *testing.T) {
+	ok, bad := promVector(map[string]string{"a": "1"}), promVector(map[string]string{"a": "0"})
+	prom, p := newFakePrometheus(t, ok, bad, ok)
+
+	meta := map[string]string{"query": "up", "operator": "==", "threshold": "1", "for": "150ms", "poll_interval": "50ms", "for_timeout": "2s"}
+	if err := p.RunCheck(meta); err != nil {
+		t.Fatalf("RunCheck: %v", err)
+	}
+	// Окно начинается заново после неудачного второго запроса: 150ms набираются не раньше пятого
+	if n := len(prom.received()); n < 5 {
+		t.Errorf("condition held after %d requests, want the window restarted after the broken one", n)
+	}
+}
+
+func TestPromQLForStopsOnShutdown(t *testing.T) {
+	_, p := newFakePrometheus(t, promVector(map[string]string{"a": "0"}))
+	ctx, cancel := context.WithCancel(context.Background())
+	p.ctx = ctx
+	time.AfterFunc(30*time.Millisecond, cancel)
+
+	meta := map[string]string{"query": "up", "operator": "==", "threshold": "1", "for": "1s", "poll_interval": "500ms", "for_timeout": "1m"}
+	start := time.Now()
+	err := p.RunCheck(meta)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("RunCheck error = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("RunCheck returned %s after cancel, want without waiting for poll_interval", elapsed)
+	}
+}
+
+func TestPromQLForTimeout(t *testing.T) {
+	_, p := newFakePrometheus(t, promVector(map[string]string{"a": "0"}))
+
+	meta := map[string]string{"query": "up", "operator": "==", "threshold": "1", "for": "100ms", "poll_interval": "20ms", "for_timeout": "150ms"}
+	err := p.RunCheck(meta)
+	if err == nil || !strings.Contains(err.Error(), "condition did not hold for 100ms within 150ms") || !strings.Contains(err.Error(), `up{instance="a"} = 0`) {
+		t.Fatalf("RunCheck error = %v, want for_timeout with the last failure", err)
+	}
+
+	meta["for_timeout"] = "50ms"
+	if err := p.ValidateCheck(meta); err == nil || !strings.Contains(err.Error(), "shorter than for") {
+		t.Errorf("ValidateCheck error = %v, want for_timeout shorter than for rejected", err)
+	}
+}
@@ -0,0 +1,385 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+/*
+	RUS: Подключение SSH-компонента задаётся его метаданными:
+		host, port (по умолчанию 22), user
+		password             — пароль (необязателен, если задан другой способ)
+		private_key          — приватный ключ в PEM
+		private_key_file     — путь к приватному ключу
+		passphrase           — пароль ключа
+		agent                — true: ключи из ssh-agent (SSH_AUTH_SOCK)
+		forward_agent        — true: пробросить ssh-agent в сессию задачи
+		keyboard_interactive — true: отвечать паролем на запросы keyboard-interactive
+		proxy_jump, jump.<N>.* — подключение через jump-хосты (см. ssh_jump.go)
+	ENG: SSH component connection settings taken from the component metadata (see above).
+*/
+
+const (
+	DefaultSSHPort        = "22"
+	DefaultSSHDialTimeout = 5 * time.Second
+)
+
+// sshTarget — параметры подключения к SSH-компоненту
+type sshTarget struct {
+	address string
+	config  *ssh.ClientConfig
+	// Сокет ssh-agent и соединение с ним, открытое при первой аутентификации
+	agentSock   string
+	agentMu     sync.Mutex
+	agentConn   net.Conn
+	agentClient agent.ExtendedAgent
+	forward     bool
+	// Jump-хосты в порядке подключения (см. ssh_jump.go)
+	jumps []*sshTarget
+	// Учётные данные и настройки проверки ключа хоста: соединение в пуле достаётся
+	// только компонентам с теми же значениями (см. key)
+	identity []string
+	// Ключ HMAC отпечатка identity (см. sshIdentityKey)
+	identityKey []byte
+}
+
+var (
+	identityKeyOnce sync.Once
+	identityKey     []byte
+	identityKeyErr  error
+)
+
+// sshIdentityKey — ключ HMAC отпечатков учётных данных в ключах пула: ключи попадают в логи,
+// а простой хеш пароля можно подобрать. Создаётся при первом разборе метаданных компонента.
+func sshIdentityKey() ([]byte, error) {
+	identityKeyOnce.Do(func() {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			identityKeyErr = fmt.Errorf("failed to generate ssh identity key: %w", err)
+			return
+		}
+		identityKey = key
+	})
+	return identityKey, identityKeyErr
+}
+
+func (t *sshTarget) Close() {
+	t.agentMu.Lock()
+	if t.agentConn != nil {
+		t.agentConn.Close()
+		t.agentConn, t.agentClient = nil, nil
+	}
+	t.agentMu.Unlock()
+	closeTargets(t.jumps)
+}
+
+// target проверяет метаданные компонента и собирает параметры подключения вместе с jump-хостами
+func (s *SSHController) target(meta map[string]string) (*sshTarget, error) {
+	target, err := s.parseTarget(meta)
+	if err != nil {
+		return nil, err
+	}
+	target.jumps, err = s.parseJumps(meta)
+	if err != nil {
+		target.Close()
+		return nil, err
+	}
+	return target, nil
+}
+
+func (s *SSHController) parseTarget(meta map[string]string) (*sshTarget, error) {
+	key, err := sshIdentityKey()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := s.parseHostKeyVerifier(meta)
+	if err != nil {
+		return nil, err
+	}
+	target, err := parseSSHTarget(meta, verifier.callback())
+	if err != nil {
+		return nil, err
+	}
+	target.identity = append(target.identity, verifier.identity())
+	target.identityKey = key
+	return target, nil
+}
+
+func parseSSHTarget(meta map[string]string, hostKey ssh.HostKeyCallback) (*sshTarget, error) {
+	host, user := meta["host"], meta["user"]
+	if host == "" {
+		return nil, fmt.Errorf("component host is required")
+	}
+	if user == "" {
+		return nil, fmt.Errorf("component user is required")
+	}
+	port := meta["port"]
+	if port == "" {
+		port = DefaultSSHPort
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return nil, fmt.Errorf("invalid component port %q", port)
+	}
+
+	target := &sshTarget{address: net.JoinHostPort(host, port)}
+	auth, err := target.authMethods(meta)
+	if err != nil {
+		return nil, err
+	}
+	target.config = &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKey,
+		Timeout:         DefaultSSHDialTimeout,
+	}
+	return target, nil
+}
+
+// authMethods собирает способы аутентификации в порядке: ключ, ssh-agent, пароль, keyboard-interactive
+func (t *sshTarget) authMethods(meta map[string]string) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+
+	signer, err := parsePrivateKey(meta)
+	if err != nil {
+		return nil, err
+	}
+	if signer != nil {
+		methods = append(methods, ssh.PublicKeys(signer))
+		t.identity = append(t.identity, "key:"+string(signer.PublicKey().Marshal()))
+	}
+
+	useAgent, err := parseBool(meta, "agent")
+	if err != nil {
+		return nil, err
+	}
+	t.forward, err = parseBool(meta, "forward_agent")
+	if err != nil {
+		return nil, err
+	}
+	if useAgent || t.forward {
+		// Агент подключается только при аутентификации: проверка метаданных соединений не открывает
+		t.agentSock = os.Getenv("SSH_AUTH_SOCK")
+		if t.agentSock == "" {
+			return nil, fmt.Errorf("agent auth requires SSH_AUTH_SOCK to be set for laplasd")
+		}
+		if useAgent {
+			methods = append(methods, ssh.PublicKeysCallback(t.agentSigners))
+			t.identity = append(t.identity, "agent:"+t.agentSock)
+		}
+	}
+
+	password := meta["password"]
+	if password != "" {
+		methods = append(methods, ssh.Password(password))
+		t.identity = append(t.identity, "password:"+password)
+	}
+
+	interactive, err := parseBool(meta, "keyboard_interactive")
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	if interactive {
+		if password == "" {
+			t.Close()
+			return nil, fmt.Errorf("keyboard_interactive auth requires password")
+		}
+		methods = append(methods, ssh.KeyboardInteractive(func(_, _ string, questions []string, _ []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i := range answers {
+				answers[i] = password
+			}
+			return answers, nil
+		}))
+		t.identity = append(t.identity, "keyboard-interactive")
+	}
+
+	if len(methods) == 0 {
+		t.Close()
+		return nil, fmt.Errorf("no SSH auth method configured: set password, private_key, private_key_file or agent=true")
+	}
+	return methods, nil
+}
+
+// agentSigners отдаёт ключи ssh-agent, подключаясь к нему при первом вызове
+func (t *sshTarget) agentSigners() ([]ssh.Signer, error) {
+	t.agentMu.Lock()
+	defer t.agentMu.Unlock()
+
+	if t.agentClient == nil {
+		conn, err := net.Dial("unix", t.agentSock)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+		}
+		t.agentConn, t.agentClient = conn, agent.NewClient(conn)
+	}
+	return t.agentClient.Signers()
+}
+
+// parsePrivateKey читает ключ из private_key или private_key_file; nil, если ключ не задан
+func parsePrivateKey(meta map[string]string) (ssh.Signer, error) {
+	inline, file := meta["private_key"], meta["private_key_file"]
+	if inline == "" && file == "" {
+		if meta["passphrase"] != "" {
+			return nil, fmt.Errorf("passphrase requires private_key or private_key_file")
+		}
+		return nil, nil
+	}
+	if inline != "" && file != "" {
+		return nil, fmt.Errorf("private_key and private_key_file are mutually exclusive")
+	}
+
+	pem := []byte(inline)
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private_key_file: %w", err)
+		}
+		pem = data
+	}
+
+	if passphrase := meta["passphrase"]; passphrase != "" {
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(pem, []byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+		}
+		return signer, nil
+	}
+	signer, err := ssh.ParsePrivateKey(pem)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return nil, fmt.Errorf("private key is passphrase-protected, set passphrase")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return signer, nil
+}
+
+// dial подключается к компоненту, напрямую или через jump-хосты
+func (t *sshTarget) dial() (*ssh.Client, error) {
+	if len(t.jumps) != 0 {
+		return t.dialJumps()
+	}
+	return ssh.Dial("tcp", t.address, t.config)
+}
+
+// key — ключ соединения в пуле. Кроме user@host:port в него входит отпечаток учётных данных
+// и настроек проверки ключа хоста: иначе компонент с неверным паролем или строгой политикой
+// получил бы соединение, открытое другим компонентом. Соединения через разные jump-хосты не смешиваются.
+func (t *sshTarget) key() string {
+	mac := hmac.New(sha256.New, t.identityKey)
+	for _, part := range t.identity {
+		mac.Write([]byte(part))
+		mac.Write([]byte{0})
+	}
+	key := t.config.User + "@" + t.address + "#" + hex.EncodeToString(mac.Sum(nil)[:8])
+	if len(t.jumps) != 0 {
+		via := make([]string, len(t.jumps))
+		for i, jump := range t.jumps {
+			via[i] = jump.key()
+		}
+		key += " via " + strings.Join(via, ",")
+	}
+	return key
+}
+
+// hosts — host:port, к которым открывается соединение: jump-хосты по порядку и сам компонент
+func (t *sshTarget) hosts() []string {
+	hosts := make([]string, 0, len(t.jumps)+1)
+	for _, jump := range t.jumps {
+		hosts = append(hosts, jump.address)
+	}
+	return append(hosts, t.address)
+}
+
+// session открывает сессию на компоненте: через пул, если он задан, иначе на отдельном соединении.
+// С forward_agent соединение всегда отдельное — обработчик агента регистрируется на клиенте один раз.
+func (s *SSHController) session(t *sshTarget) (*ssh.Session, func(), error) {
+	if s.Pool != nil && !t.forward {
+		return s.Pool.Session(t.key(), t.hosts(), t.dial)
+	}
+
+	client, err := t.dial()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to dial SSH: %w", err)
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	release := func() {
+		session.Close()
+		client.Close()
+	}
+	if err := t.forwardAgent(client, session); err != nil {
+		release()
+		return nil, nil, err
+	}
+	return session, release, nil
+}
+
+// output выполняет служебную команду на компоненте и возвращает её stdout; stderr попадает в текст ошибки
+func (s *SSHController) output(t *sshTarget, cmd string) (string, error) {
+	session, release, err := s.session(t)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	if err := session.Run(cmd); err != nil {
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			err = &ExitError{Code: exitErr.ExitStatus(), Err: err}
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.String(), fmt.Errorf("%w: %s", err, msg)
+		}
+		return stdout.String(), err
+	}
+	return stdout.String(), nil
+}
+
+// forwardAgent пробрасывает ssh-agent в сессию, если это включено в метаданных
+func (t *sshTarget) forwardAgent(client *ssh.Client, session *ssh.Session) error {
+	if !t.forward {
+		return nil
+	}
+	if err := agent.ForwardToRemote(client, os.Getenv("SSH_AUTH_SOCK")); err != nil {
+		return fmt.Errorf("failed to forward ssh-agent: %w", err)
+	}
+	if err := agent.RequestAgentForwarding(session); err != nil {
+		return fmt.Errorf("failed to request agent forwarding: %w", err)
+	}
+	return nil
+}
+
+func parseBool(meta map[string]string, key string) (bool, error) {
+	raw := meta[key]
+	if raw == "" {
+		return false, nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: expected true or false", key, raw)
+	}
+	return v, nil
+}
@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+/*
+	RUS: Проверка ключа хоста SSH-компонента. Метаданные компонента:
+		host_key_policy      — strict (по умолчанию), tofu или insecure
+		host_key_fingerprint — закреплённые отпечатки через запятую (SHA256:... или MD5:...)
+		known_hosts          — путь к known_hosts (по умолчанию SSHController.KnownHosts)
+	strict:   ключ должен совпасть с закреплённым отпечатком или записью known_hosts
+	tofu:     как strict, но неизвестный хост доверяется при первом подключении,
+	          и его ключ записывается в HostKeyStore; дальше несовпадение — ошибка
+	insecure: ключ не проверяется
+	ENG: SSH component host key verification, configured by the component metadata (see above).
+*/
+
+const (
+	HostKeyStrict   = "strict"
+	HostKeyTOFU     = "tofu"
+	HostKeyInsecure = "insecure"
+)
+
+// ErrHostKeyMismatch — ключ хоста не совпал с известным: возможна подмена хоста
+var ErrHostKeyMismatch = errors.New("host key mismatch")
+
+// HostKeyStore хранит ключи, которым доверились в режиме tofu (адрес -> ключ в формате authorized_keys)
+type HostKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]string
+	// OnTrust вызывается после записи нового ключа во время handshake и не должен блокироваться
+	OnTrust func()
+}
+
+func NewHostKeyStore() *HostKeyStore {
+	return &HostKeyStore{keys: make(map[string]string)}
+}
+
+func (s *HostKeyStore) lookup(address string) (ssh.PublicKey, bool, error) {
+	s.mu.RLock()
+	line, ok := s.keys[address]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, false, nil
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	if err != nil {
+		return nil, false, fmt.Errorf("stored host key for %s is invalid: %w", address, err)
+	}
+	return key, true, nil
+}
+
+// trust записывает ключ, если для адреса ещё нет ключа; возвращает ранее записанный ключ, если он есть
+func (s *HostKeyStore) trust(address string, key ssh.PublicKey) (string, bool) {
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+
+	s.mu.Lock()
+	if existing, ok := s.keys[address]; ok {
+		s.mu.Unlock()
+		return existing, false
+	}
+	s.keys[address] = line
+	onTrust := s.OnTrust
+	s.mu.Unlock()
+
+	if onTrust != nil {
+		onTrust()
+	}
+	return line, true
+}
+
+// HostKeys возвращает копию всех записанных ключей
+func (s *HostKeyStore) HostKeys() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make(map[string]string, len(s.keys))
+	for address, line := range s.keys {
+		keys[address] = line
+	}
+	return keys
+}
+
+// LoadHostKeys добавляет ранее сохранённые ключи
+func (s *HostKeyStore) LoadHostKeys(keys map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for address, line := range keys {
+		s.keys[address] = line
+	}
+}
+
+// hostKeyVerifier — настройки проверки ключа одного компонента
+type hostKeyVerifier struct {
+	policy       string
+	fingerprints []string
+	knownHosts   ssh.HostKeyCallback
+	// Путь к known_hosts, из которого загружен knownHosts
+	knownHostsFile string
+	store          *HostKeyStore
+	logger         func(format string, args ...interface{})
+}
+
+func (s *SSHController) parseHostKeyVerifier(meta map[string]string) (*hostKeyVerifier, error) {
+	v := &hostKeyVerifier{
+		policy: meta["host_key_policy"],
+		store:  s.HostKeys,
+	}
+	if s.Logger != nil {
+		v.logger = s.Logger.Warnf
+	}
+	if v.policy == "" {
+		v.policy = s.HostKeyPolicy
+	}
+	if v.policy == "" {
+		v.policy = HostKeyStrict
+	}
+	switch v.policy {
+	case HostKeyStrict, HostKeyTOFU, HostKeyInsecure:
+	default:
+		return nil, fmt.Errorf("unknown host_key_policy %q (expected strict, tofu or insecure)", v.policy)
+	}
+	if v.policy == HostKeyInsecure {
+		return v, nil
+	}
+
+	for _, fp := range strings.Split(meta["host_key_fingerprint"], ",") {
+		fp = strings.TrimSpace(fp)
+		if fp == "" {
+			continue
+		}
+		if !strings.HasPrefix(fp, "SHA256:") && !strings.HasPrefix(fp, "MD5:") {
+			return nil, fmt.Errorf("invalid host_key_fingerprint %q: expected SHA256:... or MD5:...", fp)
+		}
+		v.fingerprints = append(v.fingerprints, fp)
+	}
+
+	file := meta["known_hosts"]
+	if file == "" {
+		file = s.KnownHosts
+	}
+	if file != "" {
+		callback, err := knownhosts.New(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known_hosts: %w", err)
+		}
+		v.knownHosts = callback
+		v.knownHostsFile = file
+	}
+
+	if v.policy == HostKeyTOFU && v.store == nil {
+		return nil, fmt.Errorf("host_key_policy tofu is not available: no host key store")
+	}
+	if v.policy == HostKeyStrict && len(v.fingerprints) == 0 && v.knownHosts == nil {
+		return nil, fmt.Errorf("host key verification requires known_hosts or host_key_fingerprint (or host_key_policy tofu/insecure)")
+	}
+	return v, nil
+}
+
+// identity описывает настройки проверки для ключа соединения в пуле
+func (v *hostKeyVerifier) identity() string {
+	return "host_key:" + v.policy + "|" + strings.Join(v.fingerprints, ",") + "|" + v.knownHostsFile
+}
+
+func (v *hostKeyVerifier) callback() ssh.HostKeyCallback {
+	if v.policy == HostKeyInsecure {
+		return ssh.InsecureIgnoreHostKey()
+	}
+	return v.verify
+}
+
+func (v *hostKeyVerifier) verify(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	address := knownhosts.Normalize(hostname)
+
+	// Закреплённые отпечатки имеют приоритет над known_hosts и tofu
+	if len(v.fingerprints) != 0 {
+		sha, md5 := ssh.FingerprintSHA256(key), "MD5:"+ssh.FingerprintLegacyMD5(key)
+		for _, fp := range v.fingerprints {
+			if fp == sha || fp == md5 {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w for %s: got %s, pinned %s", ErrHostKeyMismatch, address, sha, strings.Join(v.fingerprints, ", "))
+	}
+
+	if v.knownHosts != nil {
+		err := v.knownHosts(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		switch {
+		case err == nil:
+			return nil
+		case errors.As(err, &keyErr) && len(keyErr.Want) != 0:
+			want := make([]string, 0, len(keyErr.Want))
+			for _, k := range keyErr.Want {
+				want = append(want, ssh.FingerprintSHA256(k.Key))
+			}
+			sort.Strings(want)
+			return fmt.Errorf("%w for %s: got %s, known_hosts has %s", ErrHostKeyMismatch, address, ssh.FingerprintSHA256(key), strings.Join(want, ", "))
+		case errors.As(err, &keyErr):
+			// Хоста нет в known_hosts: в режиме tofu решает HostKeyStore
+			if v.policy != HostKeyTOFU {
+				return fmt.Errorf("host %s is not in known_hosts (key %s)", address, ssh.FingerprintSHA256(key))
+			}
+		default:
+			return err
+		}
+	}
+
+	if v.policy != HostKeyTOFU {
+		return fmt.Errorf("host key of %s can not be verified", address)
+	}
+
+	known, ok, err := v.store.lookup(address)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if bytes.Equal(known.Marshal(), key.Marshal()) {
+			return nil
+		}
+		return fmt.Errorf("%w for %s: got %s, trusted on first use %s", ErrHostKeyMismatch, address, ssh.FingerprintSHA256(key), ssh.FingerprintSHA256(known))
+	}
+
+	// Параллельное первое подключение могло уже записать ключ
+	line, trusted := v.store.trust(address, key)
+	if !trusted {
+		stored, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil || !bytes.Equal(stored.Marshal(), key.Marshal()) {
+			return fmt.Errorf("%w for %s: got %s", ErrHostKeyMismatch, address, ssh.FingerprintSHA256(key))
+		}
+		return nil
+	}
+	if v.logger != nil {
+		v.logger("SSH: trusting host key %s for %s on first use", ssh.FingerprintSHA256(key), address)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// writeKnownHosts записывает known_hosts с ключом key для адреса address
+func writeKnownHosts(t *testing.T, address string, key ssh.PublicKey) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(address)}, key) + "\n"
+	if err := os.WriteFile(file, []byte(line), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestSSHHostKeyStrict(t *testing.T) {
+	srv := newTestSSHServer(t, testSSHAuth{password: true})
+	other, _ := newTestClientKey(t, "")
+	s := newTestSSHController()
+	meta := func(kv ...string) map[string]string {
+		return srv.meta(append([]string{"password", testSSHPassword, "host_key_policy", HostKeyStrict}, kv...)...)
+	}
+
+	if err := s.ValideComponent(meta()); err == nil || !strings.Contains(err.Error(), "requires known_hosts or host_key_fingerprint") {
+		t.Fatalf("ValideComponent error = %v, want strict policy without known keys rejected", err)
+	}
+	if err := s.ValideComponent(meta("host_key_fingerprint", "abc")); err == nil || !strings.Contains(err.Error(), "invalid host_key_fingerprint") {
+		t.Errorf("ValideComponent error = %v, want a fingerprint without a hash prefix rejected", err)
+	}
+
+	if err := s.CheckComponent(meta("host_key_fingerprint", ssh.FingerprintSHA256(srv.hostKey.PublicKey()))); err != nil {
+		t.Fatalf("CheckComponent with pinned fingerprint: %v", err)
+	}
+	if err := s.CheckComponent(meta("host_key_fingerprint", "MD5:"+ssh.FingerprintLegacyMD5(srv.hostKey.PublicKey()))); err != nil {
+		t.Fatalf("CheckComponent with pinned MD5 fingerprint: %v", err)
+	}
+	err := s.CheckComponent(meta("host_key_fingerprint", ssh.FingerprintSHA256(other)))
+	if !errors.Is(err, ErrHostKeyMismatch) {
+		t.Fatalf("CheckComponent error = %v, want host key mismatch for a wrong pinned fingerprint", err)
+	}
+
+	if err := s.CheckComponent(meta("known_hosts", writeKnownHosts(t, srv.addr, srv.hostKey.PublicKey()))); err != nil {
+		t.Fatalf("CheckComponent with known_hosts: %v", err)
+	}
+	err = s.CheckComponent(meta("known_hosts", writeKnownHosts(t, srv.addr, other)))
+	if !errors.Is(err, ErrHostKeyMismatch) {
+		t.Fatalf("CheckComponent error = %v, want host key mismatch against known_hosts", err)
+	}
+	err = s.CheckComponent(meta("known_hosts", writeKnownHosts(t, "elsewhere:22", srv.hostKey.PublicKey())))
+	if err == nil || !strings.Contains(err.Error(), "is not in known_hosts") {
+		t.Fatalf("CheckComponent error = %v, want an unknown host rejected", err)
+	}
+}
+
+func TestSSHHostKeyTOFU(t *testing.T) {
+	srv := newTestSSHServer(t, testSSHAuth{password: true})
+	meta := srv.meta("password", testSSHPassword, "host_key_policy", HostKeyTOFU)
+
+	if err := newTestSSHController().ValideComponent(meta); err == nil || !strings.Contains(err.Error(), "no host key store") {
+		t.Fatalf("ValideComponent error = %v, want tofu without a store rejected", err)
+	}
+
+	s := newTestSSHController()
+	s.HostKeys = NewHostKeyStore()
+	trusted := make(chan struct{}, 1)
+	s.HostKeys.OnTrust = func() { trusted <- struct{}{} }
+
+	if err := s.CheckComponent(meta); err != nil {
+		t.Fatalf("first CheckComponent: %v", err)
+	}
+	select {
+	case <-trusted:
+	default:
+		t.Error("OnTrust was not called for a new host key")
+	}
+	address := knownhosts.Normalize(srv.addr)
+	if line := s.HostKeys.HostKeys()[address]; line != strings.TrimSpace(string(ssh.MarshalAuthorizedKey(srv.hostKey.PublicKey()))) {
+		t.Fatalf("stored key for %s = %q", address, line)
+	}
+	if err := s.CheckComponent(meta); err != nil {
+		t.Fatalf("second CheckComponent: %v", err)
+	}
+	if len(trusted) != 0 {
+		t.Error("OnTrust was called again for a known host key")
+	}
+
+	// Хост сменил ключ после первого подключения
+	other, _ := newTestClientKey(t, "")
+	s.HostKeys.LoadHostKeys(map[string]string{address: string(ssh.MarshalAuthorizedKey(other))})
+	if err := s.CheckComponent(meta); !errors.Is(err, ErrHostKeyMismatch) {
+		t.Fatalf("CheckComponent error = %v, want host key mismatch after the key changed", err)
+	}
+}
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+	RUS: Подключение через jump-хосты (как ssh -J). В метаданных компонента:
+		proxy_jump — цепочка [user@]host[:port] через запятую в порядке подключения
+		jump.<N>.<ключ> — настройки N-го хоста цепочки (с 1): user, port и те же ключи
+			аутентификации и проверки ключа хоста, что у компонента (password, private_key,
+			private_key_file, passphrase, agent, keyboard_interactive, host_key_policy,
+			host_key_fingerprint, known_hosts)
+	Учётные данные компонента на jump-хосты не переносятся: каждый хост задаёт свои.
+	ENG: Jump host chain (like ssh -J) declared by proxy_jump and per-hop jump.<N>.<key> settings (see above).
+*/
+
+const jumpPrefix = "jump."
+
+var jumpKeys = map[string]bool{
+	"user":                 true,
+	"port":                 true,
+	"password":             true,
+	"private_key":          true,
+	"private_key_file":     true,
+	"passphrase":           true,
+	"agent":                true,
+	"keyboard_interactive": true,
+	"host_key_policy":      true,
+	"host_key_fingerprint": true,
+	"known_hosts":          true,
+}
+
+// parseJumps собирает параметры подключения jump-хостов из proxy_jump и jump.<N>.*
+func (s *SSHController) parseJumps(meta map[string]string) ([]*sshTarget, error) {
+	var specs []string
+	for _, spec := range strings.Split(meta["proxy_jump"], ",") {
+		if spec = strings.TrimSpace(spec); spec != "" {
+			specs = append(specs, spec)
+		}
+	}
+
+	hops := make([]map[string]string, len(specs))
+	for i, spec := range specs {
+		hop, err := parseJumpSpec(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy_jump host %d: %w", i+1, err)
+		}
+		hops[i] = hop
+	}
+
+	keys := make([]string, 0)
+	for key := range meta {
+		if strings.HasPrefix(key, jumpPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		index, name, ok := strings.Cut(strings.TrimPrefix(key, jumpPrefix), ".")
+		n, err := strconv.Atoi(index)
+		if !ok || err != nil || !jumpKeys[name] {
+			return nil, fmt.Errorf("invalid jump host setting %q: expected jump.<N>.<key>", key)
+		}
+		if n < 1 || n > len(hops) {
+			return nil, fmt.Errorf("%s refers to jump host %d, but proxy_jump lists %d", key, n, len(hops))
+		}
+		// Пользователь и порт из proxy_jump важнее
+		if _, set := hops[n-1][name]; set && (name == "user" || name == "port") {
+			continue
+		}
+		hops[n-1][name] = meta[key]
+	}
+
+	jumps := make([]*sshTarget, 0, len(hops))
+	for i, hop := range hops {
+		if hop["user"] == "" {
+			closeTargets(jumps)
+			return nil, fmt.Errorf("jump host %d (%s): user is required: set it in proxy_jump or jump.%d.user", i+1, specs[i], i+1)
+		}
+		jump, err := s.parseTarget(hop)
+		if err != nil {
+			closeTargets(jumps)
+			return nil, fmt.Errorf("jump host %d (%s): %w", i+1, specs[i], err)
+		}
+		jumps = append(jumps, jump)
+	}
+	return jumps, nil
+}
+
+// parseJumpSpec разбирает [user@]host[:port]
+func parseJumpSpec(spec string) (map[string]string, error) {
+	hop := make(map[string]string)
+	if user, rest, ok := strings.Cut(spec, "@"); ok {
+		if user == "" {
+			return nil, fmt.Errorf("empty user in %q", spec)
+		}
+		hop["user"] = user
+		spec = rest
+	}
+	host := spec
+	if strings.HasPrefix(spec, "[") || strings.Count(spec, ":") == 1 {
+		h, port, err := net.SplitHostPort(spec)
+		if err != nil {
+			return nil, err
+		}
+		host = h
+		hop["port"] = port
+	}
+	if host == "" {
+		return nil, fmt.Errorf("empty host in %q", spec)
+	}
+	hop["host"] = host
+	return hop, nil
+}
+
+func closeTargets(targets []*sshTarget) {
+	for _, t := range targets {
+		t.Close()
+	}
+}
+
+// dialJumps подключается к первому jump-хосту и дальше туннелирует каждое следующее соединение
+// через предыдущее. Промежуточные соединения закрываются вместе с конечным.
+func (t *sshTarget) dialJumps() (*ssh.Client, error) {
+	client, err := ssh.Dial("tcp", t.jumps[0].address, t.jumps[0].config)
+	if err != nil {
+		return nil, fmt.Errorf("jump host %s: %w", t.jumps[0].address, err)
+	}
+	clients := []*ssh.Client{client}
+	closeAll := func() {
+		for i := len(clients) - 1; i >= 0; i-- {
+			clients[i].Close()
+		}
+	}
+
+	hops := append(t.jumps[1:len(t.jumps):len(t.jumps)], t)
+	via := t.jumps[0].address
+	for _, hop := range hops {
+		client, err = hop.dialVia(clients[len(clients)-1])
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("%s via %s: %w", hop.address, via, err)
+		}
+		clients = append(clients, client)
+		via = hop.address
+	}
+
+	go func() {
+		client.Wait()
+		closeAll()
+	}()
+	return client, nil
+}
+
+// dialVia открывает SSH-соединение через туннель в уже подключённом клиенте
+func (t *sshTarget) dialVia(through *ssh.Client) (*ssh.Client, error) {
+	conn, err := through.Dial("tcp", t.address)
+	if err != nil {
+		return nil, err
+	}
+
+	// У туннеля нет дедлайнов: таймаут рукопожатия закрывает соединение
+	timeout := t.config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSSHDialTimeout
+	}
+	timer := time.AfterFunc(timeout, func() { conn.Close() })
+	c, chans, reqs, err := ssh.NewClientConn(conn, t.address, t.config)
+	if !timer.Stop() && err == nil {
+		c.Close()
+		err = fmt.Errorf("ssh handshake timed out after %s", timeout)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
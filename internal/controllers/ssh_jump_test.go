@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseJumpSpec(t *testing.T) {
+	tests := []struct {
+		spec string
+		want map[string]string
+		err  string
+	}{
+		{spec: "bastion", want: map[string]string{"host": "bastion"}},
+		{spec: "ops@bastion:2222", want: map[string]string{"user": "ops", "host": "bastion", "port": "2222"}},
+		{spec: "[::1]:22", want: map[string]string{"host": "::1", "port": "22"}},
+		{spec: "@bastion", err: "empty user"},
+		{spec: "ops@:22", err: "empty host"},
+	}
+	for _, tt := range tests {
+		got, err := parseJumpSpec(tt.spec)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error = %v, want %q", tt.spec, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, %v, want %v", tt.spec, got, err, tt.want)
+		}
+	}
+}
+
+func TestSSHJumpSettings(t *testing.T) {
+	s := newTestSSHController()
+	base := map[string]string{"host": "web", "user": "deploy", "password": "pw", "host_key_policy": HostKeyInsecure, "proxy_jump": "bastion", "jump.1.host_key_policy": HostKeyInsecure}
+	tests := []struct {
+		extra map[string]string
+		err   string
+	}{
+		{extra: map[string]string{"jump.1.user": "ops"}, err: "no SSH auth method configured"},
+		{extra: map[string]string{"jump.1.password": "pw"}, err: "user is required"},
+		{extra: map[string]string{"jump.2.user": "ops"}, err: "refers to jump host 2, but proxy_jump lists 1"},
+		{extra: map[string]string{"jump.1.command": "id"}, err: `invalid jump host setting "jump.1.command"`},
+	}
+	for _, tt := range tests {
+		meta := make(map[string]string)
+		for k, v := range base {
+			meta[k] = v
+		}
+		for k, v := range tt.extra {
+			meta[k] = v
+		}
+		if err := s.ValideComponent(meta); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%v: error = %v, want %q", tt.extra, err, tt.err)
+		}
+	}
+}
+
+func TestSSHProxyJump(t *testing.T) {
+	public, key := newTestClientKey(t, "")
+	target := newTestSSHServer(t, testSSHAuth{key: public})
+	bastion := newTestSSHServer(t, testSSHAuth{password: true})
+	_, bastionPort, _ := net.SplitHostPort(bastion.addr)
+
+	// У jump-хоста свои учётные данные: ключ компонента на него не переносится
+	meta := target.meta(
+		"private_key", key,
+		"proxy_jump", testSSHUser+"@127.0.0.1:"+bastionPort,
+		"jump.1.password", testSSHPassword,
+		"jump.1.host_key_policy", HostKeyInsecure,
+	)
+	if err := newTestSSHController().RunTask(map[string]string{"id": "t1", "type": "deploy", "command": "hostname"}, meta); err != nil {
+		t.Fatalf("RunTask: %v", err)
+	}
+
+	commands, _ := target.recorded()
+	if !reflect.DeepEqual(commands, []string{"hostname"}) {
+		t.Errorf("target ran %v, want the task command", commands)
+	}
+	commands, forwards := bastion.recorded()
+	if len(commands) != 0 || !reflect.DeepEqual(forwards, []string{target.addr}) {
+		t.Errorf("bastion ran %v and forwarded to %v, want only a tunnel to %s", commands, forwards, target.addr)
+	}
+}
@@ -0,0 +1,381 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/laplasd/inforo"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	DefaultSSHMaxConnsPerHost    = 4
+	DefaultSSHMaxSessionsPerConn = 8
+	DefaultSSHIdleTimeout        = 5 * time.Minute
+	DefaultSSHKeepAliveInterval  = 30 * time.Second
+	DefaultSSHPoolWaitTimeout    = 30 * time.Second
+)
+
+var ErrSSHPoolClosed = errors.New("ssh pool is closed")
+
+/*
+	RUS: Пул SSH-соединений. Соединения ключуются по user@host:port вместе с отпечатком учётных
+	данных и настроек проверки ключа хоста (см. sshTarget.key), на одном соединении
+	открывается до MaxSessionsPerConn сессий. MaxConnsPerHost ограничивает соединения
+	к host:port независимо от ключа: соединение через jump-хосты занимает место и на каждом
+	из них. Если лимит хоста занят простаивающими соединениями других ключей, одно из них закрывается.
+	Простаивающие дольше IdleTimeout соединения закрываются, живые проверяются keepalive,
+	порванные соединения выбрасываются из пула и при следующем запросе открываются заново.
+	ENG: SSH connection pool keyed by user@host:port plus a fingerprint of credentials and host key settings;
+	MaxConnsPerHost is enforced per host:port across keys (see above).
+*/
+
+type SSHPoolOptions struct {
+	Logger             *logrus.Logger
+	MaxConnsPerHost    int
+	MaxSessionsPerConn int
+	IdleTimeout        time.Duration
+	KeepAliveInterval  time.Duration
+	// Сколько ждать свободного соединения, если все заняты
+	WaitTimeout time.Duration
+}
+
+type SSHPool struct {
+	opts  SSHPoolOptions
+	mu    sync.Mutex
+	conns map[string][]*pooledConn
+	// Открытые и открываемые соединения на каждый host:port
+	perHost map[string]int
+	// Закрывается и заменяется при каждом освобождении сессии или соединения
+	changed chan struct{}
+	closed  bool
+	stop    chan struct{}
+}
+
+type pooledConn struct {
+	key string
+	// host:port, на которых соединение занимает место: jump-хосты и сам компонент
+	hosts    []string
+	client   *ssh.Client
+	sessions int
+	lastUsed time.Time
+	done     chan struct{}
+}
+
+func NewSSHPool(opts SSHPoolOptions) *SSHPool {
+	if opts.Logger == nil {
+		opts.Logger = inforo.NewNullLogger()
+	}
+	if opts.MaxConnsPerHost <= 0 {
+		opts.MaxConnsPerHost = DefaultSSHMaxConnsPerHost
+	}
+	if opts.MaxSessionsPerConn <= 0 {
+		opts.MaxSessionsPerConn = DefaultSSHMaxSessionsPerConn
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultSSHIdleTimeout
+	}
+	if opts.KeepAliveInterval <= 0 {
+		opts.KeepAliveInterval = DefaultSSHKeepAliveInterval
+	}
+	if opts.WaitTimeout <= 0 {
+		opts.WaitTimeout = DefaultSSHPoolWaitTimeout
+	}
+
+	p := &SSHPool{
+		opts:    opts,
+		conns:   make(map[string][]*pooledConn),
+		perHost: make(map[string]int),
+		changed: make(chan struct{}),
+		stop:    make(chan struct{}),
+	}
+	go p.reap()
+	return p
+}
+
+// Session открывает сессию на соединении из пула; release закрывает сессию и возвращает соединение в пул.
+// hosts — host:port, через которые идёт соединение, для лимита MaxConnsPerHost.
+// Если соединение оказалось порванным, оно выбрасывается и открывается новое.
+func (p *SSHPool) Session(key string, hosts []string, dial func() (*ssh.Client, error)) (*ssh.Session, func(), error) {
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		conn, err := p.acquire(key, hosts, dial)
+		if err != nil {
+			return nil, nil, err
+		}
+		session, err := conn.client.NewSession()
+		if err != nil {
+			p.opts.Logger.Debugf("SSH pool: connection %s is broken, reconnecting: %v", key, err)
+			p.discard(conn)
+			lastErr = err
+			continue
+		}
+		release := func() {
+			session.Close()
+			p.release(conn)
+		}
+		return session, release, nil
+	}
+	return nil, nil, fmt.Errorf("failed to create SSH session: %w", lastErr)
+}
+
+func (p *SSHPool) acquire(key string, hosts []string, dial func() (*ssh.Client, error)) (*pooledConn, error) {
+	deadline := time.NewTimer(p.opts.WaitTimeout)
+	defer deadline.Stop()
+
+	p.mu.Lock()
+	for {
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrSSHPoolClosed
+		}
+
+		// Наименее загруженное соединение со свободным местом под сессию
+		var best *pooledConn
+		for _, conn := range p.conns[key] {
+			if conn.sessions < p.opts.MaxSessionsPerConn && (best == nil || conn.sessions < best.sessions) {
+				best = conn
+			}
+		}
+		if best != nil {
+			best.sessions++
+			p.mu.Unlock()
+			return best, nil
+		}
+
+		if evicted, ok := p.makeRoom(hosts); ok {
+			for _, host := range hosts {
+				p.perHost[host]++
+			}
+			p.mu.Unlock()
+			if evicted != nil {
+				p.closeConn(evicted)
+			}
+			return p.open(key, hosts, dial)
+		}
+
+		wait := p.changed
+		p.mu.Unlock()
+		select {
+		case <-wait:
+		case <-deadline.C:
+			return nil, fmt.Errorf("timed out after %s waiting for a free SSH connection to %s", p.opts.WaitTimeout, key)
+		}
+		p.mu.Lock()
+	}
+}
+
+// makeRoom проверяет, что новое соединение не превысит MaxConnsPerHost ни на одном из hosts.
+// Если мешает только простаивающее соединение, оно убирается из пула и возвращается для закрытия
+// вне блокировки. Вызывается под p.mu.
+func (p *SSHPool) makeRoom(hosts []string) (*pooledConn, bool) {
+	var full []string
+	for _, host := range hosts {
+		if p.perHost[host] >= p.opts.MaxConnsPerHost {
+			full = append(full, host)
+		}
+	}
+	if len(full) == 0 {
+		return nil, true
+	}
+
+	for _, conns := range p.conns {
+		for _, conn := range conns {
+			if conn.sessions == 0 && containsAll(conn.hosts, full) {
+				p.remove(conn)
+				return conn, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func containsAll(hosts, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range hosts {
+			found = found || h == w
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// open подключается вне блокировки пула и добавляет соединение с одной занятой сессией
+func (p *SSHPool) open(key string, hosts []string, dial func() (*ssh.Client, error)) (*pooledConn, error) {
+	client, err := dial()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil || p.closed {
+		p.freeHosts(hosts)
+		p.notify()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.closed {
+		client.Close()
+		return nil, ErrSSHPoolClosed
+	}
+
+	conn := &pooledConn{
+		key:      key,
+		hosts:    hosts,
+		client:   client,
+		sessions: 1,
+		lastUsed: time.Now(),
+		done:     make(chan struct{}),
+	}
+	p.conns[key] = append(p.conns[key], conn)
+	p.opts.Logger.Debugf("SSH pool: opened connection to %s (%d open)", key, len(p.conns[key]))
+
+	go p.keepAlive(conn)
+	go func() {
+		// Wait возвращается, когда соединение закрыто сервером или порвано
+		client.Wait()
+		p.discard(conn)
+	}()
+	return conn, nil
+}
+
+func (p *SSHPool) release(conn *pooledConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conn.sessions--
+	conn.lastUsed = time.Now()
+	p.notify()
+}
+
+// discard убирает соединение из пула и закрывает его; повторный вызов ничего не делает
+func (p *SSHPool) discard(conn *pooledConn) {
+	p.mu.Lock()
+	removed := p.remove(conn)
+	p.mu.Unlock()
+
+	if removed {
+		p.closeConn(conn)
+	}
+}
+
+func (p *SSHPool) closeConn(conn *pooledConn) {
+	conn.client.Close()
+	p.opts.Logger.Debugf("SSH pool: dropped connection to %s", conn.key)
+}
+
+// remove убирает соединение из пула и освобождает его место на хостах; вызывается под p.mu
+func (p *SSHPool) remove(conn *pooledConn) bool {
+	conns := p.conns[conn.key]
+	for i, c := range conns {
+		if c != conn {
+			continue
+		}
+		p.conns[conn.key] = append(conns[:i:i], conns[i+1:]...)
+		if len(p.conns[conn.key]) == 0 {
+			delete(p.conns, conn.key)
+		}
+		p.freeHosts(conn.hosts)
+		close(conn.done)
+		p.notify()
+		return true
+	}
+	return false
+}
+
+// freeHosts освобождает места соединения на хостах; вызывается под p.mu
+func (p *SSHPool) freeHosts(hosts []string) {
+	for _, host := range hosts {
+		if p.perHost[host]--; p.perHost[host] <= 0 {
+			delete(p.perHost, host)
+		}
+	}
+}
+
+// notify будит ожидающих свободное соединение; вызывается под p.mu
+func (p *SSHPool) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+func (p *SSHPool) keepAlive(conn *pooledConn) {
+	ticker := time.NewTicker(p.opts.KeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-conn.done:
+			return
+		case <-ticker.C:
+			if _, _, err := conn.client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+				p.opts.Logger.Debugf("SSH pool: keepalive to %s failed: %v", conn.key, err)
+				p.discard(conn)
+				return
+			}
+		}
+	}
+}
+
+// reap закрывает соединения без сессий, простаивающие дольше IdleTimeout. Соединение убирается
+// из пула под той же блокировкой, под которой проверено, что на нём нет сессий: иначе acquire
+// успел бы открыть на нём сессию до закрытия.
+func (p *SSHPool) reap() {
+	ticker := time.NewTicker(p.opts.IdleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		var idle []*pooledConn
+		p.mu.Lock()
+		for _, conns := range p.conns {
+			for _, conn := range conns {
+				if conn.sessions == 0 && time.Since(conn.lastUsed) > p.opts.IdleTimeout {
+					idle = append(idle, conn)
+				}
+			}
+		}
+		for _, conn := range idle {
+			p.remove(conn)
+		}
+		p.mu.Unlock()
+
+		for _, conn := range idle {
+			p.closeConn(conn)
+		}
+	}
+}
+
+// Close закрывает все соединения; новые сессии после этого не выдаются
+func (p *SSHPool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.stop)
+	var conns []*pooledConn
+	for _, host := range p.conns {
+		conns = append(conns, host...)
+	}
+	for _, conn := range conns {
+		p.remove(conn)
+	}
+	p.notify()
+	p.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.client.Close()
+	}
+}
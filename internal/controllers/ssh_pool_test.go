@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func testSSHDial(srv *testSSHServer) func() (*ssh.Client, error) {
+	return func() (*ssh.Client, error) {
+		return ssh.Dial("tcp", srv.addr, &ssh.ClientConfig{
+			User:            testSSHUser,
+			Auth:            []ssh.AuthMethod{ssh.Password(testSSHPassword)},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		})
+	}
+}
+
+// poolSession открывает сессию пула и выполняет на ней команду, не освобождая её
+func poolSession(t *testing.T, p *SSHPool, srv *testSSHServer, key string) func() {
+	t.Helper()
+	session, release, err := p.Session(key, []string{srv.addr}, testSSHDial(srv))
+	if err != nil {
+		t.Fatalf("Session(%s): %v", key, err)
+	}
+	if err := session.Run("true"); err != nil {
+		t.Fatalf("Run on %s: %v", key, err)
+	}
+	return release
+}
+
+// poolConns возвращает число соединений пула и занятые места на хостах
+func poolConns(p *SSHPool) (conns int, hosts map[string]int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.conns {
+		conns += len(c)
+	}
+	hosts = make(map[string]int, len(p.perHost))
+	for host, n := range p.perHost {
+		hosts[host] = n
+	}
+	return conns, hosts
+}
+
+func TestSSHPoolReusesConnection(t *testing.T) {
+	srv := newTestSSHServer(t, testSSHAuth{password: true})
+	s := newTestSSHController()
+	s.Pool = NewSSHPool(SSHPoolOptions{})
+	defer s.Pool.Close()
+
+	meta := srv.meta("password", testSSHPassword)
+	for i := 0; i < 3; i++ {
+		if err := s.CheckComponent(meta); err != nil {
+			t.Fatalf("CheckComponent: %v", err)
+		}
+	}
+	if n := srv.handshakes(); n != 1 {
+		t.Errorf("%d connections opened, want one reused", n)
+	}
+
+	// Другие учётные данные — другой ключ пула, даже на том же user@host:port
+	if err := s.CheckComponent(srv.meta("password", testSSHPassword, "keyboard_interactive", "true")); err != nil {
+		t.Fatalf("CheckComponent: %v", err)
+	}
+	if n := srv.handshakes(); n != 2 {
+		t.Errorf("%d connections opened, want a separate one for other credentials", n)
+	}
+}
+
+func TestSSHPoolSessionsPerConn(t *testing.T) {
+	srv := newTestSSHServer(t, testSSHAuth{password: true})
+	p := NewSSHPool(SSHPoolOptions{MaxSessionsPerConn: 2})
+	defer p.Close()
+
+	var releases []func()
+	for i := 0; i < 3; i++ {
+		releases = append(releases, poolSession(t, p, srv, "web"))
+	}
+	if n := srv.handshakes(); n != 2 {
+		t.Errorf("%d connections opened for 3 sessions, want 2", n)
+	}
+	for _, release := range releases {
+		release()
+	}
+	poolSession(t, p, srv, "web")()
+	if n := srv.handshakes(); n != 2 {
+		t.Errorf("%d connections opened, want released ones reused", n)
+	}
+}
+
+func TestSSHPoolMaxConnsPerHostAcrossKeys(t *testing.T) {
+	srv := newTestSSHServer(t, testSSHAuth{password: true})
+	p := NewSSHPool(SSHPoolOptions{MaxConnsPerHost: 1, MaxSessionsPerConn: 1, WaitTimeout: 100 * time.Millisecond})
+	defer p.Close()
+
+	releaseA := poolSession(t, p, srv, "alice")
+	_, _, err := p.Session("bob", []string{srv.addr}, testSSHDial(srv))
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms waiting for a free SSH connection") {
+		t.Fatalf("Session error = %v, want the host limit shared by both keys", err)
+	}
+
+	// Простаивающее соединение другого ключа уступает место
+	releaseA()
+	poolSession(t, p, srv, "bob")()
+	if conns, hosts := poolConns(p); conns != 1 || hosts[srv.addr] != 1 {
+		t.Errorf("pool holds %d connections, hosts %v, want only bob's", conns, hosts)
+	}
+	if n := srv.handshakes(); n != 2 {
+		t.Errorf("%d connections opened, want 2", n)
+	}
+}
+
+func TestSSHPoolReconnectsBrokenConnection(t *testing.T) {
+	srv := newTestSSHServer(t, testSSHAuth{password: true})
+	p := NewSSHPool(SSHPoolOptions{})
+	defer p.Close()
+
+	poolSession(t, p, srv, "web")()
+	srv.dropConns()
+	poolSession(t, p, srv, "web")()
+	if n := srv.handshakes(); n != 2 {
+		t.Errorf("%d connections opened, want a reconnect after the drop", n)
+	}
+}
+
+func TestSSHPoolReapsIdleConnections(t *testing.T) {
+	srv := newTestSSHServer(t, testSSHAuth{password: true})
+	p := NewSSHPool(SSHPoolOptions{IdleTimeout: 50 * time.Millisecond})
+	defer p.Close()
+
+	release := poolSession(t, p, srv, "busy")
+	poolSession(t, p, srv, "idle")()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conns, hosts := poolConns(p)
+		if conns == 1 && hosts[srv.addr] == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pool holds %d connections, hosts %v, want the idle one reaped", conns, hosts)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	release()
+
+	p.Close()
+	if _, _, err := p.Session("web", []string{srv.addr}, testSSHDial(srv)); !errors.Is(err, ErrSSHPoolClosed) {
+		t.Errorf("Session after Close error = %v, want ErrSSHPoolClosed", err)
+	}
+}
@@ -0,0 +1,404 @@
+package controllers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const (
+	testSSHUser     = "deploy"
+	testSSHPassword = "secret"
+)
+
+// testSSHServer — SSH-сервер в процессе теста: выполняет exec-запросы, отвечая "ran: <команда>"
+// (команда "exit <N>" завершается с кодом N), и обслуживает sftp на файловой системе теста.
+type testSSHServer struct {
+	addr     string
+	hostKey  ssh.Signer
+	listener net.Listener
+
+	mu sync.Mutex
+	// Число соединений, прошедших handshake, выполненные команды и туннели
+	conns    int
+	commands []string
+	forwards []string
+	reply    func(cmd string) (string, int)
+	// Открытые серверные соединения
+	open []ssh.Conn
+}
+
+// testSSHAuth — способы аутентификации, которые принимает testSSHServer
+type testSSHAuth struct {
+	password    bool
+	interactive bool
+	// Разрешённый публичный ключ клиента
+	key ssh.PublicKey
+}
+
+func newTestSSHServer(t *testing.T, auth testSSHAuth) *testSSHServer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{}
+	if auth.password {
+		config.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == testSSHUser && string(password) == testSSHPassword {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("wrong password")
+		}
+	}
+	if auth.interactive {
+		config.KeyboardInteractiveCallback = func(conn ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := challenge("", "", []string{"Password: ", "OTP: "}, []bool{false, false})
+			if err != nil {
+				return nil, err
+			}
+			for _, answer := range answers {
+				if answer != testSSHPassword {
+					return nil, fmt.Errorf("wrong answer")
+				}
+			}
+			return nil, nil
+		}
+	}
+	if auth.key != nil {
+		config.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(auth.key.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key")
+		}
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testSSHServer{addr: listener.Addr().String(), hostKey: hostKey, listener: listener}
+	t.Cleanup(s.Close)
+	go s.serve(config)
+	return s
+}
+
+func (s *testSSHServer) serve(config *ssh.ServerConfig) {
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			conn, chans, reqs, err := ssh.NewServerConn(nc, config)
+			if err != nil {
+				nc.Close()
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			s.open = append(s.open, conn)
+			s.mu.Unlock()
+
+			go ssh.DiscardRequests(reqs)
+			for ch := range chans {
+				switch ch.ChannelType() {
+				case "session":
+					channel, requests, err := ch.Accept()
+					if err != nil {
+						continue
+					}
+					go s.session(channel, requests)
+				case "direct-tcpip":
+					go s.forward(ch)
+				default:
+					ch.Reject(ssh.UnknownChannelType, "unsupported channel type")
+				}
+			}
+		}()
+	}
+}
+
+func (s *testSSHServer) session(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		var payload struct{ Command string }
+		if req.Type != "exec" && req.Type != "subsystem" || ssh.Unmarshal(req.Payload, &payload) != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		if req.Type == "subsystem" {
+			if payload.Command != "sftp" {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			if server, err := sftp.NewServer(channel); err == nil {
+				server.Serve()
+			}
+			return
+		}
+		req.Reply(true, nil)
+
+		s.mu.Lock()
+		s.commands = append(s.commands, payload.Command)
+		reply := s.reply
+		s.mu.Unlock()
+
+		out, code := fmt.Sprintf("ran: %s\n", payload.Command), 0
+		if rest, ok := strings.CutPrefix(payload.Command, "exit "); ok {
+			code, _ = strconv.Atoi(rest)
+		}
+		if reply != nil {
+			out, code = reply(payload.Command)
+		}
+		io.WriteString(channel, out)
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(code)}))
+		return
+	}
+}
+
+// setReply задаёт вывод и код завершения команд вместо ответа по умолчанию
+func (s *testSSHServer) setReply(reply func(cmd string) (string, int)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reply = reply
+}
+
+// forward туннелирует direct-tcpip канал (ssh -J) на запрошенный адрес
+func (s *testSSHServer) forward(ch ssh.NewChannel) {
+	var target struct {
+		Host     string
+		Port     uint32
+		OrigHost string
+		OrigPort uint32
+	}
+	if err := ssh.Unmarshal(ch.ExtraData(), &target); err != nil {
+		ch.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	address := net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port)))
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		ch.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := ch.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	s.mu.Lock()
+	s.forwards = append(s.forwards, address)
+	s.mu.Unlock()
+
+	go func() {
+		io.Copy(conn, channel)
+		conn.Close()
+	}()
+	io.Copy(channel, conn)
+	channel.Close()
+}
+
+// dropConns закрывает все соединения со стороны сервера
+func (s *testSSHServer) dropConns() {
+	s.mu.Lock()
+	open := s.open
+	s.open = nil
+	s.mu.Unlock()
+	for _, conn := range open {
+		conn.Close()
+	}
+}
+
+func (s *testSSHServer) Close() {
+	s.listener.Close()
+	s.dropConns()
+}
+
+func (s *testSSHServer) handshakes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+// recorded возвращает выполненные команды и адреса туннелей
+func (s *testSSHServer) recorded() (commands, forwards []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...), append([]string(nil), s.forwards...)
+}
+
+// meta возвращает метаданные компонента на этом сервере с дополнительными парами ключ-значение
+func (s *testSSHServer) meta(kv ...string) map[string]string {
+	host, port, _ := net.SplitHostPort(s.addr)
+	meta := map[string]string{"host": host, "port": port, "user": testSSHUser, "host_key_policy": HostKeyInsecure}
+	for i := 0; i+1 < len(kv); i += 2 {
+		meta[kv[i]] = kv[i+1]
+	}
+	return meta
+}
+
+func newTestSSHController() *SSHController {
+	return &SSHController{Logger: testLogger()}
+}
+
+// newTestClientKey создаёт ключ клиента и его PEM, зашифрованный passphrase, если она задана
+func newTestClientKey(t *testing.T, passphrase string) (ssh.PublicKey, string) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(priv, "")
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer.PublicKey(), string(pem.EncodeToMemory(block))
+}
+
+func TestSSHPasswordAuth(t *testing.T) {
+	srv := newTestSSHServer(t, testSSHAuth{password: true})
+	s := newTestSSHController()
+
+	if err := s.RunTask(map[string]string{"id": "t1", "type": "deploy", "command": "uptime"}, srv.meta("password", testSSHPassword)); err != nil {
+		t.Fatalf("RunTask: %v", err)
+	}
+	if err := s.CheckComponent(srv.meta("password", "wrong")); err == nil || !strings.Contains(err.Error(), "unable to authenticate") {
+		t.Fatalf("CheckComponent error = %v, want authentication failure", err)
+	}
+	if err := s.ValideComponent(srv.meta()); err == nil || !strings.Contains(err.Error(), "no SSH auth method configured") {
+		t.Errorf("ValideComponent error = %v, want missing auth rejected", err)
+	}
+}
+
+func TestSSHPrivateKeyAuth(t *testing.T) {
+	public, key := newTestClientKey(t, "")
+	srv := newTestSSHServer(t, testSSHAuth{key: public})
+	s := newTestSSHController()
+
+	if err := s.CheckComponent(srv.meta("private_key", key)); err != nil {
+		t.Fatalf("CheckComponent with private_key: %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(file, []byte(key), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CheckComponent(srv.meta("private_key_file", file)); err != nil {
+		t.Fatalf("CheckComponent with private_key_file: %v", err)
+	}
+	if err := s.ValideComponent(srv.meta("private_key", key, "private_key_file", file)); err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Errorf("ValideComponent error = %v, want private_key and private_key_file rejected together", err)
+	}
+}
+
+func TestSSHEncryptedPrivateKey(t *testing.T) {
+	public, key := newTestClientKey(t, "hunter2")
+	srv := newTestSSHServer(t, testSSHAuth{key: public})
+	s := newTestSSHController()
+
+	if err := s.ValideComponent(srv.meta("private_key", key)); err == nil || !strings.Contains(err.Error(), "passphrase-protected") {
+		t.Fatalf("ValideComponent error = %v, want passphrase required", err)
+	}
+	if err := s.ValideComponent(srv.meta("private_key", key, "passphrase", "wrong")); err == nil || !strings.Contains(err.Error(), "failed to decrypt private key") {
+		t.Fatalf("ValideComponent error = %v, want decryption failure", err)
+	}
+	if err := s.CheckComponent(srv.meta("private_key", key, "passphrase", "hunter2")); err != nil {
+		t.Fatalf("CheckComponent: %v", err)
+	}
+}
+
+func TestSSHAgentAuth(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: priv}); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	srv := newTestSSHServer(t, testSSHAuth{key: signer.PublicKey()})
+	if err := newTestSSHController().CheckComponent(srv.meta("agent", "true")); err != nil {
+		t.Fatalf("CheckComponent with agent: %v", err)
+	}
+}
+
+func TestSSHAgentValidationDoesNotDial(t *testing.T) {
+	s := newTestSSHController()
+	meta := map[string]string{"host": "web", "user": "deploy", "agent": "true", "host_key_policy": HostKeyInsecure}
+
+	t.Setenv("SSH_AUTH_SOCK", "")
+	if err := s.ValideComponent(meta); err == nil || !strings.Contains(err.Error(), "SSH_AUTH_SOCK") {
+		t.Errorf("ValideComponent error = %v, want SSH_AUTH_SOCK required", err)
+	}
+
+	// Сокета нет: проверка метаданных не подключается к агенту
+	t.Setenv("SSH_AUTH_SOCK", filepath.Join(t.TempDir(), "missing.sock"))
+	if err := s.ValideComponent(meta); err != nil {
+		t.Errorf("ValideComponent: %v", err)
+	}
+}
+
+func TestSSHKeyboardInteractiveAuth(t *testing.T) {
+	srv := newTestSSHServer(t, testSSHAuth{interactive: true})
+	s := newTestSSHController()
+
+	if err := s.CheckComponent(srv.meta("password", testSSHPassword, "keyboard_interactive", "true")); err != nil {
+		t.Fatalf("CheckComponent: %v", err)
+	}
+	if err := s.ValideComponent(srv.meta("keyboard_interactive", "true")); err == nil || !strings.Contains(err.Error(), "requires password") {
+		t.Errorf("ValideComponent error = %v, want keyboard_interactive without password rejected", err)
+	}
+}
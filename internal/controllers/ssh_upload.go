@@ -0,0 +1,406 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+/*
+	RUS: Загрузка файлов по SFTP перед выполнением command. В метаданных задачи:
+		file.<N>.dest           — путь на компоненте (обязателен); каталоги создаются
+		file.<N>.source         — локальный файл на хосте laplasd
+		file.<N>.content        — содержимое строкой (вместо source)
+		file.<N>.content_base64 — содержимое в base64 (вместо source)
+		file.<N>.mode           — права в восьмеричном виде, по умолчанию 0644
+		file.<N>.owner          — владелец: uid:gid или user[:group]; имена переводятся в id на компоненте
+		file.<N>.sha256         — ожидаемая контрольная сумма исходного файла
+	Файл пишется во временный файл рядом с dest, читается обратно для сверки sha256
+	и только затем переименовывается в dest. Существующий dest заменяется только через
+	posix-rename@openssh.com: без него замена не атомарна, и загрузка завершается ошибкой.
+	ENG: SFTP uploads run before the task command, declared by file.<N>.<key> task metadata (see above).
+	Each file is written to a temporary file, read back to verify its sha256, then renamed to dest.
+*/
+
+const (
+	filePrefix      = "file."
+	DefaultFileMode = 0o644
+)
+
+var fileKeys = map[string]bool{
+	"dest":           true,
+	"source":         true,
+	"content":        true,
+	"content_base64": true,
+	"mode":           true,
+	"owner":          true,
+	"sha256":         true,
+}
+
+// sshUpload — один файл для загрузки
+type sshUpload struct {
+	index   int
+	source  string
+	content []byte
+	dest    string
+	mode    os.FileMode
+	owner   string
+	sha256  string
+}
+
+// sshOwner — владелец файла в числовом виде; gid < 0 — группа не меняется
+type sshOwner struct {
+	uid, gid int
+}
+
+// parseUploads собирает файлы из file.<N>.* в порядке N
+func parseUploads(meta map[string]string) ([]sshUpload, error) {
+	specs := make(map[int]map[string]string)
+	for key, value := range meta {
+		if !strings.HasPrefix(key, filePrefix) {
+			continue
+		}
+		index, name, ok := strings.Cut(strings.TrimPrefix(key, filePrefix), ".")
+		n, err := strconv.Atoi(index)
+		if !ok || err != nil || n < 1 || !fileKeys[name] {
+			return nil, fmt.Errorf("invalid file setting %q: expected file.<N>.<key>", key)
+		}
+		if specs[n] == nil {
+			specs[n] = make(map[string]string)
+		}
+		specs[n][name] = value
+	}
+
+	indexes := make([]int, 0, len(specs))
+	for n := range specs {
+		indexes = append(indexes, n)
+	}
+	sort.Ints(indexes)
+
+	uploads := make([]sshUpload, 0, len(indexes))
+	for _, n := range indexes {
+		upload, err := parseUpload(n, specs[n])
+		if err != nil {
+			return nil, fmt.Errorf("file %d: %w", n, err)
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, nil
+}
+
+func parseUpload(index int, spec map[string]string) (sshUpload, error) {
+	upload := sshUpload{
+		index:  index,
+		source: spec["source"],
+		dest:   spec["dest"],
+		mode:   DefaultFileMode,
+		owner:  spec["owner"],
+		sha256: strings.ToLower(strings.TrimPrefix(spec["sha256"], "sha256:")),
+	}
+
+	if upload.dest == "" {
+		return upload, fmt.Errorf("dest is required")
+	}
+	if !path.IsAbs(upload.dest) {
+		return upload, fmt.Errorf("dest %q must be an absolute path", upload.dest)
+	}
+
+	sources := 0
+	for _, key := range []string{"source", "content", "content_base64"} {
+		if _, ok := spec[key]; ok {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return upload, fmt.Errorf("exactly one of source, content or content_base64 is required")
+	}
+	switch {
+	case upload.source != "":
+		info, err := os.Stat(upload.source)
+		if err != nil {
+			return upload, err
+		}
+		if !info.Mode().IsRegular() {
+			return upload, fmt.Errorf("source %s is not a regular file", upload.source)
+		}
+	case spec["content_base64"] != "":
+		content, err := base64.StdEncoding.DecodeString(spec["content_base64"])
+		if err != nil {
+			return upload, fmt.Errorf("invalid content_base64: %w", err)
+		}
+		upload.content = content
+	default:
+		upload.content = []byte(spec["content"])
+	}
+
+	if raw := spec["mode"]; raw != "" {
+		mode, err := strconv.ParseUint(raw, 8, 32)
+		if err != nil || mode > 0o7777 {
+			return upload, fmt.Errorf("invalid mode %q: expected octal permissions like 0755", raw)
+		}
+		upload.mode = os.FileMode(mode)
+	}
+
+	if upload.sha256 != "" {
+		if sum, err := hex.DecodeString(upload.sha256); err != nil || len(sum) != sha256.Size {
+			return upload, fmt.Errorf("invalid sha256 %q", spec["sha256"])
+		}
+	}
+	return upload, nil
+}
+
+// open возвращает содержимое файла для загрузки
+func (u sshUpload) open() (io.ReadCloser, error) {
+	if u.source != "" {
+		return os.Open(u.source)
+	}
+	return io.NopCloser(bytes.NewReader(u.content)), nil
+}
+
+// numericOwner разбирает uid:gid; false, если владелец задан именами
+func (u sshUpload) numericOwner() (sshOwner, bool) {
+	user, group, ok := strings.Cut(u.owner, ":")
+	if !ok {
+		return sshOwner{}, false
+	}
+	uid, err := strconv.Atoi(user)
+	if err != nil {
+		return sshOwner{}, false
+	}
+	gid, err := strconv.Atoi(group)
+	if err != nil {
+		return sshOwner{}, false
+	}
+	return sshOwner{uid: uid, gid: gid}, true
+}
+
+// resolveOwners переводит владельцев, заданных именами, в uid и gid одной командой на каждого
+// до открытия SFTP-сессии: SFTP принимает только числа, а вторая сессия из пула, пока
+// занята первая, упирается в лимиты пула
+func (s *SSHController) resolveOwners(target *sshTarget, uploads []sshUpload) (map[string]sshOwner, error) {
+	owners := make(map[string]sshOwner)
+	for _, upload := range uploads {
+		if upload.owner == "" {
+			continue
+		}
+		if _, ok := owners[upload.owner]; ok {
+			continue
+		}
+		if owner, ok := upload.numericOwner(); ok {
+			owners[upload.owner] = owner
+			continue
+		}
+		owner, err := s.resolveOwner(target, upload.owner)
+		if err != nil {
+			return nil, fmt.Errorf("file %d: owner %s: %w", upload.index, upload.owner, err)
+		}
+		owners[upload.owner] = owner
+	}
+	return owners, nil
+}
+
+// resolveOwner разбирает user[:group] как chown: "user:" — основная группа пользователя,
+// без группы она не меняется
+func (s *SSHController) resolveOwner(target *sshTarget, spec string) (sshOwner, error) {
+	user, group, withGroup := strings.Cut(spec, ":")
+	if user == "" {
+		return sshOwner{}, fmt.Errorf("user is required")
+	}
+	cmd := "id -u -- " + shellQuote(user)
+	switch {
+	case !withGroup:
+		cmd += " && echo -1"
+	case group == "":
+		cmd += " && id -g -- " + shellQuote(user)
+	default:
+		cmd += " && getent group " + shellQuote(group) + " | cut -d: -f3"
+	}
+
+	out, err := s.output(target, cmd)
+	fields := strings.Fields(out)
+	// id завершается с ошибкой и ничего не печатает в stdout, если пользователя нет
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) && len(fields) == 0 {
+		return sshOwner{}, fmt.Errorf("user %q not found", user)
+	}
+	if err != nil {
+		return sshOwner{}, err
+	}
+	if len(fields) != 2 {
+		return sshOwner{}, fmt.Errorf("group %q not found", group)
+	}
+	uid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return sshOwner{}, fmt.Errorf("unexpected uid %q", fields[0])
+	}
+	gid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return sshOwner{}, fmt.Errorf("unexpected gid %q", fields[1])
+	}
+	return sshOwner{uid: uid, gid: gid}, nil
+}
+
+// upload загружает файлы задачи по SFTP через сессию из пула
+func (s *SSHController) upload(target *sshTarget, uploads []sshUpload, output TaskOutput) error {
+	owners, err := s.resolveOwners(target, uploads)
+	if err != nil {
+		return err
+	}
+
+	session, release, err := s.session(target)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		return fmt.Errorf("failed to start sftp subsystem: %w", err)
+	}
+	client, err := sftp.NewClientPipe(stdout, stdin)
+	if err != nil {
+		return fmt.Errorf("failed to start sftp client: %w", err)
+	}
+	defer client.Close()
+
+	for _, upload := range uploads {
+		sum, size, err := uploadFile(client, upload, owners[upload.owner])
+		if err != nil {
+			return fmt.Errorf("upload of %s failed: %w", upload.dest, err)
+		}
+		s.Logger.Infof("SSHController uploaded %s to %s@%s (%d bytes, sha256 %s)", upload.dest, target.config.User, target.address, size, sum)
+		if output.Stdout != nil {
+			fmt.Fprintf(output.Stdout, "uploaded %s (%d bytes, sha256 %s)\n", upload.dest, size, sum)
+		}
+	}
+	return nil
+}
+
+func uploadFile(client *sftp.Client, upload sshUpload, owner sshOwner) (string, int64, error) {
+	src, err := upload.open()
+	if err != nil {
+		return "", 0, err
+	}
+	defer src.Close()
+
+	dir := path.Dir(upload.dest)
+	if err := client.MkdirAll(dir); err != nil {
+		return "", 0, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	// Случайный суффикс не даёт двум загрузкам одного файла писать во временный файл друг друга
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", 0, err
+	}
+	tmp := path.Join(dir, "."+path.Base(upload.dest)+".laplasd-tmp-"+hex.EncodeToString(suffix))
+	sum, size, err := writeRemote(client, tmp, src)
+	if err == nil && upload.sha256 != "" && sum != upload.sha256 {
+		err = fmt.Errorf("source checksum mismatch: got %s, expected %s", sum, upload.sha256)
+	}
+	if err == nil {
+		err = client.Chmod(tmp, upload.mode)
+	}
+	if err == nil && upload.owner != "" {
+		err = chownRemote(client, tmp, owner)
+	}
+	if err == nil {
+		err = verifyRemote(client, tmp, sum)
+	}
+	if err == nil {
+		err = renameRemote(client, tmp, upload.dest)
+	}
+	if err != nil {
+		client.Remove(tmp)
+		return "", 0, err
+	}
+	return sum, size, nil
+}
+
+// writeRemote записывает файл и возвращает sha256 записанных данных
+func writeRemote(client *sftp.Client, name string, src io.Reader) (string, int64, error) {
+	f, err := client.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return "", 0, err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(f, io.TeeReader(src, hash))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// verifyRemote читает загруженный файл и сверяет его sha256
+func verifyRemote(client *sftp.Client, name string, want string) error {
+	f, err := client.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return fmt.Errorf("failed to read back %s: %w", name, err)
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != want {
+		return fmt.Errorf("checksum mismatch after upload: got %s, expected %s", got, want)
+	}
+	return nil
+}
+
+// chownRemote меняет владельца; без группы сохраняется текущая группа файла
+func chownRemote(client *sftp.Client, name string, owner sshOwner) error {
+	gid := owner.gid
+	if gid < 0 {
+		info, err := client.Stat(name)
+		if err != nil {
+			return err
+		}
+		stat, ok := info.Sys().(*sftp.FileStat)
+		if !ok {
+			return fmt.Errorf("server did not report the group of %s", name)
+		}
+		gid = int(stat.GID)
+	}
+	return client.Chown(name, owner.uid, gid)
+}
+
+// renameRemote атомарно заменяет dest через posix-rename. Без него переименование допустимо,
+// только если dest ещё нет: удаление и переименование оставили бы dest пустым при сбое между ними.
+func renameRemote(client *sftp.Client, from, to string) error {
+	err := client.PosixRename(from, to)
+	if err == nil {
+		return nil
+	}
+	if _, statErr := client.Lstat(to); !os.IsNotExist(statErr) {
+		return fmt.Errorf("failed to replace %s atomically (posix-rename@openssh.com): %w", to, err)
+	}
+	return client.Rename(from, to)
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
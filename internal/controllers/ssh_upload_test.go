@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseUploads(t *testing.T) {
+	tests := []struct {
+		meta map[string]string
+		err  string
+	}{
+		{meta: map[string]string{"file.1.dest": "/etc/app.conf", "file.1.content": "x", "file.1.mode": "0600"}},
+		{meta: map[string]string{"file.1.content": "x"}, err: "dest is required"},
+		{meta: map[string]string{"file.1.dest": "app.conf", "file.1.content": "x"}, err: "must be an absolute path"},
+		{meta: map[string]string{"file.1.dest": "/a", "file.1.content": "x", "file.1.content_base64": "eA=="}, err: "exactly one of"},
+		{meta: map[string]string{"file.1.dest": "/a", "file.1.content": "x", "file.1.mode": "0999"}, err: "invalid mode"},
+		{meta: map[string]string{"file.1.dest": "/a", "file.1.content": "x", "file.1.sha256": "abc"}, err: "invalid sha256"},
+		{meta: map[string]string{"file.0.dest": "/a"}, err: `invalid file setting "file.0.dest"`},
+	}
+	for _, tt := range tests {
+		_, err := parseUploads(tt.meta)
+		if tt.err == "" && err != nil {
+			t.Errorf("%v: unexpected error %v", tt.meta, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%v: error = %v, want %q", tt.meta, err, tt.err)
+		}
+	}
+
+	uploads, err := parseUploads(map[string]string{"file.10.dest": "/b", "file.10.content": "b", "file.2.dest": "/a", "file.2.content": "a"})
+	if err != nil || len(uploads) != 2 || uploads[0].dest != "/a" || uploads[1].dest != "/b" {
+		t.Errorf("uploads = %+v, %v, want file.2 before file.10", uploads, err)
+	}
+}
+
+func TestSSHUploadReplacesFile(t *testing.T) {
+	srv := newTestSSHServer(t, testSSHAuth{password: true})
+	dest := filepath.Join(t.TempDir(), "etc", "app.conf")
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dest, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	content := "listen 8080\n"
+	sum := sha256.Sum256([]byte(content))
+	owner := strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid())
+	task := map[string]string{
+		"id": "t1", "type": "deploy", "command": "systemctl reload app",
+		"file.1.dest": dest, "file.1.content": content, "file.1.mode": "0640",
+		"file.1.owner": owner, "file.1.sha256": "sha256:" + hex.EncodeToString(sum[:]),
+	}
+	var stdout bytes.Buffer
+	if err := newTestSSHController().RunTaskOutput(task, srv.meta("password", testSSHPassword), TaskOutput{Stdout: &stdout}); err != nil {
+		t.Fatalf("RunTaskOutput: %v", err)
+	}
+
+	data, err := os.ReadFile(dest)
+	if err != nil || string(data) != content {
+		t.Fatalf("dest = %q, %v, want the uploaded content", data, err)
+	}
+	if info, _ := os.Stat(dest); info.Mode().Perm() != 0o640 {
+		t.Errorf("dest mode = %o, want 640", info.Mode().Perm())
+	}
+	if !strings.Contains(stdout.String(), "uploaded "+dest) {
+		t.Errorf("output does not report the upload:\n%s", stdout.String())
+	}
+	// Числовой владелец не требует команд на компоненте
+	if commands, _ := srv.recorded(); !reflect.DeepEqual(commands, []string{"systemctl reload app"}) {
+		t.Errorf("commands = %v, want only the task command after the upload", commands)
+	}
+}
+
+func TestSSHUploadChecksumMismatch(t *testing.T) {
+	srv := newTestSSHServer(t, testSSHAuth{password: true})
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "app.conf")
+
+	task := map[string]string{
+		"id": "t1", "type": "deploy", "command": "true",
+		"file.1.dest": dest, "file.1.content": "tampered", "file.1.sha256": strings.Repeat("0", 64),
+	}
+	err := newTestSSHController().RunTask(task, srv.meta("password", testSSHPassword))
+	if err == nil || !strings.Contains(err.Error(), "source checksum mismatch") {
+		t.Fatalf("RunTask error = %v, want the checksum mismatch", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("upload left files behind: %v", entries)
+	}
+	if commands, _ := srv.recorded(); len(commands) != 0 {
+		t.Errorf("commands = %v, want the task command skipped after a failed upload", commands)
+	}
+}
+
+func TestSSHUploadResolvesOwnerNames(t *testing.T) {
+	srv := newTestSSHServer(t, testSSHAuth{password: true})
+	uid, gid := strconv.Itoa(os.Getuid()), strconv.Itoa(os.Getgid())
+	srv.setReply(func(cmd string) (string, int) {
+		switch {
+		case strings.HasPrefix(cmd, "id -u -- 'app' && getent group 'app'"):
+			return uid + "\n" + gid + "\n", 0
+		case strings.HasPrefix(cmd, "id -u -- 'app' && getent group 'missing'"):
+			return uid + "\n", 0
+		case cmd == "id -u -- 'app' && echo -1":
+			return uid + "\n-1\n", 0
+		case strings.HasPrefix(cmd, "id -u -- 'nobody-here'"):
+			return "", 1
+		}
+		return "", 0
+	})
+	s := newTestSSHController()
+	component := srv.meta("password", testSSHPassword)
+
+	dest := filepath.Join(t.TempDir(), "app.conf")
+	task := map[string]string{"id": "t1", "type": "deploy", "file.1.dest": dest, "file.1.content": "x", "file.1.owner": "app:app"}
+	if err := s.RunTask(task, component); err != nil {
+		t.Fatalf("RunTask: %v", err)
+	}
+	if _, err := os.Stat(dest); err != nil {
+		t.Fatalf("dest was not uploaded: %v", err)
+	}
+
+	task["file.1.owner"] = "app:missing"
+	if err := s.RunTask(task, component); err == nil || !strings.Contains(err.Error(), `owner app:missing: group "missing" not found`) {
+		t.Fatalf("RunTask error = %v, want the unknown group reported", err)
+	}
+
+	// Без группы меняется только владелец
+	task["file.1.owner"] = "app"
+	if err := s.RunTask(task, component); err != nil {
+		t.Fatalf("RunTask with owner app: %v", err)
+	}
+
+	// Несуществующий пользователь не маскируется под отсутствующую группу
+	for _, owner := range []string{"nobody-here", "nobody-here:app"} {
+		task["file.1.owner"] = owner
+		err := s.RunTask(task, component)
+		if err == nil || !strings.Contains(err.Error(), `user "nobody-here" not found`) {
+			t.Fatalf("RunTask with owner %s error = %v, want the unknown user reported", owner, err)
+		}
+	}
+}
+
+func TestSSHUploadUsesUniqueTempNames(t *testing.T) {
+	srv := newTestSSHServer(t, testSSHAuth{password: true})
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "app.conf")
+	// Чужой временный файл с прежним фиксированным именем не перезаписывается и не удаляется
+	stale := filepath.Join(dir, ".app.conf.laplasd-tmp")
+	if err := os.WriteFile(stale, []byte("other"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	task := map[string]string{"id": "t1", "type": "deploy", "file.1.dest": dest, "file.1.content": "x"}
+	if err := newTestSSHController().RunTask(task, srv.meta("password", testSSHPassword)); err != nil {
+		t.Fatalf("RunTask: %v", err)
+	}
+	if data, err := os.ReadFile(stale); err != nil || string(data) != "other" {
+		t.Errorf("stale temp file = %q, %v", data, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("dir entries = %v, want only dest and the stale file", entries)
+	}
+}
@@ -0,0 +1,429 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+/*
+	================
+	systemd-controller
+	================
+*/
+
+/*
+	RUS: Компонент systemd-controller — хост с systemd, доступный по SSH. Подключение задаётся
+	теми же метаданными, что у ssh-controller (host, port, user, ключи, proxy_jump...), а также:
+		unit       — юнит по умолчанию для задач и юнит, который проверяет CheckComponent
+		sudo       — выполнять systemctl через sudo -n (по умолчанию false)
+		user_scope — управлять пользовательскими юнитами: systemctl --user (по умолчанию false, несовместимо с sudo)
+	Метаданные задачи:
+		unit         — юнит (по умолчанию из компонента); без суффикса считается .service
+		action       — start, stop, restart, reload, enable или disable
+		now          — для enable/disable: сразу запустить или остановить юнит (по умолчанию false)
+		wait         — ждать состояния юнита после действия, по умолчанию true
+		wait_timeout — сколько ждать, по умолчанию 1m
+	После start/restart/reload ожидается ActiveState=active на двух опросах подряд без
+	автоматических перезапусков, после stop — inactive. При ошибке в вывод задачи попадает хвост journalctl.
+	ENG: systemd-controller components are SSH-reachable systemd hosts; tasks start, stop, restart,
+	reload, enable or disable a unit and wait for its state, CheckComponent uses the unit state.
+*/
+
+const (
+	DefaultSystemdWaitTimeout  = time.Minute
+	DefaultSystemdPollInterval = time.Second
+	// Сколько строк журнала юнита выводится при ошибке
+	systemdJournalLines = 20
+)
+
+// Действия задач systemd-controller
+const (
+	SystemdActionStart   = "start"
+	SystemdActionStop    = "stop"
+	SystemdActionRestart = "restart"
+	SystemdActionReload  = "reload"
+	SystemdActionEnable  = "enable"
+	SystemdActionDisable = "disable"
+)
+
+var systemdUnitName = regexp.MustCompile(`^[A-Za-z0-9:_.\\@-]+$`)
+
+// Свойства юнита, которые читает контроллер
+var systemdProperties = []string{"LoadState", "ActiveState", "SubState", "Result", "NRestarts", "ExecMainStatus", "UnitFileState"}
+
+type SystemdController struct {
+	Logger *logrus.Logger
+	// SSH-контроллер, через который выполняются команды: его пул, known_hosts и политика ключей
+	SSH *SSHController
+	// Период опроса состояния юнита, по умолчанию DefaultSystemdPollInterval
+	PollInterval time.Duration
+	// Выполнение команды на компоненте; без него — SSH.output (подменяется в тестах)
+	run func(target *sshTarget, cmd string) (string, error)
+
+	mu sync.Mutex
+	// NRestarts юнитов на момент прошлой проверки, по компоненту и юниту
+	restarts map[string]int
+}
+
+// systemdTask — действие над юнитом
+type systemdTask struct {
+	unit    string
+	action  string
+	now     bool
+	wait    bool
+	timeout time.Duration
+}
+
+// systemctl — префикс команд компонента
+type systemctl struct {
+	sudo      bool
+	userScope bool
+}
+
+func parseSystemctl(meta map[string]string) (systemctl, error) {
+	sudo, err := parseBool(meta, "sudo")
+	if err != nil {
+		return systemctl{}, err
+	}
+	userScope, err := parseBool(meta, "user_scope")
+	if err != nil {
+		return systemctl{}, err
+	}
+	// sudo systemctl --user обратился бы к менеджеру пользователя root, а не пользователя компонента
+	if sudo && userScope {
+		return systemctl{}, fmt.Errorf("sudo and user_scope are mutually exclusive")
+	}
+	return systemctl{sudo: sudo, userScope: userScope}, nil
+}
+
+func (c systemctl) command(tool string, args ...string) string {
+	parts := make([]string, 0, len(args)+4)
+	if c.sudo {
+		parts = append(parts, "sudo", "-n")
+	}
+	parts = append(parts, tool)
+	if c.userScope {
+		parts = append(parts, "--user")
+	}
+	for _, arg := range args {
+		parts = append(parts, shellQuote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+// normalizeUnit проверяет имя юнита и добавляет .service, если суффикса нет
+func normalizeUnit(unit string) (string, error) {
+	if unit == "" {
+		return "", fmt.Errorf("unit is required")
+	}
+	if !systemdUnitName.MatchString(unit) {
+		return "", fmt.Errorf("invalid unit name %q", unit)
+	}
+	if !strings.Contains(unit, ".") {
+		unit += ".service"
+	}
+	return unit, nil
+}
+
+func parseSystemdTask(taskMeta, componentMeta map[string]string) (*systemdTask, error) {
+	task := &systemdTask{
+		unit:    taskMeta["unit"],
+		action:  taskMeta["action"],
+		wait:    true,
+		timeout: DefaultSystemdWaitTimeout,
+	}
+	if task.unit == "" {
+		task.unit = componentMeta["unit"]
+	}
+	var err error
+	if task.unit, err = normalizeUnit(task.unit); err != nil {
+		return nil, err
+	}
+
+	switch task.action {
+	case SystemdActionStart, SystemdActionStop, SystemdActionRestart, SystemdActionReload, SystemdActionEnable, SystemdActionDisable:
+	case "":
+		return nil, fmt.Errorf("task action is required (start, stop, restart, reload, enable or disable)")
+	default:
+		return nil, fmt.Errorf("unknown task action %q (expected start, stop, restart, reload, enable or disable)", task.action)
+	}
+
+	if task.now, err = parseBool(taskMeta, "now"); err != nil {
+		return nil, err
+	}
+	if taskMeta["wait"] != "" {
+		if task.wait, err = parseBool(taskMeta, "wait"); err != nil {
+			return nil, err
+		}
+	}
+	if raw := taskMeta["wait_timeout"]; raw != "" {
+		if task.timeout, err = time.ParseDuration(raw); err != nil || task.timeout <= 0 {
+			return nil, fmt.Errorf("invalid wait_timeout %q", raw)
+		}
+	}
+	return task, nil
+}
+
+// command возвращает аргументы systemctl для действия
+func (t *systemdTask) command() []string {
+	args := []string{t.action}
+	if t.now && (t.action == SystemdActionEnable || t.action == SystemdActionDisable) {
+		args = append(args, "--now")
+	}
+	return append(args, t.unit)
+}
+
+// want возвращает ожидаемый ActiveState после действия или "", если ждать нечего
+func (t *systemdTask) want() string {
+	switch t.action {
+	case SystemdActionStart, SystemdActionRestart, SystemdActionReload:
+		return "active"
+	case SystemdActionStop:
+		return "inactive"
+	case SystemdActionEnable:
+		if t.now {
+			return "active"
+		}
+	case SystemdActionDisable:
+		if t.now {
+			return "inactive"
+		}
+	}
+	return ""
+}
+
+// unitState — свойства юнита из systemctl show
+type unitState map[string]string
+
+func (s unitState) restarts() int {
+	n, _ := strconv.Atoi(s["NRestarts"])
+	return n
+}
+
+func (s unitState) String() string {
+	state := s["ActiveState"] + " (" + s["SubState"] + ")"
+	if result := s["Result"]; result != "" && result != "success" {
+		state += ", result " + result
+		if status := s["ExecMainStatus"]; status != "" && status != "0" {
+			state += ", exit status " + status
+		}
+	}
+	return state
+}
+
+// output выполняет команду на компоненте и возвращает её stdout
+func (x *SystemdController) output(target *sshTarget, cmd string) (string, error) {
+	if x.run != nil {
+		return x.run(target, cmd)
+	}
+	return x.SSH.output(target, cmd)
+}
+
+func (x *SystemdController) show(target *sshTarget, ctl systemctl, unit string) (unitState, error) {
+	out, err := x.output(target, ctl.command("systemctl", "show", "--no-pager", "--property="+strings.Join(systemdProperties, ","), unit))
+	if err != nil {
+		return nil, fmt.Errorf("systemctl show %s: %w", unit, err)
+	}
+	state := make(unitState)
+	for _, line := range strings.Split(out, "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			state[key] = value
+		}
+	}
+	if state["LoadState"] == "not-found" {
+		return nil, fmt.Errorf("unit %s not found", unit)
+	}
+	return state, nil
+}
+
+// journal возвращает последние строки журнала юнита; ошибки чтения журнала не важны
+func (x *SystemdController) journal(target *sshTarget, ctl systemctl, unit string) string {
+	out, _ := x.output(target, ctl.command("journalctl", "--no-pager", "--quiet", "-n", strconv.Itoa(systemdJournalLines), "-u", unit))
+	return out
+}
+
+// wait ждёт нужного ActiveState; для active — на двух опросах подряд без новых автоматических перезапусков
+func (x *SystemdController) wait(target *sshTarget, ctl systemctl, task *systemdTask, restarts int, out io.Writer) error {
+	want := task.want()
+	interval := x.PollInterval
+	if interval <= 0 {
+		interval = DefaultSystemdPollInterval
+	}
+	deadline := time.Now().Add(task.timeout)
+
+	var last string
+	confirmed := false
+	for {
+		state, err := x.show(target, ctl, task.unit)
+		if err != nil {
+			return err
+		}
+		if status := state.String(); status != last {
+			fmt.Fprintf(out, "%s: %s\n", task.unit, status)
+			last = status
+		}
+
+		if n := state.restarts(); n > restarts {
+			return fmt.Errorf("unit %s restarted automatically %d times: %s", task.unit, n-restarts, state)
+		}
+		switch active := state["ActiveState"]; {
+		case active == "failed":
+			return fmt.Errorf("unit %s failed: %s", task.unit, state)
+		case active == want && want == "inactive":
+			return nil
+		case active == want:
+			if confirmed {
+				return nil
+			}
+			confirmed = true
+		default:
+			confirmed = false
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for unit %s to become %s: %s", task.unit, want, state)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (x *SystemdController) RunTask(taskMeta map[string]string, componentMeta map[string]string) error {
+	return RunTaskLogged(x.Logger, "systemd", x, taskMeta, componentMeta)
+}
+
+// RunTaskOutput выполняет действие над юнитом и ждёт его состояния, описывая ход выполнения в output.Stdout
+func (x *SystemdController) RunTaskOutput(taskMeta map[string]string, componentMeta map[string]string, output TaskOutput) error {
+	task, err := parseSystemdTask(taskMeta, componentMeta)
+	if err != nil {
+		return err
+	}
+	ctl, err := parseSystemctl(componentMeta)
+	if err != nil {
+		return err
+	}
+	target, err := x.SSH.target(componentMeta)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	out := output.Stdout
+	if out == nil {
+		out = io.Discard
+	}
+	x.Logger.Infof("SystemdController running task %s: systemctl %s on %s@%s", taskMeta["id"], strings.Join(task.command(), " "), target.config.User, target.address)
+
+	before, err := x.show(target, ctl, task.unit)
+	if err != nil {
+		return err
+	}
+	if _, err := x.output(target, ctl.command("systemctl", task.command()...)); err != nil {
+		x.writeJournal(target, ctl, task.unit, out)
+		return fmt.Errorf("systemctl %s: %w", strings.Join(task.command(), " "), err)
+	}
+	fmt.Fprintf(out, "systemctl %s: ok\n", strings.Join(task.command(), " "))
+
+	if !task.wait || task.want() == "" {
+		return nil
+	}
+	// Ручной start/restart сбрасывает NRestarts, поэтому отсчёт ведётся от меньшего из значений
+	// до и сразу после действия
+	restarts := before.restarts()
+	after, err := x.show(target, ctl, task.unit)
+	if err != nil {
+		return err
+	}
+	restarts = min(restarts, after.restarts())
+	if err := x.wait(target, ctl, task, restarts, out); err != nil {
+		x.writeJournal(target, ctl, task.unit, out)
+		return err
+	}
+	return nil
+}
+
+func (x *SystemdController) writeJournal(target *sshTarget, ctl systemctl, unit string, out io.Writer) {
+	if journal := x.journal(target, ctl, unit); journal != "" {
+		fmt.Fprintf(out, "journalctl -u %s:\n%s", unit, journal)
+	}
+}
+
+func (x *SystemdController) ValideTask(taskMeta map[string]string) error {
+	if taskMeta["id"] == "" {
+		return fmt.Errorf("task id is required")
+	}
+	// Юнит может прийти из компонента, поэтому здесь подставляется заглушка
+	meta := taskMeta
+	if meta["unit"] == "" {
+		meta = map[string]string{"unit": "unit.service"}
+		for key, value := range taskMeta {
+			if key != "unit" {
+				meta[key] = value
+			}
+		}
+	}
+	_, err := parseSystemdTask(meta, nil)
+	return err
+}
+
+func (x *SystemdController) ValideComponent(componentMeta map[string]string) error {
+	if unit := componentMeta["unit"]; unit != "" {
+		if _, err := normalizeUnit(unit); err != nil {
+			return err
+		}
+	}
+	if _, err := parseSystemctl(componentMeta); err != nil {
+		return err
+	}
+	return x.SSH.ValideComponent(componentMeta)
+}
+
+// CheckComponent проверяет, что юнит компонента активен и не перезапускался сам с прошлой проверки;
+// без unit проверяется только SSH-доступ
+func (x *SystemdController) CheckComponent(componentMeta map[string]string) error {
+	if componentMeta["unit"] == "" {
+		return x.SSH.CheckComponent(componentMeta)
+	}
+	unit, err := normalizeUnit(componentMeta["unit"])
+	if err != nil {
+		return err
+	}
+	ctl, err := parseSystemctl(componentMeta)
+	if err != nil {
+		return err
+	}
+	target, err := x.SSH.target(componentMeta)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	state, err := x.show(target, ctl, unit)
+	if err != nil {
+		return fmt.Errorf("systemd check failed: %w", err)
+	}
+
+	key := target.key() + " " + unit
+	restarts := state.restarts()
+	x.mu.Lock()
+	previous, seen := x.restarts[key]
+	if x.restarts == nil {
+		x.restarts = make(map[string]int)
+	}
+	x.restarts[key] = restarts
+	x.mu.Unlock()
+
+	if active := state["ActiveState"]; active != "active" && active != "reloading" {
+		return fmt.Errorf("unit %s is %s (%d automatic restarts)", unit, state, restarts)
+	}
+	if seen && restarts > previous {
+		return fmt.Errorf("unit %s restarted automatically %d times since last check (%d in total)", unit, restarts-previous, restarts)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSystemd — systemctl на компоненте: show отдаёт состояния по очереди, последнее повторяется
+type fakeSystemd struct {
+	mu       sync.Mutex
+	states   []string
+	shown    int
+	commands []string
+	// Ошибка команды действия (не show и не journalctl)
+	actionErr error
+}
+
+// unitShow — вывод systemctl show для состояния юнита
+func unitShow(active, sub string, restarts int, result string) string {
+	status := "0"
+	if result != "success" {
+		status = "1"
+	}
+	return fmt.Sprintf("LoadState=loaded\nActiveState=%s\nSubState=%s\nResult=%s\nNRestarts=%d\nExecMainStatus=%s\nUnitFileState=enabled\n",
+		active, sub, result, restarts, status)
+}
+
+func (f *fakeSystemd) run(_ *sshTarget, cmd string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.commands = append(f.commands, cmd)
+	switch {
+	case strings.Contains(cmd, "systemctl 'show'"):
+		state := f.states[min(f.shown, len(f.states)-1)]
+		f.shown++
+		return state, nil
+	case strings.Contains(cmd, "journalctl"):
+		return "app[42]: listen tcp :8080: address already in use\n", nil
+	}
+	return "", f.actionErr
+}
+
+func newTestSystemdController(f *fakeSystemd) *SystemdController {
+	return &SystemdController{Logger: testLogger(), SSH: newTestSSHController(), PollInterval: time.Millisecond, run: f.run}
+}
+
+func testSystemdComponent(kv ...string) map[string]string {
+	meta := map[string]string{"host": "web", "user": "deploy", "password": "pw", "host_key_policy": HostKeyInsecure, "unit": "app"}
+	for i := 0; i+1 < len(kv); i += 2 {
+		meta[kv[i]] = kv[i+1]
+	}
+	return meta
+}
+
+// runSystemd выполняет задачу и возвращает её вывод
+func runSystemd(f *fakeSystemd, task map[string]string, component map[string]string) (string, error) {
+	var stdout bytes.Buffer
+	err := newTestSystemdController(f).RunTaskOutput(task, component, TaskOutput{Stdout: &stdout})
+	return stdout.String(), err
+}
+
+func TestParseSystemdTask(t *testing.T) {
+	tests := []struct {
+		task      map[string]string
+		component map[string]string
+		command   string
+		want      string
+		err       string
+	}{
+		{task: map[string]string{"action": "restart"}, component: map[string]string{"unit": "app"}, command: "restart app.service", want: "active"},
+		{task: map[string]string{"action": "stop", "unit": "app.socket"}, command: "stop app.socket", want: "inactive"},
+		{task: map[string]string{"action": "enable", "unit": "app", "now": "true"}, command: "enable --now app.service", want: "active"},
+		{task: map[string]string{"action": "disable", "unit": "app"}, command: "disable app.service", want: ""},
+		{task: map[string]string{"action": "start"}, err: "unit is required"},
+		{task: map[string]string{"action": "start", "unit": "app;reboot"}, err: "invalid unit name"},
+		{task: map[string]string{"unit": "app"}, err: "task action is required"},
+		{task: map[string]string{"action": "kill", "unit": "app"}, err: `unknown task action "kill"`},
+		{task: map[string]string{"action": "start", "unit": "app", "wait_timeout": "-1s"}, err: "invalid wait_timeout"},
+	}
+	for _, tt := range tests {
+		task, err := parseSystemdTask(tt.task, tt.component)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%v: error = %v, want %q", tt.task, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", tt.task, err)
+			continue
+		}
+		if got := strings.Join(task.command(), " "); got != tt.command || task.want() != tt.want {
+			t.Errorf("%v: command %q, want state %q; expected %q, %q", tt.task, got, task.want(), tt.command, tt.want)
+		}
+	}
+}
+
+func TestUnitStateString(t *testing.T) {
+	state := unitState{"ActiveState": "failed", "SubState": "failed", "Result": "exit-code", "ExecMainStatus": "203", "NRestarts": "4"}
+	if got := state.String(); got != "failed (failed), result exit-code, exit status 203" {
+		t.Errorf("String() = %q", got)
+	}
+	if state.restarts() != 4 {
+		t.Errorf("restarts() = %d, want 4", state.restarts())
+	}
+	if got := (unitState{"ActiveState": "active", "SubState": "running", "Result": "success"}).String(); got != "active (running)" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestSystemdRestartWaitsForStableActive(t *testing.T) {
+	f := &fakeSystemd{states: []string{
+		unitShow("active", "running", 0, "success"),   // до действия
+		unitShow("activating", "start", 0, "success"), // сразу после
+		unitShow("active", "running", 0, "success"),   // первый опрос
+		unitShow("activating", "auto-restart", 0, "success"),
+		unitShow("active", "running", 0, "success"),
+		unitShow("active", "running", 0, "success"),
+	}}
+	out, err := runSystemd(f, map[string]string{"id": "t1", "action": "restart"}, testSystemdComponent())
+	if err != nil {
+		t.Fatalf("RunTaskOutput: %v", err)
+	}
+	if f.shown != 6 {
+		t.Errorf("unit state read %d times, want active confirmed on two polls in a row", f.shown)
+	}
+	if f.commands[1] != "systemctl 'restart' 'app.service'" {
+		t.Errorf("action command = %q", f.commands[1])
+	}
+	for _, want := range []string{"systemctl restart app.service: ok", "app.service: activating (auto-restart)", "app.service: active (running)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestSystemdRestartDetectsAutomaticRestarts(t *testing.T) {
+	// Ручной restart сбрасывает NRestarts: отсчёт идёт от значения сразу после действия
+	f := &fakeSystemd{states: []string{
+		unitShow("active", "running", 3, "success"),
+		unitShow("active", "running", 0, "success"),
+		unitShow("active", "running", 1, "success"),
+	}}
+	out, err := runSystemd(f, map[string]string{"id": "t1", "action": "restart"}, testSystemdComponent())
+	if err == nil || !strings.Contains(err.Error(), "unit app.service restarted automatically 1 times") {
+		t.Fatalf("RunTaskOutput error = %v, want the automatic restart reported", err)
+	}
+	if !strings.Contains(out, "journalctl -u app.service:\napp[42]: listen tcp :8080: address already in use") {
+		t.Errorf("output does not contain the journal:\n%s", out)
+	}
+}
+
+func TestSystemdWaitFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		task   map[string]string
+		states []string
+		err    string
+	}{
+		{
+			name:   "failed",
+			task:   map[string]string{"action": "stop"},
+			states: []string{unitShow("active", "running", 0, "success"), unitShow("failed", "failed", 0, "exit-code")},
+			err:    "unit app.service failed: failed (failed), result exit-code, exit status 1",
+		},
+		{
+			name:   "timeout",
+			task:   map[string]string{"action": "start", "wait_timeout": "20ms"},
+			states: []string{unitShow("inactive", "dead", 0, "success"), unitShow("activating", "start", 0, "success")},
+			err:    "timed out waiting for unit app.service to become active: activating (start)",
+		},
+		{
+			name:   "not found",
+			task:   map[string]string{"action": "start"},
+			states: []string{"LoadState=not-found\nActiveState=inactive\n"},
+			err:    "unit app.service not found",
+		},
+	}
+	for _, tt := range tests {
+		tt.task["id"] = "t1"
+		_, err := runSystemd(&fakeSystemd{states: tt.states}, tt.task, testSystemdComponent())
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+
+	// Без ожидания состояние после действия не читается
+	f := &fakeSystemd{states: []string{unitShow("active", "running", 0, "success")}}
+	if _, err := runSystemd(f, map[string]string{"id": "t1", "action": "stop", "wait": "false"}, testSystemdComponent()); err != nil || f.shown != 1 {
+		t.Errorf("wait=false: error %v, state read %d times, want only before the action", err, f.shown)
+	}
+}
+
+func TestSystemdActionFailure(t *testing.T) {
+	f := &fakeSystemd{
+		states:    []string{unitShow("inactive", "dead", 0, "success")},
+		actionErr: fmt.Errorf("Job for app.service failed"),
+	}
+	out, err := runSystemd(f, map[string]string{"id": "t1", "action": "start"}, testSystemdComponent("sudo", "true"))
+	if err == nil || !strings.Contains(err.Error(), "systemctl start app.service: Job for app.service failed") {
+		t.Fatalf("RunTaskOutput error = %v, want the systemctl failure", err)
+	}
+	if !strings.Contains(out, "address already in use") {
+		t.Errorf("output does not contain the journal:\n%s", out)
+	}
+	for _, cmd := range f.commands {
+		if !strings.HasPrefix(cmd, "sudo -n ") {
+			t.Errorf("command %q does not use sudo -n", cmd)
+		}
+	}
+
+	_, err = runSystemd(f, map[string]string{"id": "t1", "action": "start"}, testSystemdComponent("sudo", "true", "user_scope", "true"))
+	if err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Errorf("RunTaskOutput error = %v, want sudo with user_scope rejected", err)
+	}
+}
+
+func TestSystemdCheckComponentCountsRestarts(t *testing.T) {
+	f := &fakeSystemd{states: []string{
+		unitShow("active", "running", 2, "success"),
+		unitShow("active", "running", 2, "success"),
+		unitShow("active", "running", 3, "success"),
+		unitShow("inactive", "dead", 3, "success"),
+	}}
+	x := newTestSystemdController(f)
+	component := testSystemdComponent()
+
+	for i := 0; i < 2; i++ {
+		if err := x.CheckComponent(component); err != nil {
+			t.Fatalf("check %d: %v", i+1, err)
+		}
+	}
+	if err := x.CheckComponent(component); err == nil || !strings.Contains(err.Error(), "restarted automatically 1 times since last check (3 in total)") {
+		t.Fatalf("CheckComponent error = %v, want the new restart reported", err)
+	}
+	if err := x.CheckComponent(component); err == nil || !strings.Contains(err.Error(), "unit app.service is inactive (dead)") {
+		t.Fatalf("CheckComponent error = %v, want the inactive unit reported", err)
+	}
+}
@@ -0,0 +1,225 @@
+package daemon
+
+import (
+	"fmt"
+	"laplasd/internal/config"
+	"laplasd/internal/controllers"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/laplasd/inforo/api"
+)
+
+/*
+	RUS: Контроллеры регистрируются по секциям [[controllers]] и [[monitor_controllers]] config.toml:
+	kind выбирает реализацию, type — ключ, под которым она регистрируется, options — её параметры.
+	Один вид можно зарегистрировать несколько раз под разными типами с разными параметрами.
+	Неизвестный вид, неизвестный параметр или повторный тип останавливают запуск демона.
+	ENG: Controllers are registered from the [[controllers]] and [[monitor_controllers]] sections
+	of config.toml: kind selects the implementation, type is the key it is registered under and
+	options are its parameters. A kind may be registered several times under different types.
+	An unknown kind, an unknown option or a duplicate type aborts daemon startup.
+*/
+
+// controllerKind — вид контроллера компонентов: допустимые параметры и конструктор
+type controllerKind struct {
+	options []string
+	build   func(d *Daemon, opts map[string]string) (api.Controller, error)
+}
+
+// monitorControllerKind — вид контроллера мониторинга
+type monitorControllerKind struct {
+	options []string
+	build   func(d *Daemon, opts map[string]string) (api.MonitoringController, error)
+}
+
+var controllerKinds = map[string]controllerKind{
+	"ssh": {
+		options: []string{"known_hosts", "host_key_policy"},
+		build: func(d *Daemon, opts map[string]string) (api.Controller, error) {
+			return d.newSSHController(opts), nil
+		},
+	},
+	"systemd": {
+		options: []string{"known_hosts", "host_key_policy", "poll_interval"},
+		build: func(d *Daemon, opts map[string]string) (api.Controller, error) {
+			interval, err := optionDuration(opts, "poll_interval")
+			if err != nil {
+				return nil, err
+			}
+			return &controllers.SystemdController{Logger: d.logger, SSH: d.newSSHController(opts), PollInterval: interval}, nil
+		},
+	},
+	"exec": {
+		build: func(d *Daemon, opts map[string]string) (api.Controller, error) {
+			return &controllers.ExecController{Logger: d.logger}, nil
+		},
+	},
+	"http": {
+		build: func(d *Daemon, opts map[string]string) (api.Controller, error) {
+			return &controllers.HTTPController{Logger: d.logger}, nil
+		},
+	},
+	"docker": {
+		options: []string{"poll_interval"},
+		build: func(d *Daemon, opts map[string]string) (api.Controller, error) {
+			interval, err := optionDuration(opts, "poll_interval")
+			if err != nil {
+				return nil, err
+			}
+			return &controllers.DockerController{Logger: d.logger, PollInterval: interval}, nil
+		},
+	},
+	"kuber": {
+		options: []string{"poll_interval"},
+		build: func(d *Daemon, opts map[string]string) (api.Controller, error) {
+			interval, err := optionDuration(opts, "poll_interval")
+			if err != nil {
+				return nil, err
+			}
+			return &controllers.KuberController{Logger: d.logger, PollInterval: interval}, nil
+		},
+	},
+}
+
+var monitorControllerKinds = map[string]monitorControllerKind{
+	"promql": {
+		// Адрес и авторизация Prometheus могут задаваться и в Monitoring.Config каждого мониторинга
+		options: []string{"url"},
+		build: func(d *Daemon, opts map[string]string) (api.MonitoringController, error) {
+			return controllers.NewPromQLMonitorController(d.ctx, d.logger, opts["url"]), nil
+		},
+	},
+}
+
+// Контроллеры, которые регистрируются, если в config.toml нет секций [[controllers]]
+var defaultControllers = []config.Controller{
+	{Kind: "kuber", Type: "kuber-controller"},
+	{Kind: "ssh", Type: "ssh-controller"},
+	{Kind: "systemd", Type: "systemd-controller"},
+	{Kind: "exec", Type: "exec-controller"},
+	{Kind: "http", Type: "http-controller"},
+	{Kind: "docker", Type: "docker-controller"},
+}
+
+// Контроллеры мониторинга, если в config.toml нет секций [[monitor_controllers]]
+var defaultMonitorControllers = []config.Controller{
+	{Kind: "promql", Type: "promql-monitor"},
+}
+
+// registerControllers создаёт и регистрирует контроллеры компонентов из конфигурации
+func (d *Daemon) registerControllers(registry api.ControllerRegistry) error {
+	cfgs := d.config.Controllers
+	if cfgs == nil {
+		cfgs = defaultControllers
+	}
+	for i, cfg := range cfgs {
+		kind, ok := controllerKinds[cfg.Kind]
+		if !ok {
+			return fmt.Errorf("controllers[%d]: unknown kind %q (known: %s)", i, cfg.Kind, kindNames(controllerKinds))
+		}
+		if cfg.Type == "" {
+			return fmt.Errorf("controllers[%d]: type is required", i)
+		}
+		if err := checkController(cfg, kind.options); err != nil {
+			return fmt.Errorf("controllers[%d] %s: %w", i, cfg.Type, err)
+		}
+		controller, err := kind.build(d, cfg.Options)
+		if err != nil {
+			return fmt.Errorf("controllers[%d] %s: %w", i, cfg.Type, err)
+		}
+		if err := registry.Register(cfg.Type, controller); err != nil {
+			return fmt.Errorf("controllers[%d]: %w", i, err)
+		}
+		d.logger.Infof("Daemon: registered %s controller as %s", cfg.Kind, cfg.Type)
+	}
+	return nil
+}
+
+// registerMonitorControllers создаёт и регистрирует контроллеры мониторинга из конфигурации
+func (d *Daemon) registerMonitorControllers(registry api.MonitoringControllerRegistry) error {
+	cfgs := d.config.MonitorControllers
+	if cfgs == nil {
+		cfgs = defaultMonitorControllers
+	}
+	for i, cfg := range cfgs {
+		kind, ok := monitorControllerKinds[cfg.Kind]
+		if !ok {
+			return fmt.Errorf("monitor_controllers[%d]: unknown kind %q (known: %s)", i, cfg.Kind, kindNames(monitorControllerKinds))
+		}
+		if cfg.Type == "" {
+			return fmt.Errorf("monitor_controllers[%d]: type is required", i)
+		}
+		if err := checkController(cfg, kind.options); err != nil {
+			return fmt.Errorf("monitor_controllers[%d] %s: %w", i, cfg.Type, err)
+		}
+		controller, err := kind.build(d, cfg.Options)
+		if err != nil {
+			return fmt.Errorf("monitor_controllers[%d] %s: %w", i, cfg.Type, err)
+		}
+		// Ошибка реестра inforo не называет тип, поэтому он добавляется в сообщение
+		if err := registry.Register(cfg.Type, controller); err != nil {
+			return fmt.Errorf("monitor_controllers[%d] %s: %w", i, cfg.Type, err)
+		}
+		d.logger.Infof("Daemon: registered %s monitor controller as %s", cfg.Kind, cfg.Type)
+	}
+	return nil
+}
+
+// newSSHController создаёт SSH-контроллер на общем пуле; параметры переопределяют секцию [ssh]
+func (d *Daemon) newSSHController(opts map[string]string) *controllers.SSHController {
+	ssh := &controllers.SSHController{
+		Logger:        d.logger,
+		KnownHosts:    d.config.SSH.KnownHosts,
+		HostKeyPolicy: d.config.SSH.HostKeyPolicy,
+		HostKeys:      d.hostKeys,
+		Pool:          d.sshPool,
+	}
+	if v := opts["known_hosts"]; v != "" {
+		ssh.KnownHosts = v
+	}
+	if v := opts["host_key_policy"]; v != "" {
+		ssh.HostKeyPolicy = v
+	}
+	return ssh
+}
+
+// checkController проверяет отсутствие неизвестных параметров
+func checkController(cfg config.Controller, allowed []string) error {
+	for key := range cfg.Options {
+		known := false
+		for _, name := range allowed {
+			if key == name {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown option %q for %s controller", key, cfg.Kind)
+		}
+	}
+	return nil
+}
+
+// optionDuration разбирает необязательный параметр-длительность; ноль — значение по умолчанию контроллера
+func optionDuration(opts map[string]string, key string) (time.Duration, error) {
+	raw := opts[key]
+	if raw == "" {
+		return 0, nil
+	}
+	v, err := time.ParseDuration(raw)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid %s %q", key, raw)
+	}
+	return v, nil
+}
+
+func kindNames[K any](kinds map[string]K) string {
+	names := make([]string, 0, len(kinds))
+	for name := range kinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
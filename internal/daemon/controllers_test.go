@@ -0,0 +1,176 @@
+package daemon
+
+import (
+	"context"
+	"io"
+	"laplasd/internal/config"
+	"laplasd/internal/controllers"
+	"laplasd/internal/registry"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/laplasd/inforo"
+	"github.com/laplasd/inforo/api"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestDaemon — демон без запуска, достаточный для регистрации контроллеров
+func newTestDaemon(cfg *config.Config) *Daemon {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	d := New(logger, cfg)
+	d.ctx = context.Background()
+	return d
+}
+
+func newMonitorRegistry(t *testing.T, d *Daemon) api.MonitoringControllerRegistry {
+	t.Helper()
+	monitors, err := inforo.NewMonitoringControllerRegistry(inforo.MonitoringControllerRegistryOptions{Logger: d.logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return monitors
+}
+
+func TestRegisterControllersDefaults(t *testing.T) {
+	d := newTestDaemon(&config.Config{})
+	components := registry.NewControllerRegistry(registry.ControllerRegistryOptions{})
+	if err := d.registerControllers(components); err != nil {
+		t.Fatalf("registerControllers: %v", err)
+	}
+	types, _ := components.ListType()
+	want := "docker-controller,exec-controller,http-controller,kuber-controller,ssh-controller,systemd-controller"
+	if got := strings.Join(types, ","); got != want {
+		t.Errorf("registered %s, want %s", got, want)
+	}
+
+	monitors := newMonitorRegistry(t, d)
+	if err := d.registerMonitorControllers(monitors); err != nil {
+		t.Fatalf("registerMonitorControllers: %v", err)
+	}
+	if _, err := monitors.Get("promql-monitor"); err != nil {
+		t.Errorf("promql-monitor: %v", err)
+	}
+}
+
+func TestRegisterControllersFromConfig(t *testing.T) {
+	d := newTestDaemon(&config.Config{
+		SSH: config.SSH{HostKeyPolicy: "strict"},
+		Controllers: []config.Controller{
+			{Kind: "ssh", Type: "ssh-lab", Options: map[string]string{"host_key_policy": "tofu"}},
+			{Kind: "ssh", Type: "ssh-prod"},
+			{Kind: "docker", Type: "docker-fast", Options: map[string]string{"poll_interval": "100ms"}},
+		},
+	})
+	components := registry.NewControllerRegistry(registry.ControllerRegistryOptions{})
+	if err := d.registerControllers(components); err != nil {
+		t.Fatalf("registerControllers: %v", err)
+	}
+	types, _ := components.ListType()
+	if got := strings.Join(types, ","); got != "docker-fast,ssh-lab,ssh-prod" {
+		t.Fatalf("registered %s, want only the configured controllers", got)
+	}
+
+	for typ, policy := range map[string]string{"ssh-lab": "tofu", "ssh-prod": "strict"} {
+		controller, _ := components.Get(typ)
+		if ssh, ok := controller.(*controllers.SSHController); !ok || ssh.HostKeyPolicy != policy {
+			t.Errorf("%s = %#v, want SSHController with policy %s", typ, controller, policy)
+		}
+	}
+	controller, _ := components.Get("docker-fast")
+	if docker, ok := controller.(*controllers.DockerController); !ok || docker.PollInterval != 100*time.Millisecond {
+		t.Errorf("docker-fast = %#v, want DockerController polling every 100ms", controller)
+	}
+}
+
+func TestRegisterControllersErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfgs    []config.Controller
+		wantErr string
+	}{
+		{
+			name:    "unknown kind",
+			cfgs:    []config.Controller{{Kind: "ftp", Type: "ftp"}},
+			wantErr: `controllers[0]: unknown kind "ftp" (known: docker, exec, http, kuber, ssh, systemd)`,
+		},
+		{
+			name:    "unknown option",
+			cfgs:    []config.Controller{{Kind: "exec", Type: "exec", Options: map[string]string{"shell": "bash"}}},
+			wantErr: `controllers[0] exec: unknown option "shell" for exec controller`,
+		},
+		{
+			name:    "empty type",
+			cfgs:    []config.Controller{{Kind: "http"}},
+			wantErr: "controllers[0]: type is required",
+		},
+		{
+			name:    "duplicate type",
+			cfgs:    []config.Controller{{Kind: "http", Type: "web"}, {Kind: "exec", Type: "web"}},
+			wantErr: "controllers[1]: controller web already registered",
+		},
+		{
+			name:    "invalid option",
+			cfgs:    []config.Controller{{Kind: "kuber", Type: "k8s", Options: map[string]string{"poll_interval": "soon"}}},
+			wantErr: `controllers[0] k8s: invalid poll_interval "soon"`,
+		},
+	}
+	for _, tt := range tests {
+		d := newTestDaemon(&config.Config{Controllers: tt.cfgs})
+		err := d.registerControllers(registry.NewControllerRegistry(registry.ControllerRegistryOptions{}))
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%s: registerControllers = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRegisterMonitorControllersErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfgs    []config.Controller
+		wantErr string
+	}{
+		{
+			name:    "unknown kind",
+			cfgs:    []config.Controller{{Kind: "zabbix", Type: "zabbix"}},
+			wantErr: `monitor_controllers[0]: unknown kind "zabbix" (known: promql)`,
+		},
+		{
+			name:    "unknown option",
+			cfgs:    []config.Controller{{Kind: "promql", Type: "prom", Options: map[string]string{"token": "x"}}},
+			wantErr: `monitor_controllers[0] prom: unknown option "token" for promql controller`,
+		},
+		{
+			name:    "empty type",
+			cfgs:    []config.Controller{{Kind: "promql"}},
+			wantErr: "monitor_controllers[0]: type is required",
+		},
+		{
+			name:    "duplicate type",
+			cfgs:    []config.Controller{{Kind: "promql", Type: "prom"}, {Kind: "promql", Type: "prom"}},
+			wantErr: "monitor_controllers[1] prom: component already registered",
+		},
+	}
+	for _, tt := range tests {
+		d := newTestDaemon(&config.Config{MonitorControllers: tt.cfgs})
+		err := d.registerMonitorControllers(newMonitorRegistry(t, d))
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%s: registerMonitorControllers = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckController(t *testing.T) {
+	cfg := config.Controller{Kind: "systemd", Options: map[string]string{"known_hosts": "/etc/ssh/known_hosts", "poll_interval": "1s"}}
+	if err := checkController(cfg, controllerKinds["systemd"].options); err != nil {
+		t.Errorf("checkController: %v", err)
+	}
+	if err := checkController(config.Controller{Kind: "exec"}, nil); err != nil {
+		t.Errorf("checkController without options: %v", err)
+	}
+	cfg.Kind = "ssh"
+	if err := checkController(cfg, controllerKinds["ssh"].options); err == nil || !strings.Contains(err.Error(), `unknown option "poll_interval" for ssh controller`) {
+		t.Errorf("checkController = %v, want poll_interval rejected for ssh", err)
+	}
+}
@@ -2,12 +2,22 @@ package daemon
 
 import (
 	"context"
+	"fmt"
 	"laplasd/internal/config"
 	"laplasd/internal/controllers"
+	"laplasd/internal/handlers"
 	"laplasd/internal/handlers/watchdog"
 	"laplasd/internal/httpapi"
+	"laplasd/internal/lifecycle"
 	"laplasd/internal/logger"
+	"laplasd/internal/plugins"
+	"laplasd/internal/registry"
+	"laplasd/internal/store"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/laplasd/inforo"
 
@@ -18,82 +28,273 @@ var (
 	unixSocket string = "/tmp/laplasd.sock"
 )
 
+const (
+	/*
+		RUS: Дефолтное время ожидания завершения выполнений при остановке
+		ENG: Default time to wait for in-flight executions on shutdown
+	*/
+	DefaultShutdownTimeout = 30 * time.Second
+)
+
 type Daemon struct {
-	logger  *logrus.Logger
-	core    *inforo.Core
-	config  *config.Config
-	running bool
+	logger     *logrus.Logger
+	core       *inforo.Core
+	config     *config.Config
+	store      store.Store
+	state      *store.Snapshotter
+	executions *lifecycle.Group
+	tasks      *handlers.TaskHandler
+	// Ключи SSH-хостов, которым доверились при первом подключении
+	hostKeys *controllers.HostKeyStore
+	// Общий пул SSH-соединений ssh-controller
+	sshPool *controllers.SSHPool
+	// Вывод выполнений задач
+	outputs *registry.OutputRegistry
+	// Плагины-контроллеры из каталога плагинов
+	plugins *plugins.Manager
+	// Фоновые обработчики (watchdog, снапшоты), завершающиеся по отмене контекста
+	handlers sync.WaitGroup
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	// Контекст работы демона, отменяется в начале остановки
+	ctx context.Context
 }
 
 func New(logger *logrus.Logger, cfg *config.Config) *Daemon {
 	return &Daemon{
-		logger: logger,
-		config: cfg,
+		logger:     logger,
+		config:     cfg,
+		executions: lifecycle.NewGroup(),
 	}
 }
 
 func (d *Daemon) Run() error {
-	d.running = true
 	d.logger.Info("Daemon: starting...")
 
+	// Контекст отменяется по SIGINT/SIGTERM или вызовом Stop
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	d.mu.Lock()
+	d.ctx, d.cancel = ctx, cancel
+	d.mu.Unlock()
+
 	// Инициализация core
 	err := d.initCore()
 	if err != nil {
 		return err
 	}
 
-	d.core.MonitorControllers.Register("promql-monitor", controllers.NewPromQLMonitorController(d.logger, "http://prometheus:9090/api/v1"))
+	d.plugins = plugins.NewManager(plugins.ManagerOptions{
+		Logger:       d.logger,
+		Dir:          d.config.Plugins.Dir,
+		CallTimeout:  d.config.Plugins.CallTimeout,
+		StartTimeout: d.config.Plugins.StartTimeout,
+		TaskTimeout:  d.config.Plugins.TaskTimeout,
+	})
+	err = d.plugins.Load(d.core.Controllers, d.core.MonitorControllers)
+	if err != nil {
+		d.plugins.Close()
+		return err
+	}
 
-	// Создаем контекст с возможностью отмены
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Восстанавливаем состояние после регистрации контроллеров: реестры валидируют метаданные
+	err = d.initStore()
+	if err != nil {
+		d.plugins.Close()
+		return err
+	}
 
 	err = d.initHandlers(ctx)
 	if err != nil {
+		d.plugins.Close()
+		d.closeStore()
 		return err
 	}
 
 	// Удаляем старый сокет, если он существует
 	if err := os.Remove(unixSocket); err != nil && !os.IsNotExist(err) {
 		d.logger.Errorf("Failed to remove socket file: %v", err)
+		cancel()
+		d.shutdown(nil)
 		return err
 	}
 
 	// Инициализация и запуск API (один раз)
-	api := httpapi.New(d.core, unixSocket, logger.Log, d.config.Server)
+	api := httpapi.New(d.core, unixSocket, logger.Log, d.config.Server, d.executions, d.tasks)
+	apiErr := make(chan error, 1)
 	go func() {
-		if err := api.Start(); err != nil {
-			d.logger.Fatalf("API error: %v", err)
-		}
+		apiErr <- api.Start()
 	}()
 
-	// Основной цикл просто проверяет флаг running
-	for d.running {
-		// Можно добавить небольшую паузу, чтобы не нагружать CPU
-		// time.Sleep(100 * time.Millisecond)
+	var runErr error
+	select {
+	case <-ctx.Done():
+		d.logger.Info("Daemon: shutdown requested")
+	case err := <-apiErr:
+		if err != nil {
+			runErr = fmt.Errorf("API error: %w", err)
+		}
 	}
 
+	cancel()
+	d.shutdown(api)
+
 	d.logger.Info("Daemon: stopped")
-	return nil
+	return runErr
 }
 
+// Stop инициирует остановку; Run вернётся после завершения выполнений
 func (d *Daemon) Stop() {
-	d.running = false
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	d.logger.Info("Daemon: stopping")
+	if d.cancel != nil {
+		d.cancel()
+	}
+}
+
+// shutdown закрывает API, ждёт выполнения в пределах server.shutdown_timeout и сохраняет состояние
+func (d *Daemon) shutdown(api *httpapi.APIServer) {
+	timeout := d.config.Server.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	d.executions.Close()
+
+	if api != nil {
+		if err := api.Shutdown(ctx); err != nil {
+			d.logger.Errorf("Daemon: API shutdown: %v", err)
+		}
+	}
+
+	d.logger.Infof("Daemon: waiting up to %s for running executions", timeout)
+	if err := d.executions.Wait(ctx); err != nil {
+		d.logger.Warnf("Daemon: executions did not finish in time: %v", err)
+	}
+
+	handlersDone := make(chan struct{})
+	go func() {
+		d.handlers.Wait()
+		close(handlersDone)
+	}()
+	select {
+	case <-handlersDone:
+	case <-ctx.Done():
+		d.logger.Warnf("Daemon: handlers did not stop in time: %v", ctx.Err())
+	}
+
+	if d.sshPool != nil {
+		d.sshPool.Close()
+	}
+	if d.plugins != nil {
+		d.plugins.Close()
+	}
+
+	d.closeStore()
 }
 
 func (d *Daemon) initCore() error {
 
 	d.logger.Debugf("Daemon: Init Core")
 
+	// Контроллеры laplasd вместо встроенных в inforo, по секциям [[controllers]] config.toml
+	componentControllers := registry.NewControllerRegistry(registry.ControllerRegistryOptions{Logger: d.logger})
+	d.hostKeys = controllers.NewHostKeyStore()
+	d.sshPool = controllers.NewSSHPool(controllers.SSHPoolOptions{
+		Logger:             d.logger,
+		MaxConnsPerHost:    d.config.SSH.MaxConnsPerHost,
+		MaxSessionsPerConn: d.config.SSH.MaxSessionsPerConn,
+		IdleTimeout:        d.config.SSH.IdleTimeout,
+		KeepAliveInterval:  d.config.SSH.KeepAliveInterval,
+	})
+	if err := d.registerControllers(componentControllers); err != nil {
+		return err
+	}
+
 	opts := inforo.CoreOptions{
-		Logger: d.logger,
+		Logger:      d.logger,
+		Controllers: componentControllers,
 	}
 	d.logger.Debugf("Daemon: Init Core with opts: %v", opts)
 	d.core = inforo.NewCore(opts)
+
+	if err := d.registerMonitorControllers(d.core.MonitorControllers); err != nil {
+		return err
+	}
+
+	d.outputs = registry.NewOutputRegistry(registry.OutputRegistryOptions{
+		Logger:  d.logger,
+		Limit:   d.config.Tasks.OutputLimit,
+		History: d.config.Tasks.OutputHistory,
+	})
+	tasks, err := handlers.NewTaskHandler(d.logger, d.core, d.executions, d.outputs)
+	if err != nil {
+		return err
+	}
+	d.tasks = tasks
+
+	// Собственный реестр планов: восстанавливает планы с исходными ID и выполняет задачи через TaskHandler
+	plans, err := registry.NewPlanRegistry(registry.PlanRegistryOptions{
+		Logger:        d.logger,
+		Components:    d.core.Components,
+		Tasks:         d.core.Tasks,
+		Runner:        d.tasks,
+		MaxWorkers:    d.config.Plans.MaxWorkers,
+		FailurePolicy: registry.FailurePolicy(d.config.Plans.FailurePolicy),
+	})
+	if err != nil {
+		return err
+	}
+	d.core.Plans = plans
 	return nil
 }
 
+func (d *Daemon) initStore() error {
+	if d.config.Database.URL == "" {
+		d.logger.Info("Daemon: database.url is empty, state will not be persisted")
+		return nil
+	}
+
+	d.logger.Debugf("Daemon: Init Store")
+	st, err := store.New(d.config.Database)
+	if err != nil {
+		return err
+	}
+	d.store = st
+	d.state = store.NewSnapshotter(store.SnapshotterOpts{
+		Logger:   d.logger,
+		Core:     d.core,
+		Store:    st,
+		HostKeys: d.hostKeys,
+		Outputs:  d.outputs,
+	})
+	// Ключ, которому доверились, сохраняем вне очереди: иначе после рестарта хост снова будет «первым».
+	// OnTrust вызывается из проверки ключа во время handshake, поэтому сохранение асинхронное
+	d.hostKeys.OnTrust = d.state.RequestSave
+
+	return d.state.Restore()
+}
+
+func (d *Daemon) closeStore() {
+	if d.store == nil {
+		return
+	}
+	if err := d.state.Save(); err != nil {
+		d.logger.Errorf("Daemon: failed to save state: %v", err)
+	}
+	if err := d.store.Close(); err != nil {
+		d.logger.Errorf("Daemon: failed to close store: %v", err)
+	}
+}
+
 func (d *Daemon) initHandlers(ctx context.Context) error {
 	d.logger.Debugf("Daemon: Init Handlers")
 
@@ -116,29 +317,24 @@ func (d *Daemon) initHandlers(ctx context.Context) error {
 	}
 
 	/*
-		Monitor - Обработчик и очень важный
-	*/
-	/*
-		monitorOpts := monitor.MonitorOpts{
-			Logger: d.logger,
-			Core:   d.core,
-		}
-		monitoringHandler, err := monitor.NewMonitor(monitorOpts)
-		if err != nil {
-			return err
-		}
-
-
-			taskHandler, err := handlers.NewTaskHandler(d.logger, core)
-			if err != nil {
-				return err
-			}
+		TaskHandler - выполняет задачи из очереди (создаётся в initCore)
 	*/
 
 	// Запускаем обработчики в горутинах (один раз)
-	go watchdog.RunProcessor(ctx)
-	//go monitoringHandler.RunProcessor(ctx)
-	//go taskHandler.RunProcessor(ctx)
+	d.goHandler(func() { watchdog.RunProcessor(ctx) })
+	d.goHandler(func() { d.tasks.RunProcessor(ctx) })
+
+	if d.state != nil {
+		d.goHandler(func() { d.state.Run(ctx, d.config.Database.SnapshotInterval) })
+	}
 
 	return nil
 }
+
+func (d *Daemon) goHandler(fn func()) {
+	d.handlers.Add(1)
+	go func() {
+		defer d.handlers.Done()
+		fn()
+	}()
+}
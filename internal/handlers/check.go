@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/laplasd/inforo/api"
+	"github.com/laplasd/inforo/model"
+)
+
+const (
+	/*
+		RUS: Пауза между попытками проверки, если в метаданных нет "retry_interval"
+		ENG: Delay between check attempts when "retry_interval" is not set in metadata
+	*/
+	DefaultCheckInterval = 5 * time.Second
+)
+
+// checkPolicy — параметры повторов проверки из её метаданных:
+//
+//	retries        — число повторов после первой неудачной попытки (по умолчанию 0)
+//	retry_interval — пауза между попытками (по умолчанию 5s)
+//	check_timeout  — общий таймаут проверки со всеми попытками (по умолчанию без ограничения)
+type checkPolicy struct {
+	retries  int
+	interval time.Duration
+	timeout  time.Duration
+}
+
+func parseCheckPolicy(meta map[string]string) (checkPolicy, error) {
+	policy := checkPolicy{interval: DefaultCheckInterval}
+
+	if v := meta["retries"]; v != "" {
+		retries, err := strconv.Atoi(v)
+		if err != nil || retries < 0 {
+			return policy, fmt.Errorf("invalid retries %q", v)
+		}
+		policy.retries = retries
+	}
+	if v := meta["retry_interval"]; v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval < 0 {
+			return policy, fmt.Errorf("invalid retry_interval %q", v)
+		}
+		policy.interval = interval
+	}
+	if v := meta["check_timeout"]; v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return policy, fmt.Errorf("invalid check_timeout %q", v)
+		}
+		policy.timeout = timeout
+	}
+	return policy, nil
+}
+
+// runChecks выполняет проверки по очереди и останавливается на первой непрошедшей
+func (t *TaskHandler) runChecks(task *model.Task, checks []*model.Check) error {
+	for _, check := range checks {
+		t.updateCheckStatus(check, model.StatusPending)
+	}
+	for _, check := range checks {
+		if err := t.runCheck(check); err != nil {
+			t.updateCheckStatus(check, model.StatusFailed)
+			t.addCheckEvent(check, err.Error())
+			return fmt.Errorf("check %s: %w", check.ID, err)
+		}
+		t.updateCheckStatus(check, model.StatusSuccess)
+		t.addCheckEvent(check, "Check passed")
+		t.addEvent(task, fmt.Sprintf("Check %s passed", check.ID))
+	}
+	return nil
+}
+
+// runCheck вызывает RunCheck контроллера мониторинга с повторами согласно checkPolicy
+func (t *TaskHandler) runCheck(check *model.Check) error {
+	controller, meta, err := t.checkController(check)
+	if err != nil {
+		return err
+	}
+	policy, err := parseCheckPolicy(check.Metadata)
+	if err != nil {
+		return err
+	}
+	if err := controller.ValidateCheck(meta); err != nil {
+		return fmt.Errorf("invalid check: %w", err)
+	}
+
+	var deadline <-chan time.Time
+	if policy.timeout > 0 {
+		timer := time.NewTimer(policy.timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	attempts := policy.retries + 1
+	for attempt := 1; ; attempt++ {
+		t.updateCheckStatus(check, model.StatusCheck)
+
+		// RunCheck не принимает контекст: общий таймаут ограничивает ожидание результата
+		result := make(chan error, 1)
+		go func() { result <- controller.RunCheck(meta) }()
+
+		select {
+		case err = <-result:
+		case <-deadline:
+			return fmt.Errorf("timed out after %s (attempt %d of %d)", policy.timeout, attempt, attempts)
+		}
+		if err == nil {
+			return nil
+		}
+		if attempt == attempts {
+			return fmt.Errorf("failed after %d attempt(s): %w", attempts, err)
+		}
+
+		t.logger.Debugf("Check %s attempt %d of %d failed: %v", check.ID, attempt, attempts, err)
+		t.updateCheckStatus(check, model.StatusRetry)
+		t.addCheckEvent(check, fmt.Sprintf("Attempt %d of %d failed: %v", attempt, attempts, err))
+
+		select {
+		case <-time.After(policy.interval):
+		case <-deadline:
+			return fmt.Errorf("timed out after %s (attempt %d of %d): %w", policy.timeout, attempt, attempts, err)
+		}
+	}
+}
+
+// checkController находит контроллер по типу мониторинга, на который ссылается проверка,
+// и собирает метаданные для него: Monitoring.Config задаёт значения по умолчанию
+// (подключение, авторизацию, таймауты), метаданные проверки их переопределяют
+func (t *TaskHandler) checkController(check *model.Check) (api.MonitoringController, map[string]string, error) {
+	monitor, err := t.core.Monitorings.Get(check.MonitoringID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("monitoring %s: %w", check.MonitoringID, err)
+	}
+	controller, err := t.core.MonitorControllers.Get(monitor.Type)
+	if err != nil {
+		return nil, nil, fmt.Errorf("monitoring %s: %w", monitor.ID, err)
+	}
+
+	meta := make(map[string]string, len(check.Metadata)+len(monitor.Config))
+	monitor.MU.RLock()
+	for k, v := range monitor.Config {
+		meta[k] = v
+	}
+	monitor.MU.RUnlock()
+	for k, v := range check.Metadata {
+		meta[k] = v
+	}
+
+	t.logger.Debugf("Running check %s with monitoring %s", check.ID, monitor.ID)
+	return controller, meta, nil
+}
+
+func (t *TaskHandler) updateCheckStatus(check *model.Check, status model.Status) {
+	check.MU.Lock()
+	defer check.MU.Unlock()
+
+	if check.StatusHistory == nil {
+		check.StatusHistory = t.core.Tasks.NewStatus(status)
+		return
+	}
+	check.StatusHistory = t.core.Tasks.NextStatus(status, check.StatusHistory)
+}
+
+func (t *TaskHandler) addCheckEvent(check *model.Check, message string) {
+	check.MU.Lock()
+	if check.EventHistory == nil {
+		check.EventHistory = &model.EventHistory{}
+	}
+	events := check.EventHistory
+	check.MU.Unlock()
+
+	events.MU.Lock()
+	defer events.MU.Unlock()
+	t.core.Tasks.AddEvent(events, message)
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/laplasd/inforo/model"
+)
+
+// fakeMonitoring — контроллер мониторинга: проверка падает fails раз, затем проходит.
+// С hang проверка не возвращается, пока тест не закроет release.
+type fakeMonitoring struct {
+	mu      sync.Mutex
+	fails   int
+	hang    bool
+	release chan struct{}
+	calls   int
+}
+
+func (m *fakeMonitoring) RunCheck(meta map[string]string) error {
+	m.mu.Lock()
+	m.calls++
+	hang, release := m.hang, m.release
+	fail := m.calls <= m.fails
+	m.mu.Unlock()
+
+	if hang {
+		<-release
+	}
+	if fail {
+		return errors.New("condition not met")
+	}
+	return nil
+}
+
+func (m *fakeMonitoring) CheckMonitoring(config map[string]string) error    { return nil }
+func (m *fakeMonitoring) ValidateCheck(meta map[string]string) error        { return nil }
+func (m *fakeMonitoring) ValidateMonitoring(config map[string]string) error { return nil }
+
+func (m *fakeMonitoring) callCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls
+}
+
+// newCheckHandler добавляет к ядру newTestHandler мониторинг "m1" с контроллером monitoring
+func newCheckHandler(t *testing.T, controller *fakeController, monitoring *fakeMonitoring) *TaskHandler {
+	t.Helper()
+	h := newTestHandler(t, controller)
+	if err := h.core.MonitorControllers.Register("fake", monitoring); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.core.Monitorings.Register("fake", &model.Monitoring{ID: "m1", Name: "prom", Type: "fake"}); err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func newCheck(meta map[string]string) *model.Check {
+	return &model.Check{ID: "k1", MonitoringID: "m1", Metadata: meta}
+}
+
+// checkStatuses возвращает статусы проверки от первого к последнему так, как их отдаёт GET /task/:id
+func checkStatuses(t *testing.T, check *model.Check) []model.Status {
+	t.Helper()
+	data, err := json.Marshal(check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded model.Check
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	history := decoded.StatusHistory
+	if history == nil {
+		return nil
+	}
+	statuses := []model.Status{history.LastStatus}
+	// Previous хранит историю от новых статусов к старым
+	for _, prev := range history.Previous {
+		statuses = append([]model.Status{prev.Status}, statuses...)
+	}
+	return statuses
+}
+
+func joinStatuses(statuses []model.Status) string {
+	parts := make([]string, len(statuses))
+	for i, s := range statuses {
+		parts[i] = string(s)
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestRunChecksRetriesUntilSuccess(t *testing.T) {
+	monitoring := &fakeMonitoring{fails: 2}
+	h := newCheckHandler(t, &fakeController{}, monitoring)
+	task := registerTask(t, h, "t1", nil)
+	check := newCheck(map[string]string{"retries": "2", "retry_interval": "1ms"})
+
+	if err := h.runChecks(task, []*model.Check{check}); err != nil {
+		t.Fatalf("runChecks: %v", err)
+	}
+	if n := monitoring.callCount(); n != 3 {
+		t.Errorf("RunCheck called %d times, want 3", n)
+	}
+	want := "pending,checking,retry,checking,retry,checking,success"
+	if got := joinStatuses(checkStatuses(t, check)); got != want {
+		t.Errorf("check statuses = %s, want %s", got, want)
+	}
+}
+
+func TestRunChecksFailsAfterRetries(t *testing.T) {
+	monitoring := &fakeMonitoring{fails: 5}
+	h := newCheckHandler(t, &fakeController{}, monitoring)
+	task := registerTask(t, h, "t1", nil)
+	check := newCheck(map[string]string{"retries": "1", "retry_interval": "1ms"})
+
+	err := h.runChecks(task, []*model.Check{check})
+	if err == nil || !strings.Contains(err.Error(), "failed after 2 attempt(s)") {
+		t.Fatalf("runChecks = %v, want failure after 2 attempts", err)
+	}
+	if n := monitoring.callCount(); n != 2 {
+		t.Errorf("RunCheck called %d times, want 2", n)
+	}
+	want := "pending,checking,retry,checking,failed"
+	if got := joinStatuses(checkStatuses(t, check)); got != want {
+		t.Errorf("check statuses = %s, want %s", got, want)
+	}
+}
+
+func TestRunChecksWaitsRetryInterval(t *testing.T) {
+	monitoring := &fakeMonitoring{fails: 1}
+	h := newCheckHandler(t, &fakeController{}, monitoring)
+	task := registerTask(t, h, "t1", nil)
+	check := newCheck(map[string]string{"retries": "1", "retry_interval": "50ms"})
+
+	start := time.Now()
+	if err := h.runChecks(task, []*model.Check{check}); err != nil {
+		t.Fatalf("runChecks: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("retried after %s, want at least retry_interval", elapsed)
+	}
+}
+
+func TestRunChecksTimeoutCutsHungCheck(t *testing.T) {
+	monitoring := &fakeMonitoring{hang: true, release: make(chan struct{})}
+	defer close(monitoring.release)
+	h := newCheckHandler(t, &fakeController{}, monitoring)
+	task := registerTask(t, h, "t1", nil)
+	check := newCheck(map[string]string{"retries": "3", "check_timeout": "30ms"})
+
+	start := time.Now()
+	err := h.runChecks(task, []*model.Check{check})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 30ms") {
+		t.Fatalf("runChecks = %v, want timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("hung check returned after %s, want about check_timeout", elapsed)
+	}
+	want := "pending,checking,failed"
+	if got := joinStatuses(checkStatuses(t, check)); got != want {
+		t.Errorf("check statuses = %s, want %s", got, want)
+	}
+}
+
+func TestPreCheckFailureStopsRunTask(t *testing.T) {
+	controller := &fakeController{}
+	monitoring := &fakeMonitoring{fails: 1}
+	h := newCheckHandler(t, controller, monitoring)
+	task, err := h.core.Tasks.Register(&model.Task{
+		ID:         "t1",
+		Type:       model.UpdateTask,
+		Components: []string{"c1"},
+		PreChecks:  []*model.Check{newCheck(nil)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Execute("t1", ""); err == nil || !strings.Contains(err.Error(), "pre-check failed") {
+		t.Fatalf("Execute = %v, want pre-check error", err)
+	}
+	if ran := controller.runs(); len(ran) != 0 {
+		t.Errorf("RunTask called after failed pre-check: %v", ran)
+	}
+	if status := lastStatus(task); status != model.StatusFailed {
+		t.Errorf("task status = %s, want %s", status, model.StatusFailed)
+	}
+	if got := joinStatuses(checkStatuses(t, task.PreChecks[0])); got != "pending,checking,failed" {
+		t.Errorf("pre-check statuses = %s", got)
+	}
+}
+
+func TestPostCheckRunsAfterTask(t *testing.T) {
+	controller := &fakeController{}
+	monitoring := &fakeMonitoring{}
+	h := newCheckHandler(t, controller, monitoring)
+	task, err := h.core.Tasks.Register(&model.Task{
+		ID:         "t1",
+		Type:       model.UpdateTask,
+		Components: []string{"c1"},
+		PostChecks: []*model.Check{newCheck(nil)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Execute("t1", ""); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if len(controller.runs()) != 1 || monitoring.callCount() != 1 {
+		t.Errorf("ran %d tasks and %d checks, want 1 and 1", len(controller.runs()), monitoring.callCount())
+	}
+	if status := lastStatus(task); status != model.StatusSuccess {
+		t.Errorf("task status = %s, want %s", status, model.StatusSuccess)
+	}
+}
+
+func TestParseCheckPolicy(t *testing.T) {
+	policy, err := parseCheckPolicy(nil)
+	if err != nil || policy != (checkPolicy{interval: DefaultCheckInterval}) {
+		t.Errorf("default policy = %+v, %v", policy, err)
+	}
+	policy, err = parseCheckPolicy(map[string]string{"retries": "3", "retry_interval": "2s", "check_timeout": "1m"})
+	if err != nil || policy != (checkPolicy{retries: 3, interval: 2 * time.Second, timeout: time.Minute}) {
+		t.Errorf("policy = %+v, %v", policy, err)
+	}
+
+	for _, meta := range []map[string]string{
+		{"retries": "-1"},
+		{"retries": "many"},
+		{"retry_interval": "-1s"},
+		{"retry_interval": "5"},
+		{"check_timeout": "0s"},
+		{"check_timeout": "soon"},
+	} {
+		if _, err := parseCheckPolicy(meta); err == nil {
+			t.Errorf("parseCheckPolicy(%v) succeeded, want error", meta)
+		}
+	}
+}
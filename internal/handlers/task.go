@@ -2,6 +2,13 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"laplasd/internal/controllers"
+	"laplasd/internal/lifecycle"
+	"laplasd/internal/registry"
+	"strconv"
 	"sync"
 	"time"
 
@@ -9,28 +16,60 @@ import (
 	"github.com/laplasd/inforo/api"
 	"github.com/laplasd/inforo/model"
 
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
 type TaskHandler struct {
-	logger *logrus.Logger
-	mu     sync.Mutex
-	core   *inforo.Core
+	logger     *logrus.Logger
+	mu         sync.Mutex
+	core       *inforo.Core
+	executions *lifecycle.Group
+	// Задачи, выполняющиеся прямо сейчас этим обработчиком
+	active map[string]bool
+	// Вывод и коды завершения выполнений задач
+	outputs *registry.OutputRegistry
+	// Повторы задач по max_retries; под mu
+	retries map[string]*taskRetry
 }
 
-func NewTaskHandler(logger *logrus.Logger, core *inforo.Core) (*TaskHandler, error) {
+// taskRetry — повторы задачи, упавшей при самостоятельном выполнении из очереди.
+// Задачи, упавшие в плане или на откате, не повторяются: их судьбу решает план.
+type taskRetry struct {
+	attempts int
+	// Последнее выполнение задачи упало и ещё не повторено
+	failed bool
+}
+
+// taskTarget — компонент задачи и контроллер его типа
+type taskTarget struct {
+	component  *model.Component
+	controller api.Controller
+}
+
+func NewTaskHandler(logger *logrus.Logger, core *inforo.Core, executions *lifecycle.Group, outputs *registry.OutputRegistry) (*TaskHandler, error) {
+	if executions == nil {
+		executions = lifecycle.NewGroup()
+	}
+	if outputs == nil {
+		outputs = registry.NewOutputRegistry(registry.OutputRegistryOptions{Logger: logger})
+	}
 
 	taskHandler := &TaskHandler{
-		logger: logger,
-		core:   core,
+		logger:     logger,
+		core:       core,
+		executions: executions,
+		active:     make(map[string]bool),
+		outputs:    outputs,
+		retries:    make(map[string]*taskRetry),
 	}
 
 	return taskHandler, nil
 }
 
 func (t *TaskHandler) RunProcessor(ctx context.Context) {
-	t.logger.Debug("TaskManager: Component Handler started")
-	defer t.logger.Info("TaskManager: Component Handler stopped")
+	t.logger.Debug("TaskManager: Task Handler started")
+	defer t.logger.Info("TaskManager: Task Handler stopped")
 
 	var (
 		DELAY_PENDING_STATUS = 5 * time.Second
@@ -63,200 +102,463 @@ func (t *TaskHandler) RunProcessor(ctx context.Context) {
 	}
 }
 
-// Обработка компонентов по статусу с указанным обработчиком
+// Обработка задач по статусу с указанным обработчиком
 func (t *TaskHandler) processTasks(status model.Status, handler func(*model.Task)) {
 	tasks, _ := t.core.Tasks.List()
 	for _, task := range tasks {
 		// безопасная проверка nil статуса
-		if task.StatusHistory == nil || task.StatusHistory.LastStatus != status {
+		if lastStatus(task) != status || t.isActive(task.ID) {
 			continue
 		}
 		// создаём копию внутри цикла для безопасной горутины
 		copied := task
-		go handler(copied)
+		if !t.executions.Go(func() { handler(copied) }) {
+			// Демон останавливается — новые выполнения не запускаем
+			return
+		}
 	}
 }
 
-func (t *TaskHandler) handlePending(task *model.Task) {
-	t.logger.Debugf("Processing pending task ID='%s'", task.ID)
-	t.updateStatus(task, model.StatusCheck)
-	t.addEvent(task, "Task created")
-	t.checkAndUpdate(task)
+// Enqueue ставит задачу в очередь: обработчик выполнит её на ближайшем тике pending
+func (t *TaskHandler) Enqueue(taskID string) error {
+	task, err := t.core.Tasks.Get(taskID)
+	if err != nil {
+		return err
+	}
+	if t.isActive(taskID) {
+		return fmt.Errorf("task %s is already running", taskID)
+	}
+	t.resetRetries(taskID)
+	t.updateStatus(task, model.StatusPending)
+	t.addEvent(task, "Task queued")
+	return nil
 }
 
-func (t *TaskHandler) retryFailed(task *model.Task) {
-	t.logger.Debugf("Retrying failed task ID='%s'", task.ID)
-	if err := t.check(task); err != nil {
-		t.logger.Warnf("Retry failed for task ID='%s': %v", task.ID, err)
-		return
-	}
-	t.updateStatus(task, model.StatusRunning)
-	t.addEvent(task, "Task recovered")
+// Execute синхронно выполняет задачу: зависимости, проверки компонентов,
+// PreChecks, RunTask контроллера и PostChecks.
+func (t *TaskHandler) Execute(taskID string, executionID string) error {
+	return t.execute(taskID, executionID, false)
 }
 
-func (t *TaskHandler) recheck(task *model.Task) {
-	t.logger.Debugf("Rechecking task ID='%s'", task.ID)
-	if err := t.check(task); err != nil {
-		t.logger.Warnf("Task ID='%s' failed recheck: %v", task.ID, err)
-		t.updateStatus(task, model.StatusFailed)
-		t.addEvent(task, err.Error())
-		return
+// execute выполняет задачу; queued — задача взята из очереди, а не из плана или зависимостей,
+// и при неудаче её можно повторить по max_retries
+func (t *TaskHandler) execute(taskID string, executionID string, queued bool) error {
+	if executionID == "" {
+		executionID = uuid.New().String()
+	}
+
+	task, err := t.core.Tasks.Get(taskID)
+	if err != nil {
+		return err
+	}
+	if !t.acquire(taskID) {
+		return fmt.Errorf("task %s is already running", taskID)
 	}
-	t.logger.Debugf("Task ID='%s' is healthy", task.ID)
+	defer t.release(taskID)
+
+	err = t.executeTask(task, executionID)
+	if err != nil && queued {
+		t.markRetry(taskID)
+	} else {
+		t.resetRetries(taskID)
+	}
+	return err
 }
 
-func (t *TaskHandler) checkAndUpdate(task *model.Task) error {
-	if err := t.check(task); err != nil {
-		t.logger.Errorf("Check failed for task ID='%s': %v", task.ID, err)
-		t.updateStatus(task, model.StatusFailed)
-		t.addEvent(task, err.Error())
+// RollBack выполняет RollBack-метаданные задачи на всех её компонентах
+func (t *TaskHandler) RollBack(taskID string, executionID string) error {
+	if executionID == "" {
+		executionID = uuid.New().String()
+	}
+
+	task, err := t.core.Tasks.Get(taskID)
+	if err != nil {
 		return err
 	}
+	if task.RollBack == nil {
+		return fmt.Errorf("task %s has no rollback", taskID)
+	}
+	if !t.acquire(taskID) {
+		return fmt.Errorf("task %s is already running", taskID)
+	}
+	defer t.release(taskID)
+	t.resetRetries(taskID)
 
-	t.mu.Lock()
-	defer t.mu.Unlock()
+	t.logger.Infof("[%s] Rolling back task '%s'", executionID, task.ID)
+	t.addEvent(task, "Rolling back task...")
 
-	if _, err := t.core.Tasks.Get(task.ID); err == nil {
-		t.updateStatus(task, model.StatusRunning)
-		t.addEvent(task, "Task started")
-		t.executeTask(task)
+	t.outputs.BeginLog(task.ID, executionID)
+	err = t.runRollBack(task, executionID)
+	t.outputs.EndLog(task.ID, executionID, err)
+	if err != nil {
+		t.logger.Errorf("[%s] RollBack of task %s failed: %v", executionID, task.ID, err)
+		t.updateStatus(task, model.StatusFailed)
+		t.addEvent(task, fmt.Sprintf("RollBack failed: %v", err))
+		return err
 	}
+
+	t.updateStatus(task, model.StatusRollBack)
+	t.addEvent(task, "Task rolled back")
 	return nil
 }
 
-func (t *TaskHandler) check(task *model.Task) error {
-	t.core.Tasks.AddEvent(task.EventHistory, "Check components...")
-	t.core.Tasks.Update(task.ID, task)
-	/*
-		component, err := t.core.Components.Get(task.ComponentID)
-		if err != nil {
-			return err
-		}
-		t.logger.Debugf("TaskManager[task:%s]: Component ID='%s'", task.ID, component.ID)
+func (t *TaskHandler) runRollBack(task *model.Task, executionID string) error {
+	targets, err := t.resolveTargets(task)
+	if err != nil {
+		return err
+	}
 
-		controller, err := t.core.Controllers.Get(component.Type)
-		if err != nil {
-			return err
-		}
-		t.logger.Debugf("TaskManager[task:%s]: Controller Type='%s'", task.ID, component.Type)
+	meta := make(map[string]string, len(task.RollBack.Metadata)+2)
+	for k, v := range task.RollBack.Metadata {
+		meta[k] = v
+	}
+	if meta["id"] == "" {
+		meta["id"] = task.ID
+	}
+	if meta["type"] == "" {
+		meta["type"] = string(model.RollbackTask)
+	}
 
-		err = controller.CheckComponent(component.Metadata)
-		if err != nil {
-			return err
+	for _, target := range targets {
+		if err := target.controller.ValideTask(meta); err != nil {
+			return fmt.Errorf("invalid rollback for component %s: %w", target.component.ID, err)
 		}
-	*/
+		if err := t.runTarget(task, executionID, registry.OutputRollBack, target, meta); err != nil {
+			return fmt.Errorf("component %s: %w", target.component.ID, err)
+		}
+	}
 	return nil
 }
 
-// Обёртка, безопасная к nil-Status
-func (t *TaskHandler) safeNextStatus(cm api.ComponentRegistry, status model.Status, current *model.StatusHistory) *model.StatusHistory {
-	if current == nil {
-		return cm.NewStatus(status)
+// Outputs возвращает сохранённые результаты выполнений задачи, от старых к новым
+func (t *TaskHandler) Outputs(taskID string) ([]*registry.TaskOutput, error) {
+	if _, err := t.core.Tasks.Get(taskID); err != nil {
+		return nil, err
 	}
-	return cm.NextStatus(status, current)
+	return t.outputs.List(taskID), nil
 }
 
-func (t *TaskHandler) executeTask(task *model.Task) {
-	t.logger.Infof("Execute Task '%s', status='%s'!", task.ID, task.StatusHistory.LastStatus)
-	err := t.runTaskLogic(task)
+// DeleteOutputs удаляет сохранённый вывод задачи; из хранилища он уйдёт со следующим снапшотом
+func (t *TaskHandler) DeleteOutputs(taskID string) {
+	t.outputs.Delete(taskID)
+}
 
-	t.mu.Lock()
-	defer t.mu.Unlock()
+// Logs возвращает строки вывода последнего выполнения задачи
+func (t *TaskHandler) Logs(taskID string) ([]registry.LogEvent, error) {
+	if _, err := t.core.Tasks.Get(taskID); err != nil {
+		return nil, err
+	}
+	return t.outputs.Logs(taskID), nil
+}
+
+// FollowLogs подписывается на вывод задачи до конца текущего выполнения.
+// Задача в очереди ещё не выполняется: подписка дождётся её запуска.
+func (t *TaskHandler) FollowLogs(taskID string) (*registry.LogSubscription, error) {
+	task, err := t.core.Tasks.Get(taskID)
 	if err != nil {
-		t.logger.Errorf("Task %s failed: %v", task.ID, err)
-		task.StatusHistory = t.core.Tasks.NextStatus(model.StatusFailed, task.StatusHistory)
-		t.core.Tasks.Update(task.ID, task)
-	} else {
-		t.logger.Infof("Task %s completed successfully", task.ID)
-		task.StatusHistory = t.core.Tasks.NextStatus(model.StatusSuccess, task.StatusHistory)
-		t.core.Tasks.Update(task.ID, task)
+		return nil, err
+	}
+	var wait bool
+	switch lastStatus(task) {
+	case model.StatusPending, model.StatusCheck, model.StatusRunning:
+		wait = true
 	}
+	return t.outputs.Subscribe(taskID, wait || t.isActive(taskID)), nil
 }
 
-func (t *TaskHandler) runChecks(checks []*model.Check) error {
-	for _, check := range checks {
-		monitor, err := t.core.Monitorings.Get(check.MonitoringID)
-		if err != nil {
-			return err
+// runTarget выполняет задачу на компоненте и сохраняет её вывод, код завершения и время выполнения
+func (t *TaskHandler) runTarget(task *model.Task, executionID string, action string, target taskTarget, meta map[string]string) error {
+	output := &registry.TaskOutput{
+		ExecutionID: executionID,
+		Action:      action,
+		ComponentID: target.component.ID,
+		StartedAt:   time.Now(),
+	}
+	stdout, stderr := t.outputs.NewBuffer(), t.outputs.NewBuffer()
+	stdoutLog := t.outputs.NewLogWriter(task.ID, executionID, target.component.ID, registry.StreamStdout)
+	stderrLog := t.outputs.NewLogWriter(task.ID, executionID, target.component.ID, registry.StreamStderr)
+
+	var err error
+	if runner, ok := target.controller.(controllers.OutputRunner); ok {
+		err = runner.RunTaskOutput(meta, target.component.Metadata, controllers.TaskOutput{
+			Stdout: io.MultiWriter(stdout, stdoutLog),
+			Stderr: io.MultiWriter(stderr, stderrLog),
+		})
+		stdoutLog.Flush()
+		stderrLog.Flush()
+		if code, ok := controllers.ExitCode(err); ok {
+			output.ExitCode = &code
 		}
-		t.logger.Infof("monitor %v for Check %s!", monitor, check.ID)
+	} else {
+		err = target.controller.RunTask(meta, target.component.Metadata)
+	}
+
+	output.Finish(stdout, stderr, err)
+	t.outputs.Add(task.ID, output)
+	return err
+}
+
+func (t *TaskHandler) handlePending(task *model.Task) {
+	t.logger.Debugf("Processing pending task ID='%s'", task.ID)
+	if err := t.execute(task.ID, "", true); err != nil {
+		t.logger.Warnf("Pending task ID='%s' failed: %v", task.ID, err)
+	}
+}
+
+// Задача, упавшая при выполнении из очереди, повторяется, если это разрешено metadata "max_retries"
+func (t *TaskHandler) retryFailed(task *model.Task) {
+	maxRetries, _ := strconv.Atoi(task.Metadata["max_retries"])
+
+	t.mu.Lock()
+	retry := t.retries[task.ID]
+	if retry == nil || !retry.failed || retry.attempts >= maxRetries {
+		t.mu.Unlock()
+		return
+	}
+	retry.attempts++
+	retry.failed = false
+	attempts := retry.attempts
+	t.mu.Unlock()
+
+	t.logger.Debugf("Retrying failed task ID='%s' (%d/%d)", task.ID, attempts, maxRetries)
+	t.addEvent(task, fmt.Sprintf("Retrying task (attempt %d of %d)", attempts, maxRetries))
+	t.updateStatus(task, model.StatusPending)
+}
+
+// Задача в статусе running, которую никто не выполняет, потеряла своё выполнение
+func (t *TaskHandler) recheck(task *model.Task) {
+	if t.isActive(task.ID) {
+		return
+	}
+	t.logger.Warnf("Task ID='%s' is running without an execution", task.ID)
+	t.updateStatus(task, model.StatusFailed)
+	t.addEvent(task, "Task execution lost")
+}
+
+func (t *TaskHandler) executeTask(task *model.Task, executionID string) error {
+	t.logger.Infof("[%s] Execute Task '%s', status='%s'!", executionID, task.ID, lastStatus(task))
+
+	t.outputs.BeginLog(task.ID, executionID)
+	err := t.runTaskLogic(task, executionID)
+	t.outputs.EndLog(task.ID, executionID, err)
+	if err != nil {
+		t.logger.Errorf("[%s] Task %s failed: %v", executionID, task.ID, err)
+		t.updateStatus(task, model.StatusFailed)
+		t.addEvent(task, err.Error())
+		return err
 	}
+
+	t.logger.Infof("[%s] Task %s completed successfully", executionID, task.ID)
+	t.updateStatus(task, model.StatusSuccess)
+	t.addEvent(task, "Task completed")
 	return nil
 }
 
-// stub для реальной логики выполнения задачи
-func (t *TaskHandler) runTaskLogic(task *model.Task) error {
+func (t *TaskHandler) runTaskLogic(task *model.Task, executionID string) error {
+	if err := t.resolveDepends(task, executionID); err != nil {
+		return err
+	}
 
-	if len(task.DependsOn) != 0 {
-		t.logger.Infof("Depends for Task %s!", task.ID)
+	t.updateStatus(task, model.StatusCheck)
+	t.addEvent(task, "Check components...")
 
-		for _, depens := range task.DependsOn {
-			task, err := t.core.Tasks.Get(depens.ID)
-			if err != nil {
-				return err
-			}
-			t.logger.Infof("Start processing depends for depensID '%s'!", depens.ID)
-			t.executeTask(task)
-		}
+	meta := taskMeta(task)
+	targets, err := t.resolveTargets(task)
+	if err != nil {
+		return err
+	}
+	if err := t.check(targets, meta); err != nil {
+		return err
+	}
 
+	if len(task.PreChecks) != 0 {
+		t.addEvent(task, "Running pre-checks")
+		if err := t.runChecks(task, task.PreChecks); err != nil {
+			return fmt.Errorf("pre-check failed: %w", err)
+		}
 	}
-	/*
-		component, err := t.core.Components.Get(task.ComponentID)
-		if err != nil {
-			return err
+
+	t.updateStatus(task, model.StatusRunning)
+	t.addEvent(task, "Task started")
+
+	for _, target := range targets {
+		t.logger.Infof("[%s] Running task %s (%s) for component %s of type %s", executionID, task.ID, task.Type, target.component.ID, target.component.Type)
+		if err := t.runTarget(task, executionID, registry.OutputRun, target, meta); err != nil {
+			t.componentEvent(target.component, err)
+			return fmt.Errorf("component %s: %w", target.component.ID, err)
 		}
+		t.addEvent(task, fmt.Sprintf("Task applied to component %s", target.component.ID))
+	}
 
-		t.logger.Debugf("task for component %+v", component)
+	if len(task.PostChecks) != 0 {
+		t.updateStatus(task, model.StatusCheck)
+		t.addEvent(task, "Running post-checks")
+		if err := t.runChecks(task, task.PostChecks); err != nil {
+			return fmt.Errorf("%w: %w", registry.ErrPostCheckFailed, err)
+		}
+	}
+	return nil
+}
 
-		controller, err := t.core.Controllers.Get(component.Type)
+// resolveDepends выполняет незавершённые зависимости согласно их типу
+func (t *TaskHandler) resolveDepends(task *model.Task, executionID string) error {
+	for _, depends := range task.DependsOn {
+		dep, err := t.core.Tasks.Get(depends.ID)
 		if err != nil {
 			return err
 		}
+		if lastStatus(dep) == model.StatusSuccess {
+			continue
+		}
 
-		task.StatusHistory = t.core.Tasks.NextStatus(model.StatusRunning, *task.StatusHistory)
-		t.core.Tasks.Update(task.ID, *task)
-		t.logger.Infof("Running task %s (%s) for component %s of type %s", task.ID, task.Type, component.ID, component.Type)
-
-		if task.PreChecks != nil {
-			err := t.runChecks(task.PreChecks)
-			if err != nil {
-				return err
+		switch depends.Type {
+		case model.Advisory:
+			t.logger.Infof("[%s] Advisory dependency '%s' of task '%s' is not completed, skipping", executionID, dep.ID, task.ID)
+		case model.Ordered, "":
+			t.logger.Infof("[%s] Start processing depends for depensID '%s'!", executionID, dep.ID)
+			t.addEvent(dep, "Triggered by DependsOn!")
+			if err := t.Execute(dep.ID, executionID); err != nil {
+				return fmt.Errorf("dependency %s failed: %w", dep.ID, err)
 			}
+		default:
+			return fmt.Errorf("%s dependency %s is not completed (status %s)", depends.Type, dep.ID, lastStatus(dep))
 		}
+	}
+	return nil
+}
 
-		err = controller.RunTask(task.Metadata, component.Metadata)
+// resolveTargets находит компоненты задачи и контроллеры по их типу
+func (t *TaskHandler) resolveTargets(task *model.Task) ([]taskTarget, error) {
+	if len(task.Components) == 0 {
+		return nil, fmt.Errorf("task %s has no components", task.ID)
+	}
+
+	targets := make([]taskTarget, 0, len(task.Components))
+	for _, componentID := range task.Components {
+		component, err := t.core.Components.Get(componentID)
 		if err != nil {
-			task.StatusHistory = t.core.Tasks.NextStatus(model.StatusFailed, *task.StatusHistory)
-			t.core.Tasks.Update(task.ID, *task)
-			return err
+			return nil, fmt.Errorf("component %s: %w", componentID, err)
+		}
+		controller, err := t.core.Controllers.Get(component.Type)
+		if err != nil {
+			return nil, fmt.Errorf("component %s: %w", componentID, err)
+		}
+		targets = append(targets, taskTarget{component: component, controller: controller})
+	}
+	return targets, nil
+}
+
+// check проверяет метаданные задачи и доступность компонентов перед выполнением
+func (t *TaskHandler) check(targets []taskTarget, meta map[string]string) error {
+	for _, target := range targets {
+		if err := target.controller.ValideTask(meta); err != nil {
+			return fmt.Errorf("invalid task for component %s: %w", target.component.ID, err)
+		}
+		if err := target.controller.CheckComponent(target.component.Metadata); err != nil {
+			t.componentEvent(target.component, err)
+			return fmt.Errorf("component %s check failed: %w", target.component.ID, err)
 		}
-	*/
+	}
 	return nil
 }
 
 func (t *TaskHandler) updateStatus(task *model.Task, status model.Status) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-
+	task.MU.Lock()
 	if task.StatusHistory == nil {
 		task.StatusHistory = t.core.Tasks.NewStatus(status)
 	} else {
 		task.StatusHistory = t.core.Tasks.NextStatus(status, task.StatusHistory)
 	}
+	task.MU.Unlock()
+
 	t.core.Tasks.Update(task.ID, task)
 }
 
 func (t *TaskHandler) addEvent(task *model.Task, message string) {
+	if task.EventHistory == nil {
+		return
+	}
+	task.EventHistory.MU.Lock()
+	defer task.EventHistory.MU.Unlock()
+
+	t.core.Tasks.AddEvent(task.EventHistory, message)
+}
+
+// componentEvent отмечает в истории компонента ошибки, касающиеся самого компонента, а не задачи
+func (t *TaskHandler) componentEvent(component *model.Component, err error) {
+	if !errors.Is(err, controllers.ErrHostKeyMismatch) || component.EventHistory == nil {
+		return
+	}
+	component.EventHistory.MU.Lock()
+	defer component.EventHistory.MU.Unlock()
+
+	t.core.Components.AddEvent(component.EventHistory, err.Error())
+}
+
+func (t *TaskHandler) acquire(taskID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.active[taskID] {
+		return false
+	}
+	t.active[taskID] = true
+	return true
+}
 
+func (t *TaskHandler) release(taskID string) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	// Получаем актуальную версию задачи
-	currentTask, _ := t.core.Tasks.Get(task.ID)
+	delete(t.active, taskID)
+}
+
+func (t *TaskHandler) markRetry(taskID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	retry := t.retries[taskID]
+	if retry == nil {
+		retry = &taskRetry{}
+		t.retries[taskID] = retry
+	}
+	retry.failed = true
+}
+
+func (t *TaskHandler) resetRetries(taskID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
-	// Добавляем событие
-	t.core.Tasks.AddEvent(currentTask.EventHistory, message)
+	delete(t.retries, taskID)
+}
 
-	// Сохраняем обновлённую задачу
-	t.core.Tasks.Update(currentTask.ID, currentTask)
+func (t *TaskHandler) isActive(taskID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.active[taskID]
+}
+
+// taskMeta дополняет метаданные задачи её ID и типом: контроллеры ожидают их в метаданных
+func taskMeta(task *model.Task) map[string]string {
+	meta := make(map[string]string, len(task.Metadata)+2)
+	for k, v := range task.Metadata {
+		meta[k] = v
+	}
+	if meta["id"] == "" {
+		meta["id"] = task.ID
+	}
+	if meta["type"] == "" {
+		meta["type"] = string(task.Type)
+	}
+	return meta
+}
+
+func lastStatus(task *model.Task) model.Status {
+	if task.StatusHistory == nil {
+		return ""
+	}
+	task.StatusHistory.MU.RLock()
+	defer task.StatusHistory.MU.RUnlock()
+	return task.StatusHistory.LastStatus
 }
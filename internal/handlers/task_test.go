@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/laplasd/inforo"
+	"github.com/laplasd/inforo/model"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeController выполняет задачи без реального компонента и запоминает порядок запусков
+type fakeController struct {
+	mu sync.Mutex
+	// Ошибка CheckComponent
+	checkErr error
+	// Ошибки RunTask по ID задачи
+	runErr map[string]error
+	// Вызывается при запуске задачи, до её завершения
+	onRun func(taskID string)
+
+	ran []string
+}
+
+func (c *fakeController) RunTask(taskMeta, componentMeta map[string]string) error {
+	if c.onRun != nil {
+		c.onRun(taskMeta["id"])
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ran = append(c.ran, taskMeta["id"])
+	return c.runErr[taskMeta["id"]]
+}
+
+func (c *fakeController) ValideTask(meta map[string]string) error      { return nil }
+func (c *fakeController) ValideComponent(meta map[string]string) error { return nil }
+func (c *fakeController) CheckComponent(meta map[string]string) error  { return c.checkErr }
+
+func (c *fakeController) runs() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.ran...)
+}
+
+// newTestHandler собирает ядро в памяти с компонентом "c1" типа "fake" и обработчик задач над ним
+func newTestHandler(t *testing.T, controller *fakeController) *TaskHandler {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	core := inforo.NewCore(inforo.CoreOptions{Logger: logger})
+	if err := core.Controllers.Register("fake", controller); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := core.Components.Register(model.Component{ID: "c1", Name: "web", Type: "fake", Version: "1.0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := NewTaskHandler(logger, core, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handler
+}
+
+// registerTask регистрирует задачу обновления компонента "c1"
+func registerTask(t *testing.T, h *TaskHandler, id string, metadata map[string]string, depends ...model.Depends) *model.Task {
+	t.Helper()
+	task, err := h.core.Tasks.Register(&model.Task{
+		ID:         id,
+		Name:       id,
+		Type:       model.UpdateTask,
+		Components: []string{"c1"},
+		DependsOn:  depends,
+		Metadata:   metadata,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+func TestExecuteRunsOrderedDependencyFirst(t *testing.T) {
+	controller := &fakeController{}
+	h := newTestHandler(t, controller)
+	dep := registerTask(t, h, "t1", nil)
+	task := registerTask(t, h, "t2", nil, model.Depends{Type: model.Ordered, ID: "t1"})
+
+	if err := h.Execute("t2", ""); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got := strings.Join(controller.runs(), ","); got != "t1,t2" {
+		t.Errorf("ran %s, want t1,t2", got)
+	}
+	for _, tk := range []*model.Task{dep, task} {
+		if status := lastStatus(tk); status != model.StatusSuccess {
+			t.Errorf("task %s status = %s, want %s", tk.ID, status, model.StatusSuccess)
+		}
+	}
+
+	// Выполненная зависимость повторно не запускается
+	if err := h.Execute("t2", ""); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got := strings.Join(controller.runs(), ","); got != "t1,t2,t2" {
+		t.Errorf("ran %s, want t1,t2,t2", got)
+	}
+}
+
+func TestExecuteDependencyTypes(t *testing.T) {
+	tests := []struct {
+		depends model.DepensType
+		wantErr bool
+		wantRan string
+	}{
+		{depends: model.Advisory, wantRan: "t2"},
+		{depends: model.Strict, wantErr: true},
+		{depends: model.Blocking, wantErr: true},
+	}
+	for _, tt := range tests {
+		controller := &fakeController{}
+		h := newTestHandler(t, controller)
+		registerTask(t, h, "t1", nil)
+		task := registerTask(t, h, "t2", nil, model.Depends{Type: tt.depends, ID: "t1"})
+
+		err := h.Execute("t2", "")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Execute = %v, want error %v", tt.depends, err, tt.wantErr)
+		}
+		if got := strings.Join(controller.runs(), ","); got != tt.wantRan {
+			t.Errorf("%s: ran %q, want %q", tt.depends, got, tt.wantRan)
+		}
+		if tt.wantErr && lastStatus(task) != model.StatusFailed {
+			t.Errorf("%s: status = %s, want %s", tt.depends, lastStatus(task), model.StatusFailed)
+		}
+	}
+}
+
+func TestExecuteFailsWhenDependencyFails(t *testing.T) {
+	controller := &fakeController{runErr: map[string]error{"t1": errors.New("boom")}}
+	h := newTestHandler(t, controller)
+	registerTask(t, h, "t1", nil)
+	task := registerTask(t, h, "t2", nil, model.Depends{Type: model.Ordered, ID: "t1"})
+
+	if err := h.Execute("t2", ""); err == nil || !strings.Contains(err.Error(), "dependency t1 failed") {
+		t.Fatalf("Execute = %v, want dependency error", err)
+	}
+	if got := strings.Join(controller.runs(), ","); got != "t1" {
+		t.Errorf("ran %s, want only t1", got)
+	}
+	if status := lastStatus(task); status != model.StatusFailed {
+		t.Errorf("status = %s, want %s", status, model.StatusFailed)
+	}
+}
+
+func TestExecuteComponentCheckFailure(t *testing.T) {
+	controller := &fakeController{checkErr: errors.New("unreachable")}
+	h := newTestHandler(t, controller)
+	task := registerTask(t, h, "t1", nil)
+
+	err := h.Execute("t1", "")
+	if err == nil || !strings.Contains(err.Error(), "component c1 check failed") {
+		t.Fatalf("Execute = %v, want component check error", err)
+	}
+	if ran := controller.runs(); len(ran) != 0 {
+		t.Errorf("RunTask called after failed component check: %v", ran)
+	}
+	if status := lastStatus(task); status != model.StatusFailed {
+		t.Errorf("status = %s, want %s", status, model.StatusFailed)
+	}
+}
+
+func TestExecuteRunTaskError(t *testing.T) {
+	runErr := errors.New("exit status 1")
+	controller := &fakeController{runErr: map[string]error{"t1": runErr}}
+	h := newTestHandler(t, controller)
+	task := registerTask(t, h, "t1", nil)
+
+	if err := h.Execute("t1", ""); !errors.Is(err, runErr) {
+		t.Fatalf("Execute = %v, want %v", err, runErr)
+	}
+	if status := lastStatus(task); status != model.StatusFailed {
+		t.Errorf("status = %s, want %s", status, model.StatusFailed)
+	}
+}
+
+func TestQueuedTaskRetriedUpToMaxRetries(t *testing.T) {
+	controller := &fakeController{runErr: map[string]error{"t1": errors.New("boom")}}
+	h := newTestHandler(t, controller)
+	task := registerTask(t, h, "t1", map[string]string{"max_retries": "2"})
+
+	if err := h.Enqueue("t1"); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	for attempt := 1; attempt <= 3; attempt++ {
+		if status := lastStatus(task); status != model.StatusPending {
+			t.Fatalf("attempt %d: status = %s, want %s", attempt, status, model.StatusPending)
+		}
+		h.handlePending(task)
+		if status := lastStatus(task); status != model.StatusFailed {
+			t.Fatalf("attempt %d: status = %s, want %s", attempt, status, model.StatusFailed)
+		}
+		h.retryFailed(task)
+	}
+
+	// Повторы исчерпаны: задача остаётся упавшей
+	if status := lastStatus(task); status != model.StatusFailed {
+		t.Errorf("status after retries = %s, want %s", status, model.StatusFailed)
+	}
+	if n := len(controller.runs()); n != 3 {
+		t.Errorf("ran %d times, want 3", n)
+	}
+}
+
+func TestFailedTaskNotRetriedOutsideQueue(t *testing.T) {
+	controller := &fakeController{runErr: map[string]error{"t1": errors.New("boom")}}
+	h := newTestHandler(t, controller)
+	task := registerTask(t, h, "t1", map[string]string{"max_retries": "2"})
+
+	if err := h.Execute("t1", ""); err == nil {
+		t.Fatal("Execute succeeded, want error")
+	}
+	h.retryFailed(task)
+	if status := lastStatus(task); status != model.StatusFailed {
+		t.Errorf("status = %s, want %s: tasks run by plans are not retried", status, model.StatusFailed)
+	}
+}
+
+func TestEnqueueRejectsActiveTask(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	controller := &fakeController{onRun: func(string) {
+		close(started)
+		<-release
+	}}
+	h := newTestHandler(t, controller)
+	task := registerTask(t, h, "t1", nil)
+
+	done := make(chan error, 1)
+	go func() { done <- h.Execute("t1", "") }()
+	<-started
+
+	if err := h.Enqueue("t1"); err == nil {
+		t.Error("Enqueue accepted a running task")
+	}
+	if err := h.Execute("t1", ""); err == nil {
+		t.Error("Execute accepted a running task")
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	if err := h.Enqueue("t1"); err != nil {
+		t.Fatalf("Enqueue after completion: %v", err)
+	}
+	if status := lastStatus(task); status != model.StatusPending {
+		t.Errorf("status = %s, want %s", status, model.StatusPending)
+	}
+	if err := h.Enqueue("missing"); err == nil {
+		t.Error("Enqueue accepted an unknown task")
+	}
+}
@@ -3,6 +3,7 @@ package watchdog
 import (
 	"context"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/laplasd/inforo"
@@ -38,6 +39,8 @@ type WatchDog struct {
 	FailedCheckInterval  *time.Duration
 	MaxWorkers           int
 	OperationTimeout     time.Duration
+	// Проверки, запущенные обработчиками и ещё не завершённые
+	inflight sync.WaitGroup
 }
 
 type WatchDogOpts struct {
@@ -106,13 +109,33 @@ func NewNullLogger() *logrus.Logger {
 	return logger
 }
 
+// RunProcessor блокируется до отмены ctx и завершения всех запущенных проверок
 func (wd *WatchDog) RunProcessor(ctx context.Context) {
 	wd.logger.Debug("WatchDog: starting...")
 	defer wd.logger.Info("WatchDog: stopped")
 
-	go wd.RunComponentHandler(ctx)
-	go wd.RunMonitoringHandler(ctx)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		wd.RunComponentHandler(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		wd.RunMonitoringHandler(ctx)
+	}()
+	wg.Wait()
+
+	wd.logger.Debug("WatchDog: waiting for in-flight checks")
+	wd.inflight.Wait()
+}
 
+func (wd *WatchDog) spawn(fn func()) {
+	wd.inflight.Add(1)
+	go func() {
+		defer wd.inflight.Done()
+		fn()
+	}()
 }
 
 func processByStatus[T *model.Component | *model.Monitoring](
@@ -137,7 +160,7 @@ func processByStatus[T *model.Component | *model.Monitoring](
 
 				if t, ok := any(comp).(T); ok {
 					wd.logger.Debugf("WatchDog[%s]: component ID: %s", status, comp.ID)
-					go handler(t)
+					wd.spawn(func() { handler(t) })
 				}
 			}
 		}
@@ -155,7 +178,7 @@ func processByStatus[T *model.Component | *model.Monitoring](
 
 				if t, ok := any(comp).(T); ok {
 					wd.logger.Debugf("WatchDog[%s]: component ID: %s", status, comp.ID)
-					go handler(t)
+					wd.spawn(func() { handler(t) })
 				}
 			}
 		}
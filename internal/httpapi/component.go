@@ -16,7 +16,16 @@ func (s *APIServer) CreateComponent(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid component"})
 		return
 	}
-	comp, err := s.core.Components.Register(*comp)
+	// Register принимает компонент по значению: копируем поля, а не структуру с блокировкой
+	comp, err := s.core.Components.Register(model.Component{
+		ID:            comp.ID,
+		Name:          comp.Name,
+		Type:          comp.Type,
+		Version:       comp.Version,
+		StatusHistory: comp.StatusHistory,
+		EventHistory:  comp.EventHistory,
+		Metadata:      comp.Metadata,
+	})
 
 	if err != nil {
 		s.logger.Warnf("APIServer.CreateComponent: Register component conflict: %v", err)
@@ -0,0 +1,126 @@
+package httpapi
+
+import (
+	"fmt"
+	"laplasd/internal/registry"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// Интервал комментариев-пингов в потоке SSE, чтобы прокси не закрывали простаивающее соединение
+const sseKeepAlive = 15 * time.Second
+
+/*
+	RUS: Поток вывода задачи в формате Server-Sent Events:
+		event: log  — строка вывода (registry.LogEvent), id события — её seq
+		event: end  — выполнение закончилось (registry.LogEnd), поток закрывается
+	Сначала отправляются уже сохранённые строки последнего выполнения; при переподключении
+	заголовок Last-Event-ID пропускает полученные ранее строки.
+	ENG: Task output as Server-Sent Events: "log" events with the line seq as id, then one "end" event.
+	Buffered lines are replayed first; Last-Event-ID skips lines received before a reconnect.
+*/
+
+// GET /task/:id/logs?follow=true
+func (s *APIServer) TaskLogs(c *gin.Context) {
+	id := c.Param("id")
+
+	follow := false
+	if raw := c.Query("follow"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":  http.StatusBadRequest,
+				"error": fmt.Sprintf("invalid follow %q", raw),
+			})
+			return
+		}
+		follow = v
+	}
+
+	var lastSeq int64
+	if raw := c.GetHeader("Last-Event-ID"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":  http.StatusBadRequest,
+				"error": fmt.Sprintf("invalid Last-Event-ID %q", raw),
+			})
+			return
+		}
+		lastSeq = v
+	}
+
+	var (
+		replay []registry.LogEvent
+		sub    *registry.LogSubscription
+		err    error
+	)
+	if follow {
+		sub, err = s.tasks.FollowLogs(id)
+		if sub != nil {
+			defer sub.Close()
+			replay = sub.Replay
+		}
+	} else {
+		replay, err = s.tasks.Logs(id)
+	}
+	if err != nil {
+		s.logger.Warnf("Task %s not found: %v", id, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	for _, event := range replay {
+		s.sendLogEvent(c, event, lastSeq)
+	}
+	if sub == nil {
+		c.Render(-1, sse.Event{Event: "end", Data: registry.LogEnd{}})
+		c.Writer.Flush()
+		return
+	}
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				c.Render(-1, sse.Event{Event: "end", Data: sub.End()})
+				c.Writer.Flush()
+				return
+			}
+			s.sendLogEvent(c, event, lastSeq)
+			c.Writer.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(c.Writer, ": keepalive\n\n")
+			c.Writer.Flush()
+		case <-c.Request.Context().Done():
+			return
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+func (s *APIServer) sendLogEvent(c *gin.Context, event registry.LogEvent, lastSeq int64) {
+	if event.Seq <= lastSeq {
+		return
+	}
+	c.Render(-1, sse.Event{
+		Id:    strconv.FormatInt(event.Seq, 10),
+		Event: "log",
+		Data:  event,
+	})
+}
@@ -0,0 +1,194 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"laplasd/internal/config"
+	"laplasd/internal/registry"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logTasks — TaskRunner с логами из OutputRegistry; остальные методы не используются
+type logTasks struct {
+	TaskRunner
+	outputs *registry.OutputRegistry
+	// Получает ID задачи после подписки на её лог
+	followed chan string
+}
+
+func (l *logTasks) Logs(taskID string) ([]registry.LogEvent, error) {
+	if taskID != "t1" {
+		return nil, errors.New("task not found")
+	}
+	return l.outputs.Logs(taskID), nil
+}
+
+func (l *logTasks) FollowLogs(taskID string) (*registry.LogSubscription, error) {
+	if taskID != "t1" {
+		return nil, errors.New("task not found")
+	}
+	sub := l.outputs.Subscribe(taskID, true)
+	l.followed <- taskID
+	return sub, nil
+}
+
+// sseEvent — событие потока Server-Sent Events
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+func newLogServer(t *testing.T) (*httptest.Server, *logTasks) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	tasks := &logTasks{
+		outputs:  registry.NewOutputRegistry(registry.OutputRegistryOptions{}),
+		followed: make(chan string, 1),
+	}
+	s := New(nil, "", logger, config.Server{}, nil, tasks)
+	srv := httptest.NewServer(s.router)
+	t.Cleanup(srv.Close)
+	return srv, tasks
+}
+
+// readEvents читает поток до его закрытия сервером
+func readEvents(t *testing.T, body io.Reader) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var current sseEvent
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if current != (sseEvent{}) {
+				events = append(events, current)
+			}
+			current = sseEvent{}
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		switch field {
+		case "id":
+			current.id = value
+		case "event":
+			current.event = value
+		case "data":
+			current.data = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func getLogs(t *testing.T, url string, lastEventID string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestTaskLogsReplay(t *testing.T) {
+	srv, tasks := newLogServer(t)
+	tasks.outputs.BeginLog("t1", "e1")
+	w := tasks.outputs.NewLogWriter("t1", "e1", "c1", registry.StreamStdout)
+	w.Write([]byte("one\ntwo\nthree\n"))
+	tasks.outputs.EndLog("t1", "e1", nil)
+
+	resp := getLogs(t, srv.URL+"/task/t1/logs", "1")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	events := readEvents(t, resp.Body)
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 2 lines after Last-Event-ID and end: %+v", len(events), events)
+	}
+	for i, want := range []string{"two", "three"} {
+		var event registry.LogEvent
+		if err := json.Unmarshal([]byte(events[i].data), &event); err != nil {
+			t.Fatal(err)
+		}
+		if events[i].event != "log" || event.Line != want || events[i].id != strconv.Itoa(i+2) {
+			t.Errorf("event %d = %+v, want log %q", i, events[i], want)
+		}
+	}
+	if events[2].event != "end" {
+		t.Errorf("last event = %+v, want end", events[2])
+	}
+}
+
+func TestTaskLogsFollow(t *testing.T) {
+	srv, tasks := newLogServer(t)
+
+	done := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get(srv.URL + "/task/t1/logs?follow=true")
+		if err != nil {
+			resp = nil
+		}
+		done <- resp
+	}()
+	<-tasks.followed
+
+	tasks.outputs.BeginLog("t1", "e1")
+	w := tasks.outputs.NewLogWriter("t1", "e1", "c1", registry.StreamStderr)
+	w.Write([]byte("warming up\n"))
+	tasks.outputs.EndLog("t1", "e1", errors.New("exit status 3"))
+
+	resp := <-done
+	if resp == nil {
+		t.Fatal("GET /task/t1/logs?follow=true failed")
+	}
+	defer resp.Body.Close()
+	events := readEvents(t, resp.Body)
+	if len(events) != 2 || events[0].event != "log" || events[0].id != "1" || events[1].event != "end" {
+		t.Fatalf("events = %+v, want one log and end", events)
+	}
+	var end registry.LogEnd
+	if err := json.Unmarshal([]byte(events[1].data), &end); err != nil {
+		t.Fatal(err)
+	}
+	if end.ExecutionID != "e1" || end.Error != "exit status 3" {
+		t.Errorf("end = %+v", end)
+	}
+}
+
+func TestTaskLogsBadRequests(t *testing.T) {
+	srv, _ := newLogServer(t)
+	tests := []struct {
+		url         string
+		lastEventID string
+		want        int
+	}{
+		{url: "/task/t1/logs?follow=maybe", want: http.StatusBadRequest},
+		{url: "/task/t1/logs", lastEventID: "x", want: http.StatusBadRequest},
+		{url: "/task/missing/logs", want: http.StatusNotFound},
+		{url: "/task/missing/logs?follow=true", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if resp := getLogs(t, srv.URL+tt.url, tt.lastEventID); resp.StatusCode != tt.want {
+			t.Errorf("GET %s (Last-Event-ID %q) = %d, want %d", tt.url, tt.lastEventID, resp.StatusCode, tt.want)
+		}
+	}
+}
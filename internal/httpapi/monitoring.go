@@ -60,6 +60,22 @@ func (s *APIServer) UpdateMonitoring(c *gin.Context) {
 		return
 	}
 
+	// Реестр проверяет только прежний Config, поэтому новый проверяем здесь
+	if current, err := s.core.Monitorings.Get(id); err == nil {
+		if updated.Type == "" {
+			updated.Type = current.Type
+		}
+		controller, err := s.core.MonitorControllers.Get(updated.Type)
+		if err == nil {
+			err = controller.ValidateMonitoring(updated.Config)
+		}
+		if err != nil {
+			s.logger.Warnf("Invalid monitoring %s config: %v", id, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	if err := s.core.Monitorings.Update(id, updated); err != nil {
 		s.logger.Warnf("Failed to update monitoring %s: %v", id, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
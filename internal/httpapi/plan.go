@@ -1,13 +1,24 @@
 package httpapi
 
 import (
+	"errors"
+	"laplasd/internal/registry"
 	"net/http"
 
 	"github.com/laplasd/inforo/model"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
+type planExecutions interface {
+	Execution(planID string) (*registry.PlanExecution, bool)
+}
+
+type planPolicyRunner interface {
+	RunWithPolicy(planID string, executionID string, policy registry.FailurePolicy) (string, error)
+}
+
 // POST /plans
 func (s *APIServer) CreatePlan(c *gin.Context) {
 	var tasks []*model.Task
@@ -23,6 +34,14 @@ func (s *APIServer) CreatePlan(c *gin.Context) {
 	}
 
 	plan, err := s.core.Plans.Register(tasks)
+	if errors.Is(err, registry.ErrInvalidPlan) {
+		s.logger.Warnf("Rejected plan: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":     http.StatusBadRequest,
+			"message":  "invalid plan",
+			"metadata": err.Error()})
+		return
+	}
 	if err != nil {
 		s.logger.Errorf("Failed to create plan: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -51,11 +70,18 @@ func (s *APIServer) GetPlanStatus(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"status":    string(plan.StatusHistory.LastStatus),
 		"timestamp": plan.StatusHistory.Timestamp,
 		"history":   plan.StatusHistory.Previous,
-	})
+	}
+	// Время начала/окончания каждой задачи последнего выполнения
+	if executions, ok := s.core.Plans.(planExecutions); ok {
+		if execution, found := executions.Execution(id); found {
+			response["execution"] = execution
+		}
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // GET /plans
@@ -85,23 +111,69 @@ func (s *APIServer) GetPlan(c *gin.Context) {
 func (s *APIServer) DeletePlan(c *gin.Context) {
 	id := c.Param("id")
 
+	// Вывод задач плана удаляется вместе с планом
+	var taskIDs []string
+	if plan, err := s.core.Plans.Get(id); err == nil {
+		for _, graph := range plan.TaskGraphs {
+			for taskID := range graph.Tasks {
+				taskIDs = append(taskIDs, taskID)
+			}
+		}
+	}
+
 	err := s.core.Plans.Delete(id)
 	if err != nil {
 		s.logger.Warnf("Failed to delete plan %s: %v", id, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "plan not found"})
 		return
 	}
+	for _, taskID := range taskIDs {
+		s.tasks.DeleteOutputs(taskID)
+	}
 
 	s.logger.Infof("Plan %s deleted", id)
 	c.Status(http.StatusNoContent)
 }
 
+// POST /plan/run/:id?failure_policy=abort|continue|rollback-completed
 func (s *APIServer) RunPlan(c *gin.Context) {
 	id := c.Param("id")
-	procID, err := s.core.Plans.RunAsync(id, "")
+	if _, err := s.core.Plans.Get(id); err != nil {
+		s.logger.Warnf("Plan %s not found: %v", id, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "plan not found"})
+		return
+	}
+
+	policy, err := registry.ParseFailurePolicy(c.Query("failure_policy"))
 	if err != nil {
-		s.logger.Warnf("Task %s not found: %v", id, err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":     http.StatusBadRequest,
+			"message":  "invalid failure policy",
+			"metadata": err.Error(),
+		})
+		return
+	}
+	runner, ok := s.core.Plans.(planPolicyRunner)
+	if policy != "" && !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":     http.StatusBadRequest,
+			"message":  "plan registry does not support failure policies",
+			"metadata": nil,
+		})
+		return
+	}
+
+	procID := uuid.New().String()
+	started := s.runAsync("Plan "+id, procID, func() error {
+		if ok {
+			_, err := runner.RunWithPolicy(id, procID, policy)
+			return err
+		}
+		_, err := s.core.Plans.Run(id, procID)
+		return err
+	})
+	if !started {
+		s.shuttingDown(c)
 		return
 	}
 	c.JSON(http.StatusOK, procID)
@@ -1,10 +1,16 @@
 package httpapi
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"laplasd/internal/config"
+	"laplasd/internal/lifecycle"
+	"laplasd/internal/registry"
 	"net"
+	"net/http"
 	"os"
+	"sync"
 
 	"github.com/laplasd/inforo"
 
@@ -12,16 +18,34 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// TaskRunner выполняет задачи (handlers.TaskHandler)
+type TaskRunner interface {
+	Execute(taskID string, executionID string) error
+	RollBack(taskID string, executionID string) error
+	Outputs(taskID string) ([]*registry.TaskOutput, error)
+	DeleteOutputs(taskID string)
+	Logs(taskID string) ([]registry.LogEvent, error)
+	FollowLogs(taskID string) (*registry.LogSubscription, error)
+	Enqueue(taskID string) error
+}
+
 type APIServer struct {
-	core     *inforo.Core
-	logger   *logrus.Logger
-	router   *gin.Engine
-	sockPath string
-	IP       string
-	Port     int
+	core       *inforo.Core
+	tasks      TaskRunner
+	logger     *logrus.Logger
+	router     *gin.Engine
+	executions *lifecycle.Group
+	sockPath   string
+	IP         string
+	Port       int
+
+	mu      sync.Mutex
+	servers []*http.Server
+	// Закрывается при остановке: долгие потоки (SSE) завершаются, не задерживая Shutdown
+	closing chan struct{}
 }
 
-func New(core *inforo.Core, sockPath string, logger *logrus.Logger, cfg config.Server) *APIServer {
+func New(core *inforo.Core, sockPath string, logger *logrus.Logger, cfg config.Server, executions *lifecycle.Group, tasks TaskRunner) *APIServer {
 
 	gin.SetMode(gin.ReleaseMode) // чтобы не выводить дебаг-логи Gin по умолчанию
 	router := gin.New()
@@ -30,13 +54,20 @@ func New(core *inforo.Core, sockPath string, logger *logrus.Logger, cfg config.S
 	router.Use(gin.LoggerWithWriter(logger.Writer()))
 	router.Use(gin.Recovery())
 
+	if executions == nil {
+		executions = lifecycle.NewGroup()
+	}
+
 	s := &APIServer{
-		core:     core,
-		sockPath: cfg.UnixSocket,
-		IP:       cfg.Host,
-		Port:     cfg.Port,
-		logger:   logger,
-		router:   router,
+		core:       core,
+		tasks:      tasks,
+		executions: executions,
+		sockPath:   cfg.UnixSocket,
+		IP:         cfg.Host,
+		Port:       cfg.Port,
+		logger:     logger,
+		router:     router,
+		closing:    make(chan struct{}),
 	}
 
 	s.setupRoutes()
@@ -97,6 +128,8 @@ func (s *APIServer) setupRoutes() {
 		task.DELETE("/:id", s.DeleteTask)
 		task.POST("/run/:id", s.RunTask)
 		task.POST("/rollback/:id", s.RollBackTask)
+		task.GET("/:id/output", s.GetTaskOutput)
+		task.GET("/:id/logs", s.TaskLogs)
 	}
 
 	/*
@@ -141,17 +174,92 @@ func (s *APIServer) Start() error {
 	if os.Getenv("LAPLAS_ENABLE_TCP") == "1" {
 		tcpListener, err := net.Listen("tcp", "127.0.0.1:8080")
 		if err != nil {
+			unixListener.Close()
 			return fmt.Errorf("failed to start TCP listener: %w", err)
 		}
 		s.logger.Infof("API available on TCP 127.0.0.1:8080")
 
+		tcpServer, err := s.newServer()
+		if err != nil {
+			tcpListener.Close()
+			unixListener.Close()
+			return nil
+		}
 		go func() {
-			if err := s.router.RunListener(tcpListener); err != nil {
+			if err := tcpServer.Serve(tcpListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				s.logger.Errorf("TCP server error: %v", err)
 			}
 		}()
 	}
 
 	s.logger.Infof("API listening on %s", s.sockPath)
-	return s.router.RunListener(unixListener)
+	srv, err := s.newServer()
+	if err != nil {
+		unixListener.Close()
+		return nil
+	}
+	err = srv.Serve(unixListener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// newServer создаёт сервер, который закроет Shutdown.
+// После Shutdown возвращает http.ErrServerClosed: иначе сервер остался бы незакрытым.
+func (s *APIServer) newServer() (*http.Server, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.closing:
+		return nil, http.ErrServerClosed
+	default:
+	}
+
+	srv := &http.Server{Handler: s.router}
+	s.servers = append(s.servers, srv)
+	return srv, nil
+}
+
+// Shutdown закрывает слушателей и дожидается завершения активных запросов
+func (s *APIServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	servers := s.servers
+	s.servers = nil
+	select {
+	case <-s.closing:
+	default:
+		close(s.closing)
+	}
+	s.mu.Unlock()
+
+	var shutdownErr error
+	for _, srv := range servers {
+		shutdownErr = errors.Join(shutdownErr, srv.Shutdown(ctx))
+	}
+
+	if err := os.Remove(s.sockPath); err != nil && !os.IsNotExist(err) {
+		shutdownErr = errors.Join(shutdownErr, err)
+	}
+	return shutdownErr
+}
+
+// runAsync запускает выполнение в отслеживаемой горутине.
+// Возвращает false, если демон останавливается.
+func (s *APIServer) runAsync(name string, executionID string, fn func() error) bool {
+	return s.executions.Go(func() {
+		if err := fn(); err != nil {
+			s.logger.Errorf("[%s] %s failed: %v", executionID, name, err)
+			return
+		}
+		s.logger.Debugf("[%s] %s completed", executionID, name)
+	})
+}
+
+func (s *APIServer) shuttingDown(c *gin.Context) {
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"code":  http.StatusServiceUnavailable,
+		"error": "daemon is shutting down",
+	})
 }
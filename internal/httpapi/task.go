@@ -1,11 +1,13 @@
 package httpapi
 
 import (
+	"laplasd/internal/registry"
 	"net/http"
 
 	"github.com/laplasd/inforo/model"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 // POST /tasks
@@ -33,6 +35,12 @@ func (s *APIServer) CreateTask(c *gin.Context) {
 		return
 	}
 	s.logger.Infof("Task created: %+v", task)
+
+	// Созданная задача сразу ставится в очередь на выполнение
+	if err := s.tasks.Enqueue(fullTask.ID); err != nil {
+		s.logger.Warnf("Failed to queue task %s: %v", fullTask.ID, err)
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
 		"code":     http.StatusCreated,
 		"message":  "Task created",
@@ -97,29 +105,82 @@ func (s *APIServer) DeleteTask(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	s.tasks.DeleteOutputs(id)
 	s.logger.Infof("Task %s deleted", id)
 	c.Status(http.StatusOK)
 }
 
-// GET /tasks/:id
+// POST /task/run/:id
 func (s *APIServer) RunTask(c *gin.Context) {
 	id := c.Param("id")
-	procID, err := s.core.Tasks.ForkAsync(id, "")
-	if err != nil {
+	if _, err := s.core.Tasks.Get(id); err != nil {
 		s.logger.Warnf("Task %s not found: %v", id, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
 		return
 	}
+
+	procID := uuid.New().String()
+	started := s.runAsync("Task "+id, procID, func() error {
+		return s.tasks.Execute(id, procID)
+	})
+	if !started {
+		s.shuttingDown(c)
+		return
+	}
 	c.JSON(http.StatusOK, procID)
 }
 
+// POST /task/rollback/:id
 func (s *APIServer) RollBackTask(c *gin.Context) {
 	id := c.Param("id")
-	procID, err := s.core.Tasks.RollBackAsync(id, "")
+	task, err := s.core.Tasks.Get(id)
 	if err != nil {
 		s.logger.Warnf("Task %s not found: %v", id, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
 		return
 	}
+	if task.RollBack == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":  http.StatusBadRequest,
+			"error": "task has no rollback",
+		})
+		return
+	}
+
+	procID := uuid.New().String()
+	started := s.runAsync("RollBack of task "+id, procID, func() error {
+		return s.tasks.RollBack(id, procID)
+	})
+	if !started {
+		s.shuttingDown(c)
+		return
+	}
 	c.JSON(http.StatusOK, procID)
 }
+
+// GET /task/:id/output?execution_id=
+func (s *APIServer) GetTaskOutput(c *gin.Context) {
+	id := c.Param("id")
+	outputs, err := s.tasks.Outputs(id)
+	if err != nil {
+		s.logger.Warnf("Task %s not found: %v", id, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	}
+
+	if executionID := c.Query("execution_id"); executionID != "" {
+		filtered := make([]*registry.TaskOutput, 0, len(outputs))
+		for _, output := range outputs {
+			if output.ExecutionID == executionID {
+				filtered = append(filtered, output)
+			}
+		}
+		outputs = filtered
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":     http.StatusOK,
+		"message":  "TaskOutput",
+		"metadata": outputs,
+	})
+}
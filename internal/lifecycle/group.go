@@ -0,0 +1,57 @@
+package lifecycle
+
+import (
+	"context"
+	"sync"
+)
+
+// Group отслеживает фоновые выполнения (задачи, планы, откаты),
+// чтобы при остановке демона дождаться их завершения.
+type Group struct {
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	closed bool
+}
+
+func NewGroup() *Group {
+	return &Group{}
+}
+
+// Go запускает fn в горутине. Возвращает false, если группа уже закрыта и новые выполнения не принимаются.
+func (g *Group) Go(fn func()) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.closed {
+		return false
+	}
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		fn()
+	}()
+	return true
+}
+
+// Close запрещает запуск новых выполнений
+func (g *Group) Close() {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+}
+
+// Wait ждёт завершения запущенных выполнений или истечения контекста
+func (g *Group) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
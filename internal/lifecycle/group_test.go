@@ -0,0 +1,82 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupWaitDrainsRunningExecutions(t *testing.T) {
+	g := NewGroup()
+	release := make(chan struct{})
+	var finished atomic.Int32
+	for i := 0; i < 3; i++ {
+		if !g.Go(func() {
+			<-release
+			finished.Add(1)
+		}) {
+			t.Fatal("Go rejected an execution before Close")
+		}
+	}
+	g.Close()
+
+	waited := make(chan error, 1)
+	go func() { waited <- g.Wait(context.Background()) }()
+	select {
+	case err := <-waited:
+		t.Fatalf("Wait returned %v while executions were running", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after executions finished")
+	}
+	if n := finished.Load(); n != 3 {
+		t.Errorf("%d executions finished before Wait returned, want 3", n)
+	}
+}
+
+func TestGroupGoAfterClose(t *testing.T) {
+	g := NewGroup()
+	g.Close()
+
+	ran := make(chan struct{}, 1)
+	if g.Go(func() { ran <- struct{}{} }) {
+		t.Fatal("Go accepted an execution after Close")
+	}
+	if err := g.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	select {
+	case <-ran:
+		t.Fatal("rejected execution was started")
+	default:
+	}
+}
+
+func TestGroupWaitReturnsOnDeadline(t *testing.T) {
+	g := NewGroup()
+	release := make(chan struct{})
+	defer close(release)
+	g.Go(func() { <-release })
+	g.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := g.Wait(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Wait returned after %s, want about the deadline", elapsed)
+	}
+}
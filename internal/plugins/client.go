@@ -0,0 +1,226 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"laplasd/internal/controllers"
+	"laplasd/pkg/plugin"
+	"sync"
+)
+
+/*
+	RUS: Клиент JSON-RPC поверх потока (stdio процесса или unix-сокет). Вызовы выполняются
+	параллельно и сопоставляются с ответами по ID; уведомления task.output направляются в вывод вызова.
+Вызов, который перестали ждать (истёк контекст), отменяется в плагине уведомлением $/cancel.
+	ENG: JSON-RPC client over a stream; concurrent calls are matched to responses by ID and
+	task.output notifications are routed to the calling task's output.
+*/
+
+var errClientClosed = errors.New("plugin connection closed")
+
+type pendingCall struct {
+	done chan *plugin.Message
+
+	// mu удерживается на время записи вывода: завершившийся вызов не получит запись,
+	// которая началась до его завершения, но закончилась после
+	mu       sync.Mutex
+	output   controllers.TaskOutput
+	finished bool
+}
+
+type client struct {
+	conn io.ReadWriteCloser
+
+	writeMu sync.Mutex
+	enc     *json.Encoder
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]*pendingCall
+	err     error
+	// Закрывается, когда соединение разорвано
+	closed chan struct{}
+}
+
+func newClient(conn io.ReadWriteCloser) *client {
+	c := &client{
+		conn:    conn,
+		enc:     json.NewEncoder(conn),
+		pending: make(map[uint64]*pendingCall),
+		closed:  make(chan struct{}),
+	}
+	go c.read()
+	return c
+}
+
+// call выполняет метод и декодирует результат в result, если он задан
+func (c *client) call(ctx context.Context, method string, params interface{}, output controllers.TaskOutput, result interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := c.nextID
+	call := &pendingCall{done: make(chan *plugin.Message, 1), output: output}
+	c.pending[id] = call
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		// Вывод принадлежит вызывающему только до возврата из call
+		call.mu.Lock()
+		call.finished = true
+		call.mu.Unlock()
+	}()
+
+	c.writeMu.Lock()
+	err = c.enc.Encode(&plugin.Message{JSONRPC: "2.0", ID: &id, Method: method, Params: data})
+	c.writeMu.Unlock()
+	if err != nil {
+		c.fail(fmt.Errorf("%w: %v", errClientClosed, err))
+		return err
+	}
+
+	select {
+	case msg := <-call.done:
+		if msg.Error != nil {
+			return callError(msg.Error)
+		}
+		if result != nil {
+			if err := json.Unmarshal(msg.Result, result); err != nil {
+				return fmt.Errorf("%s: invalid result: %w", method, err)
+			}
+		}
+		return nil
+	case <-c.closed:
+		return c.closeErr()
+	case <-ctx.Done():
+		c.cancel(id)
+		return fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+}
+
+// cancel сообщает плагину, что результат вызова больше не нужен
+func (c *client) cancel(id uint64) {
+	data, err := json.Marshal(plugin.CancelParams{ID: id})
+	if err != nil {
+		return
+	}
+	c.writeMu.Lock()
+	err = c.enc.Encode(&plugin.Message{JSONRPC: "2.0", Method: plugin.MethodCancel, Params: data})
+	c.writeMu.Unlock()
+	if err != nil {
+		c.fail(fmt.Errorf("%w: %v", errClientClosed, err))
+	}
+}
+
+// callError переводит ошибку протокола в ошибку контроллера; код завершения сохраняется в controllers.ExitError
+func callError(callErr *plugin.Error) error {
+	if callErr.Data != nil && callErr.Data.ExitCode != nil {
+		return &controllers.ExitError{Code: *callErr.Data.ExitCode, Err: errors.New(callErr.Message)}
+	}
+	return callErr
+}
+
+func (c *client) read() {
+	dec := json.NewDecoder(c.conn)
+	for {
+		var msg plugin.Message
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errClientClosed
+			} else {
+				err = fmt.Errorf("%w: %v", errClientClosed, err)
+			}
+			c.fail(err)
+			return
+		}
+
+		if msg.Method == plugin.MethodTaskOutput {
+			c.output(msg.Params)
+			continue
+		}
+		if msg.ID == nil {
+			continue
+		}
+		// Вызов снимается с ожидания до доставки: повторный или запоздавший ответ с тем же ID
+		// не найдёт его и не заблокирует чтение
+		c.mu.Lock()
+		call := c.pending[*msg.ID]
+		delete(c.pending, *msg.ID)
+		c.mu.Unlock()
+		if call != nil {
+			call.done <- &msg
+		}
+	}
+}
+
+// output пишет часть вывода в вывод вызова; запись идёт в горутине чтения, поэтому сохраняет порядок.
+// Вывод вызова, который уже вернулся (таймаут, $/cancel), отбрасывается.
+func (c *client) output(data json.RawMessage) {
+	var params plugin.OutputParams
+	if json.Unmarshal(data, &params) != nil {
+		return
+	}
+	c.mu.Lock()
+	call := c.pending[params.RequestID]
+	c.mu.Unlock()
+	if call == nil {
+		return
+	}
+
+	call.mu.Lock()
+	defer call.mu.Unlock()
+	if call.finished {
+		return
+	}
+	writer := call.output.Stdout
+	if params.Stream == plugin.StreamStderr {
+		writer = call.output.Stderr
+	}
+	if writer != nil {
+		writer.Write(params.Data)
+	}
+}
+
+func (c *client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.closed)
+	c.conn.Close()
+}
+
+func (c *client) closeErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// alive сообщает, что соединение ещё не разорвано
+func (c *client) alive() bool {
+	select {
+	case <-c.closed:
+		return false
+	default:
+		return true
+	}
+}
+
+func (c *client) Close() {
+	c.fail(errClientClosed)
+}
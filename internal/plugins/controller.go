@@ -0,0 +1,134 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"laplasd/internal/controllers"
+	"laplasd/pkg/plugin"
+	"time"
+)
+
+/*
+	RUS: Контроллеры-посредники: реализуют api.Controller и api.MonitoringController laplasd,
+	переадресуя вызовы плагину. RunTask ограничен TaskTimeout или метаданными задачи
+	(timeout, например 10m), RunCheck — check_timeout проверки или TaskTimeout, остальные
+	вызовы — CallTimeout. По истечении таймаута плагин получает $/cancel.
+	ENG: Proxy controllers forwarding api.Controller and api.MonitoringController calls to a plugin.
+*/
+
+// Controller — контроллер компонентов из плагина
+type Controller struct {
+	plugin      *Plugin
+	typ         string
+	callTimeout time.Duration
+	taskTimeout time.Duration
+}
+
+// timeout возвращает таймаут задачи: из метаданных задачи или общий
+func (c *Controller) timeout(taskMeta map[string]string) (time.Duration, error) {
+	raw := taskMeta["timeout"]
+	if raw == "" {
+		return c.taskTimeout, nil
+	}
+	timeout, err := time.ParseDuration(raw)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q", raw)
+	}
+	return timeout, nil
+}
+
+func (c *Controller) call(method string, params plugin.ControllerParams, output controllers.TaskOutput, timeout time.Duration) error {
+	client, err := c.plugin.conn()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	params.Type = c.typ
+	return client.call(ctx, method, params, output, nil)
+}
+
+func (c *Controller) RunTask(taskMeta map[string]string, componentMeta map[string]string) error {
+	return controllers.RunTaskLogged(c.plugin.logger, "Plugin "+c.plugin.name, c, taskMeta, componentMeta)
+}
+
+// RunTaskOutput выполняет задачу в плагине; вывод приходит уведомлениями task.output
+func (c *Controller) RunTaskOutput(taskMeta map[string]string, componentMeta map[string]string, output controllers.TaskOutput) error {
+	timeout, err := c.timeout(taskMeta)
+	if err != nil {
+		return err
+	}
+	err = c.call(plugin.MethodRunTask, plugin.ControllerParams{Task: taskMeta, Component: componentMeta}, output, timeout)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("plugin %s: task timed out after %s", c.plugin.name, timeout)
+	}
+	return err
+}
+
+func (c *Controller) ValideTask(taskMeta map[string]string) error {
+	if _, err := c.timeout(taskMeta); err != nil {
+		return err
+	}
+	return c.call(plugin.MethodValideTask, plugin.ControllerParams{Task: taskMeta}, controllers.TaskOutput{}, c.callTimeout)
+}
+
+func (c *Controller) ValideComponent(componentMeta map[string]string) error {
+	return c.call(plugin.MethodValideComponent, plugin.ControllerParams{Component: componentMeta}, controllers.TaskOutput{}, c.callTimeout)
+}
+
+func (c *Controller) CheckComponent(componentMeta map[string]string) error {
+	return c.call(plugin.MethodCheckComponent, plugin.ControllerParams{Component: componentMeta}, controllers.TaskOutput{}, c.callTimeout)
+}
+
+// MonitorController — контроллер мониторинга из плагина
+type MonitorController struct {
+	plugin      *Plugin
+	typ         string
+	callTimeout time.Duration
+	// Таймаут RunCheck без check_timeout: проверки бывают долгими, как задачи
+	checkTimeout time.Duration
+}
+
+func (m *MonitorController) call(method string, meta map[string]string, timeout time.Duration) error {
+	client, err := m.plugin.conn()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return client.call(ctx, method, plugin.MonitorParams{Type: m.typ, Meta: meta}, controllers.TaskOutput{}, nil)
+}
+
+// RunCheck ограничен check_timeout проверки, как и проверки встроенных мониторингов
+func (m *MonitorController) RunCheck(monitorMeta map[string]string) error {
+	timeout := m.checkTimeout
+	if raw := monitorMeta["check_timeout"]; raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid check_timeout %q", raw)
+		}
+		timeout = d
+	}
+	err := m.call(plugin.MethodRunCheck, monitorMeta, timeout)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("plugin %s: check timed out after %s", m.plugin.name, timeout)
+	}
+	return err
+}
+
+func (m *MonitorController) CheckMonitoring(config map[string]string) error {
+	return m.call(plugin.MethodCheckMonitoring, config, m.callTimeout)
+}
+
+func (m *MonitorController) ValidateCheck(monitorMeta map[string]string) error {
+	return m.call(plugin.MethodValidateCheck, monitorMeta, m.callTimeout)
+}
+
+func (m *MonitorController) ValidateMonitoring(config map[string]string) error {
+	return m.call(plugin.MethodValidateMonitoring, config, m.callTimeout)
+}
@@ -0,0 +1,164 @@
+package plugins
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/laplasd/inforo"
+	"github.com/laplasd/inforo/api"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+	RUS: Менеджер плагинов: находит плагины в каталоге, запускает их и регистрирует их
+	контроллеры в реестрах laplasd. Исполняемые файлы запускаются и общаются через stdio,
+	к unix-сокетам laplasd подключается. Скрытые файлы и файлы без права исполнения пропускаются.
+	ENG: Plugin manager: discovers plugins in a directory, starts them and registers their
+	controllers. Executables are spoken to over stdio, unix sockets are dialed.
+*/
+
+const (
+	DefaultPluginCallTimeout  = 30 * time.Second
+	DefaultPluginStartTimeout = 10 * time.Second
+	DefaultPluginTaskTimeout  = time.Hour
+)
+
+type Manager struct {
+	dir          string
+	callTimeout  time.Duration
+	startTimeout time.Duration
+	taskTimeout  time.Duration
+	logger       *logrus.Logger
+	plugins      []*Plugin
+}
+
+type ManagerOptions struct {
+	Logger *logrus.Logger
+	// Каталог плагинов; пустой — плагины отключены
+	Dir string
+	// Таймаут вызовов, кроме RunTask
+	CallTimeout time.Duration
+	// Таймаут запуска плагина и handshake
+	StartTimeout time.Duration
+	// Таймаут задачи, если он не задан в её метаданных; им же ограничен RunCheck без check_timeout
+	TaskTimeout time.Duration
+}
+
+func NewManager(opts ManagerOptions) *Manager {
+	if opts.Logger == nil {
+		opts.Logger = inforo.NewNullLogger()
+	}
+	if opts.CallTimeout <= 0 {
+		opts.CallTimeout = DefaultPluginCallTimeout
+	}
+	if opts.StartTimeout <= 0 {
+		opts.StartTimeout = DefaultPluginStartTimeout
+	}
+	if opts.TaskTimeout <= 0 {
+		opts.TaskTimeout = DefaultPluginTaskTimeout
+	}
+	return &Manager{
+		dir:          opts.Dir,
+		callTimeout:  opts.CallTimeout,
+		startTimeout: opts.StartTimeout,
+		taskTimeout:  opts.TaskTimeout,
+		logger:       opts.Logger,
+	}
+}
+
+// discover находит плагины в каталоге
+func (m *Manager) discover() ([]*Plugin, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return nil, fmt.Errorf("plugins dir: %w", err)
+	}
+
+	var found []*Plugin
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := filepath.Join(m.dir, name)
+		// Stat, а не Lstat: плагины часто ставят симлинками
+		info, err := os.Stat(path)
+		if err != nil {
+			m.logger.Warnf("Plugins: skipping %s: %v", path, err)
+			continue
+		}
+
+		p := &Plugin{
+			name:         strings.TrimSuffix(name, filepath.Ext(name)),
+			path:         path,
+			logger:       m.logger,
+			startTimeout: m.startTimeout,
+		}
+		switch mode := info.Mode(); {
+		case mode&os.ModeSocket != 0:
+			p.transport = transportSocket
+		case mode.IsRegular() && mode.Perm()&0o111 != 0:
+			p.transport = transportExec
+			p.name = name
+		default:
+			m.logger.Debugf("Plugins: skipping %s: not an executable or a socket", path)
+			continue
+		}
+		found = append(found, p)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].name < found[j].name })
+	return found, nil
+}
+
+// Load запускает плагины и регистрирует их контроллеры. Ошибка любого плагина останавливает
+// запуск laplasd: иначе компоненты его типов не восстановятся из хранилища.
+func (m *Manager) Load(components api.ControllerRegistry, monitors api.MonitoringControllerRegistry) error {
+	if m.dir == "" {
+		return nil
+	}
+	found, err := m.discover()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range found {
+		if err := p.start(); err != nil {
+			return err
+		}
+		m.plugins = append(m.plugins, p)
+
+		info := p.Info()
+		for _, typ := range info.Controllers {
+			proxy := &Controller{plugin: p, typ: typ, callTimeout: m.callTimeout, taskTimeout: m.taskTimeout}
+			if err := components.Register(typ, proxy); err != nil {
+				return fmt.Errorf("plugin %s: %w", p.name, err)
+			}
+		}
+		for _, typ := range info.MonitorControllers {
+			proxy := &MonitorController{plugin: p, typ: typ, callTimeout: m.callTimeout, checkTimeout: m.taskTimeout}
+			if err := monitors.Register(typ, proxy); err != nil {
+				return fmt.Errorf("plugin %s: %w", p.name, err)
+			}
+		}
+		if len(info.Controllers)+len(info.MonitorControllers) == 0 {
+			m.logger.Warnf("Plugin %s serves no controllers", p.name)
+		}
+	}
+	m.logger.Infof("Plugins: loaded %d from %s", len(m.plugins), m.dir)
+	return nil
+}
+
+// Plugins возвращает загруженные плагины
+func (m *Manager) Plugins() []*Plugin {
+	return m.plugins
+}
+
+// Close останавливает все плагины
+func (m *Manager) Close() {
+	for _, p := range m.plugins {
+		p.Close()
+	}
+}
@@ -0,0 +1,284 @@
+package plugins
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"laplasd/internal/controllers"
+	"laplasd/pkg/plugin"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Способ подключения к плагину
+const (
+	transportExec   = "exec"
+	transportSocket = "unix"
+)
+
+// Plugin — один плагин из каталога: процесс, общающийся через stdio, или unix-сокет.
+// Упавший процесс перезапускается при следующем вызове, но не чаще раза в restartDelay.
+// Перезапуск идёт без блокировки mu: остальные вызовы и Info не ждут его, а сразу получают ошибку.
+type Plugin struct {
+	name      string
+	path      string
+	transport string
+	logger    *logrus.Logger
+	// Таймаут запуска и handshake
+	startTimeout time.Duration
+
+	mu         sync.Mutex
+	current    *instance
+	info       plugin.HandshakeResult
+	started    time.Time
+	restarting bool
+	closed     bool
+}
+
+// instance — запущенный экземпляр плагина: соединение и, для исполняемого файла, его процесс
+type instance struct {
+	client *client
+	cmd    *exec.Cmd
+	exited chan struct{}
+}
+
+// Минимальный интервал между перезапусками упавшего плагина
+const restartDelay = 5 * time.Second
+
+// Сколько ждать завершения процесса плагина после закрытия stdin
+const stopTimeout = 5 * time.Second
+
+func (p *Plugin) Name() string {
+	return p.name
+}
+
+// Info возвращает результат handshake
+func (p *Plugin) Info() plugin.HandshakeResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.info
+}
+
+// conn возвращает клиент плагина, при необходимости перезапуская его
+func (p *Plugin) conn() (*client, error) {
+	p.mu.Lock()
+	switch {
+	case p.closed:
+		p.mu.Unlock()
+		return nil, fmt.Errorf("plugin %s is stopped", p.name)
+	case p.current != nil && p.current.client.alive():
+		client := p.current.client
+		p.mu.Unlock()
+		return client, nil
+	case p.restarting:
+		p.mu.Unlock()
+		return nil, fmt.Errorf("plugin %s is restarting", p.name)
+	}
+	if wait := restartDelay - time.Since(p.started); !p.started.IsZero() && wait > 0 {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("plugin %s is down, restarting in %s", p.name, wait.Round(time.Second))
+	}
+	old := p.current
+	p.current, p.restarting, p.started = nil, true, time.Now()
+	p.mu.Unlock()
+
+	if old != nil {
+		p.logger.Warnf("Plugin %s: connection lost (%v), restarting", p.name, old.client.closeErr())
+		p.stop(old)
+	}
+	inst, info, err := p.launch()
+
+	p.mu.Lock()
+	p.restarting = false
+	closed := p.closed
+	if err == nil && !closed {
+		p.setLocked(inst, info)
+	}
+	p.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	if closed {
+		p.stop(inst)
+		return nil, fmt.Errorf("plugin %s is stopped", p.name)
+	}
+	return inst.client, nil
+}
+
+// start запускает плагин и выполняет handshake
+func (p *Plugin) start() error {
+	p.mu.Lock()
+	p.started = time.Now()
+	p.mu.Unlock()
+
+	inst, info, err := p.launch()
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.setLocked(inst, info)
+	return nil
+}
+
+// launch подключается к плагину (или запускает его процесс) и выполняет handshake
+func (p *Plugin) launch() (*instance, plugin.HandshakeResult, error) {
+	inst := &instance{}
+	var info plugin.HandshakeResult
+
+	var conn io.ReadWriteCloser
+	switch p.transport {
+	case transportSocket:
+		c, err := net.DialTimeout("unix", p.path, p.startTimeout)
+		if err != nil {
+			return nil, info, fmt.Errorf("plugin %s: %w", p.name, err)
+		}
+		conn = c
+	default:
+		c, err := p.spawn(inst)
+		if err != nil {
+			return nil, info, fmt.Errorf("plugin %s: %w", p.name, err)
+		}
+		conn = c
+	}
+
+	inst.client = newClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), p.startTimeout)
+	defer cancel()
+
+	err := inst.client.call(ctx, plugin.MethodHandshake, plugin.HandshakeParams{ProtocolVersion: plugin.ProtocolVersion}, controllers.TaskOutput{}, &info)
+	if err == nil && info.ProtocolVersion != plugin.ProtocolVersion {
+		err = fmt.Errorf("plugin speaks protocol version %d, laplasd supports %d", info.ProtocolVersion, plugin.ProtocolVersion)
+	}
+	if err != nil {
+		p.stop(inst)
+		return nil, info, fmt.Errorf("plugin %s: handshake: %w", p.name, err)
+	}
+
+	sort.Strings(info.Controllers)
+	sort.Strings(info.MonitorControllers)
+	return inst, info, nil
+}
+
+// setLocked делает запущенный экземпляр текущим
+func (p *Plugin) setLocked(inst *instance, info plugin.HandshakeResult) {
+	if p.info.ProtocolVersion != 0 && !sameTypes(p.info, info) {
+		p.logger.Warnf("Plugin %s: controller types changed after restart (%v/%v -> %v/%v); restart laplasd to register them",
+			p.name, p.info.Controllers, p.info.MonitorControllers, info.Controllers, info.MonitorControllers)
+	}
+	p.current = inst
+	p.info = info
+	p.logger.Infof("Plugin %s (%s) started: controllers %v, monitor controllers %v", p.name, info.Name, info.Controllers, info.MonitorControllers)
+}
+
+// spawn запускает исполняемый файл плагина; stderr плагина пишется в лог laplasd.
+// stdout и stderr — собственные os.Pipe: Wait закрывает только трубы из StdoutPipe/StderrPipe,
+// поэтому последние ответы и строки stderr вышедшего плагина дочитываются до EOF.
+func (p *Plugin) spawn(inst *instance) (io.ReadWriteCloser, error) {
+	cmd := exec.Command(p.path)
+	cmd.Env = append(os.Environ(), plugin.EnvProtocol+"="+strconv.Itoa(plugin.ProtocolVersion))
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, stdoutW, err := os.Pipe()
+	if err != nil {
+		stdin.Close()
+		return nil, err
+	}
+	stderr, stderrW, err := os.Pipe()
+	if err != nil {
+		stdin.Close()
+		stdout.Close()
+		stdoutW.Close()
+		return nil, err
+	}
+	cmd.Stdout, cmd.Stderr = stdoutW, stderrW
+	err = cmd.Start()
+	// Концы для записи остались у процесса плагина
+	stdoutW.Close()
+	stderrW.Close()
+	if err != nil {
+		stdin.Close()
+		stdout.Close()
+		stderr.Close()
+		return nil, err
+	}
+
+	go func() {
+		defer stderr.Close()
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			p.logger.Infof("Plugin %s: %s", p.name, scanner.Text())
+		}
+	}()
+
+	exited := make(chan struct{})
+	go func() {
+		err := cmd.Wait()
+		if err != nil {
+			p.logger.Warnf("Plugin %s exited: %v", p.name, err)
+		}
+		close(exited)
+	}()
+	inst.cmd, inst.exited = cmd, exited
+
+	return &stdio{Reader: stdout, stdin: stdin, stdout: stdout}, nil
+}
+
+// stdio — соединение с процессом плагина; Close закрывает обе трубы
+type stdio struct {
+	io.Reader
+	stdin  io.WriteCloser
+	stdout *os.File
+}
+
+func (s *stdio) Write(p []byte) (int, error) {
+	return s.stdin.Write(p)
+}
+
+func (s *stdio) Close() error {
+	err := s.stdin.Close()
+	s.stdout.Close()
+	return err
+}
+
+// stop закрывает соединение и останавливает процесс: сначала закрытием stdin, затем SIGKILL
+func (p *Plugin) stop(inst *instance) {
+	inst.client.Close()
+	if inst.cmd == nil {
+		return
+	}
+	select {
+	case <-inst.exited:
+	case <-time.After(stopTimeout):
+		p.logger.Warnf("Plugin %s did not exit in %s, killing", p.name, stopTimeout)
+		inst.cmd.Process.Kill()
+		<-inst.exited
+	}
+}
+
+func (p *Plugin) Close() {
+	p.mu.Lock()
+	p.closed = true
+	inst := p.current
+	p.current = nil
+	p.mu.Unlock()
+
+	if inst != nil {
+		p.stop(inst)
+	}
+}
+
+func sameTypes(a, b plugin.HandshakeResult) bool {
+	return fmt.Sprint(a.Controllers, a.MonitorControllers) == fmt.Sprint(b.Controllers, b.MonitorControllers)
+}
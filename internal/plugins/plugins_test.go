@@ -0,0 +1,509 @@
+package plugins
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"laplasd/internal/controllers"
+	"laplasd/pkg/plugin"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/laplasd/inforo/api"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// testExitError — ошибка команды с кодом завершения, как *exec.ExitError
+type testExitError struct{ code int }
+
+func (e testExitError) Error() string { return fmt.Sprintf("exit status %d", e.code) }
+func (e testExitError) ExitCode() int { return e.code }
+
+// testController — контроллер плагина; поведение задачи задаётся её метаданными mode
+type testController struct {
+	cancelled chan struct{}
+}
+
+func newTestController() *testController {
+	return &testController{cancelled: make(chan struct{})}
+}
+
+func (c *testController) RunTask(taskMeta, componentMeta map[string]string) error {
+	return c.RunTaskContext(context.Background(), taskMeta, componentMeta, io.Discard, io.Discard)
+}
+
+func (c *testController) RunTaskContext(ctx context.Context, taskMeta, componentMeta map[string]string, stdout, stderr io.Writer) error {
+	switch taskMeta["mode"] {
+	case "output":
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(stdout, "%s out %d\n", taskMeta["id"], i)
+		}
+		fmt.Fprintf(stderr, "%s err\n", taskMeta["id"])
+	case "exit":
+		fmt.Fprintln(stderr, "deploy failed")
+		return fmt.Errorf("deploy: %w", testExitError{code: 7})
+	case "binary":
+		// Двоичные байты и символ UTF-8, разрезанный между записями
+		stdout.Write([]byte{0x00, 0xff, 0xfe, 0xd0})
+		stdout.Write([]byte{0xbf, '\n'})
+	case "block":
+		<-ctx.Done()
+		close(c.cancelled)
+		return ctx.Err()
+	}
+	return nil
+}
+
+func (c *testController) ValideTask(taskMeta map[string]string) error {
+	if taskMeta["id"] == "" {
+		return fmt.Errorf("task id is required")
+	}
+	return nil
+}
+
+func (c *testController) ValideComponent(componentMeta map[string]string) error { return nil }
+func (c *testController) CheckComponent(componentMeta map[string]string) error  { return nil }
+
+// testMonitor — контроллер мониторинга плагина; RunCheck длится delay из метаданных
+type testMonitor struct{}
+
+func (testMonitor) RunCheck(monitorMeta map[string]string) error {
+	delay, _ := time.ParseDuration(monitorMeta["delay"])
+	time.Sleep(delay)
+	return nil
+}
+
+func (testMonitor) CheckMonitoring(config map[string]string) error    { return nil }
+func (testMonitor) ValidateCheck(monitorMeta map[string]string) error { return nil }
+func (testMonitor) ValidateMonitoring(config map[string]string) error { return nil }
+
+func testOptions(controller api.Controller) plugin.Options {
+	return plugin.Options{
+		Name:               "acme",
+		Controllers:        map[string]api.Controller{"acme-lb": controller},
+		MonitorControllers: map[string]api.MonitoringController{"acme-probe": testMonitor{}},
+	}
+}
+
+// newPipeClient соединяет клиент laplasd с plugin.ServeConn через net.Pipe;
+// второе значение — сторона плагина, её закрытие имитирует падение плагина
+func newPipeClient(t *testing.T, controller api.Controller) (*client, net.Conn) {
+	t.Helper()
+	laplasdSide, pluginSide := net.Pipe()
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		plugin.ServeConn(pluginSide, testOptions(controller))
+	}()
+	c := newClient(laplasdSide)
+	t.Cleanup(func() {
+		c.Close()
+		<-served
+	})
+	return c, pluginSide
+}
+
+func runTask(c *client, ctx context.Context, task map[string]string, output controllers.TaskOutput) error {
+	params := plugin.ControllerParams{Type: "acme-lb", Task: task}
+	return c.call(ctx, plugin.MethodRunTask, params, output, nil)
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestClientHandshake(t *testing.T) {
+	c, _ := newPipeClient(t, newTestController())
+
+	var info plugin.HandshakeResult
+	err := c.call(testContext(t), plugin.MethodHandshake, plugin.HandshakeParams{ProtocolVersion: plugin.ProtocolVersion}, controllers.TaskOutput{}, &info)
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	if info.ProtocolVersion != plugin.ProtocolVersion || info.Name != "acme" || fmt.Sprint(info.Controllers) != "[acme-lb]" {
+		t.Errorf("handshake result = %+v", info)
+	}
+}
+
+func TestClientRoutesTaskOutput(t *testing.T) {
+	c, _ := newPipeClient(t, newTestController())
+	ctx := testContext(t)
+
+	var wg sync.WaitGroup
+	stdout := make([]bytes.Buffer, 4)
+	stderr := make([]bytes.Buffer, 4)
+	errs := make([]error, 4)
+	for i := range stdout {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			task := map[string]string{"id": fmt.Sprintf("t%d", i), "mode": "output"}
+			errs[i] = runTask(c, ctx, task, controllers.TaskOutput{Stdout: &stdout[i], Stderr: &stderr[i]})
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range stdout {
+		if errs[i] != nil {
+			t.Fatalf("task t%d: %v", i, errs[i])
+		}
+		want := fmt.Sprintf("t%[1]d out 0\nt%[1]d out 1\nt%[1]d out 2\n", i)
+		if got := stdout[i].String(); got != want {
+			t.Errorf("task t%d stdout = %q, want %q", i, got, want)
+		}
+		if got := stderr[i].String(); got != fmt.Sprintf("t%d err\n", i) {
+			t.Errorf("task t%d stderr = %q", i, got)
+		}
+	}
+}
+
+func TestClientPassesBinaryOutput(t *testing.T) {
+	c, _ := newPipeClient(t, newTestController())
+
+	var stdout bytes.Buffer
+	if err := runTask(c, testContext(t), map[string]string{"id": "t1", "mode": "binary"}, controllers.TaskOutput{Stdout: &stdout}); err != nil {
+		t.Fatalf("RunTask: %v", err)
+	}
+	if want := []byte{0x00, 0xff, 0xfe, 0xd0, 0xbf, '\n'}; !bytes.Equal(stdout.Bytes(), want) {
+		t.Errorf("stdout = %x, want %x", stdout.Bytes(), want)
+	}
+}
+
+func TestClientDropsOutputAfterReturn(t *testing.T) {
+	laplasdSide, pluginSide := net.Pipe()
+	c := newClient(laplasdSide)
+	defer c.Close()
+
+	// Плагин не отвечает на задачу и присылает её вывод, когда laplasd уже перестал её ждать
+	late := make(chan struct{})
+	go func() {
+		dec := json.NewDecoder(pluginSide)
+		enc := json.NewEncoder(pluginSide)
+		var task plugin.Message
+		if dec.Decode(&task) != nil {
+			return
+		}
+		for {
+			var msg plugin.Message
+			if dec.Decode(&msg) != nil {
+				return
+			}
+			if msg.ID == nil {
+				continue
+			}
+			<-late
+			params, _ := json.Marshal(plugin.OutputParams{RequestID: *task.ID, Stream: plugin.StreamStdout, Data: []byte("late\n")})
+			enc.Encode(&plugin.Message{JSONRPC: "2.0", Method: plugin.MethodTaskOutput, Params: params})
+			enc.Encode(&plugin.Message{JSONRPC: "2.0", ID: msg.ID, Result: json.RawMessage(`{}`)})
+		}
+	}()
+
+	var stdout bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := runTask(c, ctx, map[string]string{"id": "t1"}, controllers.TaskOutput{Stdout: &stdout}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RunTask error = %v, want deadline exceeded", err)
+	}
+	close(late)
+	// Ответ на второй вызов читается после запоздавшего вывода
+	if err := c.call(testContext(t), plugin.MethodCheckComponent, plugin.ControllerParams{Type: "acme-lb"}, controllers.TaskOutput{}, nil); err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("output written after the call returned: %q", stdout.String())
+	}
+}
+
+func TestClientPropagatesExitCode(t *testing.T) {
+	c, _ := newPipeClient(t, newTestController())
+
+	var stderr bytes.Buffer
+	err := runTask(c, testContext(t), map[string]string{"id": "t1", "mode": "exit"}, controllers.TaskOutput{Stderr: &stderr})
+	var exitErr *controllers.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 7 {
+		t.Fatalf("RunTask error = %#v, want ExitError with code 7", err)
+	}
+	if err.Error() != "deploy: exit status 7" {
+		t.Errorf("error message = %q", err.Error())
+	}
+	if stderr.String() != "deploy failed\n" {
+		t.Errorf("stderr = %q", stderr.String())
+	}
+}
+
+func TestClientControllerErrors(t *testing.T) {
+	c, _ := newPipeClient(t, newTestController())
+	ctx := testContext(t)
+
+	err := c.call(ctx, plugin.MethodValideTask, plugin.ControllerParams{Type: "acme-lb", Task: map[string]string{}}, controllers.TaskOutput{}, nil)
+	if err == nil || err.Error() != "task id is required" {
+		t.Errorf("ValideTask error = %v, want the controller message as is", err)
+	}
+	err = c.call(ctx, plugin.MethodCheckComponent, plugin.ControllerParams{Type: "other"}, controllers.TaskOutput{}, nil)
+	var callErr *plugin.Error
+	if !errors.As(err, &callErr) || callErr.Code != plugin.CodeUnknownType {
+		t.Errorf("CheckComponent error = %v, want unknown type", err)
+	}
+}
+
+func TestClientCancelsTimedOutCall(t *testing.T) {
+	controller := newTestController()
+	c, _ := newPipeClient(t, controller)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := runTask(c, ctx, map[string]string{"id": "t1", "mode": "block"}, controllers.TaskOutput{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RunTask error = %v, want deadline exceeded", err)
+	}
+	select {
+	case <-controller.cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("task context was not canceled by $/cancel")
+	}
+	// Соединение пригодно для следующих вызовов
+	if err := runTask(c, testContext(t), map[string]string{"id": "t2"}, controllers.TaskOutput{}); err != nil {
+		t.Fatalf("RunTask after cancel: %v", err)
+	}
+}
+
+func TestClientConnectionDrop(t *testing.T) {
+	controller := newTestController()
+	c, pluginSide := newPipeClient(t, controller)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runTask(c, context.Background(), map[string]string{"id": "t1", "mode": "block"}, controllers.TaskOutput{})
+	}()
+	// Ждём, пока задача дойдёт до плагина, и обрываем соединение
+	time.Sleep(50 * time.Millisecond)
+	pluginSide.Close()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, errClientClosed) {
+			t.Fatalf("RunTask error = %v, want %v", err, errClientClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("call did not return after the connection dropped")
+	}
+	if c.alive() {
+		t.Error("client is alive after the connection dropped")
+	}
+	if err := runTask(c, testContext(t), map[string]string{"id": "t2"}, controllers.TaskOutput{}); !errors.Is(err, errClientClosed) {
+		t.Errorf("call on a dropped connection = %v, want %v", err, errClientClosed)
+	}
+	select {
+	case <-controller.cancelled:
+	case <-time.After(5 * time.Second):
+		t.Error("task context was not canceled when the connection dropped")
+	}
+}
+
+func TestClientIgnoresDuplicateResponses(t *testing.T) {
+	laplasdSide, pluginSide := net.Pipe()
+	c := newClient(laplasdSide)
+	defer c.Close()
+
+	// Плагин отвечает на каждый запрос трижды
+	go func() {
+		dec := json.NewDecoder(pluginSide)
+		enc := json.NewEncoder(pluginSide)
+		for {
+			var msg plugin.Message
+			if dec.Decode(&msg) != nil {
+				return
+			}
+			for i := 0; i < 3; i++ {
+				enc.Encode(&plugin.Message{JSONRPC: "2.0", ID: msg.ID, Result: json.RawMessage(`{}`)})
+			}
+		}
+	}()
+
+	for i := 0; i < 3; i++ {
+		if err := c.call(testContext(t), plugin.MethodCheckComponent, plugin.ControllerParams{Type: "acme-lb"}, controllers.TaskOutput{}, nil); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+}
+
+// servePluginSocket обслуживает unix-сокет плагина в каталоге теста
+func servePluginSocket(t *testing.T, handle func(net.Conn)) *Plugin {
+	t.Helper()
+	sock := filepath.Join(t.TempDir(), "acme.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	p := &Plugin{name: "acme", path: sock, transport: transportSocket, logger: logger, startTimeout: 5 * time.Second}
+	t.Cleanup(p.Close)
+	return p
+}
+
+func TestPluginHandshake(t *testing.T) {
+	p := servePluginSocket(t, func(conn net.Conn) { plugin.ServeConn(conn, testOptions(newTestController())) })
+	if err := p.start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if info := p.Info(); info.Name != "acme" || fmt.Sprint(info.Controllers) != "[acme-lb]" {
+		t.Errorf("Info() = %+v", info)
+	}
+}
+
+func TestPluginReadsOutputOfExitedProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acme")
+	script := "#!/bin/sh\nread line\n" +
+		`echo '{"jsonrpc":"2.0","id":1,"result":{"protocol_version":1,"name":"acme","controllers":["acme-lb"]}}'` + "\n" +
+		"echo bye >&2\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	logger, hook := test.NewNullLogger()
+	p := &Plugin{name: "acme", path: path, transport: transportExec, logger: logger, startTimeout: 5 * time.Second}
+	defer p.Close()
+	// Процесс выходит сразу после ответа: handshake и stderr дочитываются после его завершения
+	if err := p.start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		logged := false
+		for _, entry := range hook.AllEntries() {
+			logged = logged || entry.Message == "Plugin acme: bye"
+		}
+		if logged {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stderr of the exited plugin was not logged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPluginHandshakeVersionMismatch(t *testing.T) {
+	p := servePluginSocket(t, func(conn net.Conn) {
+		bufio.NewReader(conn).ReadBytes('\n')
+		io.WriteString(conn, `{"jsonrpc":"2.0","id":1,"result":{"protocol_version":2,"name":"acme"}}`+"\n")
+	})
+	err := p.start()
+	if err == nil || !strings.Contains(err.Error(), "plugin speaks protocol version 2, laplasd supports 1") {
+		t.Fatalf("start error = %v, want version mismatch", err)
+	}
+}
+
+func TestPluginRestartDoesNotBlockCalls(t *testing.T) {
+	release := make(chan struct{})
+	p := servePluginSocket(t, func(conn net.Conn) {
+		<-release
+		plugin.ServeConn(conn, testOptions(newTestController()))
+	})
+
+	started := make(chan error, 1)
+	go func() {
+		_, err := p.conn()
+		started <- err
+	}()
+	// Ждём, пока первый вызов начнёт запуск
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		p.mu.Lock()
+		restarting := p.restarting
+		p.mu.Unlock()
+		if restarting {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("plugin start did not begin")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	returned := make(chan error, 1)
+	go func() {
+		p.Info()
+		_, err := p.conn()
+		returned <- err
+	}()
+	select {
+	case err := <-returned:
+		if err == nil || !strings.Contains(err.Error(), "is restarting") {
+			t.Errorf("conn during restart = %v, want restarting error", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Info and conn blocked while the plugin was starting")
+	}
+
+	close(release)
+	if err := <-started; err != nil {
+		t.Fatalf("conn: %v", err)
+	}
+	if _, err := p.conn(); err != nil {
+		t.Fatalf("conn after restart: %v", err)
+	}
+}
+
+func TestControllerTaskTimeout(t *testing.T) {
+	controller := newTestController()
+	p := servePluginSocket(t, func(conn net.Conn) { plugin.ServeConn(conn, testOptions(controller)) })
+	if err := p.start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	proxy := &Controller{plugin: p, typ: "acme-lb", callTimeout: time.Second, taskTimeout: time.Minute}
+
+	if err := proxy.ValideTask(map[string]string{"id": "t1", "timeout": "soon"}); err == nil || !strings.Contains(err.Error(), `invalid timeout "soon"`) {
+		t.Errorf("ValideTask error = %v, want invalid timeout", err)
+	}
+	err := proxy.RunTaskOutput(map[string]string{"id": "t1", "mode": "block", "timeout": "50ms"}, nil, controllers.TaskOutput{})
+	if err == nil || err.Error() != "plugin acme: task timed out after 50ms" {
+		t.Fatalf("RunTaskOutput error = %v, want task timeout", err)
+	}
+	select {
+	case <-controller.cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("plugin task was not canceled after the timeout")
+	}
+}
+
+func TestMonitorControllerCheckTimeout(t *testing.T) {
+	p := servePluginSocket(t, func(conn net.Conn) { plugin.ServeConn(conn, testOptions(newTestController())) })
+	if err := p.start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	proxy := &MonitorController{plugin: p, typ: "acme-probe", callTimeout: 10 * time.Millisecond, checkTimeout: time.Minute}
+
+	// Проверка дольше CallTimeout не прерывается
+	if err := proxy.RunCheck(map[string]string{"delay": "100ms"}); err != nil {
+		t.Fatalf("RunCheck: %v", err)
+	}
+	err := proxy.RunCheck(map[string]string{"delay": "1s", "check_timeout": "50ms"})
+	if err == nil || err.Error() != "plugin acme: check timed out after 50ms" {
+		t.Errorf("RunCheck error = %v, want check timeout", err)
+	}
+}
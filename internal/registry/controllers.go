@@ -0,0 +1,121 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/laplasd/inforo"
+	"github.com/laplasd/inforo/api"
+
+	"github.com/sirupsen/logrus"
+)
+
+/*
+	RUS: Реестр контроллеров компонентов laplasd. В отличие от inforo.ControllerRegistry
+	не регистрирует встроенные контроллеры inforo, а Update/Delete/List действительно работают.
+	ENG: laplasd component controller registry. Unlike inforo.ControllerRegistry it does not
+	pre-register inforo's built-in controllers, and Update/Delete/List actually work.
+*/
+
+type ControllerRegistry struct {
+	controllers map[string]api.Controller
+	mu          *sync.RWMutex
+	logger      *logrus.Logger
+}
+
+type ControllerRegistryOptions struct {
+	Logger *logrus.Logger
+}
+
+func NewControllerRegistry(opts ControllerRegistryOptions) *ControllerRegistry {
+	if opts.Logger == nil {
+		opts.Logger = inforo.NewNullLogger()
+	}
+	return &ControllerRegistry{
+		controllers: make(map[string]api.Controller),
+		mu:          &sync.RWMutex{},
+		logger:      opts.Logger,
+	}
+}
+
+func (cr *ControllerRegistry) Register(controllerType string, controller api.Controller) error {
+	if controllerType == "" {
+		return errors.New("controller type is empty")
+	}
+	if controller == nil {
+		return fmt.Errorf("controller %s is nil", controllerType)
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if _, exists := cr.controllers[controllerType]; exists {
+		return fmt.Errorf("controller %s already registered", controllerType)
+	}
+	cr.controllers[controllerType] = controller
+	cr.logger.Debugf("Registered controller %s (%T)", controllerType, controller)
+	return nil
+}
+
+func (cr *ControllerRegistry) Get(controllerType string) (api.Controller, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	controller, ok := cr.controllers[controllerType]
+	if !ok {
+		return nil, fmt.Errorf("controller %s not found", controllerType)
+	}
+	return controller, nil
+}
+
+func (cr *ControllerRegistry) Update(controllerType string, controller api.Controller) error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if _, exists := cr.controllers[controllerType]; !exists {
+		return fmt.Errorf("controller %s not found", controllerType)
+	}
+	cr.controllers[controllerType] = controller
+	return nil
+}
+
+func (cr *ControllerRegistry) Delete(controllerType string) error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if _, exists := cr.controllers[controllerType]; !exists {
+		return fmt.Errorf("controller %s not found", controllerType)
+	}
+	delete(cr.controllers, controllerType)
+	return nil
+}
+
+func (cr *ControllerRegistry) List() ([]api.Controller, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	types := cr.types()
+	list := make([]api.Controller, 0, len(types))
+	for _, t := range types {
+		list = append(list, cr.controllers[t])
+	}
+	return list, nil
+}
+
+func (cr *ControllerRegistry) ListType() ([]string, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	return cr.types(), nil
+}
+
+func (cr *ControllerRegistry) types() []string {
+	types := make([]string, 0, len(cr.controllers))
+	for t := range cr.controllers {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,75 @@
+package registry
+
+import (
+	"strings"
+	"testing"
+)
+
+// stubController — контроллер компонентов без поведения; name различает экземпляры
+type stubController struct {
+	name string
+}
+
+func (c *stubController) RunTask(taskMeta, componentMeta map[string]string) error { return nil }
+func (c *stubController) ValideTask(meta map[string]string) error                 { return nil }
+func (c *stubController) ValideComponent(meta map[string]string) error            { return nil }
+func (c *stubController) CheckComponent(meta map[string]string) error             { return nil }
+
+func TestControllerRegistry(t *testing.T) {
+	cr := NewControllerRegistry(ControllerRegistryOptions{})
+	ssh, exec := &stubController{name: "ssh"}, &stubController{name: "exec"}
+
+	if types, _ := cr.ListType(); len(types) != 0 {
+		t.Fatalf("new registry has controllers %v, want none", types)
+	}
+	for typ, controller := range map[string]*stubController{"ssh-controller": ssh, "exec-controller": exec} {
+		if err := cr.Register(typ, controller); err != nil {
+			t.Fatalf("Register(%s): %v", typ, err)
+		}
+	}
+	if err := cr.Register("ssh-controller", exec); err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Errorf("Register duplicate = %v, want already registered", err)
+	}
+	if err := cr.Register("", ssh); err == nil {
+		t.Error("Register with an empty type succeeded")
+	}
+	if err := cr.Register("nil-controller", nil); err == nil {
+		t.Error("Register of a nil controller succeeded")
+	}
+
+	if got, err := cr.Get("ssh-controller"); err != nil || got != ssh {
+		t.Errorf("Get(ssh-controller) = %v, %v", got, err)
+	}
+	if _, err := cr.Get("missing"); err == nil {
+		t.Error("Get(missing) succeeded")
+	}
+
+	// ListType и List упорядочены по типу
+	if types, _ := cr.ListType(); strings.Join(types, ",") != "exec-controller,ssh-controller" {
+		t.Errorf("ListType = %v", types)
+	}
+	if list, _ := cr.List(); len(list) != 2 || list[0] != exec || list[1] != ssh {
+		t.Errorf("List = %v, want exec then ssh", list)
+	}
+
+	replacement := &stubController{name: "ssh v2"}
+	if err := cr.Update("ssh-controller", replacement); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got, _ := cr.Get("ssh-controller"); got != replacement {
+		t.Errorf("Get after Update = %v, want the replacement", got)
+	}
+	if err := cr.Update("missing", replacement); err == nil {
+		t.Error("Update(missing) succeeded")
+	}
+
+	if err := cr.Delete("ssh-controller"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := cr.Delete("ssh-controller"); err == nil {
+		t.Error("second Delete succeeded")
+	}
+	if types, _ := cr.ListType(); strings.Join(types, ",") != "exec-controller" {
+		t.Errorf("ListType after Delete = %v", types)
+	}
+}
@@ -0,0 +1,132 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/laplasd/inforo/model"
+)
+
+// ErrInvalidPlan — план отклонён при проверке: дубликаты, неизвестные зависимости или цикл
+var ErrInvalidPlan = errors.New("invalid plan")
+
+// ValidateTasks проверяет, что задачи плана образуют DAG, и возвращает их в топологическом порядке
+func ValidateTasks(tasks []*model.Task) ([]string, error) {
+	deps := make(map[string][]string, len(tasks))
+	for _, task := range tasks {
+		if task == nil || task.ID == "" {
+			return nil, fmt.Errorf("%w: task ID is required", ErrInvalidPlan)
+		}
+		if _, exists := deps[task.ID]; exists {
+			return nil, fmt.Errorf("%w: duplicate task %s", ErrInvalidPlan, task.ID)
+		}
+		deps[task.ID] = make([]string, 0, len(task.DependsOn))
+		for _, dep := range task.DependsOn {
+			deps[task.ID] = append(deps[task.ID], dep.ID)
+		}
+	}
+
+	for id, taskDeps := range deps {
+		for _, dep := range taskDeps {
+			if _, exists := deps[dep]; !exists {
+				return nil, fmt.Errorf("%w: dependency %s of task %s not found in plan", ErrInvalidPlan, dep, id)
+			}
+		}
+	}
+
+	if cycle := findCycle(deps); cycle != nil {
+		return nil, fmt.Errorf("%w: cycle detected: %s", ErrInvalidPlan, strings.Join(cycle, " -> "))
+	}
+	return ExecutionOrder(deps)
+}
+
+// findCycle ищет цикл обходом в глубину и возвращает его путь (первый узел повторяется в конце)
+func findCycle(deps map[string][]string) []string {
+	const (
+		unvisited = iota
+		inStack
+		done
+	)
+
+	ids := make([]string, 0, len(deps))
+	for id := range deps {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	state := make(map[string]int, len(deps))
+	var stack []string
+
+	var visit func(id string) []string
+	visit = func(id string) []string {
+		state[id] = inStack
+		stack = append(stack, id)
+		for _, dep := range deps[id] {
+			switch state[dep] {
+			case inStack:
+				for i, s := range stack {
+					if s == dep {
+						return append(append([]string{}, stack[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = done
+		return nil
+	}
+
+	for _, id := range ids {
+		if state[id] == unvisited {
+			if cycle := visit(id); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// ExecutionOrder returns task IDs in topological order (dependencies first, Kahn's algorithm).
+func ExecutionOrder(dependencies map[string][]string) ([]string, error) {
+	inDegree := make(map[string]int, len(dependencies))
+	dependents := make(map[string][]string, len(dependencies))
+	for node, deps := range dependencies {
+		inDegree[node] = len(deps)
+		for _, dep := range deps {
+			dependents[dep] = append(dependents[dep], node)
+		}
+	}
+
+	var queue, order []string
+	for node, degree := range inDegree {
+		if degree == 0 {
+			queue = append(queue, node)
+		}
+	}
+
+	for len(queue) > 0 {
+		// Сортируем для детерминированного порядка
+		sort.Strings(queue)
+		u := queue[0]
+		queue = queue[1:]
+		order = append(order, u)
+
+		for _, v := range dependents[u] {
+			inDegree[v]--
+			if inDegree[v] == 0 {
+				queue = append(queue, v)
+			}
+		}
+	}
+
+	if len(order) != len(inDegree) {
+		return nil, fmt.Errorf("%w: cycle detected in dependency graph", ErrInvalidPlan)
+	}
+	return order, nil
+}
@@ -0,0 +1,118 @@
+package registry
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/laplasd/inforo/model"
+)
+
+// testTask создаёт задачу с жёсткими зависимостями
+func testTask(id string, deps ...string) *model.Task {
+	task := &model.Task{ID: id}
+	for _, dep := range deps {
+		task.DependsOn = append(task.DependsOn, model.Depends{Type: model.Strict, ID: dep})
+	}
+	return task
+}
+
+func TestValidateTasks(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks []*model.Task
+		order []string
+		err   string
+	}{
+		{
+			name:  "chain",
+			tasks: []*model.Task{testTask("c", "b"), testTask("b", "a"), testTask("a")},
+			order: []string{"a", "b", "c"},
+		},
+		{
+			name:  "diamond",
+			tasks: []*model.Task{testTask("d", "b", "c"), testTask("b", "a"), testTask("c", "a"), testTask("a")},
+			order: []string{"a", "b", "c", "d"},
+		},
+		{
+			name:  "independent",
+			tasks: []*model.Task{testTask("b"), testTask("a")},
+			order: []string{"a", "b"},
+		},
+		{
+			name:  "empty ID",
+			tasks: []*model.Task{testTask("")},
+			err:   "task ID is required",
+		},
+		{
+			name:  "nil task",
+			tasks: []*model.Task{nil},
+			err:   "task ID is required",
+		},
+		{
+			name:  "duplicate",
+			tasks: []*model.Task{testTask("a"), testTask("a")},
+			err:   "duplicate task a",
+		},
+		{
+			name:  "unknown dependency",
+			tasks: []*model.Task{testTask("a", "x")},
+			err:   "dependency x of task a not found in plan",
+		},
+		{
+			name:  "self dependency",
+			tasks: []*model.Task{testTask("a", "a")},
+			err:   "cycle detected: a -> a",
+		},
+		{
+			name:  "cycle",
+			tasks: []*model.Task{testTask("a", "c"), testTask("b", "a"), testTask("c", "b"), testTask("d")},
+			err:   "cycle detected: a -> c -> b -> a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := ValidateTasks(tt.tasks)
+			if tt.err != "" {
+				if err == nil || !errors.Is(err, ErrInvalidPlan) || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ValidateTasks error = %v, want ErrInvalidPlan with %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateTasks: %v", err)
+			}
+			if !reflect.DeepEqual(order, tt.order) {
+				t.Errorf("order = %v, want %v", order, tt.order)
+			}
+		})
+	}
+}
+
+func TestFindCycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		deps  map[string][]string
+		cycle []string
+	}{
+		{name: "empty", deps: map[string][]string{}},
+		{name: "acyclic", deps: map[string][]string{"a": {}, "b": {"a"}, "c": {"a", "b"}}},
+		{name: "self", deps: map[string][]string{"a": {"a"}}, cycle: []string{"a", "a"}},
+		{name: "pair", deps: map[string][]string{"a": {"b"}, "b": {"a"}}, cycle: []string{"a", "b", "a"}},
+		{
+			name:  "cycle behind acyclic prefix",
+			deps:  map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"d"}, "d": {"b"}},
+			cycle: []string{"b", "c", "d", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cycle := findCycle(tt.deps); !reflect.DeepEqual(cycle, tt.cycle) {
+				t.Errorf("findCycle = %v, want %v", cycle, tt.cycle)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/laplasd/inforo/model"
+)
+
+const (
+	/*
+		RUS: Дефолтное число одновременно выполняемых задач плана
+		ENG: Default number of plan tasks executed concurrently
+	*/
+	DefaultMaxWorkers = 4
+)
+
+// TaskRun — выполнение одной задачи в рамках выполнения плана
+type TaskRun struct {
+	Status     model.Status `json:"status"`
+	StartedAt  *time.Time   `json:"started_at,omitempty"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+	Error      string       `json:"error,omitempty"`
+	// Результат отката задачи: success, failed или skipped
+	RollBack      string `json:"rollback,omitempty"`
+	RollBackError string `json:"rollback_error,omitempty"`
+	// Задача упала после применения к компонентам (на PostChecks)
+	applied bool
+}
+
+// PlanExecution — последнее выполнение плана с результатами по задачам
+type PlanExecution struct {
+	ID            string              `json:"id"`
+	FailurePolicy FailurePolicy       `json:"failure_policy"`
+	StartedAt     time.Time           `json:"started_at"`
+	FinishedAt    *time.Time          `json:"finished_at,omitempty"`
+	Tasks         map[string]*TaskRun `json:"tasks"`
+}
+
+// Execution возвращает копию последнего выполнения плана
+func (pr *PlanRegistry) Execution(planID string) (*PlanExecution, bool) {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+
+	ex, ok := pr.executions[planID]
+	if !ok {
+		return nil, false
+	}
+
+	copied := &PlanExecution{
+		ID:            ex.ID,
+		FailurePolicy: ex.FailurePolicy,
+		StartedAt:     ex.StartedAt,
+		FinishedAt:    ex.FinishedAt,
+		Tasks:         make(map[string]*TaskRun, len(ex.Tasks)),
+	}
+	for id, run := range ex.Tasks {
+		r := *run
+		copied.Tasks[id] = &r
+	}
+	return copied, true
+}
+
+// planTasks собирает задачи всех графов плана, их зависимости и корень графа каждой задачи
+func planTasks(plan *model.Plan) (tasks map[string]*model.Task, deps map[string][]string, graphOf map[string]string) {
+	tasks = make(map[string]*model.Task)
+	deps = make(map[string][]string)
+	graphOf = make(map[string]string)
+	for _, graph := range plan.TaskGraphs {
+		for id, task := range graph.Tasks {
+			tasks[id] = task
+			deps[id] = graph.Dependencies[id]
+			graphOf[id] = graph.RootTaskID
+		}
+	}
+	return tasks, deps, graphOf
+}
+
+// execute выполняет задачи плана как единый DAG: независимые ветки идут параллельно,
+// не более maxWorkers задач одновременно. Каждая задача выполняется один раз,
+// даже если от неё зависят несколько задач. Задачи, зависящие от упавших, пропускаются
+// (кроме advisory-зависимостей). При политике abort/rollback-completed после первого
+// падения новые задачи не запускаются, как и после остановки или паузы плана.
+// Повторный запуск продолжает план: задачи, выполненные прошлым запуском и не откаченные, не перезапускаются.
+func (pr *PlanRegistry) execute(plan *model.Plan, executionID string, policy FailurePolicy) error {
+	tasks, deps, graphOf := planTasks(plan)
+	if _, err := ExecutionOrder(deps); err != nil {
+		return err
+	}
+
+	dependents := make(map[string][]string, len(deps))
+	remaining := make(map[string]int, len(deps))
+	for id, taskDeps := range deps {
+		remaining[id] = len(taskDeps)
+		for _, dep := range taskDeps {
+			dependents[dep] = append(dependents[dep], id)
+		}
+	}
+
+	ex := &PlanExecution{
+		ID:            executionID,
+		FailurePolicy: policy,
+		StartedAt:     time.Now(),
+		Tasks:         make(map[string]*TaskRun, len(tasks)),
+	}
+	completed := make(map[string]bool)
+	pr.mu.Lock()
+	prev := pr.executions[plan.ID]
+	for id := range tasks {
+		if run := prevRun(prev, id); run != nil && completedRun(run) {
+			copied := *run
+			ex.Tasks[id] = &copied
+			completed[id] = true
+			continue
+		}
+		ex.Tasks[id] = &TaskRun{Status: model.StatusPending}
+	}
+	pr.executions[plan.ID] = ex
+	pr.mu.Unlock()
+
+	type result struct {
+		id  string
+		err error
+	}
+	results := make(chan result)
+
+	var ready []string
+	for id, n := range remaining {
+		if n == 0 {
+			ready = append(ready, id)
+		}
+	}
+
+	// Упавшие (не advisory) зависимости каждой задачи
+	failedDeps := make(map[string][]string)
+	var settle func(id string, ok bool)
+	settle = func(id string, ok bool) {
+		for _, next := range dependents[id] {
+			if !ok && !isAdvisory(tasks[next], id) {
+				failedDeps[next] = append(failedDeps[next], id)
+			}
+			remaining[next]--
+			if remaining[next] != 0 {
+				continue
+			}
+			if len(failedDeps[next]) != 0 {
+				pr.skipTask(plan, ex, tasks[next],
+					fmt.Sprintf("Skipped: dependency %s failed", strings.Join(failedDeps[next], ", ")))
+				settle(next, false)
+				continue
+			}
+			ready = append(ready, next)
+		}
+	}
+
+	var planErr error
+	aborted := false
+	running := 0
+	for len(ready) > 0 || running > 0 {
+		sort.Strings(ready)
+		for len(ready) > 0 && running < pr.maxWorkers && !aborted && !pr.isHalted(plan) {
+			id := ready[0]
+			ready = ready[1:]
+			if completed[id] {
+				pr.mu.Lock()
+				pr.AddEvent(plan.EventHistory, fmt.Sprintf("Task %s already completed", id))
+				pr.mu.Unlock()
+				settle(id, true)
+				continue
+			}
+			running++
+			pr.startTask(plan, ex, id)
+			go func(id string) {
+				results <- result{id: id, err: pr.runTask(id, executionID)}
+			}(id)
+		}
+		if running == 0 {
+			// План остановлен, поставлен на паузу или прерван: оставшиеся задачи не запускаем
+			break
+		}
+
+		r := <-results
+		running--
+		pr.finishTask(plan, ex, r.id, r.err)
+		if r.err != nil {
+			planErr = errors.Join(planErr, fmt.Errorf("task %s failed: %w", r.id, r.err))
+			if policy != FailureContinue && !aborted {
+				aborted = true
+				pr.mu.Lock()
+				pr.AddEvent(plan.EventHistory, fmt.Sprintf("Plan aborted: task %s failed", r.id))
+				pr.mu.Unlock()
+			}
+		} else {
+			pr.saveCheckpoint(plan.ID, &model.RollbackCheckpoint{
+				GraphID:   graphOf[r.id],
+				TaskID:    r.id,
+				Timestamp: time.Now(),
+			})
+		}
+		settle(r.id, r.err == nil)
+	}
+
+	// Незапущенные задачи прерванного или остановленного плана помечаются пропущенными;
+	// у плана на паузе они остаются pending до следующего запуска
+	reason := ""
+	switch {
+	case aborted:
+		reason = "Skipped: plan aborted"
+	case pr.isStopped(plan):
+		reason = "Skipped: plan stopped"
+	}
+	if reason != "" {
+		ids := make([]string, 0, len(tasks))
+		for id := range tasks {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			if pr.runStatus(ex, id) == model.StatusPending {
+				pr.skipTask(plan, ex, tasks[id], reason)
+			}
+		}
+	}
+
+	pr.mu.Lock()
+	finished := time.Now()
+	ex.FinishedAt = &finished
+	pr.mu.Unlock()
+
+	return planErr
+}
+
+func (pr *PlanRegistry) startTask(plan *model.Plan, ex *PlanExecution, taskID string) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	now := time.Now()
+	run := ex.Tasks[taskID]
+	run.Status = model.StatusRunning
+	run.StartedAt = &now
+	pr.AddEvent(plan.EventHistory, fmt.Sprintf("Task %s started", taskID))
+}
+
+func (pr *PlanRegistry) finishTask(plan *model.Plan, ex *PlanExecution, taskID string, err error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	now := time.Now()
+	run := ex.Tasks[taskID]
+	run.FinishedAt = &now
+	if err != nil {
+		run.Status = model.StatusFailed
+		run.Error = err.Error()
+		run.applied = errors.Is(err, ErrPostCheckFailed)
+		pr.AddEvent(plan.EventHistory, fmt.Sprintf("Task %s failed: %v", taskID, err))
+		return
+	}
+	run.Status = model.StatusSuccess
+	pr.AddEvent(plan.EventHistory, fmt.Sprintf("Task %s completed", taskID))
+}
+
+func (pr *PlanRegistry) skipTask(plan *model.Plan, ex *PlanExecution, task *model.Task, reason string) {
+	task.MU.Lock()
+	task.StatusHistory = pr.Tasks.NextStatus(model.StatusSkipped, task.StatusHistory)
+	task.MU.Unlock()
+	pr.Tasks.AddEvent(task.EventHistory, reason)
+
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	run := ex.Tasks[task.ID]
+	run.Status = model.StatusSkipped
+	run.Error = reason
+	pr.AddEvent(plan.EventHistory, fmt.Sprintf("Task %s %s", task.ID, strings.ToLower(reason)))
+}
+
+func (pr *PlanRegistry) runStatus(ex *PlanExecution, taskID string) model.Status {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+
+	return ex.Tasks[taskID].Status
+}
+
+func (pr *PlanRegistry) isStopped(plan *model.Plan) bool {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+
+	return plan.StatusHistory.LastStatus == model.StatusStopped
+}
+
+// isHalted — план остановлен или поставлен на паузу: новые задачи не запускаются
+func (pr *PlanRegistry) isHalted(plan *model.Plan) bool {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+
+	switch plan.StatusHistory.LastStatus {
+	case model.StatusStopped, model.StatusPaused:
+		return true
+	}
+	return false
+}
+
+func prevRun(prev *PlanExecution, taskID string) *TaskRun {
+	if prev == nil {
+		return nil
+	}
+	return prev.Tasks[taskID]
+}
+
+// completedRun — задача выполнена и её результат на компонентах остался: откат её не снял
+func completedRun(run *TaskRun) bool {
+	if run.Status != model.StatusSuccess {
+		return false
+	}
+	return run.RollBack == "" || run.RollBack == string(model.StatusSkipped)
+}
+
+// isAdvisory — задача допускает неуспех зависимости depID
+func isAdvisory(task *model.Task, depID string) bool {
+	for _, dep := range task.DependsOn {
+		if dep.ID == depID {
+			return dep.Type == model.Advisory
+		}
+	}
+	return false
+}
@@ -0,0 +1,323 @@
+package registry
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/laplasd/inforo"
+	"github.com/laplasd/inforo/api"
+	"github.com/laplasd/inforo/model"
+)
+
+// fakeRunner выполняет задачи плана без контроллеров
+type fakeRunner struct {
+	mu sync.Mutex
+	// Задачи, которые должны упасть
+	fail map[string]bool
+	// Задачи, откат которых должен упасть
+	failRollback map[string]bool
+	// Вызывается при запуске задачи, до её завершения
+	onRun func(taskID string)
+	// Пауза выполнения, чтобы задачи успели пересечься
+	delay time.Duration
+
+	ran        []string
+	rolledBack []string
+	running    int
+	maxRunning int
+}
+
+func (r *fakeRunner) Execute(taskID string, executionID string) error {
+	r.mu.Lock()
+	r.ran = append(r.ran, taskID)
+	r.running++
+	if r.running > r.maxRunning {
+		r.maxRunning = r.running
+	}
+	r.mu.Unlock()
+
+	if r.onRun != nil {
+		r.onRun(taskID)
+	}
+	time.Sleep(r.delay)
+
+	r.mu.Lock()
+	r.running--
+	r.mu.Unlock()
+	if r.fail[taskID] {
+		return errors.New("boom")
+	}
+	return nil
+}
+
+func (r *fakeRunner) RollBack(taskID string, executionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rolledBack = append(r.rolledBack, taskID)
+	if r.failRollback[taskID] {
+		return errors.New("rollback boom")
+	}
+	return nil
+}
+
+// testTaskRegistry отдаёт задачи плана без регистрации: inforo требует у задач компоненты
+type testTaskRegistry struct {
+	api.TaskRegistry
+	tasks map[string]*model.Task
+}
+
+func (r *testTaskRegistry) Get(id string) (*model.Task, error) {
+	task, ok := r.tasks[id]
+	if !ok {
+		return nil, errors.New("task not found")
+	}
+	return task, nil
+}
+
+// newTestPlan регистрирует план из задач в обход реестра задач: исполнитель работает с графами плана
+func newTestPlan(t *testing.T, runner *fakeRunner, maxWorkers int, tasks ...*model.Task) (*PlanRegistry, *model.Plan) {
+	t.Helper()
+	status := &inforo.StatusManager{}
+	taskRegistry, err := inforo.NewTaskRegistry(inforo.TaskRegistryOptions{
+		Logger:        inforo.NewNullLogger(),
+		StatusManager: status,
+		EventManager:  &inforo.Events{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := make(map[string]*model.Task, len(tasks))
+	pr, err := NewPlanRegistry(PlanRegistryOptions{
+		Tasks:      &testTaskRegistry{TaskRegistry: taskRegistry, tasks: byID},
+		Runner:     runner,
+		MaxWorkers: maxWorkers,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, task := range tasks {
+		task.StatusHistory = status.NewStatus(model.StatusPending)
+		task.EventHistory = &model.EventHistory{}
+		byID[task.ID] = task
+	}
+	graphs, err := BuildTaskGraphs(byID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := &model.Plan{ID: "plan", TaskGraphs: graphs}
+	if err := pr.Restore(plan); err != nil {
+		t.Fatal(err)
+	}
+	return pr, plan
+}
+
+// runStatuses возвращает статусы задач последнего выполнения плана
+func runStatuses(t *testing.T, pr *PlanRegistry, planID string) map[string]model.Status {
+	t.Helper()
+	ex, ok := pr.Execution(planID)
+	if !ok {
+		t.Fatal("plan has no execution")
+	}
+	statuses := make(map[string]model.Status, len(ex.Tasks))
+	for id, run := range ex.Tasks {
+		statuses[id] = run.Status
+	}
+	return statuses
+}
+
+func TestExecuteRespectsMaxWorkers(t *testing.T) {
+	tests := []struct {
+		maxWorkers int
+		tasks      int
+	}{
+		{maxWorkers: 1, tasks: 4},
+		{maxWorkers: 2, tasks: 6},
+		{maxWorkers: 8, tasks: 3},
+	}
+
+	for _, tt := range tests {
+		runner := &fakeRunner{delay: 20 * time.Millisecond}
+		var tasks []*model.Task
+		for i := 0; i < tt.tasks; i++ {
+			tasks = append(tasks, testTask(string(rune('a'+i))))
+		}
+		pr, plan := newTestPlan(t, runner, tt.maxWorkers, tasks...)
+
+		if _, err := pr.Run(plan.ID, "exec"); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		want := min(tt.maxWorkers, tt.tasks)
+		if runner.maxRunning != want {
+			t.Errorf("maxWorkers %d, %d tasks: %d tasks ran concurrently, want %d", tt.maxWorkers, tt.tasks, runner.maxRunning, want)
+		}
+		if len(runner.ran) != tt.tasks {
+			t.Errorf("ran %v, want every task once", runner.ran)
+		}
+	}
+}
+
+func TestExecuteContinuePolicySkipsDependents(t *testing.T) {
+	advisory := testTask("advisory")
+	advisory.DependsOn = []model.Depends{{Type: model.Advisory, ID: "a"}}
+	runner := &fakeRunner{fail: map[string]bool{"a": true}}
+	pr, plan := newTestPlan(t, runner, 1,
+		testTask("a"), testTask("b", "a"), testTask("c", "b"), advisory, testTask("independent"))
+
+	if _, err := pr.RunWithPolicy(plan.ID, "exec", FailureContinue); err == nil {
+		t.Fatal("Run succeeded, want the failure of task a")
+	}
+
+	want := map[string]model.Status{
+		"a":           model.StatusFailed,
+		"b":           model.StatusSkipped,
+		"c":           model.StatusSkipped,
+		"advisory":    model.StatusSuccess,
+		"independent": model.StatusSuccess,
+	}
+	for id, status := range runStatuses(t, pr, plan.ID) {
+		if status != want[id] {
+			t.Errorf("task %s: status %s, want %s", id, status, want[id])
+		}
+	}
+	for _, graph := range plan.TaskGraphs {
+		if task, ok := graph.Tasks["c"]; ok && task.StatusHistory.LastStatus != model.StatusSkipped {
+			t.Errorf("task c status history: %s, want skipped", task.StatusHistory.LastStatus)
+		}
+	}
+}
+
+func TestExecuteAbortPolicySkipsPendingTasks(t *testing.T) {
+	runner := &fakeRunner{fail: map[string]bool{"a": true}}
+	pr, plan := newTestPlan(t, runner, 1, testTask("a"), testTask("b"), testTask("c"))
+
+	if _, err := pr.RunWithPolicy(plan.ID, "exec", FailureAbort); err == nil {
+		t.Fatal("Run succeeded, want the failure of task a")
+	}
+	statuses := runStatuses(t, pr, plan.ID)
+	if statuses["b"] != model.StatusSkipped || statuses["c"] != model.StatusSkipped {
+		t.Errorf("statuses = %v, want b and c skipped after the abort", statuses)
+	}
+	if status, _ := pr.Status(plan.ID); status != model.StatusFailed {
+		t.Errorf("plan status = %s, want failed", status)
+	}
+}
+
+func TestExecuteStoppedPlanSkipsPendingTasks(t *testing.T) {
+	runner := &fakeRunner{}
+	pr, plan := newTestPlan(t, runner, 1, testTask("a"), testTask("b"), testTask("c", "a"))
+	runner.onRun = func(taskID string) {
+		if taskID == "a" {
+			if err := pr.Stop(plan.ID); err != nil {
+				t.Errorf("Stop: %v", err)
+			}
+		}
+	}
+
+	if _, err := pr.Run(plan.ID, "exec"); err == nil || err.Error() != "plan stopped" {
+		t.Fatalf("Run error = %v, want plan stopped", err)
+	}
+	want := map[string]model.Status{"a": model.StatusSuccess, "b": model.StatusSkipped, "c": model.StatusSkipped}
+	for id, status := range runStatuses(t, pr, plan.ID) {
+		if status != want[id] {
+			t.Errorf("task %s: status %s, want %s", id, status, want[id])
+		}
+	}
+	if len(runner.ran) != 1 {
+		t.Errorf("ran %v after the plan was stopped", runner.ran)
+	}
+}
+
+func TestExecutePausedPlanResumes(t *testing.T) {
+	runner := &fakeRunner{}
+	pr, plan := newTestPlan(t, runner, 1, testTask("a"), testTask("b", "a"))
+	runner.onRun = func(taskID string) {
+		if taskID == "a" {
+			if err := pr.Pause(plan.ID); err != nil {
+				t.Errorf("Pause: %v", err)
+			}
+		}
+	}
+
+	if _, err := pr.Run(plan.ID, "exec"); err == nil || err.Error() != "plan paused" {
+		t.Fatalf("Run error = %v, want plan paused", err)
+	}
+	if status, _ := pr.Status(plan.ID); status != model.StatusPaused {
+		t.Errorf("plan status = %s, want paused", status)
+	}
+	if statuses := runStatuses(t, pr, plan.ID); statuses["b"] != model.StatusPending {
+		t.Errorf("statuses = %v, want b pending while the plan is paused", statuses)
+	}
+
+	runner.onRun = nil
+	if _, err := pr.Run(plan.ID, "resume"); err != nil {
+		t.Fatalf("resumed Run: %v", err)
+	}
+	if status, _ := pr.Status(plan.ID); status != model.StatusSuccess {
+		t.Errorf("plan status = %s, want success", status)
+	}
+	if !reflect.DeepEqual(runner.ran, []string{"a", "b"}) {
+		t.Errorf("ran %v, want each task once across both runs", runner.ran)
+	}
+}
+
+func TestExecuteRerunSkipsCompletedTasks(t *testing.T) {
+	runner := &fakeRunner{fail: map[string]bool{"b": true}}
+	pr, plan := newTestPlan(t, runner, 1, testTask("a"), testTask("b", "a"))
+
+	if _, err := pr.RunWithPolicy(plan.ID, "exec", FailureAbort); err == nil {
+		t.Fatal("Run succeeded, want the failure of task b")
+	}
+	runner.fail = nil
+	if _, err := pr.Run(plan.ID, "rerun"); err != nil {
+		t.Fatalf("rerun: %v", err)
+	}
+	if !reflect.DeepEqual(runner.ran, []string{"a", "b", "b"}) {
+		t.Errorf("ran %v, want a once and b retried", runner.ran)
+	}
+	if statuses := runStatuses(t, pr, plan.ID); statuses["a"] != model.StatusSuccess || statuses["b"] != model.StatusSuccess {
+		t.Errorf("statuses = %v, want both tasks succeeded", statuses)
+	}
+}
+
+func TestRollbackOutcomeInPlanStatus(t *testing.T) {
+	withRollback := func(task *model.Task) *model.Task {
+		task.RollBack = &model.Rollback{Type: "task"}
+		return task
+	}
+	tests := []struct {
+		name         string
+		fail         map[string]bool
+		failRollback map[string]bool
+		rolledBack   []string
+		status       model.Status
+	}{
+		{name: "nothing completed", fail: map[string]bool{"a": true}, status: model.StatusRollBack},
+		{name: "completed tasks reverted", fail: map[string]bool{"c": true}, rolledBack: []string{"b", "a"}, status: model.StatusRollBack},
+		{name: "rollback failed", fail: map[string]bool{"c": true}, failRollback: map[string]bool{"b": true}, rolledBack: []string{"b", "a"}, status: model.StatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{fail: tt.fail, failRollback: tt.failRollback}
+			tasks := []*model.Task{withRollback(testTask("a")), withRollback(testTask("b", "a")), withRollback(testTask("c", "b"))}
+			pr, plan := newTestPlan(t, runner, 1, tasks...)
+
+			if _, err := pr.RunWithPolicy(plan.ID, "exec", FailureRollback); err == nil {
+				t.Fatal("Run succeeded, want the task failure")
+			}
+			if status, _ := pr.Status(plan.ID); status != tt.status {
+				t.Errorf("plan status = %s, want %s", status, tt.status)
+			}
+			if !reflect.DeepEqual(runner.rolledBack, tt.rolledBack) {
+				t.Errorf("rolled back %v, want %v", runner.rolledBack, tt.rolledBack)
+			}
+			if pending := RollbackPending(plan); pending != (tt.status == model.StatusFailed) {
+				t.Errorf("RollbackPending = %v after the rollback", pending)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package registry
+
+import (
+	"github.com/laplasd/inforo/model"
+)
+
+// CopyStatusHistory копирует историю статусов под её блокировкой
+func CopyStatusHistory(history *model.StatusHistory) *model.StatusHistory {
+	if history == nil {
+		return nil
+	}
+	history.MU.RLock()
+	defer history.MU.RUnlock()
+
+	return &model.StatusHistory{
+		LastStatus: history.LastStatus,
+		Timestamp:  history.Timestamp,
+		// Записи Previous не меняются после создания, достаточно скопировать срез
+		Previous: append(history.Previous[:0:0], history.Previous...),
+	}
+}
+
+// CopyEventHistory копирует историю событий под её блокировкой
+func CopyEventHistory(history *model.EventHistory) *model.EventHistory {
+	if history == nil {
+		return nil
+	}
+	history.MU.Lock()
+	defer history.MU.Unlock()
+
+	return &model.EventHistory{Event: append([]model.Event(nil), history.Event...)}
+}
@@ -0,0 +1,267 @@
+package registry
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+const (
+	/*
+		RUS: Сколько последних строк лога задачи хранится для повторной отправки подписчикам
+		ENG: Number of most recent task log lines kept for replay to late subscribers
+	*/
+	DefaultLogReplay = 1000
+	// Строка длиннее режется на части
+	maxLogLine = 16 * 1024
+	// Подписчик, отставший на столько событий, отключается
+	logSubscriberBuffer = 256
+)
+
+// Потоки вывода в LogEvent.Stream
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// LogEvent — строка вывода команды задачи. Seq растёт в пределах задачи и между её выполнениями.
+type LogEvent struct {
+	Seq         int64     `json:"seq"`
+	ExecutionID string    `json:"execution_id"`
+	ComponentID string    `json:"component_id"`
+	Stream      string    `json:"stream"`
+	Line        string    `json:"line"`
+	Time        time.Time `json:"time"`
+}
+
+// LogEnd — чем закончилась подписка на лог
+type LogEnd struct {
+	ExecutionID string `json:"execution_id,omitempty"`
+	Error       string `json:"error,omitempty"`
+	// Подписчик не успевал читать события и был отключён
+	Lagged bool `json:"lagged,omitempty"`
+}
+
+// taskLog — лог последнего выполнения задачи
+type taskLog struct {
+	seq         int64
+	executionID string
+	running     bool
+	lines       []LogEvent
+	end         LogEnd
+	subscribers map[*LogSubscription]struct{}
+}
+
+// LogSubscription — подписка на лог задачи: Replay уже сохранённые строки, Events новые.
+// Events закрывается по окончании выполнения; результат в End.
+type LogSubscription struct {
+	Replay []LogEvent
+	Events <-chan LogEvent
+
+	events  chan LogEvent
+	taskID  string
+	started bool
+	end     LogEnd
+	logs    *OutputRegistry
+}
+
+// End возвращает итог подписки после закрытия Events
+func (s *LogSubscription) End() LogEnd {
+	s.logs.logsMu.Lock()
+	defer s.logs.logsMu.Unlock()
+
+	return s.end
+}
+
+// Close отменяет подписку
+func (s *LogSubscription) Close() {
+	s.logs.logsMu.Lock()
+	defer s.logs.logsMu.Unlock()
+
+	if log, ok := s.logs.logs[s.taskID]; ok {
+		if _, subscribed := log.subscribers[s]; subscribed {
+			delete(log.subscribers, s)
+			close(s.events)
+		}
+	}
+}
+
+func (or *OutputRegistry) taskLog(taskID string) *taskLog {
+	log, ok := or.logs[taskID]
+	if !ok {
+		log = &taskLog{subscribers: make(map[*LogSubscription]struct{})}
+		or.logs[taskID] = log
+	}
+	return log
+}
+
+// BeginLog отмечает начало выполнения задачи; строки предыдущего выполнения отбрасываются
+func (or *OutputRegistry) BeginLog(taskID string, executionID string) {
+	or.logsMu.Lock()
+	defer or.logsMu.Unlock()
+
+	log := or.taskLog(taskID)
+	if log.executionID != executionID {
+		log.lines = nil
+	}
+	log.executionID = executionID
+	log.running = true
+	log.end = LogEnd{}
+	for sub := range log.subscribers {
+		sub.started = true
+	}
+}
+
+// EndLog завершает подписки, заставшие выполнение
+func (or *OutputRegistry) EndLog(taskID string, executionID string, err error) {
+	or.logsMu.Lock()
+	defer or.logsMu.Unlock()
+
+	log := or.taskLog(taskID)
+	log.running = false
+	log.end = LogEnd{ExecutionID: executionID}
+	if err != nil {
+		log.end.Error = err.Error()
+	}
+	for sub := range log.subscribers {
+		if sub.started {
+			sub.end = log.end
+			delete(log.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Logs возвращает сохранённые строки последнего выполнения задачи
+func (or *OutputRegistry) Logs(taskID string) []LogEvent {
+	or.logsMu.Lock()
+	defer or.logsMu.Unlock()
+
+	log, ok := or.logs[taskID]
+	if !ok {
+		return []LogEvent{}
+	}
+	return append([]LogEvent{}, log.lines...)
+}
+
+// Subscribe подписывается на лог задачи. Если задача сейчас не выполняется, подписка с wait
+// ждёт следующего выполнения, а без wait сразу завершается после Replay.
+func (or *OutputRegistry) Subscribe(taskID string, wait bool) *LogSubscription {
+	or.logsMu.Lock()
+	defer or.logsMu.Unlock()
+
+	log := or.taskLog(taskID)
+	sub := &LogSubscription{
+		Replay:  append([]LogEvent{}, log.lines...),
+		events:  make(chan LogEvent, logSubscriberBuffer),
+		taskID:  taskID,
+		started: log.running,
+		logs:    or,
+	}
+	sub.Events = sub.events
+
+	if !log.running && !wait {
+		sub.end = log.end
+		close(sub.events)
+		return sub
+	}
+	log.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (or *OutputRegistry) deleteLog(taskID string) {
+	or.logsMu.Lock()
+	defer or.logsMu.Unlock()
+
+	log, ok := or.logs[taskID]
+	if !ok {
+		return
+	}
+	for sub := range log.subscribers {
+		close(sub.events)
+	}
+	delete(or.logs, taskID)
+}
+
+func (or *OutputRegistry) publish(taskID string, event LogEvent) {
+	or.logsMu.Lock()
+	defer or.logsMu.Unlock()
+
+	log := or.taskLog(taskID)
+	log.seq++
+	event.Seq = log.seq
+	log.lines = append(log.lines, event)
+	if len(log.lines) > or.replay {
+		log.lines = append([]LogEvent(nil), log.lines[len(log.lines)-or.replay:]...)
+	}
+
+	for sub := range log.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			sub.end = LogEnd{ExecutionID: event.ExecutionID, Lagged: true}
+			delete(log.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// LogWriter — io.Writer, публикующий вывод команды построчно; Flush отправляет незавершённую строку
+type LogWriter struct {
+	mu      sync.Mutex
+	logs    *OutputRegistry
+	taskID  string
+	event   LogEvent
+	partial []byte
+}
+
+// NewLogWriter создаёт писатель лога задачи для одного потока вывода компонента
+func (or *OutputRegistry) NewLogWriter(taskID, executionID, componentID, stream string) *LogWriter {
+	return &LogWriter{
+		logs:   or,
+		taskID: taskID,
+		event: LogEvent{
+			ExecutionID: executionID,
+			ComponentID: componentID,
+			Stream:      stream,
+		},
+	}
+}
+
+func (w *LogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.publish(w.partial[:i])
+		w.partial = w.partial[i+1:]
+	}
+	for len(w.partial) >= maxLogLine {
+		w.publish(w.partial[:maxLogLine])
+		w.partial = w.partial[maxLogLine:]
+	}
+	w.partial = append([]byte(nil), w.partial...)
+	return len(p), nil
+}
+
+func (w *LogWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.partial) != 0 {
+		w.publish(w.partial)
+		w.partial = nil
+	}
+}
+
+func (w *LogWriter) publish(line []byte) {
+	event := w.event
+	event.Line = string(bytes.TrimSuffix(line, []byte("\r")))
+	event.Time = time.Now()
+	w.logs.publish(w.taskID, event)
+}
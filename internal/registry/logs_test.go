@@ -0,0 +1,198 @@
+package registry
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeLines пишет строки в поток stdout выполнения
+func writeLines(or *OutputRegistry, taskID, executionID string, lines ...string) {
+	w := or.NewLogWriter(taskID, executionID, "c1", StreamStdout)
+	for _, line := range lines {
+		w.Write([]byte(line + "\n"))
+	}
+}
+
+// collect читает события подписки до закрытия Events
+func collect(t *testing.T, sub *LogSubscription) []LogEvent {
+	t.Helper()
+	var events []LogEvent
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		case <-timeout:
+			t.Fatalf("subscription was not closed, got %d events", len(events))
+		}
+	}
+}
+
+func logLines(events []LogEvent) string {
+	lines := make([]string, len(events))
+	for i, event := range events {
+		lines[i] = event.Line
+	}
+	return strings.Join(lines, ",")
+}
+
+func TestLogReplayToLateSubscriber(t *testing.T) {
+	or := NewOutputRegistry(OutputRegistryOptions{Replay: 2})
+	or.BeginLog("t1", "e1")
+	writeLines(or, "t1", "e1", "one", "two", "three")
+
+	sub := or.Subscribe("t1", false)
+	defer sub.Close()
+	if got := logLines(sub.Replay); got != "two,three" {
+		t.Errorf("Replay = %s, want the last 2 lines", got)
+	}
+	if sub.Replay[0].Seq != 2 || sub.Replay[1].Seq != 3 {
+		t.Errorf("replayed seq = %d,%d, want 2,3", sub.Replay[0].Seq, sub.Replay[1].Seq)
+	}
+
+	writeLines(or, "t1", "e1", "four")
+	or.EndLog("t1", "e1", errors.New("exit status 1"))
+	if got := logLines(collect(t, sub)); got != "four" {
+		t.Errorf("Events = %s, want four", got)
+	}
+	if end := sub.End(); end.ExecutionID != "e1" || end.Error != "exit status 1" || end.Lagged {
+		t.Errorf("End = %+v", end)
+	}
+}
+
+func TestLogSubscribeIdle(t *testing.T) {
+	or := NewOutputRegistry(OutputRegistryOptions{})
+	or.BeginLog("t1", "e1")
+	writeLines(or, "t1", "e1", "done")
+	or.EndLog("t1", "e1", nil)
+
+	// Без wait подписка на завершённое выполнение сразу закрыта
+	sub := or.Subscribe("t1", false)
+	if events := collect(t, sub); len(events) != 0 || logLines(sub.Replay) != "done" {
+		t.Errorf("events = %v, replay = %v", events, sub.Replay)
+	}
+	if end := sub.End(); end.ExecutionID != "e1" {
+		t.Errorf("End = %+v, want the previous execution", end)
+	}
+	sub.Close()
+
+	// С wait подписка дожидается следующего выполнения; строки прошлого выполнения отбрасываются
+	sub = or.Subscribe("t1", true)
+	or.BeginLog("t1", "e2")
+	writeLines(or, "t1", "e2", "next")
+	if got := or.Logs("t1"); logLines(got) != "next" || got[0].Seq != 2 {
+		t.Errorf("Logs = %+v, want only the new execution with seq continued", got)
+	}
+	or.EndLog("t1", "e2", nil)
+	if got := logLines(collect(t, sub)); got != "next" {
+		t.Errorf("Events = %s, want next", got)
+	}
+	if end := sub.End(); end.ExecutionID != "e2" || end.Error != "" {
+		t.Errorf("End = %+v", end)
+	}
+}
+
+func TestLogLaggingSubscriberDropped(t *testing.T) {
+	or := NewOutputRegistry(OutputRegistryOptions{})
+	or.BeginLog("t1", "e1")
+	slow := or.Subscribe("t1", false)
+	fast := or.Subscribe("t1", false)
+
+	w := or.NewLogWriter("t1", "e1", "c1", StreamStdout)
+	for i := 0; i < logSubscriberBuffer+1; i++ {
+		w.Write([]byte("line\n"))
+		if i < logSubscriberBuffer {
+			<-fast.Events
+		}
+	}
+	<-fast.Events
+
+	if n := len(collect(t, slow)); n != logSubscriberBuffer {
+		t.Errorf("slow subscriber got %d events, want %d", n, logSubscriberBuffer)
+	}
+	if end := slow.End(); !end.Lagged || end.ExecutionID != "e1" {
+		t.Errorf("End = %+v, want lagged", end)
+	}
+
+	// Успевающий подписчик остаётся подписан
+	w.Write([]byte("more\n"))
+	select {
+	case event, ok := <-fast.Events:
+		if !ok || event.Line != "more" {
+			t.Errorf("fast subscriber got %+v, %v", event, ok)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("fast subscriber got no event")
+	}
+	fast.Close()
+}
+
+func TestLogSubscriptionClosedOnce(t *testing.T) {
+	or := NewOutputRegistry(OutputRegistryOptions{})
+
+	// Close после EndLog и повторный Close
+	or.BeginLog("t1", "e1")
+	sub := or.Subscribe("t1", false)
+	or.EndLog("t1", "e1", nil)
+	sub.Close()
+	sub.Close()
+
+	// Close после удаления задачи, в том числе когда у задачи уже новое выполнение
+	or.BeginLog("t1", "e2")
+	sub = or.Subscribe("t1", false)
+	or.Delete("t1")
+	if events := collect(t, sub); len(events) != 0 {
+		t.Errorf("events after Delete = %v", events)
+	}
+	or.BeginLog("t1", "e3")
+	sub.Close()
+	or.EndLog("t1", "e3", nil)
+
+	// EndLog после Close
+	or.BeginLog("t1", "e4")
+	sub = or.Subscribe("t1", false)
+	sub.Close()
+	or.EndLog("t1", "e4", nil)
+	if _, ok := <-sub.Events; ok {
+		t.Error("Events still open after Close")
+	}
+}
+
+func TestLogWriterSplitsLines(t *testing.T) {
+	or := NewOutputRegistry(OutputRegistryOptions{})
+	or.BeginLog("t1", "e1")
+	w := or.NewLogWriter("t1", "e1", "c1", StreamStderr)
+
+	w.Write([]byte("par"))
+	w.Write([]byte("tial\r\nwhole\n\nlast"))
+	if got := logLines(or.Logs("t1")); got != "partial,whole," {
+		t.Errorf("lines before Flush = %q", got)
+	}
+	w.Flush()
+	w.Flush()
+	if got := logLines(or.Logs("t1")); got != "partial,whole,,last" {
+		t.Errorf("lines after Flush = %q", got)
+	}
+
+	long := strings.Repeat("x", maxLogLine*2+10)
+	w.Write([]byte(long))
+	lines := or.Logs("t1")[4:]
+	if len(lines) != 2 || len(lines[0].Line) != maxLogLine || len(lines[1].Line) != maxLogLine {
+		t.Fatalf("long line split into %d parts before Flush, want 2 full parts", len(lines))
+	}
+	w.Flush()
+	lines = or.Logs("t1")[4:]
+	if len(lines) != 3 || len(lines[2].Line) != 10 {
+		t.Fatalf("long line split into %d parts, want the rest flushed", len(lines))
+	}
+	for _, event := range lines {
+		if event.Stream != StreamStderr || event.ComponentID != "c1" || event.ExecutionID != "e1" {
+			t.Errorf("event = %+v", event)
+		}
+	}
+}
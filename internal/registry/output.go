@@ -0,0 +1,209 @@
+package registry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/laplasd/inforo"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	/*
+		RUS: Сколько байт stdout и stderr хранится для одного выполнения (сохраняется конец вывода)
+		ENG: Bytes of stdout and stderr kept per run (the tail of the output is kept)
+	*/
+	DefaultOutputLimit = 64 * 1024
+	/*
+		RUS: Сколько последних выполнений хранится для одной задачи
+		ENG: Number of most recent runs kept per task
+	*/
+	DefaultOutputHistory = 20
+)
+
+// Действие, результат которого записан в TaskOutput
+const (
+	OutputRun      = "run"
+	OutputRollBack = "rollback"
+)
+
+// TaskOutput — результат выполнения задачи на одном компоненте
+type TaskOutput struct {
+	ExecutionID string    `json:"execution_id"`
+	Action      string    `json:"action"`
+	ComponentID string    `json:"component_id"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	DurationMS  int64     `json:"duration_ms"`
+	// Код завершения команды; нет, если команда не запускалась или контроллер его не сообщает
+	ExitCode        *int   `json:"exit_code,omitempty"`
+	Stdout          string `json:"stdout"`
+	Stderr          string `json:"stderr"`
+	StdoutTruncated bool   `json:"stdout_truncated,omitempty"`
+	StderrTruncated bool   `json:"stderr_truncated,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+// Finish заполняет время окончания, вывод и ошибку выполнения
+func (o *TaskOutput) Finish(stdout, stderr *OutputBuffer, err error) {
+	o.FinishedAt = time.Now()
+	o.DurationMS = o.FinishedAt.Sub(o.StartedAt).Milliseconds()
+	o.Stdout, o.StdoutTruncated = stdout.Output()
+	o.Stderr, o.StderrTruncated = stderr.Output()
+	if err != nil {
+		o.Error = err.Error()
+	}
+}
+
+/*
+	RUS: Хранилище результатов выполнения задач. Для каждой задачи хранится не больше History
+	последних результатов, вывод каждого потока ограничен Limit байтами.
+	ENG: Task run results store, capped at History runs per task and Limit bytes per stream.
+*/
+
+type OutputRegistry struct {
+	outputs map[string][]*TaskOutput
+	mu      *sync.RWMutex
+	limit   int
+	history int
+	logger  *logrus.Logger
+
+	// Живые логи выполнений (см. logs.go)
+	logs   map[string]*taskLog
+	logsMu sync.Mutex
+	replay int
+}
+
+type OutputRegistryOptions struct {
+	Logger  *logrus.Logger
+	Limit   int
+	History int
+	// Сколько строк лога хранится для повторной отправки подписчикам
+	Replay int
+}
+
+func NewOutputRegistry(opts OutputRegistryOptions) *OutputRegistry {
+	if opts.Logger == nil {
+		opts.Logger = inforo.NewNullLogger()
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultOutputLimit
+	}
+	if opts.History <= 0 {
+		opts.History = DefaultOutputHistory
+	}
+	if opts.Replay <= 0 {
+		opts.Replay = DefaultLogReplay
+	}
+	return &OutputRegistry{
+		outputs: make(map[string][]*TaskOutput),
+		mu:      &sync.RWMutex{},
+		limit:   opts.Limit,
+		history: opts.History,
+		logger:  opts.Logger,
+		logs:    make(map[string]*taskLog),
+		replay:  opts.Replay,
+	}
+}
+
+// NewBuffer создаёт буфер вывода с лимитом реестра
+func (or *OutputRegistry) NewBuffer() *OutputBuffer {
+	return NewOutputBuffer(or.limit)
+}
+
+// Add сохраняет результат, вытесняя самые старые сверх History
+func (or *OutputRegistry) Add(taskID string, output *TaskOutput) {
+	or.mu.Lock()
+	defer or.mu.Unlock()
+
+	outputs := append(or.outputs[taskID], output)
+	if len(outputs) > or.history {
+		outputs = append([]*TaskOutput(nil), outputs[len(outputs)-or.history:]...)
+	}
+	or.outputs[taskID] = outputs
+	or.logger.Debugf("Stored %s output of task %s on component %s", output.Action, taskID, output.ComponentID)
+}
+
+// List возвращает результаты задачи от старых к новым
+func (or *OutputRegistry) List(taskID string) []*TaskOutput {
+	or.mu.RLock()
+	defer or.mu.RUnlock()
+
+	return append([]*TaskOutput(nil), or.outputs[taskID]...)
+}
+
+// Delete удаляет результаты и поток вывода задачи; подписки на поток закрываются
+func (or *OutputRegistry) Delete(taskID string) {
+	or.mu.Lock()
+	delete(or.outputs, taskID)
+	or.mu.Unlock()
+
+	or.deleteLog(taskID)
+}
+
+// TaskOutputs и LoadTaskOutputs используются снапшотами состояния (store.Snapshotter)
+func (or *OutputRegistry) TaskOutputs() map[string][]*TaskOutput {
+	or.mu.RLock()
+	defer or.mu.RUnlock()
+
+	result := make(map[string][]*TaskOutput, len(or.outputs))
+	for taskID, outputs := range or.outputs {
+		result[taskID] = append([]*TaskOutput(nil), outputs...)
+	}
+	return result
+}
+
+func (or *OutputRegistry) LoadTaskOutputs(outputs map[string][]*TaskOutput) {
+	or.mu.Lock()
+	defer or.mu.Unlock()
+
+	for taskID, list := range outputs {
+		if len(list) > or.history {
+			list = list[len(list)-or.history:]
+		}
+		or.outputs[taskID] = list
+	}
+}
+
+// OutputBuffer — io.Writer, хранящий не больше limit последних байт
+type OutputBuffer struct {
+	mu        sync.Mutex
+	data      []byte
+	limit     int
+	truncated bool
+}
+
+func NewOutputBuffer(limit int) *OutputBuffer {
+	if limit <= 0 {
+		limit = DefaultOutputLimit
+	}
+	return &OutputBuffer{limit: limit}
+}
+
+func (b *OutputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(p)
+	if overflow := len(b.data) + len(p) - b.limit; overflow > 0 {
+		b.truncated = true
+		if overflow >= len(b.data) {
+			// Сохранённый вывод вытесняется целиком, от p остаётся конец
+			p = p[overflow-len(b.data):]
+			b.data = b.data[:0]
+		} else {
+			b.data = append(b.data[:0], b.data[overflow:]...)
+		}
+	}
+	b.data = append(b.data, p...)
+	return n, nil
+}
+
+// Output возвращает сохранённый вывод и признак того, что начало было отброшено
+func (b *OutputBuffer) Output() (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return string(b.data), b.truncated
+}
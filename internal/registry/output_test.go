@@ -0,0 +1,111 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputBufferKeepsTail(t *testing.T) {
+	tests := []struct {
+		name          string
+		writes        []string
+		want          string
+		wantTruncated bool
+	}{
+		{name: "fits", writes: []string{"abc", "de"}, want: "abcde"},
+		{name: "exact limit", writes: []string{"abcdefgh"}, want: "abcdefgh"},
+		{name: "overflow across writes", writes: []string{"abcdef", "ghij"}, want: "cdefghij", wantTruncated: true},
+		{name: "single write over limit", writes: []string{"ab", "0123456789"}, want: "23456789", wantTruncated: true},
+		{name: "many small writes", writes: strings.Split("0123456789ab", ""), want: "456789ab", wantTruncated: true},
+	}
+	for _, tt := range tests {
+		b := NewOutputBuffer(8)
+		for _, w := range tt.writes {
+			n, err := b.Write([]byte(w))
+			if err != nil || n != len(w) {
+				t.Fatalf("%s: Write(%q) = %d, %v", tt.name, w, n, err)
+			}
+		}
+		got, truncated := b.Output()
+		if got != tt.want || truncated != tt.wantTruncated {
+			t.Errorf("%s: Output() = %q, %v, want %q, %v", tt.name, got, truncated, tt.want, tt.wantTruncated)
+		}
+	}
+}
+
+func TestTaskOutputFinish(t *testing.T) {
+	stdout, stderr := NewOutputBuffer(4), NewOutputBuffer(4)
+	stdout.Write([]byte("hello"))
+	stderr.Write([]byte("oops"))
+
+	output := &TaskOutput{StartedAt: time.Now().Add(-time.Second)}
+	output.Finish(stdout, stderr, errors.New("exit status 1"))
+	if output.Stdout != "ello" || !output.StdoutTruncated {
+		t.Errorf("stdout = %q, truncated %v", output.Stdout, output.StdoutTruncated)
+	}
+	if output.Stderr != "oops" || output.StderrTruncated {
+		t.Errorf("stderr = %q, truncated %v", output.Stderr, output.StderrTruncated)
+	}
+	if output.Error != "exit status 1" || output.DurationMS < 1000 {
+		t.Errorf("error = %q, duration %dms", output.Error, output.DurationMS)
+	}
+}
+
+func newOutputs(n int) []*TaskOutput {
+	outputs := make([]*TaskOutput, n)
+	for i := range outputs {
+		outputs[i] = &TaskOutput{ExecutionID: fmt.Sprint("e", i+1), Action: OutputRun}
+	}
+	return outputs
+}
+
+func executionIDs(outputs []*TaskOutput) string {
+	ids := make([]string, len(outputs))
+	for i, output := range outputs {
+		ids[i] = output.ExecutionID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestOutputRegistryEvictsOldest(t *testing.T) {
+	or := NewOutputRegistry(OutputRegistryOptions{History: 3})
+	for _, output := range newOutputs(5) {
+		or.Add("t1", output)
+	}
+	if got := executionIDs(or.List("t1")); got != "e3,e4,e5" {
+		t.Errorf("List = %s, want the 3 most recent", got)
+	}
+
+	// List отдаёт копию: изменения не попадают в реестр
+	list := or.List("t1")
+	list[0] = &TaskOutput{ExecutionID: "changed"}
+	if got := executionIDs(or.List("t1")); got != "e3,e4,e5" {
+		t.Errorf("List after changing a copy = %s", got)
+	}
+
+	or.Delete("t1")
+	if got := or.List("t1"); len(got) != 0 {
+		t.Errorf("List after Delete = %d outputs", len(got))
+	}
+}
+
+func TestOutputRegistryLoadTaskOutputs(t *testing.T) {
+	or := NewOutputRegistry(OutputRegistryOptions{History: 2})
+	or.LoadTaskOutputs(map[string][]*TaskOutput{"t1": newOutputs(3), "t2": newOutputs(1)})
+
+	saved := or.TaskOutputs()
+	if got := executionIDs(saved["t1"]); got != "e2,e3" {
+		t.Errorf("t1 outputs = %s, want history cap applied on load", got)
+	}
+	if got := executionIDs(saved["t2"]); got != "e1" {
+		t.Errorf("t2 outputs = %s", got)
+	}
+
+	or.Add("t2", &TaskOutput{ExecutionID: "e9"})
+	if got := executionIDs(saved["t2"]); got != "e1" {
+		t.Errorf("TaskOutputs snapshot changed after Add: %s", got)
+	}
+}
@@ -0,0 +1,467 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/laplasd/inforo"
+	"github.com/laplasd/inforo/api"
+	"github.com/laplasd/inforo/model"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+	RUS: Реестр планов laplasd. Повторяет поведение inforo.PlanRegistry,
+	но позволяет восстановить план с исходным ID (см. Restore).
+	ENG: laplasd plan registry. Mirrors inforo.PlanRegistry behaviour,
+	but allows a plan to be restored with its original ID (see Restore).
+*/
+
+// ErrPostCheckFailed — задача применена к компонентам, но не прошла PostChecks.
+// TaskRunner оборачивает им ошибку, чтобы такая задача тоже попала под откат плана.
+var ErrPostCheckFailed = errors.New("post-check failed")
+
+// TaskRunner выполняет и откатывает одну задачу плана (handlers.TaskHandler)
+type TaskRunner interface {
+	Execute(taskID string, executionID string) error
+	RollBack(taskID string, executionID string) error
+}
+
+type PlanRegistry struct {
+	plans      map[string]*model.Plan
+	Components api.ComponentRegistry
+	Tasks      api.TaskRegistry
+	runner     TaskRunner
+	maxWorkers int
+	policy     FailurePolicy
+	// Последнее выполнение каждого плана
+	executions map[string]*PlanExecution
+	*inforo.StatusManager
+	*inforo.Events
+	mu     *sync.RWMutex
+	logger *logrus.Logger
+}
+
+type PlanRegistryOptions struct {
+	Logger     *logrus.Logger
+	Components api.ComponentRegistry
+	Tasks      api.TaskRegistry
+	// Если не задан, задачи выполняются через Tasks.Fork
+	Runner TaskRunner
+	// Максимум одновременно выполняемых задач одного плана
+	MaxWorkers int
+	// Политика при падении задачи, если не задана при запуске плана
+	FailurePolicy FailurePolicy
+}
+
+func NewPlanRegistry(opts PlanRegistryOptions) (*PlanRegistry, error) {
+	if opts.Tasks == nil {
+		return nil, errors.New("plan registry requires a task registry")
+	}
+	if opts.Logger == nil {
+		opts.Logger = inforo.NewNullLogger()
+	}
+	if opts.MaxWorkers <= 0 {
+		opts.MaxWorkers = DefaultMaxWorkers
+	}
+	policy, err := ParseFailurePolicy(string(opts.FailurePolicy))
+	if err != nil {
+		return nil, err
+	}
+	if policy == "" {
+		policy = DefaultFailurePolicy
+	}
+	pr := &PlanRegistry{
+		mu:            &sync.RWMutex{},
+		logger:        opts.Logger,
+		StatusManager: &inforo.StatusManager{},
+		Events:        &inforo.Events{},
+		plans:         make(map[string]*model.Plan),
+		Components:    opts.Components,
+		Tasks:         opts.Tasks,
+		runner:        opts.Runner,
+		maxWorkers:    opts.MaxWorkers,
+		policy:        policy,
+		executions:    make(map[string]*PlanExecution),
+	}
+	return pr, nil
+}
+
+func (pr *PlanRegistry) Register(tasks []*model.Task) (*model.Plan, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	if len(tasks) == 0 {
+		return nil, errors.New("plan must contain at least one task")
+	}
+
+	// DAG проверяется до регистрации задач, чтобы не оставлять в реестре задачи отклонённого плана
+	order, err := ValidateTasks(tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*model.Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+
+	// Реестр задач требует, чтобы зависимости были зарегистрированы раньше
+	taskMap := make(map[string]*model.Task, len(tasks))
+	for _, id := range order {
+		registeredTask, err := pr.Tasks.Register(byID[id])
+		if err != nil {
+			for registered := range taskMap {
+				pr.Tasks.Delete(registered)
+			}
+			return nil, fmt.Errorf("failed to register task %s: %w", id, err)
+		}
+		taskMap[id] = registeredTask
+	}
+
+	graphs, err := BuildTaskGraphs(taskMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build task graphs: %w", err)
+	}
+
+	plan := &model.Plan{
+		ID:            uuid.New().String(),
+		TaskGraphs:    graphs,
+		StatusHistory: pr.NewStatus(model.StatusCreated),
+		EventHistory:  &model.EventHistory{},
+		RollbackStack: make([]*model.RollbackCheckpoint, 0),
+	}
+	pr.AddEvent(plan.EventHistory, "Created plan!")
+
+	pr.plans[plan.ID] = plan
+	pr.logger.Infof("Created new plan %s with %d independent task graphs", plan.ID, len(graphs))
+
+	return plan, nil
+}
+
+// Restore puts an already built plan back into the registry, keeping its ID and histories.
+func (pr *PlanRegistry) Restore(plan *model.Plan) error {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	if plan.ID == "" {
+		return errors.New("plan ID is empty")
+	}
+	if _, exists := pr.plans[plan.ID]; exists {
+		return fmt.Errorf("plan %s already exists", plan.ID)
+	}
+	if plan.StatusHistory == nil {
+		plan.StatusHistory = pr.NewStatus(model.StatusCreated)
+	}
+	if plan.EventHistory == nil {
+		plan.EventHistory = &model.EventHistory{}
+	}
+	if plan.RollbackStack == nil {
+		plan.RollbackStack = make([]*model.RollbackCheckpoint, 0)
+	}
+
+	pr.plans[plan.ID] = plan
+	return nil
+}
+
+// BuildTaskGraphs splits tasks into independent dependency graphs.
+// Dependencies outside of the given tasks are rejected.
+func BuildTaskGraphs(tasks map[string]*model.Task) ([]*model.TaskGraph, error) {
+	deps := make(map[string][]string, len(tasks))
+	revDeps := make(map[string][]string, len(tasks))
+	for id := range tasks {
+		deps[id] = []string{}
+		revDeps[id] = []string{}
+	}
+	for id, task := range tasks {
+		for _, dep := range task.DependsOn {
+			if _, exists := tasks[dep.ID]; !exists {
+				return nil, fmt.Errorf("%w: dependency %s not found", ErrInvalidPlan, dep.ID)
+			}
+			deps[id] = append(deps[id], dep.ID)
+			revDeps[dep.ID] = append(revDeps[dep.ID], id)
+		}
+	}
+
+	ids := make([]string, 0, len(tasks))
+	for id := range tasks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	visited := make(map[string]bool)
+	var graphs []*model.TaskGraph
+	for _, root := range ids {
+		if visited[root] || len(deps[root]) != 0 {
+			continue
+		}
+
+		graph := &model.TaskGraph{
+			RootTaskID:   root,
+			Tasks:        make(map[string]*model.Task),
+			Dependencies: make(map[string][]string),
+			Dependents:   make(map[string][]string),
+		}
+
+		// Обход в ширину по зависимостям в обе стороны
+		queue := []string{root}
+		visited[root] = true
+		for len(queue) > 0 {
+			currentID := queue[0]
+			queue = queue[1:]
+
+			graph.Tasks[currentID] = tasks[currentID]
+			graph.Dependencies[currentID] = deps[currentID]
+			graph.Dependents[currentID] = revDeps[currentID]
+
+			for _, next := range append(append([]string{}, revDeps[currentID]...), deps[currentID]...) {
+				if !visited[next] {
+					visited[next] = true
+					queue = append(queue, next)
+				}
+			}
+		}
+		graphs = append(graphs, graph)
+	}
+
+	// Задачи без корня возможны только при циклической зависимости
+	if len(visited) != len(tasks) {
+		return nil, fmt.Errorf("%w: cycle detected in dependency graph", ErrInvalidPlan)
+	}
+	return graphs, nil
+}
+
+func (pr *PlanRegistry) Get(id string) (*model.Plan, error) {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+
+	plan, ok := pr.plans[id]
+	if !ok {
+		return nil, errors.New("plan not found")
+	}
+	return plan, nil
+}
+
+// Update меняет статус плана; из updated читается лишь StatusHistory, блокировка копии не используется.
+// План передаётся по значению, потому что так объявлен Update в api.PlanRegistry.
+//
+//nolint:govet // copylocks: сигнатура задана интерфейсом inforo, копия плана не блокируется
+func (pr *PlanRegistry) Update(id string, updated model.Plan) error {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	plan, exists := pr.plans[id]
+	if !exists {
+		return errors.New("plan not found")
+	}
+
+	if updated.StatusHistory != nil && updated.StatusHistory.LastStatus != "" {
+		plan.StatusHistory = pr.NextStatus(updated.StatusHistory.LastStatus, plan.StatusHistory)
+	}
+	return nil
+}
+
+func (pr *PlanRegistry) Delete(id string) error {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	if _, exists := pr.plans[id]; !exists {
+		return errors.New("plan not found")
+	}
+	delete(pr.plans, id)
+	delete(pr.executions, id)
+	return nil
+}
+
+func (pr *PlanRegistry) List() ([]*model.Plan, error) {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+
+	plans := make([]*model.Plan, 0, len(pr.plans))
+	for _, p := range pr.plans {
+		plans = append(plans, p)
+	}
+	return plans, nil
+}
+
+// Snapshot возвращает копии всех планов, снятые под блокировкой реестра:
+// выполнение плана меняет его статус, события и стек отката под той же блокировкой
+func (pr *PlanRegistry) Snapshot() []*model.Plan {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+
+	plans := make([]*model.Plan, 0, len(pr.plans))
+	for _, p := range pr.plans {
+		copied := &model.Plan{
+			ID:            p.ID,
+			RollbackStack: append([]*model.RollbackCheckpoint(nil), p.RollbackStack...),
+			StatusHistory: CopyStatusHistory(p.StatusHistory),
+			EventHistory:  CopyEventHistory(p.EventHistory),
+		}
+		for _, g := range p.TaskGraphs {
+			graph := &model.TaskGraph{
+				RootTaskID:   g.RootTaskID,
+				Tasks:        make(map[string]*model.Task, len(g.Tasks)),
+				Dependencies: g.Dependencies,
+				Dependents:   g.Dependents,
+			}
+			for id, task := range g.Tasks {
+				graph.Tasks[id] = task
+			}
+			copied.TaskGraphs = append(copied.TaskGraphs, graph)
+		}
+		plans = append(plans, copied)
+	}
+	return plans
+}
+
+func (pr *PlanRegistry) RunAsync(planID string, executionID string) (string, error) {
+	if executionID == "" {
+		executionID = uuid.New().String()
+	}
+	pr.logger.Debugf("[%s] PlanRegistry.RunAsync() - planID: %s", executionID, planID)
+
+	if _, err := pr.Get(planID); err != nil {
+		return "", err
+	}
+
+	go pr.Run(planID, executionID)
+	return executionID, nil
+}
+
+func (pr *PlanRegistry) Run(planID string, executionID string) (string, error) {
+	return pr.RunWithPolicy(planID, executionID, "")
+}
+
+// RunWithPolicy выполняет план с указанной политикой падения (пустая — политика реестра)
+func (pr *PlanRegistry) RunWithPolicy(planID string, executionID string, policy FailurePolicy) (string, error) {
+	if executionID == "" {
+		executionID = uuid.New().String()
+	}
+	policy, err := ParseFailurePolicy(string(policy))
+	if err != nil {
+		return "", err
+	}
+	if policy == "" {
+		policy = pr.policy
+	}
+	pr.logger.Infof("[%s] PlanRegistry.Run() - planID: %s, failure policy: %s", executionID, planID, policy)
+
+	pr.mu.Lock()
+	plan, exists := pr.plans[planID]
+	if !exists {
+		pr.mu.Unlock()
+		return "", errors.New("plan not found")
+	}
+	if ex, ok := pr.executions[planID]; ok && ex.FinishedAt == nil {
+		// План на паузе или остановленный план дожидается своих задач
+		pr.mu.Unlock()
+		return "", errors.New("plan is still running")
+	}
+	switch plan.StatusHistory.LastStatus {
+	case model.StatusRunning:
+		pr.mu.Unlock()
+		return "", errors.New("plan is already running")
+	case model.StatusSuccess:
+		pr.mu.Unlock()
+		return "", errors.New("cannot run already completed plan")
+	}
+	plan.StatusHistory = pr.NextStatus(model.StatusRunning, plan.StatusHistory)
+	pr.mu.Unlock()
+
+	executionErr := pr.execute(plan, executionID, policy)
+	if executionErr != nil && policy == FailureRollback && !pr.isStopped(plan) {
+		return executionID, pr.rollback(plan, executionID, executionErr)
+	}
+
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	if plan.StatusHistory.LastStatus == model.StatusStopped {
+		pr.AddEvent(plan.EventHistory, "Plan stopped")
+		pr.logger.Warnf("[%s] Plan %s stopped", executionID, planID)
+		return executionID, errors.New("plan stopped")
+	}
+	if plan.StatusHistory.LastStatus == model.StatusPaused && executionErr == nil {
+		pr.AddEvent(plan.EventHistory, "Plan paused, run it again to resume")
+		pr.logger.Infof("[%s] Plan %s paused", executionID, planID)
+		return executionID, errors.New("plan paused")
+	}
+	if executionErr != nil {
+		plan.StatusHistory = pr.NextStatus(model.StatusFailed, plan.StatusHistory)
+		pr.AddEvent(plan.EventHistory, executionErr.Error())
+		pr.logger.Errorf("[%s] Plan execution failed: %v", executionID, executionErr)
+		return executionID, executionErr
+	}
+	plan.StatusHistory = pr.NextStatus(model.StatusSuccess, plan.StatusHistory)
+	pr.AddEvent(plan.EventHistory, "Plan completed!")
+	pr.logger.Infof("[%s] Plan executed successfully", executionID)
+	return executionID, nil
+}
+
+func (pr *PlanRegistry) runTask(taskID, executionID string) error {
+	if pr.runner != nil {
+		return pr.runner.Execute(taskID, executionID)
+	}
+	_, err := pr.Tasks.Fork(taskID, executionID)
+	return err
+}
+
+func (pr *PlanRegistry) rollbackTask(taskID, executionID string) error {
+	if pr.runner != nil {
+		return pr.runner.RollBack(taskID, executionID)
+	}
+	_, err := pr.Tasks.RollBack(taskID, executionID)
+	return err
+}
+
+func (pr *PlanRegistry) saveCheckpoint(planID string, checkpoint *model.RollbackCheckpoint) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	if plan, ok := pr.plans[planID]; ok {
+		plan.RollbackStack = append(plan.RollbackStack, checkpoint)
+	}
+}
+
+func (pr *PlanRegistry) Status(planID string) (model.Status, error) {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+
+	plan, exists := pr.plans[planID]
+	if !exists {
+		return "", errors.New("plan not found")
+	}
+	return plan.StatusHistory.LastStatus, nil
+}
+
+func (pr *PlanRegistry) Stop(planID string) error {
+	return pr.transition(planID, model.StatusStopped, model.StatusRunning, model.StatusPaused)
+}
+
+func (pr *PlanRegistry) Pause(planID string) error {
+	return pr.transition(planID, model.StatusPaused, model.StatusRunning)
+}
+
+func (pr *PlanRegistry) transition(planID string, to model.Status, from ...model.Status) error {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	plan, exists := pr.plans[planID]
+	if !exists {
+		return errors.New("plan not found")
+	}
+
+	current := plan.StatusHistory.LastStatus
+	for _, status := range from {
+		if current == status {
+			plan.StatusHistory = pr.NextStatus(to, plan.StatusHistory)
+			pr.logger.Infof("Plan '%s' %s", planID, to)
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot move plan from status '%s' to '%s'", current, to)
+}
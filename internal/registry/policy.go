@@ -0,0 +1,27 @@
+package registry
+
+import "fmt"
+
+// FailurePolicy определяет поведение плана при падении задачи
+type FailurePolicy string
+
+const (
+	// FailureAbort — новые задачи не запускаются, уже запущенные дорабатывают
+	FailureAbort FailurePolicy = "abort"
+	// FailureContinue — независимые ветки выполняются дальше, зависимые задачи пропускаются
+	FailureContinue FailurePolicy = "continue"
+	// FailureRollback — как abort, затем успешные задачи откатываются в обратном топологическом порядке
+	FailureRollback FailurePolicy = "rollback-completed"
+
+	DefaultFailurePolicy = FailureAbort
+)
+
+// ParseFailurePolicy проверяет имя политики. Пустая строка означает политику по умолчанию реестра.
+func ParseFailurePolicy(name string) (FailurePolicy, error) {
+	switch policy := FailurePolicy(name); policy {
+	case "", FailureAbort, FailureContinue, FailureRollback:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown failure policy %q (expected %s, %s or %s)",
+		name, FailureAbort, FailureContinue, FailureRollback)
+}
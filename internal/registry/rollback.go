@@ -0,0 +1,133 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/laplasd/inforo/model"
+)
+
+// rollback откатывает выполненные задачи упавшего плана в обратном топологическом порядке:
+// задача откатывается раньше своих зависимостей. Задача, упавшая на PostChecks, уже применена
+// к компонентам и тоже откатывается. Статус плана: failed -> rollback, где он и остаётся
+// после удачного отката; если хотя бы один откат не удался — снова failed.
+func (pr *PlanRegistry) rollback(plan *model.Plan, executionID string, cause error) error {
+	pr.mu.Lock()
+	plan.StatusHistory = pr.NextStatus(model.StatusFailed, plan.StatusHistory)
+	pr.AddEvent(plan.EventHistory, cause.Error())
+	plan.StatusHistory = pr.NextStatus(model.StatusRollBack, plan.StatusHistory)
+	pr.AddEvent(plan.EventHistory, "Rolling back completed tasks...")
+	ex := pr.executions[plan.ID]
+	pr.mu.Unlock()
+	pr.logger.Warnf("[%s] Plan %s failed, rolling back: %v", executionID, plan.ID, cause)
+
+	_, deps, _ := planTasks(plan)
+	order, err := ExecutionOrder(deps)
+	if err != nil {
+		return pr.finishRollback(plan, executionID, cause, err, 0)
+	}
+
+	var rollbackErr error
+	rolledBack := 0
+	for i := len(order) - 1; i >= 0; i-- {
+		id := order[i]
+		if !pr.needsRollback(ex, id) {
+			continue
+		}
+
+		task, err := pr.Tasks.Get(id)
+		if err != nil {
+			rollbackErr = errors.Join(rollbackErr, fmt.Errorf("task %s: %w", id, err))
+			pr.markRollback(plan, ex, id, err)
+			continue
+		}
+		if task.RollBack == nil {
+			pr.skipRollback(plan, ex, id)
+			continue
+		}
+
+		err = pr.rollbackTask(id, executionID)
+		if err != nil {
+			rollbackErr = errors.Join(rollbackErr, fmt.Errorf("rollback of task %s failed: %w", id, err))
+		} else {
+			rolledBack++
+		}
+		pr.markRollback(plan, ex, id, err)
+	}
+
+	return pr.finishRollback(plan, executionID, cause, rollbackErr, rolledBack)
+}
+
+func (pr *PlanRegistry) finishRollback(plan *model.Plan, executionID string, cause, rollbackErr error, rolledBack int) error {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	if rollbackErr == nil {
+		pr.AddEvent(plan.EventHistory, fmt.Sprintf("Plan rolled back: %d tasks reverted", rolledBack))
+		pr.logger.Infof("[%s] Plan %s rolled back, %d tasks reverted", executionID, plan.ID, rolledBack)
+		return cause
+	}
+	plan.StatusHistory = pr.NextStatus(model.StatusFailed, plan.StatusHistory)
+	pr.AddEvent(plan.EventHistory, fmt.Sprintf("Rollback failed: %v", rollbackErr))
+	pr.logger.Errorf("[%s] Rollback of plan %s failed: %v", executionID, plan.ID, rollbackErr)
+	return errors.Join(cause, rollbackErr)
+}
+
+// RollbackPending — в стеке отката плана остались задачи с откатом: откат плана в статусе
+// rollback был прерван. Удачно откаченные задачи из стека убираются, остаются только задачи без отката.
+func RollbackPending(plan *model.Plan) bool {
+	tasks, _, _ := planTasks(plan)
+	for _, checkpoint := range plan.RollbackStack {
+		if task, ok := tasks[checkpoint.TaskID]; ok && task.RollBack != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// needsRollback — задача успела изменить компоненты в этом выполнении
+func (pr *PlanRegistry) needsRollback(ex *PlanExecution, taskID string) bool {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+
+	run, ok := ex.Tasks[taskID]
+	if !ok {
+		return false
+	}
+	return run.Status == model.StatusSuccess || (run.Status == model.StatusFailed && run.applied)
+}
+
+func (pr *PlanRegistry) markRollback(plan *model.Plan, ex *PlanExecution, taskID string, err error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	run := ex.Tasks[taskID]
+	if err != nil {
+		run.RollBack = string(model.StatusFailed)
+		run.RollBackError = err.Error()
+		pr.AddEvent(plan.EventHistory, fmt.Sprintf("Task %s rollback failed: %v", taskID, err))
+		return
+	}
+	run.RollBack = string(model.StatusSuccess)
+	pr.removeCheckpoint(plan, taskID)
+	pr.AddEvent(plan.EventHistory, fmt.Sprintf("Task %s rolled back", taskID))
+}
+
+func (pr *PlanRegistry) skipRollback(plan *model.Plan, ex *PlanExecution, taskID string) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	ex.Tasks[taskID].RollBack = string(model.StatusSkipped)
+	pr.AddEvent(plan.EventHistory, fmt.Sprintf("Task %s has no rollback, skipped", taskID))
+}
+
+// removeCheckpoint убирает откаченную задачу из стека контрольных точек плана
+func (pr *PlanRegistry) removeCheckpoint(plan *model.Plan, taskID string) {
+	kept := plan.RollbackStack[:0]
+	for _, checkpoint := range plan.RollbackStack {
+		if checkpoint.TaskID != taskID {
+			kept = append(kept, checkpoint)
+		}
+	}
+	plan.RollbackStack = kept
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+/*
+	================
+	bolt-store
+	================
+*/
+
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database %s: %w", path, err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Save пересоздаёт бакеты всех типов в одной транзакции
+func (b *BoltStore) Save(records []Record) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		buckets := make(map[Kind]*bolt.Bucket, len(Kinds))
+		for _, kind := range Kinds {
+			if err := tx.DeleteBucket([]byte(kind)); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return err
+			}
+			bucket, err := tx.CreateBucket([]byte(kind))
+			if err != nil {
+				return err
+			}
+			buckets[kind] = bucket
+		}
+
+		for _, rec := range records {
+			bucket, ok := buckets[rec.Kind]
+			if !ok {
+				return fmt.Errorf("unknown record kind %q", rec.Kind)
+			}
+			if err := bucket.Put([]byte(rec.ID), rec.Data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *BoltStore) Load() ([]Record, error) {
+	var records []Record
+	err := b.db.View(func(tx *bolt.Tx) error {
+		for _, kind := range Kinds {
+			bucket := tx.Bucket([]byte(kind))
+			if bucket == nil {
+				continue
+			}
+			err := bucket.ForEach(func(k, v []byte) error {
+				// Данные bolt валидны только внутри транзакции
+				records = append(records, Record{
+					Kind: kind,
+					ID:   string(k),
+					Data: append([]byte(nil), v...),
+				})
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return records, err
+}
+
+func (b *BoltStore) Close() error {
+	return b.db.Close()
+}
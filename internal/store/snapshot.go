@@ -0,0 +1,626 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"laplasd/internal/registry"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/laplasd/inforo"
+	"github.com/laplasd/inforo/model"
+
+	"github.com/sirupsen/logrus"
+)
+
+// PlanRestorer — реестр планов, умеющий принять план с уже известным ID
+type PlanRestorer interface {
+	Restore(plan *model.Plan) error
+}
+
+// HostKeySource — ключи SSH-хостов, которым доверились при первом подключении (controllers.HostKeyStore)
+type HostKeySource interface {
+	HostKeys() map[string]string
+	LoadHostKeys(keys map[string]string)
+}
+
+// PlanSnapshotter — реестр планов, отдающий копии планов, снятые под его блокировкой (registry.PlanRegistry)
+type PlanSnapshotter interface {
+	Snapshot() []*model.Plan
+}
+
+// TaskOutputSource — вывод выполнений задач (registry.OutputRegistry)
+type TaskOutputSource interface {
+	TaskOutputs() map[string][]*registry.TaskOutput
+	LoadTaskOutputs(outputs map[string][]*registry.TaskOutput)
+}
+
+type Snapshotter struct {
+	logger   *logrus.Logger
+	core     *inforo.Core
+	store    Store
+	hostKeys HostKeySource
+	outputs  TaskOutputSource
+	// Save вызывается и по таймеру, и вне очереди по RequestSave
+	mu sync.Mutex
+	// Запросы внеочередного сохранения; повторные запросы до сохранения объединяются
+	saveRequests chan struct{}
+	// Записи, которые не удалось восстановить. Save полностью заменяет состояние в хранилище,
+	// поэтому они сохраняются обратно без изменений, пока не появится сущность с тем же ID.
+	kept []Record
+}
+
+type SnapshotterOpts struct {
+	Logger   *logrus.Logger
+	Core     *inforo.Core
+	Store    Store
+	HostKeys HostKeySource
+	Outputs  TaskOutputSource
+}
+
+func NewSnapshotter(opts SnapshotterOpts) *Snapshotter {
+	if opts.Logger == nil {
+		opts.Logger = inforo.NewNullLogger()
+	}
+	return &Snapshotter{
+		logger:   opts.Logger,
+		core:     opts.Core,
+		store:    opts.Store,
+		hostKeys: opts.HostKeys,
+		outputs:  opts.Outputs,
+
+		saveRequests: make(chan struct{}, 1),
+	}
+}
+
+// planRecord — сериализуемое представление плана: задачи графов хранятся ссылками на ID
+type planRecord struct {
+	ID            string                      `json:"id"`
+	TaskGraphs    []graphRecord               `json:"task_graphs"`
+	RollbackStack []*model.RollbackCheckpoint `json:"rollback_stack,omitempty"`
+	StatusHistory *model.StatusHistory        `json:"StatusHistory,omitempty"`
+	EventHistory  *model.EventHistory         `json:"EventHistory,omitempty"`
+}
+
+type graphRecord struct {
+	RootTaskID   string              `json:"root_task_id"`
+	Tasks        []string            `json:"tasks"`
+	Dependencies map[string][]string `json:"dependencies"`
+	Dependents   map[string][]string `json:"dependents"`
+}
+
+// Run сохраняет состояние по таймеру и по RequestSave до отмены контекста
+func (s *Snapshotter) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultSnapshotInterval
+	}
+	s.logger.Debugf("Snapshotter: saving state every %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.saveRequests:
+		}
+		if err := s.Save(); err != nil {
+			s.logger.Errorf("Snapshotter: failed to save state: %v", err)
+		}
+	}
+}
+
+// RequestSave просит Run сохранить состояние, не дожидаясь таймера и не блокируя вызывающего
+func (s *Snapshotter) RequestSave() {
+	select {
+	case s.saveRequests <- struct{}{}:
+	default:
+	}
+}
+
+// Save снимает состояние всех реестров и записывает его в хранилище
+func (s *Snapshotter) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.capture()
+	if err != nil {
+		return err
+	}
+	if err := s.store.Save(records); err != nil {
+		return err
+	}
+	s.logger.Debugf("Snapshotter: saved %d records", len(records))
+	return nil
+}
+
+func (s *Snapshotter) capture() ([]Record, error) {
+	var records []Record
+	add := func(kind Kind, id string, v any) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s/%s: %w", kind, id, err)
+		}
+		records = append(records, Record{Kind: kind, ID: id, Data: data})
+		return nil
+	}
+
+	if s.hostKeys != nil {
+		for address, key := range s.hostKeys.HostKeys() {
+			if err := add(KindHostKey, address, key); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	monitorings, _ := s.core.Monitorings.List()
+	for _, m := range monitorings {
+		if err := add(KindMonitoring, m.ID, copyMonitoring(m)); err != nil {
+			return nil, err
+		}
+	}
+
+	components, _ := s.core.Components.List()
+	for _, c := range components {
+		if err := add(KindComponent, c.ID, copyComponent(c)); err != nil {
+			return nil, err
+		}
+	}
+
+	tasks, _ := s.core.Tasks.List()
+	for _, t := range tasks {
+		if err := add(KindTask, t.ID, copyTask(t)); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.outputs != nil {
+		for taskID, outputs := range s.outputs.TaskOutputs() {
+			// Вывод удалённых задач не сохраняем
+			if _, err := s.core.Tasks.Get(taskID); err != nil {
+				continue
+			}
+			if err := add(KindTaskOutput, taskID, outputs); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var plans []*model.Plan
+	if snapshotter, ok := s.core.Plans.(PlanSnapshotter); ok {
+		plans = snapshotter.Snapshot()
+	} else {
+		plans, _ = s.core.Plans.List()
+	}
+	for _, p := range plans {
+		rec := planRecord{
+			ID:            p.ID,
+			RollbackStack: p.RollbackStack,
+			StatusHistory: p.StatusHistory,
+			EventHistory:  p.EventHistory,
+		}
+		for _, g := range p.TaskGraphs {
+			gr := graphRecord{
+				RootTaskID:   g.RootTaskID,
+				Dependencies: g.Dependencies,
+				Dependents:   g.Dependents,
+			}
+			for id := range g.Tasks {
+				gr.Tasks = append(gr.Tasks, id)
+			}
+			sort.Strings(gr.Tasks)
+			rec.TaskGraphs = append(rec.TaskGraphs, gr)
+		}
+		if err := add(KindPlan, p.ID, rec); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.withKept(records), nil
+}
+
+// withKept добавляет к снятому состоянию невосстановленные записи, которые ещё не заменены живыми сущностями
+func (s *Snapshotter) withKept(records []Record) []Record {
+	if len(s.kept) == 0 {
+		return records
+	}
+	type key struct {
+		kind Kind
+		id   string
+	}
+	live := make(map[key]bool, len(records))
+	for _, rec := range records {
+		live[key{rec.Kind, rec.ID}] = true
+	}
+
+	kept := s.kept[:0]
+	for _, rec := range s.kept {
+		if live[key{rec.Kind, rec.ID}] {
+			s.logger.Infof("Snapshotter: unrestored %s %s replaced by a new one", rec.Kind, rec.ID)
+			continue
+		}
+		kept = append(kept, rec)
+		records = append(records, rec)
+	}
+	s.kept = kept
+	return records
+}
+
+// keep оставляет запись, которую не удалось восстановить, для следующих сохранений
+func (s *Snapshotter) keep(rec Record) {
+	s.kept = append(s.kept, rec)
+}
+
+// Restore загружает состояние из хранилища и регистрирует его в реестрах ядра.
+// Контроллеры должны быть зарегистрированы заранее: реестры валидируют метаданные при регистрации.
+func (s *Snapshotter) Restore() error {
+	records, err := s.store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	byKind := make(map[Kind][]Record, len(Kinds))
+	for _, rec := range records {
+		byKind[rec.Kind] = append(byKind[rec.Kind], rec)
+	}
+
+	s.restoreHostKeys(byKind[KindHostKey])
+	s.restoreMonitorings(byKind[KindMonitoring])
+	s.restoreComponents(byKind[KindComponent])
+	s.restoreTasks(byKind[KindTask])
+	s.restoreTaskOutputs(byKind[KindTaskOutput])
+	s.restorePlans(byKind[KindPlan])
+
+	s.logger.Infof("Snapshotter: restored %d records", len(records)-len(s.kept))
+	if len(s.kept) != 0 {
+		s.logger.Warnf("Snapshotter: %d records were not restored and are kept in the store unchanged", len(s.kept))
+	}
+	return nil
+}
+
+func (s *Snapshotter) restoreHostKeys(records []Record) {
+	if s.hostKeys == nil {
+		return
+	}
+	keys := make(map[string]string, len(records))
+	for _, rec := range records {
+		var key string
+		if err := json.Unmarshal(rec.Data, &key); err != nil {
+			s.logger.Errorf("Snapshotter: skip host key %s: %v", rec.ID, err)
+			s.keep(rec)
+			continue
+		}
+		keys[rec.ID] = key
+	}
+	s.hostKeys.LoadHostKeys(keys)
+}
+
+func (s *Snapshotter) restoreMonitorings(records []Record) {
+	for _, rec := range records {
+		var saved model.Monitoring
+		if err := json.Unmarshal(rec.Data, &saved); err != nil {
+			s.logger.Errorf("Snapshotter: skip monitoring %s: %v", rec.ID, err)
+			s.keep(rec)
+			continue
+		}
+		m, err := s.core.Monitorings.Register(saved.Type, &model.Monitoring{
+			ID:     saved.ID,
+			Name:   saved.Name,
+			Type:   saved.Type,
+			Config: saved.Config,
+		})
+		if err != nil {
+			s.logger.Errorf("Snapshotter: skip monitoring %s: %v", rec.ID, err)
+			s.keep(rec)
+			continue
+		}
+		restoreHistory(&m.StatusHistory, &m.EventHistory, saved.StatusHistory, saved.EventHistory)
+	}
+}
+
+func (s *Snapshotter) restoreComponents(records []Record) {
+	for _, rec := range records {
+		var saved model.Component
+		if err := json.Unmarshal(rec.Data, &saved); err != nil {
+			s.logger.Errorf("Snapshotter: skip component %s: %v", rec.ID, err)
+			s.keep(rec)
+			continue
+		}
+		c, err := s.core.Components.Register(model.Component{
+			ID:       saved.ID,
+			Name:     saved.Name,
+			Type:     saved.Type,
+			Version:  saved.Version,
+			Metadata: saved.Metadata,
+		})
+		if err != nil {
+			s.logger.Errorf("Snapshotter: skip component %s: %v", rec.ID, err)
+			s.keep(rec)
+			continue
+		}
+		restoreHistory(&c.StatusHistory, &c.EventHistory, saved.StatusHistory, saved.EventHistory)
+	}
+}
+
+func (s *Snapshotter) restoreTasks(records []Record) {
+	saved := make(map[string]*model.Task, len(records))
+	byID := make(map[string]Record, len(records))
+	deps := make(map[string][]string, len(records))
+	for _, rec := range records {
+		var t model.Task
+		if err := json.Unmarshal(rec.Data, &t); err != nil {
+			s.logger.Errorf("Snapshotter: skip task %s: %v", rec.ID, err)
+			s.keep(rec)
+			continue
+		}
+		saved[t.ID] = &t
+		byID[t.ID] = rec
+	}
+	for id, t := range saved {
+		deps[id] = []string{}
+		for _, dep := range t.DependsOn {
+			if _, ok := saved[dep.ID]; ok {
+				deps[id] = append(deps[id], dep.ID)
+			}
+		}
+	}
+
+	// Реестр задач требует, чтобы зависимости были зарегистрированы раньше зависимой задачи
+	order, err := registry.ExecutionOrder(deps)
+	if err != nil {
+		s.logger.Errorf("Snapshotter: skip tasks: %v", err)
+		for _, rec := range byID {
+			s.keep(rec)
+		}
+		return
+	}
+
+	for _, id := range order {
+		t := saved[id]
+		task, err := s.core.Tasks.Register(&model.Task{
+			ID:         t.ID,
+			Name:       t.Name,
+			Type:       t.Type,
+			Components: t.Components,
+			RollBack:   t.RollBack,
+			DependsOn:  t.DependsOn,
+			PreChecks:  t.PreChecks,
+			PostChecks: t.PostChecks,
+			Metadata:   t.Metadata,
+		})
+		if err != nil {
+			s.logger.Errorf("Snapshotter: skip task %s: %v", id, err)
+			s.keep(byID[id])
+			continue
+		}
+		restoreHistory(&task.StatusHistory, &task.EventHistory, t.StatusHistory, t.EventHistory)
+		if interrupted(task.StatusHistory) {
+			task.StatusHistory = s.core.Tasks.NextStatus(model.StatusFailed, task.StatusHistory)
+			s.core.Tasks.AddEvent(task.EventHistory, "Interrupted by daemon restart")
+		}
+	}
+}
+
+func (s *Snapshotter) restoreTaskOutputs(records []Record) {
+	if s.outputs == nil {
+		return
+	}
+	outputs := make(map[string][]*registry.TaskOutput, len(records))
+	for _, rec := range records {
+		if _, err := s.core.Tasks.Get(rec.ID); err != nil {
+			s.logger.Errorf("Snapshotter: skip output of task %s: %v", rec.ID, err)
+			s.keep(rec)
+			continue
+		}
+		var list []*registry.TaskOutput
+		if err := json.Unmarshal(rec.Data, &list); err != nil {
+			s.logger.Errorf("Snapshotter: skip output of task %s: %v", rec.ID, err)
+			s.keep(rec)
+			continue
+		}
+		outputs[rec.ID] = list
+	}
+	s.outputs.LoadTaskOutputs(outputs)
+}
+
+func (s *Snapshotter) restorePlans(records []Record) {
+	restorer, ok := s.core.Plans.(PlanRestorer)
+	if !ok {
+		if len(records) != 0 {
+			s.logger.Warnf("Snapshotter: plan registry %T can not restore plans, %d plans skipped", s.core.Plans, len(records))
+		}
+		s.kept = append(s.kept, records...)
+		return
+	}
+
+	for _, rec := range records {
+		var saved planRecord
+		if err := json.Unmarshal(rec.Data, &saved); err != nil {
+			s.logger.Errorf("Snapshotter: skip plan %s: %v", rec.ID, err)
+			s.keep(rec)
+			continue
+		}
+
+		plan := &model.Plan{
+			ID:            saved.ID,
+			RollbackStack: saved.RollbackStack,
+			StatusHistory: saved.StatusHistory,
+			EventHistory:  saved.EventHistory,
+		}
+		var missing error
+		for _, gr := range saved.TaskGraphs {
+			graph := &model.TaskGraph{
+				RootTaskID:   gr.RootTaskID,
+				Tasks:        make(map[string]*model.Task, len(gr.Tasks)),
+				Dependencies: gr.Dependencies,
+				Dependents:   gr.Dependents,
+			}
+			for _, id := range gr.Tasks {
+				task, err := s.core.Tasks.Get(id)
+				if err != nil {
+					missing = errors.Join(missing, err)
+					continue
+				}
+				graph.Tasks[id] = task
+			}
+			plan.TaskGraphs = append(plan.TaskGraphs, graph)
+		}
+		if missing != nil {
+			s.logger.Errorf("Snapshotter: skip plan %s: %v", rec.ID, missing)
+			s.keep(rec)
+			continue
+		}
+
+		if plan.StatusHistory != nil && planInterrupted(plan) {
+			plan.StatusHistory = s.core.Plans.NextStatus(model.StatusFailed, plan.StatusHistory)
+			if plan.EventHistory == nil {
+				plan.EventHistory = &model.EventHistory{}
+			}
+			s.core.Plans.AddEvent(plan.EventHistory, "Interrupted by daemon restart")
+		}
+		if err := restorer.Restore(plan); err != nil {
+			s.logger.Errorf("Snapshotter: skip plan %s: %v", rec.ID, err)
+			s.keep(rec)
+		}
+	}
+}
+
+// restoreHistory заменяет свежие истории, созданные при регистрации, на сохранённые
+func restoreHistory(status **model.StatusHistory, events **model.EventHistory, savedStatus *model.StatusHistory, savedEvents *model.EventHistory) {
+	if savedStatus != nil {
+		*status = savedStatus
+	}
+	if savedEvents != nil {
+		*events = savedEvents
+	}
+}
+
+// interrupted — выполнение было прервано остановкой демона
+func interrupted(history *model.StatusHistory) bool {
+	switch history.LastStatus {
+	case model.StatusPending, model.StatusCheck, model.StatusRunning:
+		return true
+	}
+	return false
+}
+
+// planInterrupted — выполнение или откат плана были прерваны остановкой демона.
+// rollback — и статус идущего отката, и итог удачного: их различает стек отката.
+func planInterrupted(plan *model.Plan) bool {
+	if plan.StatusHistory.LastStatus == model.StatusRollBack {
+		return registry.RollbackPending(plan)
+	}
+	return interrupted(plan.StatusHistory)
+}
+
+/*
+	RUS: Копии сущностей для сохранения. Их меняют выполняющиеся задачи и watchdog,
+	поэтому поля читаются под блокировками объектов и их историй, а сериализуется копия.
+	ENG: Entity copies for saving. Running tasks and the watchdog change them,
+	so fields are read under the object and history locks and the copy is marshaled.
+*/
+
+func copyMonitoring(m *model.Monitoring) *model.Monitoring {
+	m.MU.RLock()
+	copied := &model.Monitoring{
+		ID:     m.ID,
+		Name:   m.Name,
+		Type:   m.Type,
+		Config: maps.Clone(m.Config),
+	}
+	status, events := m.StatusHistory, m.EventHistory
+	m.MU.RUnlock()
+
+	copied.StatusHistory = registry.CopyStatusHistory(status)
+	copied.EventHistory = registry.CopyEventHistory(events)
+	return copied
+}
+
+func copyComponent(c *model.Component) *model.Component {
+	c.MU.RLock()
+	copied := &model.Component{
+		ID:       c.ID,
+		Name:     c.Name,
+		Type:     c.Type,
+		Version:  c.Version,
+		Metadata: maps.Clone(c.Metadata),
+	}
+	status, events := c.StatusHistory, c.EventHistory
+	c.MU.RUnlock()
+
+	copied.StatusHistory = registry.CopyStatusHistory(status)
+	copied.EventHistory = registry.CopyEventHistory(events)
+	return copied
+}
+
+func copyTask(t *model.Task) *model.Task {
+	t.MU.RLock()
+	copied := &model.Task{
+		ID:         t.ID,
+		Name:       t.Name,
+		Type:       t.Type,
+		Components: append([]string(nil), t.Components...),
+		RollBack:   copyRollback(t.RollBack),
+		DependsOn:  append([]model.Depends(nil), t.DependsOn...),
+		Metadata:   maps.Clone(t.Metadata),
+	}
+	status, events := t.StatusHistory, t.EventHistory
+	preChecks, postChecks := t.PreChecks, t.PostChecks
+	t.MU.RUnlock()
+
+	copied.StatusHistory = registry.CopyStatusHistory(status)
+	copied.EventHistory = registry.CopyEventHistory(events)
+	copied.PreChecks = copyChecks(preChecks)
+	copied.PostChecks = copyChecks(postChecks)
+	return copied
+}
+
+func copyRollback(r *model.Rollback) *model.Rollback {
+	if r == nil {
+		return nil
+	}
+	r.MU.RLock()
+	defer r.MU.RUnlock()
+
+	return &model.Rollback{
+		Type:       r.Type,
+		ID:         r.ID,
+		TaskID:     r.TaskID,
+		PlanID:     r.PlanID,
+		Components: append([]string(nil), r.Components...),
+		Metadata:   maps.Clone(r.Metadata),
+	}
+}
+
+func copyChecks(checks []*model.Check) []*model.Check {
+	if checks == nil {
+		return nil
+	}
+	copied := make([]*model.Check, 0, len(checks))
+	for _, c := range checks {
+		if c == nil {
+			copied = append(copied, nil)
+			continue
+		}
+		c.MU.RLock()
+		check := &model.Check{
+			ID:           c.ID,
+			Name:         c.Name,
+			MonitoringID: c.MonitoringID,
+			Metadata:     maps.Clone(c.Metadata),
+		}
+		status, events := c.StatusHistory, c.EventHistory
+		c.MU.RUnlock()
+
+		check.StatusHistory = registry.CopyStatusHistory(status)
+		check.EventHistory = registry.CopyEventHistory(events)
+		copied = append(copied, check)
+	}
+	return copied
+}
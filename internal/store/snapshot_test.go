@@ -0,0 +1,325 @@
+package store
+
+import (
+	"encoding/json"
+	"io"
+	"laplasd/internal/registry"
+	"path/filepath"
+	"testing"
+
+	"github.com/laplasd/inforo"
+	"github.com/laplasd/inforo/model"
+	"github.com/sirupsen/logrus"
+)
+
+// memStore — хранилище в памяти: Save, как и bolt/sql, полностью заменяет состояние
+type memStore struct {
+	records []Record
+}
+
+func (m *memStore) Save(records []Record) error {
+	m.records = append([]Record(nil), records...)
+	return nil
+}
+
+func (m *memStore) Load() ([]Record, error) { return m.records, nil }
+func (m *memStore) Close() error            { return nil }
+
+func newTestSnapshotter(t *testing.T, st Store) *Snapshotter {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	// Реестр контроллеров пуст: компоненты любого типа не проходят регистрацию
+	core := inforo.NewCore(inforo.CoreOptions{
+		Logger:      logger,
+		Controllers: registry.NewControllerRegistry(registry.ControllerRegistryOptions{Logger: logger}),
+	})
+	return NewSnapshotter(SnapshotterOpts{Logger: logger, Core: core, Store: st})
+}
+
+func TestSnapshotterKeepsUnrestoredRecords(t *testing.T) {
+	data, err := json.Marshal(&model.Component{ID: "c1", Name: "web", Type: "ssh", Metadata: map[string]string{"host": "web"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &memStore{records: []Record{
+		{Kind: KindComponent, ID: "c1", Data: data},
+		{Kind: KindTask, ID: "t1", Data: []byte("{broken")},
+	}}
+
+	s := newTestSnapshotter(t, st)
+	if err := s.Restore(); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if len(st.records) != 2 {
+		t.Fatalf("saved %d records, want both unrestored records kept: %+v", len(st.records), st.records)
+	}
+	for _, rec := range st.records {
+		if rec.ID == "c1" && string(rec.Data) != string(data) {
+			t.Errorf("component record changed on save: %s", rec.Data)
+		}
+	}
+}
+
+// hostKeys — HostKeySource в памяти
+type hostKeys map[string]string
+
+func (h hostKeys) HostKeys() map[string]string { return h }
+func (h hostKeys) LoadHostKeys(keys map[string]string) {
+	for address, key := range keys {
+		h[address] = key
+	}
+}
+
+func TestSnapshotterDropsKeptRecordReplacedByLiveOne(t *testing.T) {
+	st := &memStore{records: []Record{{Kind: KindHostKey, ID: "web:22", Data: []byte("{broken")}}}
+	s := newTestSnapshotter(t, st)
+	keys := hostKeys{}
+	s.hostKeys = keys
+	if err := s.Restore(); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	keys["web:22"] = "ssh-ed25519 AAAA"
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if len(st.records) != 1 || string(st.records[0].Data) != `"ssh-ed25519 AAAA"` {
+		t.Fatalf("saved records = %+v, want only the live host key", st.records)
+	}
+	if len(s.kept) != 0 {
+		t.Errorf("replaced record is still kept: %+v", s.kept)
+	}
+}
+
+func TestPlanInterrupted(t *testing.T) {
+	reversible := &model.Task{ID: "a", RollBack: &model.Rollback{Type: "task"}}
+	graphs := []*model.TaskGraph{{RootTaskID: "a", Tasks: map[string]*model.Task{"a": reversible}}}
+	status := &inforo.StatusManager{}
+	tests := []struct {
+		name   string
+		status model.Status
+		stack  []*model.RollbackCheckpoint
+		want   bool
+	}{
+		{name: "running", status: model.StatusRunning, want: true},
+		{name: "failed", status: model.StatusFailed, want: false},
+		{name: "rolled back", status: model.StatusRollBack, want: false},
+		{name: "rollback in progress", status: model.StatusRollBack, stack: []*model.RollbackCheckpoint{{TaskID: "a"}}, want: true},
+	}
+	for _, tt := range tests {
+		plan := &model.Plan{ID: "p1", TaskGraphs: graphs, RollbackStack: tt.stack, StatusHistory: status.NewStatus(tt.status)}
+		if got := planInterrupted(plan); got != tt.want {
+			t.Errorf("%s: planInterrupted = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// testController принимает любые метаданные компонентов, задач и мониторингов
+type testController struct{}
+
+func (testController) RunTask(taskMeta, componentMeta map[string]string) error { return nil }
+func (testController) ValideTask(meta map[string]string) error                 { return nil }
+func (testController) ValideComponent(meta map[string]string) error            { return nil }
+func (testController) CheckComponent(meta map[string]string) error             { return nil }
+func (testController) RunCheck(meta map[string]string) error                   { return nil }
+func (testController) CheckMonitoring(config map[string]string) error          { return nil }
+func (testController) ValidateCheck(meta map[string]string) error              { return nil }
+func (testController) ValidateMonitoring(config map[string]string) error       { return nil }
+
+// newRoundTripCore собирает ядро, как демон: контроллеры типа "test" и реестр планов laplasd
+func newRoundTripCore(t *testing.T, logger *logrus.Logger) *inforo.Core {
+	t.Helper()
+	controllers := registry.NewControllerRegistry(registry.ControllerRegistryOptions{Logger: logger})
+	if err := controllers.Register("test", testController{}); err != nil {
+		t.Fatal(err)
+	}
+	core := inforo.NewCore(inforo.CoreOptions{Logger: logger, Controllers: controllers})
+	if err := core.MonitorControllers.Register("test", testController{}); err != nil {
+		t.Fatal(err)
+	}
+	plans, err := registry.NewPlanRegistry(registry.PlanRegistryOptions{
+		Logger:     logger,
+		Components: core.Components,
+		Tasks:      core.Tasks,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	core.Plans = plans
+	return core
+}
+
+func TestSnapshotterBoltRoundTrip(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	core := newRoundTripCore(t, logger)
+	m, err := core.Monitorings.Register("test", &model.Monitoring{ID: "m1", Name: "prom", Type: "test", Config: map[string]string{"url": "http://prom"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.StatusHistory = core.Monitorings.NextStatus(model.StatusSuccess, m.StatusHistory)
+
+	c, err := core.Components.Register(model.Component{ID: "c1", Name: "web", Type: "test", Version: "1.0", Metadata: map[string]string{"host": "web"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.StatusHistory = core.Components.NextStatus(model.StatusSuccess, c.StatusHistory)
+	core.Components.AddEvent(c.EventHistory, "Health check passed")
+
+	// Задачи плана регистрирует реестр планов
+	plan, err := core.Plans.Register([]*model.Task{
+		{ID: "t1", Name: "deploy", Type: model.UpdateTask, Components: []string{"c1"},
+			PreChecks: []*model.Check{{ID: "k1", MonitoringID: "m1", Metadata: map[string]string{"query": "up"}}},
+			Metadata:  map[string]string{"cmd": "true"}},
+		{ID: "t2", Name: "migrate", Type: model.UpdateTask, Components: []string{"c1"},
+			DependsOn: []model.Depends{{Type: model.Strict, ID: "t1"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t1, err := core.Tasks.Get("t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t1.StatusHistory = core.Tasks.NextStatus(model.StatusSuccess, t1.StatusHistory)
+	plan.StatusHistory = core.Plans.NextStatus(model.StatusFailed, plan.StatusHistory)
+	core.Plans.AddEvent(plan.EventHistory, "Task t2 failed")
+
+	st, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewSnapshotter(SnapshotterOpts{Logger: logger, Core: core, Store: st}).Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	st.Close()
+
+	st, err = NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	restored := newRoundTripCore(t, logger)
+	s := NewSnapshotter(SnapshotterOpts{Logger: logger, Core: restored, Store: st})
+	if err := s.Restore(); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if len(s.kept) != 0 {
+		t.Fatalf("records not restored: %+v", s.kept)
+	}
+
+	gotM, err := restored.Monitorings.Get("m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotM.Config["url"] != "http://prom" || gotM.StatusHistory.LastStatus != model.StatusSuccess {
+		t.Errorf("monitoring = %+v, status %s", gotM.Config, gotM.StatusHistory.LastStatus)
+	}
+
+	gotC, err := restored.Components.Get("c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotC.Version != "1.0" || gotC.Metadata["host"] != "web" {
+		t.Errorf("component = %+v", gotC)
+	}
+	checkHistory(t, "component", gotC.StatusHistory, gotC.EventHistory, model.StatusSuccess, c.EventHistory)
+
+	gotT1, err := restored.Tasks.Get("t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkHistory(t, "task t1", gotT1.StatusHistory, gotT1.EventHistory, model.StatusSuccess, t1.EventHistory)
+	if len(gotT1.PreChecks) != 1 || gotT1.PreChecks[0].MonitoringID != "m1" || gotT1.Metadata["cmd"] != "true" {
+		t.Errorf("task t1 = %+v", gotT1)
+	}
+	gotT2, err := restored.Tasks.Get("t2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gotT2.DependsOn) != 1 || gotT2.DependsOn[0].ID != "t1" {
+		t.Errorf("task t2 depends on %+v, want t1", gotT2.DependsOn)
+	}
+
+	gotPlan, err := restored.Plans.Get(plan.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkHistory(t, "plan", gotPlan.StatusHistory, gotPlan.EventHistory, model.StatusFailed, plan.EventHistory)
+	if len(gotPlan.TaskGraphs) != 1 || gotPlan.TaskGraphs[0].RootTaskID != "t1" ||
+		gotPlan.TaskGraphs[0].Tasks["t2"] != gotT2 || len(gotPlan.TaskGraphs[0].Dependencies["t2"]) != 1 {
+		t.Errorf("plan graphs = %+v", gotPlan.TaskGraphs)
+	}
+}
+
+// checkHistory сверяет восстановленные истории с сохранёнными
+func checkHistory(t *testing.T, name string, status *model.StatusHistory, events *model.EventHistory, want model.Status, wantEvents *model.EventHistory) {
+	t.Helper()
+	if status.LastStatus != want || len(status.Previous) == 0 {
+		t.Errorf("%s status = %s with %d previous, want %s with history", name, status.LastStatus, len(status.Previous), want)
+	}
+	if len(events.Event) != len(wantEvents.Event) {
+		t.Errorf("%s has %d events, want %d", name, len(events.Event), len(wantEvents.Event))
+		return
+	}
+	for i := range wantEvents.Event {
+		if events.Event[i].Message != wantEvents.Event[i].Message {
+			t.Errorf("%s event %d = %q, want %q", name, i, events.Event[i].Message, wantEvents.Event[i].Message)
+		}
+	}
+}
+
+func TestSnapshotterTaskOutputRoundTrip(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	st := &memStore{}
+
+	core := newRoundTripCore(t, logger)
+	if _, err := core.Components.Register(model.Component{ID: "c1", Type: "test", Version: "1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"t1", "t2"} {
+		if _, err := core.Tasks.Register(&model.Task{ID: id, Type: model.UpdateTask, Components: []string{"c1"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outputs := registry.NewOutputRegistry(registry.OutputRegistryOptions{Logger: logger})
+	code := 2
+	outputs.Add("t1", &registry.TaskOutput{ExecutionID: "e1", Action: registry.OutputRun, ComponentID: "c1",
+		ExitCode: &code, Stdout: "tail", StdoutTruncated: true, Stderr: "boom", Error: "exit status 2"})
+	outputs.Add("t2", &registry.TaskOutput{ExecutionID: "e2", Action: registry.OutputRun, ComponentID: "c1"})
+	// Вывод удалённой задачи не сохраняется
+	outputs.Add("gone", &registry.TaskOutput{ExecutionID: "e3"})
+	if err := core.Tasks.Delete("t2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewSnapshotter(SnapshotterOpts{Logger: logger, Core: core, Store: st, Outputs: outputs}).Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	for _, rec := range st.records {
+		if rec.Kind == KindTaskOutput && rec.ID != "t1" {
+			t.Errorf("saved output of deleted task %s", rec.ID)
+		}
+	}
+
+	restoredCore := newRoundTripCore(t, logger)
+	restored := registry.NewOutputRegistry(registry.OutputRegistryOptions{Logger: logger})
+	s := NewSnapshotter(SnapshotterOpts{Logger: logger, Core: restoredCore, Store: st, Outputs: restored})
+	if err := s.Restore(); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	got := restored.List("t1")
+	if len(got) != 1 {
+		t.Fatalf("restored %d outputs of t1, want 1", len(got))
+	}
+	o := got[0]
+	if o.ExecutionID != "e1" || o.ExitCode == nil || *o.ExitCode != 2 || o.Stdout != "tail" || !o.StdoutTruncated || o.Stderr != "boom" || o.Error != "exit status 2" {
+		t.Errorf("restored output = %+v", o)
+	}
+}
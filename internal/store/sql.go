@@ -0,0 +1,98 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+/*
+	================
+	sql-store
+	================
+*/
+
+const stateTable = "laplas_state"
+
+type SQLStore struct {
+	db *sql.DB
+}
+
+func NewSQLStore(driver string, dsn string, maxConnections int) (*SQLStore, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %w", driver, err)
+	}
+	if maxConnections > 0 {
+		db.SetMaxOpenConns(maxConnections)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to %s database: %w", driver, err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS ` + stateTable + ` (
+		kind       VARCHAR(32)  NOT NULL,
+		id         VARCHAR(255) NOT NULL,
+		data       TEXT         NOT NULL,
+		updated_at TIMESTAMP    NOT NULL,
+		PRIMARY KEY (kind, id)
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create %s table: %w", stateTable, err)
+	}
+
+	return &SQLStore{db: db}, nil
+}
+
+// Save заменяет содержимое таблицы в одной транзакции
+func (s *SQLStore) Save(records []Record) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM ` + stateTable); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO ` + stateTable + ` (kind, id, data, updated_at) VALUES ($1, $2, $3, $4)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	for _, rec := range records {
+		if _, err := stmt.Exec(string(rec.Kind), rec.ID, string(rec.Data), now); err != nil {
+			return fmt.Errorf("failed to save %s/%s: %w", rec.Kind, rec.ID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) Load() ([]Record, error) {
+	rows, err := s.db.Query(`SELECT kind, id, data FROM ` + stateTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var kind, id, data string
+		if err := rows.Scan(&kind, &id, &data); err != nil {
+			return nil, err
+		}
+		records = append(records, Record{Kind: Kind(kind), ID: id, Data: []byte(data)})
+	}
+	return records, rows.Err()
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
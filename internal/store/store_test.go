@@ -0,0 +1,124 @@
+package store
+
+import (
+	"laplasd/internal/config"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// testSQLDSNEnv — DSN тестовой базы PostgreSQL; без него тест SQL-хранилища пропускается
+const testSQLDSNEnv = "LAPLASD_TEST_POSTGRES_DSN"
+
+// checkStoreRoundTrip сохраняет записи, повторно открывает хранилище и сверяет загруженное.
+// Второй Save должен полностью заменить первый.
+func checkStoreRoundTrip(t *testing.T, open func() Store) {
+	t.Helper()
+
+	st := open()
+	first := []Record{
+		{Kind: KindComponent, ID: "c1", Data: []byte(`{"id":"c1"}`)},
+		{Kind: KindTask, ID: "t1", Data: []byte(`{"ID":"t1"}`)},
+	}
+	if err := st.Save(first); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	want := []Record{
+		{Kind: KindHostKey, ID: "web:22", Data: []byte(`"ssh-ed25519 AAAA"`)},
+		{Kind: KindMonitoring, ID: "m1", Data: []byte(`{"id":"m1"}`)},
+		{Kind: KindComponent, ID: "c1", Data: []byte(`{"id":"c1","version":"2"}`)},
+		{Kind: KindTaskOutput, ID: "t2", Data: []byte(`[]`)},
+		{Kind: KindPlan, ID: "p1", Data: []byte(`{"id":"p1"}`)},
+	}
+	if err := st.Save(want); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := st.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	st = open()
+	defer st.Close()
+	got, err := st.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	sortRecords(got)
+	sortRecords(want)
+	if len(got) != len(want) {
+		t.Fatalf("loaded %d records, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].Kind != want[i].Kind || got[i].ID != want[i].ID || string(got[i].Data) != string(want[i].Data) {
+			t.Errorf("record %d = %s/%s %s, want %s/%s %s",
+				i, got[i].Kind, got[i].ID, got[i].Data, want[i].Kind, want[i].ID, want[i].Data)
+		}
+	}
+}
+
+func sortRecords(records []Record) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Kind != records[j].Kind {
+			return records[i].Kind < records[j].Kind
+		}
+		return records[i].ID < records[j].ID
+	})
+}
+
+func TestBoltStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	checkStoreRoundTrip(t, func() Store {
+		st, err := NewBoltStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st
+	})
+}
+
+func TestBoltStoreRejectsUnknownKind(t *testing.T) {
+	st, err := NewBoltStore(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	if err := st.Save([]Record{{Kind: "unknown", ID: "x", Data: []byte("{}")}}); err == nil {
+		t.Fatal("Save accepted a record of unknown kind")
+	}
+}
+
+func TestSQLStoreRoundTrip(t *testing.T) {
+	dsn := os.Getenv(testSQLDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testSQLDSNEnv)
+	}
+	checkStoreRoundTrip(t, func() Store {
+		st, err := NewSQLStore("postgres", dsn, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st
+	})
+}
+
+func TestNewSelectsBackendByScheme(t *testing.T) {
+	dir := t.TempDir()
+	for _, url := range []string{"bolt://" + filepath.Join(dir, "a.db"), "file://" + filepath.Join(dir, "b.db")} {
+		st, err := New(config.Database{URL: url})
+		if err != nil {
+			t.Fatalf("New(%q): %v", url, err)
+		}
+		if _, ok := st.(*BoltStore); !ok {
+			t.Errorf("New(%q) = %T, want *BoltStore", url, st)
+		}
+		st.Close()
+	}
+
+	for _, url := range []string{"", "bolt://", "mysql://localhost/db"} {
+		if _, err := New(config.Database{URL: url}); err == nil {
+			t.Errorf("New(%q) succeeded, want error", url)
+		}
+	}
+}
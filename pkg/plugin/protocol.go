@@ -0,0 +1,153 @@
+/*
+Package plugin описывает протокол внешних контроллеров laplasd и помогает их писать.
+
+RUS: Плагин — отдельный исполняемый файл в каталоге плагинов (config: [plugins] dir) или
+unix-сокет там же. laplasd запускает исполняемые файлы и общается с ними через stdin/stdout,
+к сокетам подключается. Сообщения — JSON-RPC 2.0, по одному JSON-объекту на строку.
+Сначала laplasd вызывает plugin.handshake, плагин отвечает версией протокола и типами
+контроллеров, которые laplasd регистрирует у себя. Логи плагин пишет в stderr: stdout занят протоколом.
+Если laplasd перестаёт ждать вызов (истёк таймаут задачи), он отправляет уведомление $/cancel;
+контроллерам, реализующим ContextController, отменяется контекст задачи.
+
+ENG: A plugin is an executable (spoken to over stdio) or a unix socket in the plugins directory.
+Messages are newline-delimited JSON-RPC 2.0; plugin.handshake negotiates the protocol version and
+lists the controller types the plugin serves. laplasd sends $/cancel when it stops waiting for a
+call (task timeout); controllers implementing ContextController get their context canceled.
+
+	func main() {
+		err := plugin.Serve(plugin.Options{
+			Name:        "acme",
+			Controllers: map[string]api.Controller{"acme-lb": &LBController{}},
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+*/
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	/*
+		RUS: Версия протокола. Увеличивается при несовместимых изменениях; laplasd отказывается
+		работать с плагином другой версии.
+		ENG: Protocol version, bumped on incompatible changes.
+	*/
+	ProtocolVersion = 1
+)
+
+// Переменная окружения, по которой исполняемый файл понимает, что его запустил laplasd
+const EnvProtocol = "LAPLASD_PLUGIN_PROTOCOL"
+
+// Методы протокола
+const (
+	MethodHandshake = "plugin.handshake"
+
+	MethodRunTask         = "controller.run_task"
+	MethodValideTask      = "controller.valide_task"
+	MethodValideComponent = "controller.valide_component"
+	MethodCheckComponent  = "controller.check_component"
+
+	MethodRunCheck           = "monitor.run_check"
+	MethodCheckMonitoring    = "monitor.check_monitoring"
+	MethodValidateCheck      = "monitor.validate_check"
+	MethodValidateMonitoring = "monitor.validate_monitoring"
+
+	// Уведомление плагина: часть вывода выполняемой задачи
+	MethodTaskOutput = "task.output"
+	// Уведомление laplasd: вызов больше не нужен (таймаут задачи), его контекст отменяется
+	MethodCancel = "$/cancel"
+)
+
+// Потоки вывода задачи
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// Коды ошибок: стандартные JSON-RPC и собственные
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+
+	// Контроллер вернул ошибку: сообщение передаётся пользователю как есть
+	CodeControllerError = 1
+	// Плагин не обслуживает запрошенный тип контроллера
+	CodeUnknownType = 2
+)
+
+// Message — сообщение JSON-RPC: запрос (Method и ID), уведомление (Method без ID) или ответ (ID с Result или Error)
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *uint64         `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error — ошибка вызова
+type Error struct {
+	Code    int        `json:"code"`
+	Message string     `json:"message"`
+	Data    *ErrorData `json:"data,omitempty"`
+}
+
+// ErrorData — подробности ошибки контроллера
+type ErrorData struct {
+	// Код завершения команды задачи, если он известен
+	ExitCode *int `json:"exit_code,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == CodeControllerError {
+		return e.Message
+	}
+	return fmt.Sprintf("plugin error %d: %s", e.Code, e.Message)
+}
+
+type HandshakeParams struct {
+	ProtocolVersion int `json:"protocol_version"`
+}
+
+type HandshakeResult struct {
+	ProtocolVersion    int      `json:"protocol_version"`
+	Name               string   `json:"name"`
+	Controllers        []string `json:"controllers"`
+	MonitorControllers []string `json:"monitor_controllers"`
+}
+
+// ControllerParams — параметры методов controller.*
+type ControllerParams struct {
+	Type      string            `json:"type"`
+	Task      map[string]string `json:"task,omitempty"`
+	Component map[string]string `json:"component,omitempty"`
+}
+
+// MonitorParams — параметры методов monitor.*
+type MonitorParams struct {
+	Type string            `json:"type"`
+	Meta map[string]string `json:"meta"`
+}
+
+// CancelParams — параметры уведомления $/cancel
+type CancelParams struct {
+	// ID отменяемого запроса
+	ID uint64 `json:"id"`
+}
+
+// OutputParams — параметры уведомления task.output
+type OutputParams struct {
+	// ID запроса controller.run_task, к которому относится вывод
+	RequestID uint64 `json:"request_id"`
+	Stream    string `json:"stream"`
+	// Байты вывода как есть, в JSON — base64: вывод бывает двоичным и режется посреди символа UTF-8
+	Data []byte `json:"data"`
+}
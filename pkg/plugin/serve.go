@@ -0,0 +1,264 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/laplasd/inforo/api"
+)
+
+// OutputController — контроллер, передающий вывод задачи по мере выполнения.
+// Если контроллер его не реализует, вызывается RunTask без вывода.
+type OutputController interface {
+	RunTaskOutput(taskMeta, componentMeta map[string]string, stdout, stderr io.Writer) error
+}
+
+// ContextController — контроллер, задачу которого можно прервать: ctx отменяется по $/cancel
+// от laplasd (истёк таймаут задачи) и при разрыве соединения. Без него задача выполняется до конца,
+// даже если laplasd её уже не ждёт.
+type ContextController interface {
+	RunTaskContext(ctx context.Context, taskMeta, componentMeta map[string]string, stdout, stderr io.Writer) error
+}
+
+type Options struct {
+	// Имя плагина для логов laplasd
+	Name               string
+	Controllers        map[string]api.Controller
+	MonitorControllers map[string]api.MonitoringController
+}
+
+// Serve обслуживает laplasd через stdin/stdout до закрытия stdin
+func Serve(opts Options) error {
+	return ServeConn(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, opts)
+}
+
+// ListenAndServe обслуживает подключения к unix-сокету; сокет нужно создать в каталоге плагинов laplasd
+func ListenAndServe(socket string, opts Options) error {
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			ServeConn(conn, opts)
+		}()
+	}
+}
+
+// ServeConn обслуживает одно подключение; запросы выполняются параллельно
+func ServeConn(conn io.ReadWriter, opts Options) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &server{opts: opts, enc: json.NewEncoder(conn), calls: make(map[uint64]context.CancelFunc)}
+	dec := json.NewDecoder(conn)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	// Задачи разорванного соединения никто не ждёт
+	defer cancel()
+
+	for {
+		var msg Message
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			var syntax *json.SyntaxError
+			if errors.As(err, &syntax) {
+				s.reply(nil, nil, &Error{Code: CodeParseError, Message: err.Error()})
+			}
+			return err
+		}
+		if msg.ID == nil {
+			if msg.Method == MethodCancel {
+				s.cancel(msg.Params)
+			}
+			continue
+		}
+		// Вызов регистрируется до запуска горутины, чтобы $/cancel не обогнал его
+		callCtx, callCancel := context.WithCancel(ctx)
+		s.callsMu.Lock()
+		s.calls[*msg.ID] = callCancel
+		s.callsMu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := s.handle(callCtx, &msg)
+			s.callsMu.Lock()
+			delete(s.calls, *msg.ID)
+			s.callsMu.Unlock()
+			callCancel()
+			s.reply(msg.ID, result, err)
+		}()
+	}
+}
+
+type server struct {
+	opts Options
+	mu   sync.Mutex
+	enc  *json.Encoder
+
+	callsMu sync.Mutex
+	// Отмена выполняемых вызовов по ID запроса
+	calls map[uint64]context.CancelFunc
+}
+
+// cancel отменяет вызов по уведомлению $/cancel; завершившийся вызов уже не найдётся
+func (s *server) cancel(data json.RawMessage) {
+	var params CancelParams
+	if json.Unmarshal(data, &params) != nil {
+		return
+	}
+	s.callsMu.Lock()
+	cancel := s.calls[params.ID]
+	s.callsMu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+func (s *server) send(msg *Message) {
+	msg.JSONRPC = "2.0"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enc.Encode(msg)
+}
+
+func (s *server) reply(id *uint64, result interface{}, callErr *Error) {
+	msg := &Message{ID: id, Error: callErr}
+	if id == nil {
+		var zero uint64
+		msg.ID = &zero
+	}
+	if callErr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			msg.Error = &Error{Code: CodeInternalError, Message: err.Error()}
+		} else {
+			msg.Result = data
+		}
+	}
+	s.send(msg)
+}
+
+func (s *server) handle(ctx context.Context, msg *Message) (interface{}, *Error) {
+	switch msg.Method {
+	case MethodHandshake:
+		var params HandshakeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		result := HandshakeResult{ProtocolVersion: ProtocolVersion, Name: s.opts.Name}
+		for name := range s.opts.Controllers {
+			result.Controllers = append(result.Controllers, name)
+		}
+		for name := range s.opts.MonitorControllers {
+			result.MonitorControllers = append(result.MonitorControllers, name)
+		}
+		return result, nil
+
+	case MethodRunTask, MethodValideTask, MethodValideComponent, MethodCheckComponent:
+		var params ControllerParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		controller, ok := s.opts.Controllers[params.Type]
+		if !ok {
+			return nil, &Error{Code: CodeUnknownType, Message: fmt.Sprintf("unknown controller type %q", params.Type)}
+		}
+		var err error
+		switch msg.Method {
+		case MethodRunTask:
+			err = s.runTask(ctx, *msg.ID, controller, params)
+		case MethodValideTask:
+			err = controller.ValideTask(params.Task)
+		case MethodValideComponent:
+			err = controller.ValideComponent(params.Component)
+		case MethodCheckComponent:
+			err = controller.CheckComponent(params.Component)
+		}
+		return nil, controllerError(err)
+
+	case MethodRunCheck, MethodCheckMonitoring, MethodValidateCheck, MethodValidateMonitoring:
+		var params MonitorParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		controller, ok := s.opts.MonitorControllers[params.Type]
+		if !ok {
+			return nil, &Error{Code: CodeUnknownType, Message: fmt.Sprintf("unknown monitor controller type %q", params.Type)}
+		}
+		var err error
+		switch msg.Method {
+		case MethodRunCheck:
+			err = controller.RunCheck(params.Meta)
+		case MethodCheckMonitoring:
+			err = controller.CheckMonitoring(params.Meta)
+		case MethodValidateCheck:
+			err = controller.ValidateCheck(params.Meta)
+		case MethodValidateMonitoring:
+			err = controller.ValidateMonitoring(params.Meta)
+		}
+		return nil, controllerError(err)
+	}
+	return nil, &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method %q not found", msg.Method)}
+}
+
+func (s *server) runTask(ctx context.Context, id uint64, controller api.Controller, params ControllerParams) error {
+	stdout := &outputWriter{server: s, id: id, stream: StreamStdout}
+	stderr := &outputWriter{server: s, id: id, stream: StreamStderr}
+	switch runner := controller.(type) {
+	case ContextController:
+		return runner.RunTaskContext(ctx, params.Task, params.Component, stdout, stderr)
+	case OutputController:
+		return runner.RunTaskOutput(params.Task, params.Component, stdout, stderr)
+	}
+	return controller.RunTask(params.Task, params.Component)
+}
+
+// controllerError переводит ошибку контроллера в ошибку протокола, сохраняя код завершения
+// ошибок с методом ExitCode() int (например, *exec.ExitError)
+func controllerError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	callErr := &Error{Code: CodeControllerError, Message: err.Error()}
+	var exit interface{ ExitCode() int }
+	if errors.As(err, &exit) {
+		code := exit.ExitCode()
+		callErr.Data = &ErrorData{ExitCode: &code}
+	}
+	return callErr
+}
+
+// outputWriter отправляет вывод задачи уведомлениями task.output
+type outputWriter struct {
+	server *server
+	id     uint64
+	stream string
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	params, err := json.Marshal(OutputParams{RequestID: w.id, Stream: w.stream, Data: p})
+	if err != nil {
+		return 0, err
+	}
+	w.server.send(&Message{Method: MethodTaskOutput, Params: params})
+	return len(p), nil
+}